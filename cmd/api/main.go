@@ -1,10 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
+	_ "time/tzdata" // zona waktu organisasi tanpa bergantung tzdata OS
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-migrate/migrate/v4"
@@ -23,6 +31,9 @@ import (
 
 	"github.com/username/fms-api/internal/alert"
 	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/command"
+	"github.com/username/fms-api/internal/geocode"
+	"github.com/username/fms-api/internal/ingest"
 	"github.com/username/fms-api/internal/trip"
 	"github.com/username/fms-api/internal/vehicle"
 )
@@ -88,18 +99,49 @@ func main() {
 	authH := authHandler.NewHandler(gormDB)
 	authH.RegisterRoutes(router)
 
+	// Pipeline ingestion: semua listener & endpoint ingest menulis lewat antrian batch yang sama
+	// filter kualitas, estimasi jam device & batas ingestion dari env INGEST_* (sama dengan fmsctl)
+	ingestSvc := ingest.NewServiceFromEnv(gormDB)
+	pipeline := ingest.NewPipeline(ingestSvc, ingest.PipelineConfig{
+		Workers:   envInt("INGEST_WORKERS", 4),
+		QueueSize: envInt("INGEST_QUEUE_SIZE", 1024),
+		BatchSize: envInt("INGEST_BATCH_SIZE", 500),
+	})
+	ingestSvc.Pipeline = pipeline
+
+	// Antrian command downlink: dikirim lewat koneksi TCP listener, atau SMS bila gateway diset
+	commandSvc := command.NewService(gormDB)
+	if url := os.Getenv("SMS_GATEWAY_URL"); url != "" {
+		commandSvc.SMS = &command.HTTPSMSGateway{URL: url, Token: os.Getenv("SMS_GATEWAY_TOKEN"), Client: &http.Client{Timeout: 30 * time.Second}}
+	}
+	commandHub := ingest.NewCommandHub(commandSvc)
+	commandSvc.Transport = commandHub
+	ingestSvc.Commands = commandHub
+
+	// protokol OsmAnd / Traccar Client (tanpa JWT, device dikenali dari parameter id)
+	osmand := router.Group("/osmand")
+	ingest.NewHandlerWithService(ingestSvc).RegisterOsmAndRoutes(osmand)
+
 	// 7. Group API yang butuh auth
 	api := router.Group("/api")
 	api.Use(auth.AuthMiddleware())
 
+	// reverse geocoding offline dari tabel places (isi lewat `fmsctl import-places`)
+	geocoder := geocode.NewCache(&geocode.PlaceGeocoder{
+		DB:            gormDB,
+		MaxDistanceKm: float64(envInt("GEOCODE_MAX_DISTANCE_KM", 25)),
+	}, envInt("GEOCODE_CACHE_SIZE", 10000))
+
 	// Daftarkan handler ke group ini
 	vehicleHandler := vehicle.NewHandler(gormDB)
+	vehicleHandler.Geocoder = geocoder
 	vehicleHandler.RegisterRoutes(api)
 
 	userH := userHandler.NewHandler(gormDB)
 	userH.RegisterRoutes(api)
 
 	tripHandler := trip.NewHandler(gormDB)
+	tripHandler.Geocoder = geocoder
 	tripHandler.RegisterRoutes(api)
 
 	alertHandler := alert.NewHandler(gormDB)
@@ -114,12 +156,134 @@ func main() {
 	devH := deviceHandler.NewHandler(gormDB)
 	devH.RegisterAdminRoutes(admin)
 
-	// 8. Start server
+	ingestH := ingest.NewHandlerWithService(ingestSvc)
+	ingestH.RegisterAdminRoutes(admin)
+
+	commandH := command.NewHandler(commandSvc)
+	if v := os.Getenv("COMMAND_ORG_WHITELIST"); v != "" {
+		commandH.OrgWhitelist = nil
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				commandH.OrgWhitelist = append(commandH.OrgWhitelist, strings.ToUpper(t))
+			}
+		}
+	}
+	commandH.RegisterAdminRoutes(admin)
+
+	tripHandler.RegisterAdminRoutes(admin)
+
+	// 8. Listener TCP untuk device (Teltonika Codec 8 / 8E)
+	teltonikaAddr := os.Getenv("TELTONIKA_ADDR")
+	if teltonikaAddr == "" {
+		teltonikaAddr = ":5027"
+	}
+	teltonikaSrv := ingest.NewTeltonikaServer(teltonikaAddr, ingestSvc)
+	go func() {
+		fmt.Println("📡 Listener Teltonika berjalan di " + teltonikaAddr)
+		if err := teltonikaSrv.ListenAndServe(); err != nil {
+			log.Printf("listener Teltonika berhenti: %v", err)
+		}
+	}()
+
+	// Listener TCP untuk device GT06 / Concox
+	gt06Addr := os.Getenv("GT06_ADDR")
+	if gt06Addr == "" {
+		gt06Addr = ":5023"
+	}
+	gt06Srv := ingest.NewGT06Server(gt06Addr, ingestSvc)
+	go func() {
+		fmt.Println("📡 Listener GT06 berjalan di " + gt06Addr)
+		if err := gt06Srv.ListenAndServe(); err != nil {
+			log.Printf("listener GT06 berhenti: %v", err)
+		}
+	}()
+
+	// Listener bersama (opsional): Teltonika, GT06 dan OsmAnd HTTP di satu port, protokol dikenali otomatis
+	var muxSrv *ingest.MuxServer
+	if muxAddr := os.Getenv("INGEST_MUX_ADDR"); muxAddr != "" {
+		muxSrv = ingest.NewMuxServer(muxAddr, ingestSvc)
+		go func() {
+			fmt.Println("📡 Listener multi-protokol berjalan di " + muxAddr)
+			if err := muxSrv.ListenAndServe(); err != nil {
+				log.Printf("listener multi-protokol berhenti: %v", err)
+			}
+		}()
+	}
+
+	// Subscriber MQTT, satu per data source bertipe MQTT
+	mqttManager := ingest.NewMQTTManager(ingestSvc)
+	if err := mqttManager.Start(); err != nil {
+		log.Printf("gagal menjalankan subscriber MQTT: %v", err)
+	}
+
+	// Pull connector, satu poller per data source yang tipenya punya adapter (misal API)
+	connectorManager := ingest.NewConnectorManager(ingestSvc)
+	if err := connectorManager.Start(); err != nil {
+		log.Printf("gagal menjalankan pull connector: %v", err)
+	}
+
+	// Pengecekan device offline (jendela default, bisa di-override per data source / device)
+	offlineChecker := ingest.NewOfflineChecker(gormDB, time.Duration(envInt("DEVICE_OFFLINE_AFTER_SECONDS", 1800))*time.Second)
+	offlineChecker.Interval = time.Duration(envInt("DEVICE_OFFLINE_CHECK_SECONDS", 60)) * time.Second
+	offlineChecker.Start()
+
+	// Expiry command yang lewat batas waktu
+	commandSvc.Start(time.Duration(envInt("COMMAND_EXPIRY_CHECK_SECONDS", 60)) * time.Second)
+
+	// Trip builder: segmentasi trip dari position_log, incremental per kendaraan
+	tripBuilder := trip.NewBuilder(gormDB)
+	tripBuilder.Interval = time.Duration(envInt("TRIP_BUILDER_INTERVAL_SECONDS", 30)) * time.Second
+	tripBuilder.Lookback = time.Duration(envInt("TRIP_BUILDER_LOOKBACK_HOURS", 24)) * time.Hour
+	tripBuilder.Start()
+
+	// Rebuild trip: job dari POST /admin/trips/rebuild
+	tripRebuilder := trip.NewRebuilder(gormDB)
+	tripRebuilder.Interval = time.Duration(envInt("TRIP_REBUILD_INTERVAL_SECONDS", 10)) * time.Second
+	tripRebuilder.StaleAfter = time.Duration(envInt("TRIP_REBUILD_STALE_MINUTES", 60)) * time.Minute
+	tripRebuilder.Start()
+
+	// 9. Start server
 	addr := ":8080"
 	fmt.Println("🚀 Server berjalan di http://localhost" + addr)
 	fmt.Println("📘 Swagger UI di: http://localhost" + addr + "/swagger/")
 
-	if err := router.Run(addr); err != nil {
-		log.Fatalf("gagal menjalankan HTTP server: %v", err)
+	srv := &http.Server{Addr: addr, Handler: router}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("gagal menjalankan HTTP server: %v", err)
+		}
+	}()
+
+	// 10. Graceful shutdown: berhenti menerima data baru, lalu kosongkan antrian pipeline
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	fmt.Println("⏳ Menghentikan server...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("gagal menghentikan HTTP server: %v", err)
+	}
+	teltonikaSrv.Close()
+	gt06Srv.Close()
+	if muxSrv != nil {
+		muxSrv.Close()
+	}
+	mqttManager.Stop()
+	connectorManager.Stop()
+	offlineChecker.Stop()
+	commandSvc.Stop()
+	tripRebuilder.Stop()
+	tripBuilder.Stop()
+	pipeline.Close()
+	fmt.Println("✅ Antrian ingestion sudah kosong, server berhenti")
+}
+
+// envInt baca env var angka, pakai default bila kosong / tidak valid
+func envInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return v
 	}
+	return def
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/trip"
+)
+
+// runRefreshDailyStats: fmsctl refresh-daily-stats (-vehicle 12 | -org 3) -from 2025-01-01 -to 2025-01-31
+// Hitung ulang vehicle_daily_stats dari trips & stops, mis. sesudah migrasi atau zona waktu organisasi diganti.
+func runRefreshDailyStats(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("refresh-daily-stats", flag.ExitOnError)
+	vehicleID := fs.Int64("vehicle", 0, "vehicles.id yang rollup-nya dihitung ulang")
+	orgID := fs.Int64("org", 0, "organizations.id: hitung ulang semua kendaraan organisasi")
+	from := fs.String("from", "", "tanggal awal (YYYY-MM-DD, wajib)")
+	to := fs.String("to", "", "tanggal akhir, inklusif (YYYY-MM-DD, wajib)")
+	fs.Parse(args)
+
+	if (*vehicleID == 0) == (*orgID == 0) {
+		fs.Usage()
+		return fmt.Errorf("isi salah satu dari -vehicle atau -org")
+	}
+	fromDay, err := trip.ParseLocalDate(*from)
+	if err != nil {
+		fs.Usage()
+		return fmt.Errorf("-from: %w", err)
+	}
+	toDay, err := trip.ParseLocalDate(*to)
+	if err != nil {
+		fs.Usage()
+		return fmt.Errorf("-to: %w", err)
+	}
+	if toDay.Before(fromDay.Time) {
+		return fmt.Errorf("-to harus sesudah -from")
+	}
+
+	ids := []int64{*vehicleID}
+	if *orgID != 0 {
+		ids = nil
+		if err := db.Table("vehicles").Where("organization_id = ?", *orgID).Order("id").Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+	}
+	// tanggal dibaca di zona waktu organisasi masing-masing kendaraan
+	for i, id := range ids {
+		if err := trip.RefreshDailyStats(db, id, fromDay, toDay); err != nil {
+			return fmt.Errorf("kendaraan %d: %w", id, err)
+		}
+		log.Printf("%d/%d kendaraan", i+1, len(ids))
+	}
+	return nil
+}
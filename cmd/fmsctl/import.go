@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/ingest"
+)
+
+// runImport: fmsctl import -file history.csv [-format csv] [-data-source CODE] [-columns '{"deviceId":"imei"}']
+func runImport(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	file := fs.String("file", "", "path file CSV / NDJSON (wajib)")
+	format := fs.String("format", "", "csv atau ndjson (default dari ekstensi file)")
+	dataSource := fs.String("data-source", "", "kode data source; kolom device berisi external_id (kosong = devices.id)")
+	columns := fs.String("columns", "", `mapping kolom dalam JSON, misal {"deviceId":"imei","ts":"time"}`)
+	speedUnit := fs.String("speed-unit", "", "kph (default), mps atau knots")
+	batchSize := fs.Int("batch", 1000, "jumlah row per insert")
+	maxErrors := fs.Int("max-errors", 1000, "jumlah error maksimal di laporan")
+	fs.Parse(args)
+
+	if *file == "" {
+		fs.Usage()
+		return errors.New("-file wajib diisi")
+	}
+
+	opts := ingest.ImportOptions{
+		Format:     *format,
+		DataSource: *dataSource,
+		SpeedUnit:  *speedUnit,
+		BatchSize:  *batchSize,
+		MaxErrors:  *maxErrors,
+	}
+	if opts.Format == "" {
+		opts.Format = ingest.ImportFormatFromFilename(*file)
+	}
+	if *columns != "" {
+		if err := json.Unmarshal([]byte(*columns), &opts.Columns); err != nil {
+			return fmt.Errorf("-columns harus JSON object: %w", err)
+		}
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	report, importErr := ingest.NewServiceFromEnv(db).Import(f, opts)
+	if report != nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	}
+	return importErr
+}
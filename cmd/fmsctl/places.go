@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/geocode"
+)
+
+// runImportPlaces: fmsctl import-places -file ID.txt [-admin1 admin1CodesASCII.txt -admin2 admin2Codes.txt]
+// Isi tabel places untuk reverse geocoding offline. Import ulang dengan -source yang sama memperbarui data lama.
+func runImportPlaces(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("import-places", flag.ExitOnError)
+	file := fs.String("file", "", "path dump GeoNames / CSV tempat (wajib)")
+	format := fs.String("format", "geonames", "geonames atau csv")
+	source := fs.String("source", "", "nama dataset (default sama dengan -format)")
+	admin1 := fs.String("admin1", "", "admin1CodesASCII.txt GeoNames untuk nama provinsi")
+	admin2 := fs.String("admin2", "", "admin2Codes.txt GeoNames untuk nama kabupaten / kota")
+	classes := fs.String("classes", "P", "kelas fitur GeoNames yang diambil, mis. PA")
+	batchSize := fs.Int("batch", 1000, "jumlah row per insert")
+	fs.Parse(args)
+
+	if *file == "" {
+		fs.Usage()
+		return errors.New("-file wajib diisi")
+	}
+	opts := geocode.ImportOptions{Source: *source, FeatureClasses: *classes, BatchSize: *batchSize}
+	var err error
+	if opts.Admin1, err = readAdminCodes(*admin1); err != nil {
+		return fmt.Errorf("-admin1: %w", err)
+	}
+	if opts.Admin2, err = readAdminCodes(*admin2); err != nil {
+		return fmt.Errorf("-admin2: %w", err)
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var n int
+	switch *format {
+	case "geonames":
+		n, err = geocode.ImportGeoNames(db, f, opts)
+	case "csv":
+		n, err = geocode.ImportCSV(db, f, opts)
+	default:
+		fs.Usage()
+		return fmt.Errorf("-format harus geonames atau csv")
+	}
+	log.Printf("%d tempat disimpan", n)
+	return err
+}
+
+func readAdminCodes(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return geocode.ReadAdminCodes(f)
+}
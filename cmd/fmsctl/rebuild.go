@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/trip"
+)
+
+// runRebuildTrips: fmsctl rebuild-trips (-vehicle 12 | -org 3) -from 2025-01-01T00:00:00Z -to 2025-02-01T00:00:00Z
+func runRebuildTrips(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("rebuild-trips", flag.ExitOnError)
+	vehicleID := fs.Int64("vehicle", 0, "vehicles.id yang trip-nya dibangun ulang")
+	orgID := fs.Int64("org", 0, "organizations.id: bangun ulang trip semua kendaraan organisasi")
+	from := fs.String("from", "", "batas awal rentang (RFC3339, wajib)")
+	to := fs.String("to", "", "batas akhir rentang, eksklusif (RFC3339, wajib)")
+	fs.Parse(args)
+
+	var req trip.RebuildRequest
+	if *vehicleID != 0 {
+		req.VehicleID = vehicleID
+	}
+	if *orgID != 0 {
+		req.OrganizationID = orgID
+	}
+	for _, p := range []struct {
+		name string
+		val  string
+		dst  *time.Time
+	}{{"from", *from, &req.From}, {"to", *to, &req.To}} {
+		t, err := time.Parse(time.RFC3339, p.val)
+		if err != nil {
+			fs.Usage()
+			return fmt.Errorf("-%s harus RFC3339: %w", p.name, err)
+		}
+		*p.dst = t
+	}
+
+	// job dicatat di trip_rebuild_jobs supaya progresnya juga terlihat lewat API
+	job, err := trip.CreateRebuildJob(db, req, nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("job %d: %d kendaraan, %s s/d %s", job.ID, job.TotalVehicles, job.FromTS.Format(time.RFC3339), job.ToTS.Format(time.RFC3339))
+
+	err = trip.NewRebuilder(db).Run(job, func(j *trip.RebuildJob) {
+		log.Printf("job %d: %d/%d kendaraan, %d trip dihapus, %d trip dibuat", j.ID, j.DoneVehicles, j.TotalVehicles, j.TripsDeleted, j.TripsCreated)
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("job %d selesai", job.ID)
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/ingest"
+)
+
+// runReprocess: fmsctl reprocess [-device 12] [-from 2025-01-01T00:00:00Z] [-to ...] [-dry-run]
+func runReprocess(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("reprocess", flag.ExitOnError)
+	deviceID := fs.Int64("device", 0, "devices.id yang diproses ulang (0 = semua device)")
+	from := fs.String("from", "", "batas awal ts (RFC3339)")
+	to := fs.String("to", "", "batas akhir ts (RFC3339)")
+	dryRun := fs.Bool("dry-run", false, "hanya laporkan row yang akan berubah, tanpa menulis")
+	batchSize := fs.Int("batch", 500, "jumlah row per transaksi")
+	maxChanges := fs.Int("max-changes", 1000, "jumlah perubahan maksimal di laporan")
+	fs.Parse(args)
+
+	opts := ingest.ReprocessOptions{
+		DeviceID:   *deviceID,
+		DryRun:     *dryRun,
+		BatchSize:  *batchSize,
+		MaxChanges: *maxChanges,
+	}
+	for _, p := range []struct {
+		name string
+		val  string
+		dst  **time.Time
+	}{{"from", *from, &opts.From}, {"to", *to, &opts.To}} {
+		if p.val == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, p.val)
+		if err != nil {
+			return fmt.Errorf("-%s harus RFC3339: %w", p.name, err)
+		}
+		*p.dst = &t
+	}
+	// seluruh position_log sekaligus terlalu berat untuk dijalankan tanpa sengaja
+	if opts.DeviceID == 0 && opts.From == nil && opts.To == nil {
+		fs.Usage()
+		return errors.New("isi minimal salah satu dari -device, -from atau -to")
+	}
+
+	report, err := ingest.NewServiceFromEnv(db).Reprocess(opts)
+	if report != nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if encErr := enc.Encode(report); encErr != nil {
+			return encErr
+		}
+	}
+	return err
+}
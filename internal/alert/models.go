@@ -24,3 +24,17 @@ type Alert struct {
 func (Alert) TableName() string {
 	return "alerts"
 }
+
+// Model untuk tabel alert_types (master kode alert)
+type AlertType struct {
+	ID              int64     `json:"id"              gorm:"column:id;primaryKey"`
+	Code            string    `json:"code"            gorm:"column:code"`
+	Name            string    `json:"name"            gorm:"column:name"`
+	DefaultSeverity string    `json:"defaultSeverity" gorm:"column:default_severity"`
+	Description     *string   `json:"description"     gorm:"column:description"`
+	CreatedAt       time.Time `json:"createdAt"       gorm:"column:created_at"`
+}
+
+func (AlertType) TableName() string {
+	return "alert_types"
+}
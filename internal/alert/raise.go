@@ -0,0 +1,34 @@
+package alert
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Raise membuat alert ACTIVE baru berdasarkan kode alert_types (misal "SOS", "POWER_CUT").
+// Dipakai oleh proses ingestion / background job, bukan oleh handler HTTP.
+func Raise(db *gorm.DB, typeCode string, vehicleID int64, deviceID *int64, startedAt time.Time, message string, payload map[string]interface{}) (*Alert, error) {
+	var at AlertType
+	if err := db.Where("code = ?", typeCode).First(&at).Error; err != nil {
+		return nil, fmt.Errorf("alert type %s: %w", typeCode, err)
+	}
+
+	a := Alert{
+		VehicleID:   vehicleID,
+		DeviceID:    deviceID,
+		AlertTypeID: at.ID,
+		StartedAt:   startedAt.UTC(),
+		Status:      "ACTIVE",
+		Payload:     payload,
+	}
+	if message != "" {
+		a.Message = &message
+	}
+
+	if err := db.Create(&a).Error; err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
@@ -0,0 +1,203 @@
+package command
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/device"
+	"github.com/username/fms-api/internal/pagination"
+)
+
+// DefaultOrgWhitelist jenis command yang boleh dikirim ORG admin ke kendaraan organisasinya
+var DefaultOrgWhitelist = []string{TypeEngineCut, TypeEngineResume, TypeReboot}
+
+type Handler struct {
+	Service      *Service
+	OrgWhitelist []string
+}
+
+func NewHandler(svc *Service) *Handler {
+	return &Handler{Service: svc, OrgWhitelist: DefaultOrgWhitelist}
+}
+
+// RegisterAdminRoutes route command di group /admin (SUPER_ADMIN, atau ORG admin untuk device kendaraannya)
+func (h *Handler) RegisterAdminRoutes(r gin.IRoutes) {
+	r.POST("/devices/:deviceId/commands", h.CreateCommand)
+	r.GET("/devices/:deviceId/commands", h.ListCommands)
+	r.GET("/devices/:deviceId/commands/:commandId", h.GetCommand)
+}
+
+// target device + kendaraan yang sedang terikat
+type target struct {
+	Device         device.Device
+	VehicleID      *int64
+	OrganizationID *int64
+}
+
+// authorize cek device ada dan user boleh mengakses command-nya. Response error sudah ditulis bila false.
+func (h *Handler) authorize(c *gin.Context) (auth.CurrentUser, *target, bool) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok || (!cu.IsSuperAdmin() && !cu.IsOrgAdmin()) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "forbidden",
+			"message": "hanya SUPER_ADMIN atau admin organisasi yang boleh mengirim command",
+		})
+		return cu, nil, false
+	}
+
+	deviceID, err := strconv.ParseInt(c.Param("deviceId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_device_id"})
+		return cu, nil, false
+	}
+
+	t := &target{}
+	if err := h.Service.DB.First(&t.Device, deviceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return cu, nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return cu, nil, false
+	}
+
+	var bound struct {
+		VehicleID      int64  `gorm:"column:vehicle_id"`
+		OrganizationID *int64 `gorm:"column:organization_id"`
+	}
+	err = h.Service.DB.Table("vehicle_devices vd").
+		Select("vd.vehicle_id, v.organization_id").
+		Joins("JOIN vehicles v ON v.id = vd.vehicle_id").
+		Where("vd.device_id = ? AND vd.active = ?", deviceID, true).
+		Take(&bound).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return cu, nil, false
+	}
+	if err == nil {
+		t.VehicleID, t.OrganizationID = &bound.VehicleID, bound.OrganizationID
+	}
+
+	if !cu.IsSuperAdmin() && (t.OrganizationID == nil || cu.OrganizationID == nil || *t.OrganizationID != *cu.OrganizationID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "message": "device tidak terikat ke kendaraan organisasi anda"})
+		return cu, nil, false
+	}
+	return cu, t, true
+}
+
+// CreateCommand POST /admin/devices/:deviceId/commands
+func (h *Handler) CreateCommand(c *gin.Context) {
+	cu, t, ok := h.authorize(c)
+	if !ok {
+		return
+	}
+
+	var req CreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Type) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "type wajib diisi"})
+		return
+	}
+	req.Type = strings.ToUpper(strings.TrimSpace(req.Type))
+	userID := cu.ID
+
+	if !cu.IsSuperAdmin() && !h.allowedForOrg(req.Type) {
+		if err := h.Service.Reject(t.Device.ID, &userID, req, "jenis command di luar whitelist organisasi"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "command_not_allowed", "message": "command " + req.Type + " tidak diizinkan untuk admin organisasi"})
+		return
+	}
+
+	cmd, err := h.Service.Create(t.Device, t.VehicleID, &userID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnknownType), errors.Is(err, ErrUnknownChannel), errors.Is(err, ErrInvalidParams):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": err.Error()})
+		case errors.Is(err, ErrUnsupported):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "unsupported_command", "message": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, cmd)
+}
+
+func (h *Handler) allowedForOrg(cmdType string) bool {
+	for _, t := range h.OrgWhitelist {
+		if strings.EqualFold(t, cmdType) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListCommands GET /admin/devices/:deviceId/commands?status=
+func (h *Handler) ListCommands(c *gin.Context) {
+	_, t, ok := h.authorize(c)
+	if !ok {
+		return
+	}
+
+	p := pagination.ParsePagination(c)
+	if c.IsAborted() {
+		return
+	}
+
+	query := h.Service.DB.Model(&DeviceCommand{}).Where("device_id = ?", t.Device.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", strings.ToUpper(status))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	var cmds []DeviceCommand
+	if err := query.Order("id DESC").Limit(p.Limit).Offset(p.Offset).Find(&cmds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": cmds, "pagination": gin.H{"total": total, "limit": p.Limit, "page": p.Page, "max_limit": p.MaxLimit}})
+}
+
+// GetCommand GET /admin/devices/:deviceId/commands/:commandId, termasuk audit trail
+func (h *Handler) GetCommand(c *gin.Context) {
+	_, t, ok := h.authorize(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("commandId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_command_id"})
+		return
+	}
+
+	var cmd DeviceCommand
+	if err := h.Service.DB.Where("id = ? AND device_id = ?", id, t.Device.ID).First(&cmd).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+
+	var trail []CommandAudit
+	if err := h.Service.DB.Where("command_id = ?", cmd.ID).Order("id").Find(&trail).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"command": cmd, "audit": trail})
+}
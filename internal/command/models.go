@@ -0,0 +1,83 @@
+package command
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// Status command downlink
+const (
+	StatusQueued  = "QUEUED"  // menunggu device terhubung
+	StatusSent    = "SENT"    // sudah ditulis ke koneksi device / dikirim lewat SMS
+	StatusAcked   = "ACKED"   // device membalas
+	StatusFailed  = "FAILED"  // gagal dikirim
+	StatusExpired = "EXPIRED" // lewat expires_at sebelum terkirim / dibalas
+)
+
+// Jenis command yang dikenal, diterjemahkan ke teks per protokol oleh Text
+const (
+	TypeEngineCut    = "ENGINE_CUT"
+	TypeEngineResume = "ENGINE_RESUME"
+	TypeReboot       = "REBOOT"
+	TypeConfigSet    = "CONFIG_SET" // params: key, value
+	TypeCustom       = "CUSTOM"     // params: text (dikirim apa adanya)
+)
+
+// Channel pengiriman
+const (
+	ChannelAuto = "AUTO" // TCP bila device sedang terhubung, SMS bila tersedia, selain itu antre untuk TCP
+	ChannelTCP  = "TCP"
+	ChannelSMS  = "SMS"
+)
+
+// Aksi di audit trail command
+const (
+	ActionCreated  = "CREATED"
+	ActionRejected = "REJECTED" // ditolak sebelum masuk antrian (misal di luar whitelist org)
+	ActionSent     = "SENT"
+	ActionRequeued = "REQUEUED" // koneksi putus saat menulis, dikirim ulang saat device terhubung lagi
+	ActionAcked    = "ACKED"
+	ActionFailed   = "FAILED"
+	ActionExpired  = "EXPIRED"
+)
+
+// Tabel device_commands
+type DeviceCommand struct {
+	ID          int64             `json:"id"                  gorm:"column:id;primaryKey"`
+	DeviceID    int64             `json:"deviceId"            gorm:"column:device_id"`
+	VehicleID   *int64            `json:"vehicleId"           gorm:"column:vehicle_id"`
+	Type        string            `json:"type"                gorm:"column:type"`
+	Params      datatypes.JSONMap `json:"params,omitempty"    gorm:"column:params"`
+	Text        string            `json:"text"                gorm:"column:text"`    // teks command yang dikirim ke device
+	Channel     string            `json:"channel"             gorm:"column:channel"` // AUTO sampai terkirim, lalu TCP / SMS
+	Status      string            `json:"status"              gorm:"column:status"`
+	Response    *string           `json:"response"            gorm:"column:response"`
+	Error       *string           `json:"error"               gorm:"column:error"`
+	RequestedBy *int64            `json:"requestedBy"         gorm:"column:requested_by"`
+	Attempts    int               `json:"attempts"            gorm:"column:attempts"`
+	CreatedAt   time.Time         `json:"createdAt"           gorm:"column:created_at"`
+	SentAt      *time.Time        `json:"sentAt"              gorm:"column:sent_at"`
+	AckedAt     *time.Time        `json:"ackedAt"             gorm:"column:acked_at"`
+	ExpiresAt   time.Time         `json:"expiresAt"           gorm:"column:expires_at"`
+	UpdatedAt   time.Time         `json:"updatedAt"           gorm:"column:updated_at"`
+}
+
+func (DeviceCommand) TableName() string {
+	return "device_commands"
+}
+
+// Tabel device_command_audit: setiap perubahan status dan setiap permintaan yang ditolak
+type CommandAudit struct {
+	ID        int64             `json:"id"               gorm:"column:id;primaryKey"`
+	CommandID *int64            `json:"commandId"        gorm:"column:command_id"`
+	DeviceID  int64             `json:"deviceId"         gorm:"column:device_id"`
+	UserID    *int64            `json:"userId"           gorm:"column:user_id"` // nil = sistem (listener, expiry)
+	Action    string            `json:"action"           gorm:"column:action"`
+	Detail    datatypes.JSONMap `json:"detail,omitempty" gorm:"column:detail"`
+	CreatedAt time.Time         `json:"createdAt"        gorm:"column:created_at"`
+}
+
+func (CommandAudit) TableName() string {
+	return "device_command_audit"
+}
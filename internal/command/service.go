@@ -0,0 +1,331 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/device"
+)
+
+// DefaultTTL batas waktu command sebelum EXPIRED bila request tidak menentukan ttlSeconds
+const DefaultTTL = time.Hour
+
+var (
+	ErrUnknownChannel = errors.New("channel harus AUTO, TCP atau SMS")
+	ErrNoSMSGateway   = errors.New("SMS gateway belum dikonfigurasi")
+	ErrNoSimNumber    = errors.New("device tidak punya sim_number")
+)
+
+// SMSGateway pengirim SMS yang bisa diganti (HTTP provider, modem GSM, dsb)
+type SMSGateway interface {
+	SendSMS(ctx context.Context, to, text string) error
+}
+
+// Transport koneksi live ke device (listener protokol). Notify meminta listener
+// mengirim command QUEUED milik device sekarang juga bila device sedang terhubung.
+type Transport interface {
+	Connected(deviceID int64) bool
+	Notify(deviceID int64)
+}
+
+// Service antrian command downlink per device
+type Service struct {
+	DB        *gorm.DB
+	SMS       SMSGateway // nil = channel SMS tidak tersedia
+	Transport Transport  // nil = tidak ada listener (command tetap antre)
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{DB: db}
+}
+
+type CreateRequest struct {
+	Type       string                 `json:"type"`
+	Params     map[string]interface{} `json:"params,omitempty"`
+	Channel    string                 `json:"channel,omitempty"`    // default AUTO
+	TTLSeconds int                    `json:"ttlSeconds,omitempty"` // default 3600
+}
+
+// Create masukkan command ke antrian device lalu coba kirim sesuai channel.
+// Error validasi (jenis, params, channel) dikembalikan sebelum apa pun ditulis.
+func (s *Service) Create(dev device.Device, vehicleID, userID *int64, req CreateRequest) (*DeviceCommand, error) {
+	req.Type = strings.ToUpper(strings.TrimSpace(req.Type))
+	channel := strings.ToUpper(strings.TrimSpace(req.Channel))
+	if channel == "" {
+		channel = ChannelAuto
+	}
+	if channel != ChannelAuto && channel != ChannelTCP && channel != ChannelSMS {
+		return nil, ErrUnknownChannel
+	}
+
+	text, err := Text(dev.Protocol, req.Type, req.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := DefaultTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	now := time.Now().UTC()
+	cmd := DeviceCommand{
+		DeviceID:    dev.ID,
+		VehicleID:   vehicleID,
+		Type:        req.Type,
+		Params:      req.Params,
+		Text:        text,
+		Channel:     channel,
+		Status:      StatusQueued,
+		RequestedBy: userID,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+		UpdatedAt:   now,
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&cmd).Error; err != nil {
+			return err
+		}
+		return audit(tx, &cmd.ID, dev.ID, userID, ActionCreated, map[string]interface{}{
+			"type": cmd.Type, "channel": channel, "text": text,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	connected := s.Transport != nil && s.Transport.Connected(dev.ID)
+	switch {
+	case channel == ChannelSMS, channel == ChannelAuto && !connected && s.SMS != nil && dev.SimNumber != "":
+		if err := s.sendSMS(&cmd, dev); err != nil {
+			return nil, err
+		}
+	case s.Transport != nil:
+		s.Transport.Notify(dev.ID)
+	}
+
+	if err := s.DB.First(&cmd, cmd.ID).Error; err != nil {
+		return nil, err
+	}
+	return &cmd, nil
+}
+
+// Reject catat permintaan command yang ditolak (misal di luar whitelist) tanpa membuat antrian
+func (s *Service) Reject(deviceID int64, userID *int64, req CreateRequest, reason string) error {
+	return audit(s.DB, nil, deviceID, userID, ActionRejected, map[string]interface{}{
+		"type": req.Type, "channel": req.Channel, "reason": reason,
+	})
+}
+
+// sendSMS kirim command lewat gateway, status langsung SENT atau FAILED
+func (s *Service) sendSMS(cmd *DeviceCommand, dev device.Device) error {
+	var sendErr error
+	switch {
+	case s.SMS == nil:
+		sendErr = ErrNoSMSGateway
+	case dev.SimNumber == "":
+		sendErr = ErrNoSimNumber
+	default:
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		sendErr = s.SMS.SendSMS(ctx, dev.SimNumber, smsText(dev, cmd.Text))
+	}
+
+	now := time.Now().UTC()
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{"channel": ChannelSMS, "attempts": gorm.Expr("attempts + 1"), "updated_at": now}
+		action, detail := ActionSent, map[string]interface{}{"channel": ChannelSMS, "to": dev.SimNumber}
+		if sendErr != nil {
+			updates["status"], updates["error"] = StatusFailed, sendErr.Error()
+			action, detail["error"] = ActionFailed, sendErr.Error()
+		} else {
+			updates["status"], updates["sent_at"] = StatusSent, now
+		}
+		if err := tx.Model(&DeviceCommand{}).Where("id = ?", cmd.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		return audit(tx, &cmd.ID, cmd.DeviceID, nil, action, detail)
+	})
+}
+
+// smsText format SMS command. Teltonika butuh prefix "<login> <password> " (default kosong),
+// bisa diatur lewat devices.metadata.smsLogin / smsPassword.
+func smsText(dev device.Device, text string) string {
+	if strings.ToUpper(dev.Protocol) != "TELTONIKA" {
+		return text
+	}
+	login, _ := dev.Metadata["smsLogin"].(string)
+	password, _ := dev.Metadata["smsPassword"].(string)
+	return login + " " + password + " " + text
+}
+
+// Claim ambil command QUEUED tertua milik device untuk dikirim lewat koneksi TCP dan tandai SENT.
+// Aman dipanggil paralel: command hanya bisa diklaim sekali. nil bila antrian kosong.
+func (s *Service) Claim(deviceID int64, now time.Time) (*DeviceCommand, error) {
+	for {
+		// Find + Limit supaya antrian kosong tidak tercatat sebagai "record not found" di log
+		var cmds []DeviceCommand
+		err := s.DB.Where("device_id = ? AND status = ? AND channel IN ? AND expires_at > ?",
+			deviceID, StatusQueued, []string{ChannelAuto, ChannelTCP}, now).
+			Order("id").Limit(1).Find(&cmds).Error
+		if err != nil {
+			return nil, err
+		}
+		if len(cmds) == 0 {
+			return nil, nil
+		}
+		cmd := cmds[0]
+
+		claimed := false
+		err = s.DB.Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(&DeviceCommand{}).Where("id = ? AND status = ?", cmd.ID, StatusQueued).Updates(map[string]interface{}{
+				"status": StatusSent, "channel": ChannelTCP, "sent_at": now,
+				"attempts": gorm.Expr("attempts + 1"), "updated_at": now,
+			})
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+			claimed = true
+			return audit(tx, &cmd.ID, deviceID, nil, ActionSent, map[string]interface{}{"channel": ChannelTCP})
+		})
+		if err != nil {
+			return nil, err
+		}
+		if claimed {
+			cmd.Status, cmd.Channel, cmd.SentAt = StatusSent, ChannelTCP, &now
+			return &cmd, nil
+		}
+		// diklaim goroutine lain, coba command berikutnya
+	}
+}
+
+// Requeue kembalikan command SENT ke antrian bila koneksi putus saat menulis
+func (s *Service) Requeue(id int64, reason string) error {
+	return s.transition(id, []string{StatusSent}, ActionRequeued, map[string]interface{}{
+		"status": StatusQueued, "channel": ChannelTCP, "sent_at": nil,
+	}, map[string]interface{}{"reason": reason})
+}
+
+// Ack simpan balasan device. commandID nil = protokol tanpa korelasi (Teltonika Codec 12):
+// balasan dipasangkan ke command SENT tertua milik device.
+func (s *Service) Ack(deviceID int64, commandID *int64, response string) error {
+	var cmd DeviceCommand
+	q := s.DB.Where("device_id = ? AND status = ? AND channel = ?", deviceID, StatusSent, ChannelTCP)
+	if commandID != nil {
+		q = q.Where("id = ?", *commandID)
+	}
+	err := q.Order("sent_at, id").Take(&cmd).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("tidak ada command SENT untuk device %d", deviceID)
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	return s.transition(cmd.ID, []string{StatusSent}, ActionAcked, map[string]interface{}{
+		"status": StatusAcked, "response": response, "acked_at": now,
+	}, map[string]interface{}{"response": response})
+}
+
+// Fail tandai command gagal
+func (s *Service) Fail(id int64, reason string) error {
+	return s.transition(id, []string{StatusQueued, StatusSent}, ActionFailed, map[string]interface{}{
+		"status": StatusFailed, "error": reason,
+	}, map[string]interface{}{"error": reason})
+}
+
+// ExpireDue tandai EXPIRED command QUEUED, atau SENT lewat TCP yang belum dibalas, yang lewat expires_at.
+// Command SMS yang sudah SENT tidak di-expire karena balasan SMS tidak dilacak.
+func (s *Service) ExpireDue(now time.Time) (int, error) {
+	var due []DeviceCommand
+	err := s.DB.Where("expires_at <= ? AND (status = ? OR (status = ? AND channel = ?))",
+		now, StatusQueued, StatusSent, ChannelTCP).Find(&due).Error
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, cmd := range due {
+		err := s.transition(cmd.ID, []string{StatusQueued, StatusSent}, ActionExpired,
+			map[string]interface{}{"status": StatusExpired}, map[string]interface{}{"previousStatus": cmd.Status})
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// transition ubah status command (hanya bila status saat ini salah satu dari from) + tulis audit
+func (s *Service) transition(id int64, from []string, action string, updates, detail map[string]interface{}) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var cmd DeviceCommand
+		if err := tx.Select("id", "device_id").First(&cmd, id).Error; err != nil {
+			return err
+		}
+		updates["updated_at"] = time.Now().UTC()
+		res := tx.Model(&DeviceCommand{}).Where("id = ? AND status IN ?", id, from).Updates(updates)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return audit(tx, &id, cmd.DeviceID, nil, action, detail)
+	})
+}
+
+func audit(tx *gorm.DB, commandID *int64, deviceID int64, userID *int64, action string, detail map[string]interface{}) error {
+	return tx.Create(&CommandAudit{
+		CommandID: commandID,
+		DeviceID:  deviceID,
+		UserID:    userID,
+		Action:    action,
+		Detail:    detail,
+		CreatedAt: time.Now().UTC(),
+	}).Error
+}
+
+// Start jalankan expiry berkala di background
+func (s *Service) Start(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n, err := s.ExpireDue(time.Now().UTC()); err != nil {
+					log.Printf("command expiry: %v", err)
+				} else if n > 0 {
+					log.Printf("command expiry: %d command EXPIRED", n)
+				}
+			}
+		}
+	}()
+}
+
+// Stop hentikan expiry berkala dan tunggu goroutine selesai
+func (s *Service) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
@@ -0,0 +1,48 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// HTTPSMSGateway SMSGateway generik: POST {"to": "...", "text": "..."} ke URL provider
+// dengan header Authorization: Bearer <Token>. Provider lain cukup mengimplementasikan SMSGateway.
+type HTTPSMSGateway struct {
+	URL    string
+	Token  string
+	Client *http.Client
+}
+
+func (g *HTTPSMSGateway) SendSMS(ctx context.Context, to, text string) error {
+	body, err := json.Marshal(map[string]string{"to": to, "text": text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("sms gateway: status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrUnknownType   = errors.New("jenis command tidak dikenal")
+	ErrUnsupported   = errors.New("command tidak didukung untuk protokol device ini")
+	ErrInvalidParams = errors.New("params command tidak valid")
+)
+
+// teks command per protokol (nilai devices.protocol)
+var protocolTexts = map[string]map[string]string{
+	// Teltonika Codec 12 / SMS
+	"TELTONIKA": {
+		TypeEngineCut:    "setdigout 1",
+		TypeEngineResume: "setdigout 0",
+		TypeReboot:       "cpureset",
+	},
+	// GT06 / Concox (password default 000000)
+	"GT06": {
+		TypeEngineCut:    "DYD,000000#",
+		TypeEngineResume: "HFYD,000000#",
+		TypeReboot:       "RESET#",
+	},
+}
+
+// Text terjemahkan jenis command + params ke teks yang dikirim ke device
+func Text(protocol, cmdType string, params map[string]interface{}) (string, error) {
+	protocol = strings.ToUpper(protocol)
+
+	switch cmdType {
+	case TypeCustom:
+		text, _ := params["text"].(string)
+		if strings.TrimSpace(text) == "" {
+			return "", fmt.Errorf("%w: params.text wajib diisi untuk CUSTOM", ErrInvalidParams)
+		}
+		return text, nil
+
+	case TypeConfigSet:
+		key := fmt.Sprint(params["key"])
+		value, ok := params["value"]
+		if params["key"] == nil || !ok {
+			return "", fmt.Errorf("%w: params.key dan params.value wajib diisi untuk CONFIG_SET", ErrInvalidParams)
+		}
+		switch protocol {
+		case "TELTONIKA":
+			return fmt.Sprintf("setparam %s:%v", key, value), nil
+		case "GT06":
+			return fmt.Sprintf("%s,%v#", key, value), nil
+		}
+		return "", ErrUnsupported
+
+	case TypeEngineCut, TypeEngineResume, TypeReboot:
+		if text, ok := protocolTexts[protocol][cmdType]; ok {
+			return text, nil
+		}
+		return "", ErrUnsupported
+	}
+	return "", ErrUnknownType
+}
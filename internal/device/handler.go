@@ -1,8 +1,10 @@
 package device
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -23,9 +25,10 @@ func NewHandler(db *gorm.DB) *Handler {
 // ========= DTO REQUEST & RESPONSE =========
 
 type CreateDataSourceRequest struct {
-	Name string `json:"name"`
-	Code string `json:"code"`
-	Type string `json:"type"` // contoh: "TELTONIKA", "CARTRACK_API", dll
+	Name   string                 `json:"name"`
+	Code   string                 `json:"code"`
+	Type   string                 `json:"type"`   // contoh: "TELTONIKA", "CARTRACK_API", "MQTT", dll
+	Config map[string]interface{} `json:"config"` // optional, misal broker & field mapping MQTT
 }
 
 type CreateDeviceRequest struct {
@@ -38,9 +41,10 @@ type CreateDeviceRequest struct {
 }
 
 type UpdateDataSourceRequest struct {
-	Name *string `json:"name,omitempty"`
-	Code *string `json:"code,omitempty"`
-	Type *string `json:"type,omitempty"`
+	Name   *string                `json:"name,omitempty"`
+	Code   *string                `json:"code,omitempty"`
+	Type   *string                `json:"type,omitempty"`
+	Config map[string]interface{} `json:"config,omitempty"`
 }
 
 type UpdateDeviceRequest struct {
@@ -104,6 +108,9 @@ func (h *Handler) CreateDataSource(c *gin.Context) {
 		Code: req.Code,
 		Type: req.Type,
 	}
+	if req.Config != nil {
+		ds.Config = req.Config
+	}
 
 	if err := h.DB.Create(&ds).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -113,7 +120,7 @@ func (h *Handler) CreateDataSource(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, ds)
+	c.JSON(http.StatusCreated, ds.Redacted())
 }
 
 func (h *Handler) ListDataSources(c *gin.Context) {
@@ -144,6 +151,9 @@ func (h *Handler) ListDataSources(c *gin.Context) {
 		return
 	}
 
+	for i := range sources {
+		sources[i] = sources[i].Redacted()
+	}
 	c.JSON(http.StatusOK, gin.H{"data": sources, "pagination": gin.H{"total": total, "limit": p.Limit, "page": p.Page, "max_limit": p.MaxLimit}})
 }
 
@@ -164,7 +174,7 @@ func (h *Handler) GetDataSource(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, ds)
+	c.JSON(http.StatusOK, ds.Redacted())
 }
 
 // UpdateDataSource updates a data source. Only SUPER_ADMIN.
@@ -199,12 +209,16 @@ func (h *Handler) UpdateDataSource(c *gin.Context) {
 	if req.Type != nil {
 		ds.Type = *req.Type
 	}
+	if req.Config != nil {
+		keepSecrets(req.Config, ds.Config)
+		ds.Config = req.Config
+	}
 
 	if err := h.DB.Save(&ds).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, ds)
+	c.JSON(http.StatusOK, ds.Redacted())
 }
 
 // DeleteDataSource deletes a data source if no devices reference it
@@ -326,6 +340,8 @@ func (h *Handler) ListDevices(c *gin.Context) {
 
 	activeStr := c.Query("active")
 	dataSourceIDStr := c.Query("dataSourceId")
+	onlineStr := c.Query("online")
+	silentSinceStr := c.Query("silentSince")
 
 	query := h.DB.Model(&Device{})
 
@@ -340,6 +356,23 @@ func (h *Handler) ListDevices(c *gin.Context) {
 			query = query.Where("data_source_id = ?", dsID)
 		}
 	}
+	if onlineStr != "" {
+		online, err := strconv.ParseBool(onlineStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "online harus true atau false"})
+			return
+		}
+		query = query.Where("online = ?", online)
+	}
+	if silentSinceStr != "" {
+		// silentSince = RFC3339 atau durasi mundur dari sekarang (misal 2h); device yang belum pernah terlihat ikut
+		since, err := parseSilentSince(silentSinceStr, time.Now().UTC())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "silentSince harus RFC3339 atau durasi seperti 30m / 2h"})
+			return
+		}
+		query = query.Where("last_seen_at IS NULL OR last_seen_at < ?", since)
+	}
 
 	p := pagination.ParsePagination(c)
 	if c.IsAborted() {
@@ -361,6 +394,18 @@ func (h *Handler) ListDevices(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": devices, "pagination": gin.H{"total": total, "limit": p.Limit, "page": p.Page, "max_limit": p.MaxLimit}})
 }
 
+// parseSilentSince terima waktu RFC3339 atau durasi Go yang dihitung mundur dari now
+func parseSilentSince(v string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return time.Time{}, errors.New("silentSince tidak valid")
+	}
+	return now.Add(-d), nil
+}
+
 // Device aktif yang belum terikat ke kendaraan mana pun
 func (h *Handler) ListUnassignedDevices(c *gin.Context) {
 	cu, ok := auth.GetCurrentUser(c)
@@ -500,7 +545,7 @@ func (h *Handler) UpdateDevice(c *gin.Context) {
 		dev.Active = *req.Active
 	}
 
-	if err := h.DB.Save(&dev).Error; err != nil {
+	if err := h.DB.Omit(presenceColumns...).Save(&dev).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
 		return
 	}
@@ -525,7 +570,7 @@ func (h *Handler) DeleteDevice(c *gin.Context) {
 		return
 	}
 	dev.Active = false
-	if err := h.DB.Save(&dev).Error; err != nil {
+	if err := h.DB.Omit(presenceColumns...).Save(&dev).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
 		return
 	}
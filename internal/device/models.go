@@ -8,17 +8,56 @@ import (
 
 // Tabel data_sources
 type DataSource struct {
-	ID        int64     `json:"id"        gorm:"column:id;primaryKey"`
-	Name      string    `json:"name"      gorm:"column:name"`
-	Code      string    `json:"code"      gorm:"column:code"`
-	Type      string    `json:"type"      gorm:"column:type"` // contoh: "DEVICE", "API"
-	CreatedAt time.Time `json:"createdAt" gorm:"column:created_at"`
+	ID        int64             `json:"id"        gorm:"column:id;primaryKey"`
+	Name      string            `json:"name"      gorm:"column:name"`
+	Code      string            `json:"code"      gorm:"column:code"`
+	Type      string            `json:"type"      gorm:"column:type"`   // contoh: "DEVICE", "API", "MQTT"
+	Config    datatypes.JSONMap `json:"config"    gorm:"column:config"` // konfigurasi khusus tipe (broker, field mapping, dll)
+	CreatedAt time.Time         `json:"createdAt" gorm:"column:created_at"`
 }
 
 func (DataSource) TableName() string {
 	return "data_sources"
 }
 
+// RedactedSecret pengganti nilai rahasia config di response API
+const RedactedSecret = "********"
+
+// secretConfigKeys kunci config yang berisi kredensial (password broker MQTT, apiKey connector)
+var secretConfigKeys = []string{"password", "apiKey"}
+
+// Redacted salinan data source dengan kredensial di config disamarkan, untuk response API
+func (ds DataSource) Redacted() DataSource {
+	if ds.Config == nil {
+		return ds
+	}
+	cfg := make(datatypes.JSONMap, len(ds.Config))
+	for k, v := range ds.Config {
+		cfg[k] = v
+	}
+	for _, k := range secretConfigKeys {
+		if s, ok := cfg[k].(string); ok && s != "" {
+			cfg[k] = RedactedSecret
+		}
+	}
+	ds.Config = cfg
+	return ds
+}
+
+// keepSecrets isi kembali kredensial yang dikirim balik client dalam bentuk tersamar
+// (hasil GET lalu PUT apa adanya) dengan nilai lama
+func keepSecrets(cfg, old datatypes.JSONMap) {
+	for _, k := range secretConfigKeys {
+		if cfg[k] == RedactedSecret {
+			if v, ok := old[k]; ok {
+				cfg[k] = v
+			} else {
+				delete(cfg, k)
+			}
+		}
+	}
+}
+
 // Tabel devices
 type Device struct {
 	ID           int64             `json:"id"           gorm:"column:id;primaryKey"`
@@ -30,12 +69,21 @@ type Device struct {
 	Active       bool              `json:"active"       gorm:"column:active"`
 	Metadata     datatypes.JSONMap `json:"metadata"     gorm:"column:metadata"`
 	CreatedAt    time.Time         `json:"createdAt"    gorm:"column:created_at"`
+
+	// diisi ingestion: kontak terakhir (termasuk heartbeat), ts fix terakhir, dan sumber koneksinya
+	LastSeenAt *time.Time `json:"lastSeenAt"  gorm:"column:last_seen_at"`
+	LastFixAt  *time.Time `json:"lastFixAt"   gorm:"column:last_fix_at"`
+	LastSource *string    `json:"lastSource"  gorm:"column:last_source"` // TELTONIKA, GT06, OSMAND, MQTT, API, HTTP
+	Online     bool       `json:"online"      gorm:"column:online"`      // false setelah diam melewati jendela offline
 }
 
 func (Device) TableName() string {
 	return "devices"
 }
 
+// kolom yang hanya ditulis ingestion, tidak ikut ditimpa saat admin menyimpan device
+var presenceColumns = []string{"last_seen_at", "last_fix_at", "last_source", "online"}
+
 // Mapping vehicle <-> device (tabel vehicle_devices yang sudah ada)
 type VehicleDevice struct {
 	ID           int64      `json:"id"          gorm:"column:id;primaryKey"`
@@ -0,0 +1,89 @@
+package geocode
+
+import (
+	"container/list"
+	"strconv"
+	"sync"
+)
+
+// Cache Geocoder dengan cache LRU di memori. Koordinat dibulatkan ke Precision desimal (NewCache: 3,
+// sekitar 110 m; 0 = tanpa pembulatan) sebelum diteruskan ke Next, jadi titik yang berdekatan berbagi satu hasil.
+// Hasil kosong (tidak ada tempat) ikut di-cache, error tidak.
+type Cache struct {
+	Next      Geocoder
+	Size      int // jumlah entri maksimal (default 10000)
+	Precision int
+
+	mu    sync.Mutex
+	order *list.List // depan = paling baru dipakai
+	items map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key  string
+	addr *Address
+}
+
+func NewCache(next Geocoder, size int) *Cache {
+	return &Cache{Next: next, Size: size, Precision: 3}
+}
+
+func (c *Cache) Reverse(lat, lon float64) (*Address, error) {
+	lat, lon = c.round(lat), c.round(lon)
+	key := strconv.FormatFloat(lat, 'f', -1, 64) + "," + strconv.FormatFloat(lon, 'f', -1, 64)
+
+	c.mu.Lock()
+	if c.items == nil {
+		c.order, c.items = list.New(), make(map[string]*list.Element)
+	}
+	if el, ok := c.items[key]; ok {
+		c.order.MoveToFront(el)
+		addr := el.Value.(*cacheEntry).addr
+		c.mu.Unlock()
+		return addr, nil
+	}
+	c.mu.Unlock()
+
+	// lookup di luar lock: request paralel untuk key yang sama boleh sama-sama ke Next
+	addr, err := c.Next.Reverse(lat, lon)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.order.MoveToFront(el)
+		return addr, nil
+	}
+	c.items[key] = c.order.PushFront(&cacheEntry{key: key, addr: addr})
+	size := c.Size
+	if size <= 0 {
+		size = 10000
+	}
+	for c.order.Len() > size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+	return addr, nil
+}
+
+// Len jumlah entri di cache
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.order == nil {
+		return 0
+	}
+	return c.order.Len()
+}
+
+func (c *Cache) round(v float64) float64 {
+	if c.Precision <= 0 {
+		return v
+	}
+	s := strconv.FormatFloat(v, 'f', c.Precision, 64)
+	r, _ := strconv.ParseFloat(s, 64)
+	return r
+}
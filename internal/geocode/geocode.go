@@ -0,0 +1,146 @@
+// Package geocode reverse geocoding offline: koordinat -> nama tempat terdekat dari tabel places.
+package geocode
+
+import (
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Geocoder ubah koordinat menjadi alamat. nil tanpa error = tidak ada tempat yang cukup dekat.
+type Geocoder interface {
+	Reverse(lat, lon float64) (*Address, error)
+}
+
+// Address hasil reverse geocoding
+type Address struct {
+	Label       string  `json:"label"` // "Nama, Admin2, Admin1, Negara"
+	Name        string  `json:"name"`
+	Admin1      *string `json:"admin1,omitempty"` // provinsi / state
+	Admin2      *string `json:"admin2,omitempty"` // kabupaten / kota
+	CountryCode *string `json:"countryCode,omitempty"`
+	DistanceKm  float64 `json:"distanceKm"` // jarak koordinat ke tempat
+}
+
+// Place satu tempat di dataset offline
+type Place struct {
+	ID          int64     `json:"id"          gorm:"column:id;primaryKey"`
+	Source      string    `json:"source"      gorm:"column:source;uniqueIndex:uq_place_source"`      // nama dataset, mis. geonames
+	ExternalID  string    `json:"externalId"  gorm:"column:external_id;uniqueIndex:uq_place_source"` // id di dataset sumber
+	Name        string    `json:"name"        gorm:"column:name"`
+	Admin1      *string   `json:"admin1"      gorm:"column:admin1"`
+	Admin2      *string   `json:"admin2"      gorm:"column:admin2"`
+	CountryCode *string   `json:"countryCode" gorm:"column:country_code"`
+	FeatureCode *string   `json:"featureCode" gorm:"column:feature_code"`
+	Population  *int64    `json:"population"  gorm:"column:population"`
+	Lat         float64   `json:"lat"         gorm:"column:lat"`
+	Lon         float64   `json:"lon"         gorm:"column:lon"`
+	CreatedAt   time.Time `json:"createdAt"   gorm:"column:created_at"`
+}
+
+func (Place) TableName() string {
+	return "places"
+}
+
+// address alamat dari tempat dengan jarak distanceKm
+func (p *Place) address(distanceKm float64) *Address {
+	parts := []string{p.Name}
+	for _, v := range []*string{p.Admin2, p.Admin1, p.CountryCode} {
+		if v != nil && *v != "" {
+			parts = append(parts, *v)
+		}
+	}
+	return &Address{
+		Label:       strings.Join(parts, ", "),
+		Name:        p.Name,
+		Admin1:      p.Admin1,
+		Admin2:      p.Admin2,
+		CountryCode: p.CountryCode,
+		DistanceKm:  math.Round(distanceKm*100) / 100,
+	}
+}
+
+// PlaceGeocoder Geocoder dari tabel places: tempat terdekat dalam MaxDistanceKm
+type PlaceGeocoder struct {
+	DB            *gorm.DB
+	MaxDistanceKm float64 // default 25 km
+}
+
+func NewPlaceGeocoder(db *gorm.DB) *PlaceGeocoder {
+	return &PlaceGeocoder{DB: db, MaxDistanceKm: 25}
+}
+
+// Reverse cari tempat terdekat dengan kotak pencarian yang membesar bertahap. Tempat di luar kotak
+// berjarak lebih dari setengah sisi kotak, jadi hasil dalam radius itu pasti yang terdekat.
+func (g *PlaceGeocoder) Reverse(lat, lon float64) (*Address, error) {
+	maxKm := g.MaxDistanceKm
+	if maxKm <= 0 {
+		maxKm = 25
+	}
+	radius := math.Min(2, maxKm)
+	for {
+		best, dist, err := g.nearest(lat, lon, radius)
+		if err != nil {
+			return nil, err
+		}
+		if best != nil && dist <= radius {
+			return best.address(dist), nil
+		}
+		if radius >= maxKm {
+			return nil, nil
+		}
+		if best != nil {
+			radius = math.Min(dist, maxKm)
+		} else {
+			radius = math.Min(radius*4, maxKm)
+		}
+	}
+}
+
+// nearest tempat terdekat di kotak dengan setengah sisi radiusKm
+func (g *PlaceGeocoder) nearest(lat, lon, radiusKm float64) (*Place, float64, error) {
+	const kmPerDeg = 111.32
+	dLat := radiusKm / kmPerDeg
+	dLon := radiusKm / (kmPerDeg * math.Max(math.Cos(lat*math.Pi/180), 0.01))
+
+	var places []Place
+	if err := g.DB.Where("lat BETWEEN ? AND ? AND lon BETWEEN ? AND ?", lat-dLat, lat+dLat, lon-dLon, lon+dLon).
+		Find(&places).Error; err != nil {
+		return nil, 0, err
+	}
+	var best *Place
+	bestDist := math.Inf(1)
+	for i := range places {
+		if d := HaversineKm(lat, lon, places[i].Lat, places[i].Lon); d < bestDist {
+			best, bestDist = &places[i], d
+		}
+	}
+	return best, bestDist, nil
+}
+
+// HaversineKm jarak great-circle dua titik dalam km (dipakai juga filter kualitas ingest & trip builder)
+func HaversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371.0
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// Lookup alamat untuk response API: g nil (geocoding tidak dipasang) atau error = nil.
+// Error hanya di-log supaya endpoint tetap jalan tanpa alamat.
+func Lookup(g Geocoder, lat, lon float64) *Address {
+	if g == nil {
+		return nil
+	}
+	addr, err := g.Reverse(lat, lon)
+	if err != nil {
+		log.Printf("geocode: %.5f,%.5f: %v", lat, lon, err)
+		return nil
+	}
+	return addr
+}
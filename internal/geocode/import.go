@@ -0,0 +1,227 @@
+package geocode
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInvalidPlaceFile = errors.New("file dataset tempat tidak valid")
+
+// ImportOptions opsi import dataset tempat
+type ImportOptions struct {
+	Source string // nama dataset, mis. "geonames"; dipakai bersama id sumber sebagai kunci upsert
+	// Admin1 / Admin2 kode -> nama dari admin1CodesASCII.txt / admin2Codes.txt GeoNames
+	// (kunci "ID.04" / "ID.04.3171"); tanpa mapping, kode yang disimpan
+	Admin1         map[string]string
+	Admin2         map[string]string
+	FeatureClasses string // kelas fitur GeoNames yang diambil, default "P" (kota / desa)
+	BatchSize      int
+}
+
+// ReadAdminCodes baca file kode admin GeoNames (kode<TAB>nama<TAB>...) menjadi map kode -> nama
+func ReadAdminCodes(r io.Reader) (map[string]string, error) {
+	codes := make(map[string]string)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		cols := strings.Split(sc.Text(), "\t")
+		if len(cols) < 2 || cols[0] == "" {
+			continue
+		}
+		codes[cols[0]] = cols[1]
+	}
+	return codes, sc.Err()
+}
+
+// ImportGeoNames import dump GeoNames (allCountries.txt / ID.txt, 19 kolom dipisah tab).
+// Baris dengan kelas fitur di luar FeatureClasses dilewati. Hasil = jumlah tempat yang disimpan.
+func ImportGeoNames(db *gorm.DB, r io.Reader, opts ImportOptions) (int, error) {
+	opts = opts.withDefaults("geonames")
+	w := &placeWriter{db: db, batchSize: opts.BatchSize}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := sc.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		cols := strings.Split(text, "\t")
+		if len(cols) < 15 {
+			return w.total, fmt.Errorf("%w: baris %d: %d kolom, GeoNames butuh 19", ErrInvalidPlaceFile, line, len(cols))
+		}
+		if !strings.Contains(opts.FeatureClasses, cols[6]) {
+			continue
+		}
+		lat, latErr := strconv.ParseFloat(cols[4], 64)
+		lon, lonErr := strconv.ParseFloat(cols[5], 64)
+		if latErr != nil || lonErr != nil {
+			return w.total, fmt.Errorf("%w: baris %d: koordinat tidak valid", ErrInvalidPlaceFile, line)
+		}
+
+		country, a1, a2 := cols[8], cols[10], cols[11]
+		p := Place{
+			Source:      opts.Source,
+			ExternalID:  cols[0],
+			Name:        cols[1],
+			CountryCode: optional(country),
+			FeatureCode: optional(cols[7]),
+			Lat:         lat,
+			Lon:         lon,
+		}
+		if a1 != "" {
+			p.Admin1 = optional(lookup(opts.Admin1, country+"."+a1, a1))
+		}
+		if a2 != "" {
+			p.Admin2 = optional(lookup(opts.Admin2, country+"."+a1+"."+a2, a2))
+		}
+		if n, err := strconv.ParseInt(cols[14], 10, 64); err == nil && n > 0 {
+			p.Population = &n
+		}
+		if err := w.add(p); err != nil {
+			return w.total, err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return w.total, err
+	}
+	return w.total, w.flush()
+}
+
+// ImportCSV import CSV dengan header; kolom id, name, lat, lon wajib,
+// admin1, admin2, country_code, feature_code, population opsional.
+// Dipakai untuk dataset selain GeoNames, mis. titik tengah batas administrasi.
+func ImportCSV(db *gorm.DB, r io.Reader, opts ImportOptions) (int, error) {
+	opts = opts.withDefaults("csv")
+	w := &placeWriter{db: db, batchSize: opts.BatchSize}
+
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		if err == io.EOF {
+			return 0, fmt.Errorf("%w: file CSV kosong", ErrInvalidPlaceFile)
+		}
+		return 0, err
+	}
+	idx := make(map[string]int, len(header))
+	for i, h := range header {
+		idx[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, col := range []string{"id", "name", "lat", "lon"} {
+		if _, ok := idx[col]; !ok {
+			return 0, fmt.Errorf("%w: kolom %q tidak ada di header", ErrInvalidPlaceFile, col)
+		}
+	}
+	get := func(rec []string, col string) string {
+		if i, ok := idx[col]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return w.total, fmt.Errorf("%w: %v", ErrInvalidPlaceFile, err)
+		}
+		lat, latErr := strconv.ParseFloat(get(rec, "lat"), 64)
+		lon, lonErr := strconv.ParseFloat(get(rec, "lon"), 64)
+		if latErr != nil || lonErr != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+			return w.total, fmt.Errorf("%w: baris %d: koordinat tidak valid", ErrInvalidPlaceFile, line)
+		}
+		p := Place{
+			Source:      opts.Source,
+			ExternalID:  get(rec, "id"),
+			Name:        get(rec, "name"),
+			Admin1:      optional(get(rec, "admin1")),
+			Admin2:      optional(get(rec, "admin2")),
+			CountryCode: optional(get(rec, "country_code")),
+			FeatureCode: optional(get(rec, "feature_code")),
+			Lat:         lat,
+			Lon:         lon,
+		}
+		if p.ExternalID == "" || p.Name == "" {
+			return w.total, fmt.Errorf("%w: baris %d: id dan name wajib diisi", ErrInvalidPlaceFile, line)
+		}
+		if n, err := strconv.ParseInt(get(rec, "population"), 10, 64); err == nil && n > 0 {
+			p.Population = &n
+		}
+		if err := w.add(p); err != nil {
+			return w.total, err
+		}
+	}
+	return w.total, w.flush()
+}
+
+func (o ImportOptions) withDefaults(source string) ImportOptions {
+	if o.Source == "" {
+		o.Source = source
+	}
+	if o.FeatureClasses == "" {
+		o.FeatureClasses = "P"
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 1000
+	}
+	return o
+}
+
+// placeWriter upsert tempat per batch; import ulang dataset yang sama memperbarui row lama
+type placeWriter struct {
+	db        *gorm.DB
+	batchSize int
+	batch     []Place
+	total     int
+}
+
+func (w *placeWriter) add(p Place) error {
+	w.batch = append(w.batch, p)
+	if len(w.batch) >= w.batchSize {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *placeWriter) flush() error {
+	if len(w.batch) == 0 {
+		return nil
+	}
+	err := w.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "source"}, {Name: "external_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "admin1", "admin2", "country_code", "feature_code", "population", "lat", "lon"}),
+	}).Create(&w.batch).Error
+	if err != nil {
+		return err
+	}
+	w.total += len(w.batch)
+	w.batch = w.batch[:0]
+	return nil
+}
+
+func lookup(names map[string]string, key, fallback string) string {
+	if name, ok := names[key]; ok && name != "" {
+		return name
+	}
+	return fallback
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,133 @@
+package ingest
+
+import (
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/username/fms-api/internal/command"
+)
+
+// CommandHub menghubungkan antrian command downlink dengan koneksi TCP device yang sedang aktif.
+// Mengimplementasikan command.Transport. Semua method aman dipanggil lewat hub nil
+// (listener tetap jalan tanpa fitur command).
+type CommandHub struct {
+	Commands *command.Service
+
+	mu       sync.Mutex
+	sessions map[int64]*deviceSession
+}
+
+func NewCommandHub(svc *command.Service) *CommandHub {
+	return &CommandHub{Commands: svc, sessions: make(map[int64]*deviceSession)}
+}
+
+// deviceSession koneksi satu device. Semua tulisan ke koneksi (ACK listener maupun command)
+// lewat sini supaya tidak saling menimpa.
+type deviceSession struct {
+	deviceID int64
+	conn     io.Writer
+	encode   func(cmd *command.DeviceCommand) []byte
+
+	mu sync.Mutex
+}
+
+func (s *deviceSession) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn.Write(p)
+}
+
+func (s *deviceSession) send(cmd *command.DeviceCommand) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.conn.Write(s.encode(cmd))
+	return err
+}
+
+// Connected true bila device punya koneksi aktif ke salah satu listener
+func (h *CommandHub) Connected(deviceID int64) bool {
+	if h == nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.sessions[deviceID]
+	return ok
+}
+
+// Notify kirim command QUEUED milik device di background bila device sedang terhubung
+func (h *CommandHub) Notify(deviceID int64) {
+	if h.Connected(deviceID) {
+		go h.deliver(deviceID)
+	}
+}
+
+// attach daftarkan koneksi device setelah handshake/login. Koneksi lama device yang sama diganti.
+func (h *CommandHub) attach(deviceID int64, conn io.Writer, encode func(cmd *command.DeviceCommand) []byte) *deviceSession {
+	sess := &deviceSession{deviceID: deviceID, conn: conn, encode: encode}
+	if h == nil {
+		return sess
+	}
+	h.mu.Lock()
+	h.sessions[deviceID] = sess
+	h.mu.Unlock()
+	go h.deliver(deviceID)
+	return sess
+}
+
+// detach lepas koneksi saat ditutup (hanya bila belum diganti koneksi yang lebih baru)
+func (h *CommandHub) detach(sess *deviceSession) {
+	if h == nil || sess == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.sessions[sess.deviceID] == sess {
+		delete(h.sessions, sess.deviceID)
+	}
+}
+
+// deliver tulis semua command QUEUED milik device ke koneksinya. Bila penulisan gagal
+// command dikembalikan ke antrian dan dicoba lagi saat device terhubung kembali.
+func (h *CommandHub) deliver(deviceID int64) {
+	if h == nil || h.Commands == nil {
+		return
+	}
+	for {
+		h.mu.Lock()
+		sess := h.sessions[deviceID]
+		h.mu.Unlock()
+		if sess == nil {
+			return
+		}
+
+		cmd, err := h.Commands.Claim(deviceID, time.Now().UTC())
+		if err != nil {
+			log.Printf("command: device %d: gagal mengambil antrian: %v", deviceID, err)
+			return
+		}
+		if cmd == nil {
+			return
+		}
+
+		if err := sess.send(cmd); err != nil {
+			log.Printf("command: device %d: gagal mengirim command %d: %v", deviceID, cmd.ID, err)
+			if err := h.Commands.Requeue(cmd.ID, err.Error()); err != nil {
+				log.Printf("command: device %d: gagal requeue command %d: %v", deviceID, cmd.ID, err)
+			}
+			return
+		}
+	}
+}
+
+// ack simpan balasan device untuk command yang sudah dikirim
+func (h *CommandHub) ack(deviceID int64, commandID *int64, response string) {
+	if h == nil || h.Commands == nil {
+		return
+	}
+	if err := h.Commands.Ack(deviceID, commandID, response); err != nil {
+		log.Printf("command: device %d: balasan %q tidak dipasangkan: %v", deviceID, response, err)
+	}
+}
@@ -0,0 +1,298 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/username/fms-api/internal/device"
+)
+
+// Connector = adapter vendor untuk data source bertipe API (pull).
+// Poll mengambil fix baru sejak cursor dan mengembalikan cursor berikutnya.
+type Connector interface {
+	Poll(ctx context.Context, cursor string) (*PollResult, error)
+}
+
+// PulledFix = satu fix hasil pull beserta external id device di sisi vendor
+type PulledFix struct {
+	ExternalID string
+	Fix        Fix
+}
+
+type PollResult struct {
+	Fixes  []PulledFix
+	Cursor string // cursor / high-watermark baru, kosong = tidak berubah
+}
+
+// RateLimitError dikembalikan connector saat vendor membalas rate limit (HTTP 429)
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited, retry after %s", e.RetryAfter)
+}
+
+// TemporaryError menandai error yang boleh di-retry (timeout, 5xx, dll)
+type TemporaryError struct {
+	Err error
+}
+
+func (e *TemporaryError) Error() string { return e.Err.Error() }
+func (e *TemporaryError) Unwrap() error { return e.Err }
+
+// ========= REGISTRY =========
+
+// ConnectorFactory membuat connector dari konfigurasi data source
+type ConnectorFactory func(ds device.DataSource) (Connector, error)
+
+var (
+	connectorMu       sync.RWMutex
+	connectorRegistry = map[string]ConnectorFactory{}
+)
+
+// RegisterConnector daftarkan adapter untuk data_sources.type tertentu (misal "API", "CARTRACK_API")
+func RegisterConnector(dataSourceType string, factory ConnectorFactory) {
+	connectorMu.Lock()
+	defer connectorMu.Unlock()
+	connectorRegistry[strings.ToUpper(dataSourceType)] = factory
+}
+
+// NewConnector buat connector sesuai tipe data source
+func NewConnector(ds device.DataSource) (Connector, error) {
+	connectorMu.RLock()
+	factory, ok := connectorRegistry[strings.ToUpper(ds.Type)]
+	connectorMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("tidak ada connector untuk tipe %s", ds.Type)
+	}
+	return factory(ds)
+}
+
+// ConnectorTypes daftar tipe data source yang punya connector
+func ConnectorTypes() []string {
+	connectorMu.RLock()
+	defer connectorMu.RUnlock()
+	types := make([]string, 0, len(connectorRegistry))
+	for t := range connectorRegistry {
+		types = append(types, t)
+	}
+	return types
+}
+
+// ========= POLLER =========
+
+// Poller menjalankan satu connector secara periodik dan menyimpan cursor di connector_states
+type Poller struct {
+	Service    *Service
+	Source     device.DataSource
+	Connector  Connector
+	Interval   time.Duration
+	MaxRetries int
+	Backoff    Backoff
+}
+
+// NewPoller interval diambil dari config "pollIntervalSeconds" (default 60 detik)
+func NewPoller(ds device.DataSource, conn Connector, svc *Service) *Poller {
+	interval := 60 * time.Second
+	if v, ok := anyFloat(ds.Config["pollIntervalSeconds"]); ok && v > 0 {
+		interval = time.Duration(v) * time.Second
+	}
+	return &Poller{
+		Service:    svc,
+		Source:     ds,
+		Connector:  conn,
+		Interval:   interval,
+		MaxRetries: 5,
+		Backoff:    Backoff{Min: time.Second, Max: time.Minute},
+	}
+}
+
+// PollSummary ringkasan satu putaran poll
+type PollSummary struct {
+	Result
+	Unknown int    `json:"unknown"` // fix dari device yang tidak dikenal / belum terikat
+	Cursor  string `json:"cursor"`
+}
+
+// PollOnce satu putaran: baca cursor, poll (dengan retry), simpan fix, lalu simpan cursor baru
+func (p *Poller) PollOnce(ctx context.Context) (PollSummary, error) {
+	var summary PollSummary
+
+	state := ConnectorState{DataSourceID: p.Source.ID}
+	if err := p.Service.DB.Where("data_source_id = ?", p.Source.ID).Take(&state).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return summary, err
+	}
+
+	res, err := p.pollWithRetry(ctx, state.Cursor)
+	now := time.Now().UTC()
+	state.LastPolledAt = &now
+	if err != nil {
+		msg := err.Error()
+		state.LastError = &msg
+		p.saveState(&state)
+		return summary, err
+	}
+
+	// kelompokkan per device supaya resolve cukup sekali
+	byDevice := map[string][]Fix{}
+	var order []string
+	for _, pf := range res.Fixes {
+		if _, ok := byDevice[pf.ExternalID]; !ok {
+			order = append(order, pf.ExternalID)
+		}
+		byDevice[pf.ExternalID] = append(byDevice[pf.ExternalID], pf.Fix)
+	}
+	for _, ext := range order {
+		target, err := p.Service.ResolveByDataSource(p.Source.Code, ext)
+		if err != nil {
+			if _, status := resolveErrorCode(err); status != 500 {
+				if errors.Is(err, ErrUnknownDevice) {
+					p.Service.HoldUnknown(DataSourceTypeAPI, p.Source.Code, ext, byDevice[ext], nil)
+				}
+				summary.Unknown += len(byDevice[ext])
+				continue
+			}
+			return summary, err
+		}
+		// data hasil pull bisa tertinggal jauh dari waktu terima, bukan sampel jam device
+		for i := range byDevice[ext] {
+			byDevice[ext][i].History = true
+		}
+		r, err := p.Service.Store(target, byDevice[ext])
+		if err != nil {
+			return summary, err
+		}
+		summary.Inserted += r.Inserted
+		summary.Duplicates += r.Duplicates
+	}
+
+	// cursor baru hanya disimpan setelah semua fix tersimpan
+	if res.Cursor != "" {
+		state.Cursor = res.Cursor
+	}
+	state.LastSuccessAt = &now
+	state.LastError = nil
+	if err := p.saveState(&state); err != nil {
+		return summary, err
+	}
+
+	summary.Cursor = state.Cursor
+	return summary, nil
+}
+
+// pollWithRetry retry untuk rate limit (ikuti Retry-After) dan error sementara (backoff)
+func (p *Poller) pollWithRetry(ctx context.Context, cursor string) (*PollResult, error) {
+	p.Backoff.Reset()
+	for attempt := 0; ; attempt++ {
+		res, err := p.Connector.Poll(ctx, cursor)
+		if err == nil {
+			return res, nil
+		}
+
+		var wait time.Duration
+		var rl *RateLimitError
+		var tmp *TemporaryError
+		switch {
+		case errors.As(err, &rl):
+			wait = rl.RetryAfter
+			if wait <= 0 {
+				wait = p.Backoff.Next()
+			}
+		case errors.As(err, &tmp):
+			wait = p.Backoff.Next()
+		default:
+			return nil, err
+		}
+
+		if attempt >= p.MaxRetries {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (p *Poller) saveState(state *ConnectorState) error {
+	state.UpdatedAt = time.Now().UTC()
+	return p.Service.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "data_source_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"cursor", "last_polled_at", "last_success_at", "last_error", "updated_at"}),
+	}).Create(state).Error
+}
+
+// Run poll setiap Interval sampai ctx dibatalkan
+func (p *Poller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	for {
+		if s, err := p.PollOnce(ctx); err != nil {
+			log.Printf("connector %s: poll gagal: %v", p.Source.Code, err)
+		} else if s.Inserted > 0 || s.Unknown > 0 {
+			log.Printf("connector %s: %d fix baru, %d duplikat, %d device tidak dikenal", p.Source.Code, s.Inserted, s.Duplicates, s.Unknown)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ========= MANAGER =========
+
+// ConnectorManager menjalankan satu poller per data source yang tipenya punya connector
+type ConnectorManager struct {
+	Service *Service
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewConnectorManager(svc *Service) *ConnectorManager {
+	return &ConnectorManager{Service: svc}
+}
+
+// Start baca semua data source yang tipenya punya connector lalu jalankan poller-nya di background
+func (m *ConnectorManager) Start() error {
+	var sources []device.DataSource
+	if err := m.Service.DB.Where("UPPER(type) IN ?", ConnectorTypes()).Order("id").Find(&sources).Error; err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	for _, ds := range sources {
+		conn, err := NewConnector(ds)
+		if err != nil {
+			log.Printf("connector %s: dilewati: %v", ds.Code, err)
+			continue
+		}
+		poller := NewPoller(ds, conn, m.Service)
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			poller.Run(ctx)
+		}()
+	}
+	return nil
+}
+
+// Stop hentikan semua poller dan tunggu sampai selesai
+func (m *ConnectorManager) Stop() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.wg.Wait()
+}
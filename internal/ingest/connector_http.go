@@ -0,0 +1,214 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/username/fms-api/internal/device"
+)
+
+// DataSourceTypeAPI = connector referensi: REST API vendor yang mengembalikan JSON
+const DataSourceTypeAPI = "API"
+
+func init() {
+	RegisterConnector(DataSourceTypeAPI, func(ds device.DataSource) (Connector, error) {
+		cfg, err := ParseHTTPConnectorConfig(ds)
+		if err != nil {
+			return nil, err
+		}
+		return NewHTTPJSONConnector(cfg), nil
+	})
+}
+
+// HTTPConnectorConfig dibaca dari data_sources.config untuk data source bertipe API
+type HTTPConnectorConfig struct {
+	URL             string            `json:"url"`
+	APIKey          string            `json:"apiKey"`
+	AuthHeader      string            `json:"authHeader"`      // default "Authorization" (nilai "Bearer <apiKey>")
+	ItemsPath       string            `json:"itemsPath"`       // path array posisi di response, kosong = response itu sendiri array
+	ExternalIDField string            `json:"externalIdField"` // default "deviceId"
+	CursorParam     string            `json:"cursorParam"`     // default "since"
+	NextCursorPath  string            `json:"nextCursorPath"`  // kosong = cursor = ts terbesar (RFC3339)
+	FieldMapping    map[string]string `json:"fieldMapping"`
+	SpeedUnit       string            `json:"speedUnit"`
+	TimeoutSeconds  int               `json:"timeoutSeconds"`
+}
+
+// ParseHTTPConnectorConfig baca config data source lalu isi default yang kosong
+func ParseHTTPConnectorConfig(ds device.DataSource) (HTTPConnectorConfig, error) {
+	var cfg HTTPConnectorConfig
+	if ds.Config != nil {
+		b, err := json.Marshal(ds.Config)
+		if err != nil {
+			return cfg, err
+		}
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return cfg, fmt.Errorf("config API data source %s tidak valid: %w", ds.Code, err)
+		}
+	}
+
+	if cfg.URL == "" {
+		return cfg, fmt.Errorf("url data source %s wajib diisi", ds.Code)
+	}
+	if cfg.AuthHeader == "" {
+		cfg.AuthHeader = "Authorization"
+	}
+	if cfg.ExternalIDField == "" {
+		cfg.ExternalIDField = "deviceId"
+	}
+	if cfg.CursorParam == "" {
+		cfg.CursorParam = "since"
+	}
+	if cfg.TimeoutSeconds <= 0 {
+		cfg.TimeoutSeconds = 30
+	}
+	cfg.FieldMapping = mergeFieldMapping(cfg.FieldMapping)
+
+	return cfg, nil
+}
+
+// HTTPJSONConnector GET <url>?<cursorParam>=<cursor> lalu petakan setiap item ke Fix
+type HTTPJSONConnector struct {
+	Config HTTPConnectorConfig
+	Client *http.Client
+}
+
+func NewHTTPJSONConnector(cfg HTTPConnectorConfig) *HTTPJSONConnector {
+	return &HTTPJSONConnector{
+		Config: cfg,
+		Client: &http.Client{Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second},
+	}
+}
+
+func (c *HTTPJSONConnector) Poll(ctx context.Context, cursor string) (*PollResult, error) {
+	u, err := url.Parse(c.Config.URL)
+	if err != nil {
+		return nil, err
+	}
+	if cursor != "" {
+		q := u.Query()
+		q.Set(c.Config.CursorParam, cursor)
+		u.RawQuery = q.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Config.APIKey != "" {
+		if c.Config.AuthHeader == "Authorization" {
+			req.Header.Set("Authorization", "Bearer "+c.Config.APIKey)
+		} else {
+			req.Header.Set(c.Config.AuthHeader, c.Config.APIKey)
+		}
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, &TemporaryError{Err: err}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return nil, &RateLimitError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	case resp.StatusCode >= 500:
+		return nil, &TemporaryError{Err: fmt.Errorf("vendor membalas HTTP %d", resp.StatusCode)}
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("vendor membalas HTTP %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &TemporaryError{Err: err}
+	}
+	return c.decode(body, cursor)
+}
+
+// decode ambil array item dari response lalu konversi ke PulledFix.
+// Item yang tidak valid dilewati supaya satu titik rusak tidak menahan cursor. Cursor default = ts
+// terbesar dari item yang punya ts sendiri (bukan waktu terima) dan tidak pernah mundur dari cursor tersimpan.
+func (c *HTTPJSONConnector) decode(body []byte, cursor string) (*PollResult, error) {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, errors.New("response vendor bukan JSON")
+	}
+
+	items, ok := doc.([]interface{})
+	if c.Config.ItemsPath != "" {
+		root, isObj := doc.(map[string]interface{})
+		if !isObj {
+			return nil, errors.New("response vendor bukan JSON object")
+		}
+		v, _ := lookupPath(root, c.Config.ItemsPath)
+		items, ok = v.([]interface{})
+		if v == nil {
+			items, ok = nil, true
+		}
+	}
+	if !ok {
+		return nil, errors.New("daftar posisi tidak ditemukan di response vendor")
+	}
+
+	res := &PollResult{Cursor: cursor}
+	var maxTS time.Time
+	for _, it := range items {
+		item, ok := it.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		ext, found := lookupPath(item, c.Config.ExternalIDField)
+		if !found {
+			continue
+		}
+		fix, err := decodeMappedFix(item, c.Config.FieldMapping, c.Config.SpeedUnit)
+		if err != nil {
+			continue
+		}
+		fix.Raw = map[string]interface{}{
+			"protocol": DataSourceTypeAPI,
+			"payload":  item,
+		}
+		res.Fixes = append(res.Fixes, PulledFix{ExternalID: fmt.Sprint(ext), Fix: fix})
+		if _, hasTS := lookupPath(item, c.Config.FieldMapping["ts"]); hasTS && fix.TS.After(maxTS) {
+			maxTS = fix.TS
+		}
+	}
+
+	if c.Config.NextCursorPath != "" {
+		if root, isObj := doc.(map[string]interface{}); isObj {
+			if v, found := lookupPath(root, c.Config.NextCursorPath); found {
+				res.Cursor = fmt.Sprint(v)
+			}
+		}
+	} else if !maxTS.IsZero() {
+		if prev, err := time.Parse(time.RFC3339, cursor); err != nil || maxTS.Truncate(time.Second).After(prev) {
+			res.Cursor = maxTS.UTC().Format(time.RFC3339)
+		}
+	}
+	return res, nil
+}
+
+// parseRetryAfter terima detik ("120") atau HTTP-date
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,483 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/device"
+	"github.com/username/fms-api/internal/pagination"
+)
+
+// jumlah dead-letter yang di-replay per batch
+const deadLetterReplayBatch = 200
+
+// jarak minimal antar pembersihan dead-letter yang lewat DeadLetterTTL
+const deadLetterPruneInterval = time.Minute
+
+// protokol yang device-nya di-resolve lewat data_sources.type, jadi data source hasil
+// provisioning wajib bertipe sama (lihat ResolveByDataSourceType)
+var dataSourceTypeByProtocol = map[string]string{
+	ProtocolGT06:       ProtocolGT06,
+	DataSourceTypeMQTT: DataSourceTypeMQTT,
+}
+
+var (
+	ErrNoHeldPackets      = errors.New("tidak ada paket yang ditahan untuk external id ini")
+	ErrDeviceExists       = errors.New("device dengan data source + external id ini sudah ada")
+	ErrDataSourceNotFound = errors.New("data source tidak ditemukan")
+	ErrVehicleNotFound    = errors.New("kendaraan tidak ditemukan")
+	ErrReplayNeedsVehicle = errors.New("replay butuh vehicleId supaya paket bisa masuk position_log")
+	ErrAmbiguousProtocol  = errors.New("paket yang ditahan berasal dari beberapa protokol, isi protocol")
+	ErrDataSourceMismatch = errors.New("tipe data source tidak cocok dengan protokol device")
+)
+
+// HoldUnknown simpan paket dari external id yang belum terdaftar (beserta fix hasil decode)
+// supaya bisa di-replay setelah device di-provision. Gagal simpan hanya dicatat di log,
+// fix yang gagal di-encode dicatat di kolom error (payload tetap disimpan).
+// Tanpa AcceptUnknown paket tidak ditahan.
+func (s *Service) HoldUnknown(protocol, dataSourceCode, externalID string, fixes []Fix, payload map[string]interface{}) {
+	if !s.AcceptUnknown {
+		return
+	}
+	dl := DeadLetter{
+		Reason:         DeadLetterUnknownDevice,
+		Protocol:       protocol,
+		DataSourceCode: dataSourceCode,
+		ExternalID:     externalID,
+		Payload:        payload,
+		ReceivedAt:     time.Now().UTC(),
+	}
+	if len(fixes) > 0 {
+		b, err := json.Marshal(fixes)
+		if err != nil {
+			log.Printf("dead-letter: %s %s: gagal encode fix: %v", protocol, externalID, err)
+			msg := "gagal encode fix: " + err.Error()
+			dl.Error = &msg
+		} else {
+			dl.Fixes = b
+		}
+	}
+	s.deadLetter(&dl)
+}
+
+// HoldUnparsable simpan paket yang gagal di-decode. externalID boleh kosong bila belum diketahui.
+func (s *Service) HoldUnparsable(protocol, externalID string, payload map[string]interface{}, cause error) {
+	msg := cause.Error()
+	s.deadLetter(&DeadLetter{
+		Reason:     DeadLetterUnparsable,
+		Protocol:   protocol,
+		ExternalID: externalID,
+		Payload:    payload,
+		Error:      &msg,
+		ReceivedAt: time.Now().UTC(),
+	})
+}
+
+func (s *Service) deadLetter(dl *DeadLetter) {
+	if !s.allowDeadLetter(dl.ReceivedAt) {
+		return
+	}
+	if err := s.DB.Create(dl).Error; err != nil {
+		log.Printf("dead-letter: gagal menyimpan paket %s %s: %v", dl.Protocol, dl.ExternalID, err)
+		return
+	}
+	if err := s.capDeadLetters(dl); err != nil {
+		log.Printf("dead-letter: gagal membuang paket lama %s %s: %v", dl.Protocol, dl.ExternalID, err)
+	}
+	if err := s.pruneDeadLetters(dl.ReceivedAt); err != nil {
+		log.Printf("dead-letter: gagal menghapus paket kedaluwarsa: %v", err)
+	}
+}
+
+// allowDeadLetter batasi jumlah dead-letter per menit (DeadLetterRate) supaya external id acak dari
+// endpoint tanpa autentikasi tidak membuat tabel tumbuh tanpa batas. Pembuangan dicatat sekali per menit.
+func (s *Service) allowDeadLetter(now time.Time) bool {
+	if s.DeadLetterRate <= 0 {
+		return true
+	}
+	s.deadLetterMu.Lock()
+	defer s.deadLetterMu.Unlock()
+	if now.Sub(s.rateWindow) >= time.Minute || now.Before(s.rateWindow) {
+		s.rateWindow, s.rateCount = now, 0
+	}
+	s.rateCount++
+	if s.rateCount == s.DeadLetterRate+1 {
+		log.Printf("dead-letter: batas %d paket per menit tercapai, paket berikutnya dibuang", s.DeadLetterRate)
+	}
+	return s.rateCount <= s.DeadLetterRate
+}
+
+// capDeadLetters buang paket terlama bila jumlah paket yang ditahan untuk protokol + external id
+// (dan alasan) yang sama melebihi DeadLetterCap
+func (s *Service) capDeadLetters(dl *DeadLetter) error {
+	if s.DeadLetterCap <= 0 {
+		return nil
+	}
+	held := func() *gorm.DB {
+		return s.DB.Model(&DeadLetter{}).
+			Where("reason = ? AND protocol = ? AND external_id = ? AND device_id IS NULL", dl.Reason, dl.Protocol, dl.ExternalID)
+	}
+	// id paket ke-(cap+1) dari yang terbaru; paket itu dan yang lebih lama dibuang
+	var ids []int64
+	if err := held().Order("id DESC").Offset(s.DeadLetterCap).Limit(1).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return held().Where("id <= ?", ids[0]).Delete(&DeadLetter{}).Error
+}
+
+// pruneDeadLetters hapus dead-letter yang lebih lama dari DeadLetterTTL, paling sering sekali per menit
+func (s *Service) pruneDeadLetters(now time.Time) error {
+	if s.DeadLetterTTL <= 0 {
+		return nil
+	}
+	s.deadLetterMu.Lock()
+	if !s.prunedAt.IsZero() && now.Sub(s.prunedAt) < deadLetterPruneInterval {
+		s.deadLetterMu.Unlock()
+		return nil
+	}
+	s.prunedAt = now
+	s.deadLetterMu.Unlock()
+
+	return s.DB.Where("received_at < ?", now.Add(-s.DeadLetterTTL)).Delete(&DeadLetter{}).Error
+}
+
+// UnknownDevice ringkasan paket yang ditahan per external id yang belum terdaftar
+type UnknownDevice struct {
+	Protocol       string                 `json:"protocol"`
+	DataSourceCode string                 `json:"dataSourceCode,omitempty"`
+	ExternalID     string                 `json:"externalId"`
+	FirstSeen      time.Time              `json:"firstSeen"`
+	LastSeen       time.Time              `json:"lastSeen"`
+	PacketCount    int64                  `json:"packetCount"`
+	SamplePayload  map[string]interface{} `json:"samplePayload,omitempty"` // paket terakhir
+}
+
+// ProvisionRequest buat device untuk external id yang paketnya ditahan
+type ProvisionRequest struct {
+	DataSourceID int64  `json:"dataSourceId"`
+	Protocol     string `json:"protocol,omitempty"`  // default: protokol paket yang ditahan
+	VehicleID    *int64 `json:"vehicleId,omitempty"` // opsional, langsung diikat ke kendaraan
+	SimNumber    string `json:"simNumber,omitempty"`
+	Model        string `json:"model,omitempty"`
+	Replay       bool   `json:"replay"` // masukkan paket yang ditahan ke position_log
+}
+
+type ProvisionResult struct {
+	Device    device.Device `json:"device"`
+	VehicleID *int64        `json:"vehicleId,omitempty"`
+	Held      int64         `json:"held"`     // paket yang ditahan untuk external id ini
+	Replayed  int           `json:"replayed"` // paket yang di-replay
+	Result    Result        `json:"result"`   // hasil penyimpanan fix hasil replay
+}
+
+// Provision buat device di data source terpilih untuk external id yang paketnya ditahan,
+// opsional ikat ke kendaraan lalu replay paketnya ke position_log.
+// Paket yang ditahan dengan data source lain (HTTP / MQTT / API) tidak ikut.
+func (s *Service) Provision(externalID string, req ProvisionRequest) (*ProvisionResult, error) {
+	if req.Replay && req.VehicleID == nil {
+		return nil, ErrReplayNeedsVehicle
+	}
+
+	var ds device.DataSource
+	if err := s.DB.First(&ds, req.DataSourceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDataSourceNotFound
+		}
+		return nil, err
+	}
+
+	held := func(db *gorm.DB) *gorm.DB {
+		q := db.Model(&DeadLetter{}).
+			Where("reason = ? AND external_id = ? AND device_id IS NULL", DeadLetterUnknownDevice, externalID).
+			Where("(data_source_code = '' OR data_source_code IS NULL OR data_source_code = ?)", ds.Code)
+		if req.Protocol != "" {
+			q = q.Where("UPPER(protocol) = ?", strings.ToUpper(req.Protocol))
+		}
+		return q
+	}
+
+	var protocols []string
+	if err := held(s.DB).Distinct().Pluck("protocol", &protocols).Error; err != nil {
+		return nil, err
+	}
+	if len(protocols) == 0 {
+		return nil, ErrNoHeldPackets
+	}
+	protocol := strings.ToUpper(req.Protocol)
+	if protocol == "" {
+		if len(protocols) > 1 {
+			return nil, ErrAmbiguousProtocol
+		}
+		protocol = protocols[0]
+	}
+	if want, ok := dataSourceTypeByProtocol[strings.ToUpper(protocol)]; ok && !strings.EqualFold(ds.Type, want) {
+		return nil, fmt.Errorf("%w: protokol %s butuh data source bertipe %s, bukan %s", ErrDataSourceMismatch, protocol, want, ds.Type)
+	}
+
+	res := &ProvisionResult{VehicleID: req.VehicleID}
+	dev := device.Device{
+		DataSourceID: ds.ID,
+		ExternalID:   externalID,
+		SimNumber:    req.SimNumber,
+		Model:        req.Model,
+		Protocol:     protocol,
+		Active:       true,
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var exists int64
+		if err := tx.Model(&device.Device{}).Where("data_source_id = ? AND external_id = ?", ds.ID, externalID).
+			Count(&exists).Error; err != nil {
+			return err
+		}
+		if exists > 0 {
+			return ErrDeviceExists
+		}
+		if err := tx.Create(&dev).Error; err != nil {
+			return err
+		}
+
+		if req.VehicleID != nil {
+			var vcount int64
+			if err := tx.Table("vehicles").Where("id = ?", *req.VehicleID).Count(&vcount).Error; err != nil {
+				return err
+			}
+			if vcount == 0 {
+				return ErrVehicleNotFound
+			}
+			if err := tx.Create(&device.VehicleDevice{
+				VehicleID: *req.VehicleID, DeviceID: dev.ID, Active: true, AssignedAt: time.Now(),
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		upd := held(tx).Update("device_id", dev.ID)
+		res.Held = upd.RowsAffected
+		return upd.Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	res.Device = dev
+
+	if req.Replay {
+		target := &Target{Device: dev, VehicleID: *req.VehicleID}
+		if err := s.replayHeld(target, res); err != nil {
+			return res, fmt.Errorf("device dibuat tapi replay gagal: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// replayHeld masukkan fix dari dead-letter milik device ke position_log, per batch
+func (s *Service) replayHeld(target *Target, res *ProvisionResult) error {
+	var lastID int64
+	for {
+		var rows []DeadLetter
+		if err := s.DB.Where("device_id = ? AND reason = ? AND replayed_at IS NULL AND id > ?",
+			target.Device.ID, DeadLetterUnknownDevice, lastID).
+			Order("id").Limit(deadLetterReplayBatch).Find(&rows).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		var fixes []Fix
+		ids := make([]int64, 0, len(rows))
+		for _, row := range rows {
+			lastID = row.ID
+			ids = append(ids, row.ID)
+			if len(row.Fixes) == 0 {
+				continue
+			}
+			var f []Fix
+			if err := json.Unmarshal(row.Fixes, &f); err != nil {
+				return fmt.Errorf("dead-letter %d: %w", row.ID, err)
+			}
+			// skew jam dihitung terhadap waktu paket diterima, bukan waktu replay
+			for k := range f {
+				f[k].ReceivedAt = &row.ReceivedAt
+			}
+			fixes = append(fixes, f...)
+		}
+
+		r, err := s.Store(target, fixes)
+		if err != nil {
+			return err
+		}
+		res.Result.Inserted += r.Inserted
+		res.Result.Duplicates += r.Duplicates
+		res.Result.Late += r.Late
+		res.Result.Quarantined += r.Quarantined
+		res.Result.Flagged += r.Flagged
+		res.Result.Dropped += r.Dropped
+
+		if err := s.DB.Model(&DeadLetter{}).Where("id IN ?", ids).Update("replayed_at", time.Now().UTC()).Error; err != nil {
+			return err
+		}
+		res.Replayed += len(rows)
+	}
+}
+
+// ========= HANDLER =========
+
+// ListUnknownDevices GET /admin/ingest/unknown?protocol= — external id belum terdaftar, terbaru dulu
+func (h *Handler) ListUnknownDevices(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok || !cu.IsSuperAdmin() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "message": "hanya SUPER_ADMIN"})
+		return
+	}
+
+	p := pagination.ParsePagination(c)
+	if c.IsAborted() {
+		return
+	}
+
+	groups := h.DB.Model(&DeadLetter{}).
+		Select("protocol, data_source_code, external_id, MIN(id) AS first_id, MAX(id) AS last_id, COUNT(*) AS packet_count").
+		Where("reason = ? AND device_id IS NULL", DeadLetterUnknownDevice).
+		Group("protocol, data_source_code, external_id")
+	if v := c.Query("protocol"); v != "" {
+		groups = groups.Where("UPPER(protocol) = ?", strings.ToUpper(v))
+	}
+
+	var total int64
+	if err := h.DB.Table("(?) AS g", groups).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+
+	var rows []struct {
+		Protocol       string
+		DataSourceCode string
+		ExternalID     string
+		FirstID        int64
+		LastID         int64
+		PacketCount    int64
+	}
+	if err := groups.Order("last_id DESC").Limit(p.Limit).Offset(p.Offset).Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+
+	// waktu pertama/terakhir + sample payload diambil dari row pertama & terakhir tiap grup
+	ids := make([]int64, 0, 2*len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.FirstID, r.LastID)
+	}
+	byID := map[int64]DeadLetter{}
+	if len(ids) > 0 {
+		var letters []DeadLetter
+		if err := h.DB.Where("id IN ?", ids).Find(&letters).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+			return
+		}
+		for _, l := range letters {
+			byID[l.ID] = l
+		}
+	}
+
+	data := make([]UnknownDevice, 0, len(rows))
+	for _, r := range rows {
+		last := byID[r.LastID]
+		data = append(data, UnknownDevice{
+			Protocol:       r.Protocol,
+			DataSourceCode: r.DataSourceCode,
+			ExternalID:     r.ExternalID,
+			FirstSeen:      byID[r.FirstID].ReceivedAt,
+			LastSeen:       last.ReceivedAt,
+			PacketCount:    r.PacketCount,
+			SamplePayload:  last.Payload,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": data, "pagination": gin.H{"total": total, "limit": p.Limit, "page": p.Page, "max_limit": p.MaxLimit}})
+}
+
+// ListDeadLetters GET /admin/ingest/dead-letters?reason=&protocol=&externalId=
+func (h *Handler) ListDeadLetters(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok || !cu.IsSuperAdmin() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "message": "hanya SUPER_ADMIN"})
+		return
+	}
+
+	query := h.DB.Model(&DeadLetter{})
+	if v := c.Query("reason"); v != "" {
+		query = query.Where("reason = ?", strings.ToUpper(v))
+	}
+	if v := c.Query("protocol"); v != "" {
+		query = query.Where("UPPER(protocol) = ?", strings.ToUpper(v))
+	}
+	if v := c.Query("externalId"); v != "" {
+		query = query.Where("external_id = ?", v)
+	}
+
+	p := pagination.ParsePagination(c)
+	if c.IsAborted() {
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	var rows []DeadLetter
+	if err := query.Order("id DESC").Limit(p.Limit).Offset(p.Offset).Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": rows, "pagination": gin.H{"total": total, "limit": p.Limit, "page": p.Page, "max_limit": p.MaxLimit}})
+}
+
+// ProvisionUnknown POST /admin/ingest/unknown/:externalId/provision
+func (h *Handler) ProvisionUnknown(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok || !cu.IsSuperAdmin() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "message": "hanya SUPER_ADMIN yang boleh membuat device"})
+		return
+	}
+
+	var req ProvisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.DataSourceID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "dataSourceId wajib diisi"})
+		return
+	}
+
+	res, err := h.Service.Provision(c.Param("externalId"), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrReplayNeedsVehicle), errors.Is(err, ErrAmbiguousProtocol), errors.Is(err, ErrDataSourceMismatch):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": err.Error()})
+		case errors.Is(err, ErrNoHeldPackets):
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": err.Error()})
+		case errors.Is(err, ErrDataSourceNotFound):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid_data_source", "message": err.Error()})
+		case errors.Is(err, ErrVehicleNotFound):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "vehicle_not_found", "message": err.Error()})
+		case errors.Is(err, ErrDeviceExists):
+			c.JSON(http.StatusConflict, gin.H{"error": "device_exists", "message": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
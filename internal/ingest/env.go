@@ -0,0 +1,76 @@
+package ingest
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// NewServiceFromEnv Service dengan filter kualitas, estimasi jam device dan batas ingestion dari env (INGEST_*).
+// Dipakai API maupun fmsctl supaya import / reprocess dari CLI dinilai sama dengan ingestion live.
+func NewServiceFromEnv(db *gorm.DB) *Service {
+	s := NewService(db)
+	// INGEST_MAX_FUTURE_SKEW_SECONDS negatif = tanpa karantina fix bertanggal masa depan
+	s.MaxFutureSkew = time.Duration(envSignedInt("INGEST_MAX_FUTURE_SKEW_SECONDS", 300)) * time.Second
+	s.Quality = NewQualityFilter(QualityConfigFromEnv())
+	s.ClockSkew = NewClockSkewFilter(ClockSkewConfigFromEnv())
+	// paket dari external id yang belum terdaftar ditolak kecuali INGEST_ACCEPT_UNKNOWN=true (ditahan di dead-letter)
+	s.AcceptUnknown = os.Getenv("INGEST_ACCEPT_UNKNOWN") == "true"
+	// batas paket yang ditahan per external id, umur & laju dead-letter; 0 atau negatif = tanpa batas
+	s.DeadLetterCap = envSignedInt("INGEST_DEAD_LETTER_CAP", 1000)
+	s.DeadLetterTTL = time.Duration(envSignedInt("INGEST_DEAD_LETTER_TTL_HOURS", 7*24)) * time.Hour
+	s.DeadLetterRate = envSignedInt("INGEST_DEAD_LETTER_RATE_PER_MINUTE", 600)
+	return s
+}
+
+// QualityConfigFromEnv ambang filter kualitas GPS dari env, default DefaultQualityConfig.
+// INGEST_QUALITY_DROP daftar marker dipisah koma yang fix-nya dibuang, misal "INVALID_COORD,SPEED_SPIKE".
+func QualityConfigFromEnv() QualityConfig {
+	cfg := DefaultQualityConfig()
+	cfg.MaxSpeedKph = float64(envInt("INGEST_MAX_SPEED_KPH", int(cfg.MaxSpeedKph)))
+	cfg.MaxImpliedSpeedKph = float64(envInt("INGEST_MAX_IMPLIED_SPEED_KPH", int(cfg.MaxImpliedSpeedKph)))
+	cfg.MinSatellites = envInt("INGEST_MIN_SATELLITES", cfg.MinSatellites)
+	cfg.DriftRadiusM = float64(envInt("INGEST_DRIFT_RADIUS_M", int(cfg.DriftRadiusM)))
+	cfg.ReanchorAfter = envSignedInt("INGEST_QUALITY_REANCHOR_AFTER", cfg.ReanchorAfter)
+	if v, err := strconv.ParseFloat(os.Getenv("INGEST_MAX_HDOP"), 64); err == nil && v > 0 {
+		cfg.MaxHDOP = v
+	}
+	for _, m := range strings.Split(os.Getenv("INGEST_QUALITY_DROP"), ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			cfg.Drop = append(cfg.Drop, strings.ToUpper(m))
+		}
+	}
+	return cfg
+}
+
+// ClockSkewConfigFromEnv ambang estimasi jam device dari env, default DefaultClockSkewConfig.
+// INGEST_CLOCK_SKEW_MODE = CORRECT / MARK / OFF, bisa dioverride per device lewat devices.metadata.clockSkewMode.
+func ClockSkewConfigFromEnv() ClockSkewConfig {
+	cfg := DefaultClockSkewConfig()
+	if m := strings.ToUpper(strings.TrimSpace(os.Getenv("INGEST_CLOCK_SKEW_MODE"))); m != "" {
+		cfg.Mode = m
+	}
+	cfg.Threshold = time.Duration(envInt("INGEST_CLOCK_SKEW_THRESHOLD_SECONDS", int(cfg.Threshold/time.Second))) * time.Second
+	cfg.MinSamples = envInt("INGEST_CLOCK_SKEW_MIN_SAMPLES", cfg.MinSamples)
+	cfg.Window = envInt("INGEST_CLOCK_SKEW_WINDOW", cfg.Window)
+	return cfg
+}
+
+// envInt baca env var angka positif, pakai default bila kosong / tidak valid
+func envInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+// envSignedInt seperti envInt tapi 0 & negatif diterima, untuk setting yang memakai negatif sebagai "nonaktif"
+func envSignedInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,519 @@
+package ingest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/username/fms-api/internal/alert"
+	"github.com/username/fms-api/internal/command"
+)
+
+const (
+	ProtocolGT06 = "GT06"
+
+	// protocol number paket GT06 / Concox
+	GT06Login        byte = 0x01
+	GT06Location     byte = 0x12
+	GT06Heartbeat    byte = 0x13
+	GT06Alarm        byte = 0x16
+	GT06LocationExt  byte = 0x22 // varian GT06N / Concox dengan status ACC
+	GT06Command      byte = 0x80 // command server -> device
+	GT06CommandReply byte = 0x15 // balasan command dari device
+)
+
+var ErrGT06CRC = errors.New("gt06: CRC tidak cocok")
+
+// gt06AlarmTypes memetakan kode alarm GT06 ke alert_types.code
+var gt06AlarmTypes = map[byte]string{
+	0x01: "SOS",
+	0x02: "POWER_CUT",
+}
+
+// GT06Packet = satu frame GT06 yang sudah dipisah per bagian
+type GT06Packet struct {
+	Protocol byte
+	Content  []byte // information content (tanpa protocol number, serial, CRC)
+	Serial   uint16
+	Frame    []byte // frame utuh termasuk start & stop bit
+}
+
+// GT06Position = isi paket lokasi / alarm setelah di-decode
+type GT06Position struct {
+	TS           time.Time
+	Lat          float64
+	Lon          float64
+	SpeedKph     float64
+	Course       uint16
+	Satellites   byte
+	Positioned   bool
+	MCC          uint16
+	MNC          byte
+	LAC          uint16
+	CellID       uint32
+	IgnitionOn   *bool
+	TerminalInfo *byte
+	Alarm        *byte
+	Realtime     *bool // 0x22: false = fix re-upload dari buffer device
+}
+
+// GT06CRC menghitung CRC-ITU (CRC-16/X-25) yang dipakai GT06
+func GT06CRC(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 == 1 {
+				crc = (crc >> 1) ^ 0x8408
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return ^crc
+}
+
+// ReadGT06Frame membaca satu frame 0x7878 (length 1 byte) atau 0x7979 (length 2 byte)
+func ReadGT06Frame(r io.Reader) ([]byte, error) {
+	var start [2]byte
+	if _, err := io.ReadFull(r, start[:]); err != nil {
+		return nil, err
+	}
+
+	var lenBytes []byte
+	var length int
+	switch {
+	case start[0] == 0x78 && start[1] == 0x78:
+		lenBytes = make([]byte, 1)
+		if _, err := io.ReadFull(r, lenBytes); err != nil {
+			return nil, err
+		}
+		length = int(lenBytes[0])
+	case start[0] == 0x79 && start[1] == 0x79:
+		lenBytes = make([]byte, 2)
+		if _, err := io.ReadFull(r, lenBytes); err != nil {
+			return nil, err
+		}
+		length = int(binary.BigEndian.Uint16(lenBytes))
+	default:
+		return nil, fmt.Errorf("gt06: start bit tidak dikenal %x", start)
+	}
+	if length < 5 {
+		return nil, fmt.Errorf("gt06: panjang paket tidak valid (%d)", length)
+	}
+
+	frame := make([]byte, 0, 2+len(lenBytes)+length+2)
+	frame = append(frame, start[:]...)
+	frame = append(frame, lenBytes...)
+	rest := make([]byte, length+2) // isi + stop bit 0x0D0A
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, err
+	}
+	return append(frame, rest...), nil
+}
+
+// DecodeGT06Frame memecah frame dan cek CRC + stop bit
+func DecodeGT06Frame(frame []byte) (*GT06Packet, error) {
+	if len(frame) < 10 {
+		return nil, errors.New("gt06: frame terlalu pendek")
+	}
+	lenSize := 1
+	if frame[0] == 0x79 && frame[1] == 0x79 {
+		lenSize = 2
+	} else if frame[0] != 0x78 || frame[1] != 0x78 {
+		return nil, errors.New("gt06: start bit tidak dikenal")
+	}
+	if frame[len(frame)-2] != 0x0D || frame[len(frame)-1] != 0x0A {
+		return nil, errors.New("gt06: stop bit tidak valid")
+	}
+
+	// CRC dihitung dari length s/d serial number
+	body := frame[2 : len(frame)-4]
+	crc := binary.BigEndian.Uint16(frame[len(frame)-4 : len(frame)-2])
+	if GT06CRC(body) != crc {
+		return nil, ErrGT06CRC
+	}
+
+	payload := body[lenSize:]
+	if len(payload) < 3 {
+		return nil, errors.New("gt06: isi paket terlalu pendek")
+	}
+	return &GT06Packet{
+		Protocol: payload[0],
+		Content:  payload[1 : len(payload)-2],
+		Serial:   binary.BigEndian.Uint16(payload[len(payload)-2:]),
+		Frame:    frame,
+	}, nil
+}
+
+// GT06Response membuat paket balasan standar (login, heartbeat, alarm) untuk serial tertentu
+func GT06Response(protocol byte, serial uint16) []byte {
+	buf := []byte{0x78, 0x78, 0x05, protocol, byte(serial >> 8), byte(serial)}
+	crc := GT06CRC(buf[2:])
+	return append(buf, byte(crc>>8), byte(crc), 0x0D, 0x0A)
+}
+
+// GT06CommandPacket membuat paket command 0x80. serverFlag dikembalikan device di balasan 0x15
+// sehingga balasan bisa dipasangkan ke command (dipakai id command).
+func GT06CommandPacket(serverFlag uint32, text string, serial uint16) []byte {
+	content := make([]byte, 0, 5+len(text)+2)
+	content = append(content, byte(4+len(text)))
+	content = binary.BigEndian.AppendUint32(content, serverFlag)
+	content = append(content, text...)
+	content = append(content, 0x00, 0x02) // bahasa: inggris
+
+	buf := []byte{0x78, 0x78, byte(1 + len(content) + 2 + 2), GT06Command}
+	buf = append(buf, content...)
+	buf = append(buf, byte(serial>>8), byte(serial))
+	crc := GT06CRC(buf[2:])
+	return append(buf, byte(crc>>8), byte(crc), 0x0D, 0x0A)
+}
+
+// CommandReply membaca server flag + teks dari paket balasan command 0x15
+func (p *GT06Packet) CommandReply() (uint32, string, error) {
+	if p.Protocol != GT06CommandReply {
+		return 0, "", fmt.Errorf("gt06: protocol 0x%02x bukan balasan command", p.Protocol)
+	}
+	if len(p.Content) < 5 {
+		return 0, "", errors.New("gt06: balasan command terlalu pendek")
+	}
+	n := int(p.Content[0])
+	if n < 4 || 1+n > len(p.Content) {
+		return 0, "", fmt.Errorf("gt06: panjang balasan command tidak valid (%d)", n)
+	}
+	flag := binary.BigEndian.Uint32(p.Content[1:5])
+	return flag, string(p.Content[5 : 1+n]), nil
+}
+
+// IMEI membaca terminal ID (8 byte BCD) dari paket login
+func (p *GT06Packet) IMEI() (string, error) {
+	if p.Protocol != GT06Login || len(p.Content) < 8 {
+		return "", errors.New("gt06: bukan paket login")
+	}
+	id := hex.EncodeToString(p.Content[:8])
+	// IMEI 15 digit disimpan dengan satu nol di depan
+	return strings.TrimPrefix(id, "0"), nil
+}
+
+// Location decode paket lokasi (0x12 / 0x22) atau alarm (0x16)
+func (p *GT06Packet) Location() (*GT06Position, error) {
+	if p.Protocol != GT06Location && p.Protocol != GT06LocationExt && p.Protocol != GT06Alarm {
+		return nil, fmt.Errorf("gt06: protocol 0x%02x bukan paket lokasi", p.Protocol)
+	}
+
+	c := &byteCursor{buf: p.Content}
+	dt := c.next(6)
+	gpsInfo := byte(c.uint(1))
+	rawLat := c.uint(4)
+	rawLon := c.uint(4)
+	speed := c.uint(1)
+	courseStatus := uint16(c.uint(2))
+	if c.err != nil {
+		return nil, fmt.Errorf("gt06: paket lokasi terpotong: %w", c.err)
+	}
+
+	loc := &GT06Position{
+		TS:         time.Date(2000+int(dt[0]), time.Month(dt[1]), int(dt[2]), int(dt[3]), int(dt[4]), int(dt[5]), 0, time.UTC),
+		Lat:        float64(rawLat) / 1800000,
+		Lon:        float64(rawLon) / 1800000,
+		SpeedKph:   float64(speed),
+		Course:     courseStatus & 0x03FF,
+		Satellites: gpsInfo & 0x0F,
+		Positioned: courseStatus&(1<<12) != 0,
+	}
+	// bit 10: lintang utara, bit 11: bujur barat
+	if courseStatus&(1<<10) == 0 {
+		loc.Lat = -loc.Lat
+	}
+	if courseStatus&(1<<11) != 0 {
+		loc.Lon = -loc.Lon
+	}
+
+	if p.Protocol == GT06Alarm {
+		c.uint(1) // panjang LBS
+	}
+	loc.MCC = uint16(c.uint(2))
+	loc.MNC = byte(c.uint(1))
+	loc.LAC = uint16(c.uint(2))
+	loc.CellID = uint32(c.uint(3))
+
+	switch p.Protocol {
+	case GT06LocationExt:
+		acc := c.uint(1)
+		if c.err == nil {
+			on := acc != 0
+			loc.IgnitionOn = &on
+		}
+		c.uint(1) // data upload mode
+		reupload := c.uint(1)
+		if c.err == nil {
+			realtime := reupload == 0
+			loc.Realtime = &realtime
+		}
+	case GT06Alarm:
+		info := byte(c.uint(1))
+		c.uint(1) // voltage level
+		c.uint(1) // GSM signal
+		alarm := byte(c.uint(1))
+		if c.err != nil {
+			return nil, fmt.Errorf("gt06: paket alarm terpotong: %w", c.err)
+		}
+		on := info&0x02 != 0
+		loc.IgnitionOn = &on
+		loc.TerminalInfo = &info
+		loc.Alarm = &alarm
+	}
+
+	return loc, nil
+}
+
+// Fix konversi lokasi GT06 ke Fix, frame mentah disimpan di raw payload
+func (l *GT06Position) Fix(p *GT06Packet) Fix {
+	speed := l.SpeedKph
+	heading := float64(l.Course)
+	raw := map[string]interface{}{
+		"protocol":       ProtocolGT06,
+		"protocolNumber": p.Protocol,
+		"frame":          hex.EncodeToString(p.Frame),
+		"satellites":     l.Satellites,
+		"positioned":     l.Positioned,
+		"mcc":            l.MCC,
+		"mnc":            l.MNC,
+		"lac":            l.LAC,
+		"cellId":         l.CellID,
+	}
+	if l.Alarm != nil {
+		raw["alarm"] = *l.Alarm
+	}
+	if l.Realtime != nil {
+		raw["realtime"] = *l.Realtime
+	}
+
+	return Fix{
+		TS:         l.TS,
+		Lat:        l.Lat,
+		Lon:        l.Lon,
+		SpeedKph:   &speed,
+		HeadingDeg: &heading,
+		IgnitionOn: l.IgnitionOn,
+		Raw:        raw,
+		History:    l.Realtime != nil && !*l.Realtime,
+	}
+}
+
+// ========= TCP SERVER =========
+
+// GT06Server listener TCP untuk device GT06 / Concox
+type GT06Server struct {
+	Addr        string
+	Service     *Service
+	IdleTimeout time.Duration
+
+	tcpListener
+}
+
+func NewGT06Server(addr string, svc *Service) *GT06Server {
+	return &GT06Server{Addr: addr, Service: svc, IdleTimeout: 10 * time.Minute}
+}
+
+func (s *GT06Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+func (s *GT06Server) Serve(ln net.Listener) error {
+	return s.serve(ln, s.HandleConn)
+}
+
+// HandleConn: paket pertama wajib login, setelah itu lokasi / heartbeat / alarm
+func (s *GT06Server) HandleConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	var target *Target
+	var imei string
+	var unknown bool // login dari IMEI yang belum terdaftar, paket ditahan di dead-letter
+	var sess *deviceSession
+	defer func() { s.Service.Commands.detach(sess) }()
+	for {
+		touchDeadline(conn, s.IdleTimeout)
+		frame, err := ReadGT06Frame(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("gt06: %s: gagal membaca frame: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		pkt, err := DecodeGT06Frame(frame)
+		if err != nil {
+			log.Printf("gt06: %s: frame tidak valid: %v", conn.RemoteAddr(), err)
+			s.Service.HoldUnparsable(ProtocolGT06, imei, map[string]interface{}{"frame": hex.EncodeToString(frame)}, err)
+			continue
+		}
+
+		if pkt.Protocol == GT06Login {
+			imei, err = pkt.IMEI()
+			if err != nil {
+				log.Printf("gt06: %s: %v", conn.RemoteAddr(), err)
+				return
+			}
+			target, err = s.Service.ResolveByDataSourceType(ProtocolGT06, imei)
+			// login ulang dengan IMEI lain: session command device sebelumnya dilepas
+			if sess != nil && (target == nil || sess.deviceID != target.Device.ID) {
+				s.Service.Commands.detach(sess)
+				sess = nil
+			}
+			if errors.Is(err, ErrUnknownDevice) && s.Service.AcceptUnknown {
+				log.Printf("gt06: IMEI %s belum terdaftar, paket ditahan di dead-letter", imei)
+				if _, err := conn.Write(GT06Response(GT06Login, pkt.Serial)); err != nil {
+					return
+				}
+				unknown = true
+				continue
+			}
+			if err != nil {
+				log.Printf("gt06: IMEI %s ditolak: %v", imei, err)
+				return
+			}
+			if _, err := conn.Write(GT06Response(GT06Login, pkt.Serial)); err != nil {
+				return
+			}
+			s.seen(target, imei)
+			if sess == nil {
+				sess = s.Service.Commands.attach(target.Device.ID, conn, gt06CommandEncoder())
+			}
+			continue
+		}
+
+		if target == nil && unknown {
+			if err := s.holdUnknown(conn, imei, pkt); err != nil {
+				return
+			}
+			continue
+		}
+		if target == nil {
+			log.Printf("gt06: %s: paket 0x%02x sebelum login, koneksi ditutup", conn.RemoteAddr(), pkt.Protocol)
+			return
+		}
+
+		switch pkt.Protocol {
+		case GT06Location, GT06LocationExt:
+			if err := s.storeLocation(target, imei, pkt); err != nil {
+				return
+			}
+		case GT06Alarm:
+			if err := s.storeLocation(target, imei, pkt); err != nil {
+				return
+			}
+			if _, err := sess.Write(GT06Response(GT06Alarm, pkt.Serial)); err != nil {
+				return
+			}
+		case GT06Heartbeat:
+			if _, err := sess.Write(GT06Response(GT06Heartbeat, pkt.Serial)); err != nil {
+				return
+			}
+			s.seen(target, imei)
+		case GT06CommandReply:
+			flag, text, err := pkt.CommandReply()
+			if err != nil {
+				log.Printf("gt06: IMEI %s: %v", imei, err)
+				continue
+			}
+			id := int64(flag)
+			s.Service.Commands.ack(target.Device.ID, &id, text)
+		default:
+			log.Printf("gt06: IMEI %s: protocol 0x%02x belum didukung", imei, pkt.Protocol)
+		}
+	}
+}
+
+// gt06CommandEncoder encoder command per koneksi dengan serial number sendiri
+// (dipanggil di bawah lock session)
+func gt06CommandEncoder() func(cmd *command.DeviceCommand) []byte {
+	var serial uint16
+	return func(cmd *command.DeviceCommand) []byte {
+		serial++
+		return GT06CommandPacket(uint32(cmd.ID), cmd.Text, serial)
+	}
+}
+
+// holdUnknown tahan paket lokasi/alarm dari IMEI yang belum terdaftar, heartbeat & alarm tetap dibalas
+func (s *GT06Server) holdUnknown(conn net.Conn, imei string, pkt *GT06Packet) error {
+	switch pkt.Protocol {
+	case GT06Location, GT06LocationExt, GT06Alarm:
+		payload := map[string]interface{}{"frame": hex.EncodeToString(pkt.Frame)}
+		loc, err := pkt.Location()
+		if err != nil {
+			s.Service.HoldUnparsable(ProtocolGT06, imei, payload, err)
+		} else {
+			fix := loc.Fix(pkt)
+			fix.Raw["imei"] = imei
+			s.Service.HoldUnknown(ProtocolGT06, "", imei, []Fix{fix}, payload)
+		}
+		if pkt.Protocol == GT06Alarm {
+			_, err := conn.Write(GT06Response(GT06Alarm, pkt.Serial))
+			return err
+		}
+	case GT06Heartbeat:
+		_, err := conn.Write(GT06Response(GT06Heartbeat, pkt.Serial))
+		return err
+	}
+	return nil
+}
+
+// seen catat login / heartbeat sebagai kontak device
+func (s *GT06Server) seen(target *Target, imei string) {
+	if err := s.Service.Seen(target.Device.ID, ProtocolGT06); err != nil {
+		log.Printf("gt06: IMEI %s: gagal mencatat last seen: %v", imei, err)
+	}
+}
+
+// storeLocation simpan fix dari paket lokasi/alarm, alarm yang dikenal dijadikan row alerts.
+// Alarm yang dikirim ulang (ACK hilang) tersimpan sebagai duplikat dan tidak membuat alert lagi.
+func (s *GT06Server) storeLocation(target *Target, imei string, pkt *GT06Packet) error {
+	loc, err := pkt.Location()
+	if err != nil {
+		log.Printf("gt06: IMEI %s: %v", imei, err)
+		s.Service.HoldUnparsable(ProtocolGT06, imei, map[string]interface{}{"frame": hex.EncodeToString(pkt.Frame)}, err)
+		return nil
+	}
+
+	fix := loc.Fix(pkt)
+	fix.Raw["imei"] = imei
+	res, err := s.Service.Store(target, []Fix{fix})
+	if err != nil {
+		log.Printf("gt06: IMEI %s: gagal menyimpan posisi: %v", imei, err)
+		return err
+	}
+
+	if loc.Alarm == nil || res.Inserted == 0 {
+		return nil
+	}
+	code, ok := gt06AlarmTypes[*loc.Alarm]
+	if !ok {
+		return nil
+	}
+	deviceID := target.Device.ID
+	payload := map[string]interface{}{
+		"protocol": ProtocolGT06,
+		"alarm":    *loc.Alarm,
+		"lat":      loc.Lat,
+		"lon":      loc.Lon,
+		"frame":    hex.EncodeToString(pkt.Frame),
+	}
+	if _, err := alert.Raise(s.Service.DB, code, target.VehicleID, &deviceID, loc.TS, "alarm "+code+" dari device "+imei, payload); err != nil {
+		log.Printf("gt06: IMEI %s: gagal membuat alert %s: %v", imei, code, err)
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package ingest
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/pagination"
+)
+
+// Handler untuk endpoint ingestion telemetri
+type Handler struct {
+	DB      *gorm.DB
+	Service *Service
+}
+
+func NewHandler(db *gorm.DB) *Handler {
+	return &Handler{DB: db, Service: NewService(db)}
+}
+
+// NewHandlerWithService pakai Service bersama (misal yang sudah terpasang Pipeline)
+func NewHandlerWithService(svc *Service) *Handler {
+	return &Handler{DB: svc.DB, Service: svc}
+}
+
+// ========= DTO REQUEST & RESPONSE =========
+
+// PositionRequest = satu fix yang dikirim lewat HTTP, dikunci dengan data_sources.code + devices.external_id
+type PositionRequest struct {
+	DataSource string                 `json:"dataSource"`
+	ExternalID string                 `json:"externalId"`
+	TS         string                 `json:"ts"` // RFC3339
+	Lat        *float64               `json:"lat"`
+	Lon        *float64               `json:"lon"`
+	SpeedKph   *float64               `json:"speedKph,omitempty"`
+	HeadingDeg *float64               `json:"headingDeg,omitempty"`
+	AltitudeM  *float64               `json:"altitudeM,omitempty"`
+	IgnitionOn *bool                  `json:"ignitionOn,omitempty"`
+	OdometerKm *float64               `json:"odometerKm,omitempty"`
+	Raw        map[string]interface{} `json:"raw,omitempty"`
+}
+
+type IngestPositionsRequest struct {
+	Positions []PositionRequest `json:"positions"`
+}
+
+// RejectedPosition = fix yang ditolak, index merujuk ke urutan di request
+type RejectedPosition struct {
+	Index   int    `json:"index"`
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+type IngestPositionsResponse struct {
+	Inserted    int                `json:"inserted"`
+	Duplicates  int                `json:"duplicates"`
+	Late        int                `json:"late"`
+	Quarantined int                `json:"quarantined"`
+	Flagged     int                `json:"flagged"`
+	Dropped     int                `json:"dropped"`
+	Rejected    []RejectedPosition `json:"rejected"`
+}
+
+// ========= REGISTER ROUTES (HANYA UNTUK /admin GROUP) =========
+
+func (h *Handler) RegisterAdminRoutes(r gin.IRoutes) {
+	r.POST("/ingest/positions", h.IngestPositions)
+	r.POST("/ingest/import", h.ImportPositions)
+	r.GET("/ingest/pipeline", h.PipelineStatus)
+	r.GET("/ingest/quarantine", h.ListQuarantine)
+	r.GET("/ingest/unknown", h.ListUnknownDevices)
+	r.POST("/ingest/unknown/:externalId/provision", h.ProvisionUnknown)
+	r.GET("/ingest/dead-letters", h.ListDeadLetters)
+	r.GET("/ingest/clock-skew", h.ListClockSkew)
+}
+
+// IngestPositions menerima satu atau lebih fix lalu menulis ke position_log & vehicle_current_position.
+// Hanya SUPER_ADMIN (akun integrasi) yang boleh mengirim data.
+func (h *Handler) IngestPositions(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok || !cu.IsSuperAdmin() {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "forbidden",
+			"message": "hanya SUPER_ADMIN yang boleh mengirim data posisi",
+		})
+		return
+	}
+
+	var req IngestPositionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "body bukan JSON valid",
+		})
+		return
+	}
+
+	if len(req.Positions) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "positions wajib diisi minimal satu",
+		})
+		return
+	}
+
+	resp := IngestPositionsResponse{Rejected: []RejectedPosition{}}
+
+	// kelompokkan per device supaya resolve device cukup sekali
+	type group struct {
+		dataSource string
+		externalID string
+		indexes    []int
+		fixes      []Fix
+	}
+	var groups []*group
+	byKey := map[[2]string]*group{}
+
+	for i, p := range req.Positions {
+		fix, msg := p.toFix()
+		if msg != "" {
+			resp.Rejected = append(resp.Rejected, RejectedPosition{Index: i, Error: "invalid_fix", Message: msg})
+			continue
+		}
+
+		key := [2]string{p.DataSource, p.ExternalID}
+		g, found := byKey[key]
+		if !found {
+			g = &group{dataSource: p.DataSource, externalID: p.ExternalID}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.indexes = append(g.indexes, i)
+		g.fixes = append(g.fixes, fix)
+	}
+
+	for _, g := range groups {
+		target, err := h.Service.ResolveByDataSource(g.dataSource, g.externalID)
+		if err != nil {
+			code, status := resolveErrorCode(err)
+			if status == http.StatusInternalServerError {
+				c.JSON(status, gin.H{"error": code, "message": err.Error()})
+				return
+			}
+			if errors.Is(err, ErrUnknownDevice) {
+				h.Service.HoldUnknown(SeenSourceHTTP, g.dataSource, g.externalID, g.fixes, nil)
+			}
+			for _, idx := range g.indexes {
+				resp.Rejected = append(resp.Rejected, RejectedPosition{Index: idx, Error: code, Message: err.Error()})
+			}
+			continue
+		}
+
+		res, err := h.Service.Store(target, g.fixes)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+			return
+		}
+		resp.Inserted += res.Inserted
+		resp.Duplicates += res.Duplicates
+		resp.Late += res.Late
+		resp.Quarantined += res.Quarantined
+		resp.Flagged += res.Flagged
+		resp.Dropped += res.Dropped
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListQuarantine daftar fix yang dikarantina, filter opsional deviceId & reason
+func (h *Handler) ListQuarantine(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok || !cu.IsSuperAdmin() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "message": "hanya SUPER_ADMIN"})
+		return
+	}
+
+	query := h.DB.Model(&QuarantinedPosition{})
+	if v := c.Query("deviceId"); v != "" {
+		deviceID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "deviceId tidak valid"})
+			return
+		}
+		query = query.Where("device_id = ?", deviceID)
+	}
+	if v := c.Query("reason"); v != "" {
+		query = query.Where("reason = ?", v)
+	}
+
+	p := pagination.ParsePagination(c)
+	if c.IsAborted() {
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	var rows []QuarantinedPosition
+	if err := query.Order("id DESC").Limit(p.Limit).Offset(p.Offset).Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": rows, "pagination": gin.H{"total": total, "limit": p.Limit, "page": p.Page, "max_limit": p.MaxLimit}})
+}
+
+// toFix validasi field wajib & konversi ke Fix. msg != "" berarti fix tidak valid.
+func (p PositionRequest) toFix() (Fix, string) {
+	if p.DataSource == "" || p.ExternalID == "" {
+		return Fix{}, "dataSource dan externalId wajib diisi"
+	}
+	if p.Lat == nil || p.Lon == nil {
+		return Fix{}, "lat dan lon wajib diisi"
+	}
+	if *p.Lat < -90 || *p.Lat > 90 || *p.Lon < -180 || *p.Lon > 180 {
+		return Fix{}, "lat/lon di luar jangkauan"
+	}
+	ts, err := time.Parse(time.RFC3339, p.TS)
+	if err != nil {
+		return Fix{}, "ts wajib diisi dengan format RFC3339"
+	}
+
+	return Fix{
+		TS:         ts,
+		Lat:        *p.Lat,
+		Lon:        *p.Lon,
+		SpeedKph:   p.SpeedKph,
+		HeadingDeg: p.HeadingDeg,
+		AltitudeM:  p.AltitudeM,
+		IgnitionOn: p.IgnitionOn,
+		OdometerKm: p.OdometerKm,
+		Raw:        p.Raw,
+	}, ""
+}
+
+// resolveErrorCode memetakan error resolve device ke kode error API
+func resolveErrorCode(err error) (string, int) {
+	switch {
+	case errors.Is(err, ErrUnknownDevice):
+		return "unknown_device", http.StatusUnprocessableEntity
+	case errors.Is(err, ErrDeviceInactive):
+		return "device_inactive", http.StatusUnprocessableEntity
+	case errors.Is(err, ErrDeviceUnbound):
+		return "device_unbound", http.StatusUnprocessableEntity
+	default:
+		return "db_error", http.StatusInternalServerError
+	}
+}
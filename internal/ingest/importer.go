@@ -0,0 +1,435 @@
+package ingest
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/device"
+)
+
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+
+	// ProtocolImport ditulis di raw_payload.protocol untuk row hasil import historis
+	ProtocolImport = "IMPORT"
+
+	defaultImportBatchSize = 1000
+	defaultImportMaxErrors = 1000
+)
+
+// ErrInvalidImportFile file tidak bisa diproses sama sekali (format / header salah)
+var ErrInvalidImportFile = errors.New("file import tidak valid")
+
+// defaultImportColumns: nama field Fix -> nama kolom CSV / field NDJSON
+var defaultImportColumns = map[string]string{
+	"deviceId":   "device_id",
+	"ts":         "ts",
+	"lat":        "lat",
+	"lon":        "lon",
+	"speedKph":   "speed_kph",
+	"headingDeg": "heading_deg",
+	"altitudeM":  "altitude_m",
+	"ignitionOn": "ignition_on",
+	"odometerKm": "odometer_km",
+}
+
+// ImportOptions pengaturan satu kali import
+type ImportOptions struct {
+	Format string `json:"format"` // "csv" atau "ndjson"
+	// DataSource diisi = kolom deviceId berisi devices.external_id pada data source ini,
+	// kosong = kolom deviceId berisi devices.id
+	DataSource string            `json:"dataSource"`
+	Columns    map[string]string `json:"columns"`   // override defaultImportColumns
+	SpeedUnit  string            `json:"speedUnit"` // "kph" (default), "mps", "knots"
+	BatchSize  int               `json:"batchSize"`
+	MaxErrors  int               `json:"maxErrors"` // batas jumlah error yang dimuat di laporan
+}
+
+// ImportRowError = satu baris yang ditolak, line = nomor baris di file (header CSV = baris 1)
+type ImportRowError struct {
+	Line    int    `json:"line"`
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+type ImportReport struct {
+	Rows            int              `json:"rows"`
+	Inserted        int              `json:"inserted"`
+	Duplicates      int              `json:"duplicates"`
+	Quarantined     int              `json:"quarantined"`
+	Flagged         int              `json:"flagged"`
+	Dropped         int              `json:"dropped"`
+	Failed          int              `json:"failed"`
+	Errors          []ImportRowError `json:"errors"`
+	ErrorsTruncated bool             `json:"errorsTruncated"`
+}
+
+// Import membaca file CSV / NDJSON secara streaming lalu menulis ke position_log per batch.
+// Duplikat (device_id, ts) dilewati dan vehicle_current_position tidak pernah mundur.
+// Error per baris masuk laporan; error database menghentikan import.
+func (s *Service) Import(r io.Reader, opts ImportOptions) (*ImportReport, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultImportBatchSize
+	}
+	if opts.MaxErrors <= 0 {
+		opts.MaxErrors = defaultImportMaxErrors
+	}
+
+	mapping := map[string]string{}
+	for k, v := range defaultImportColumns {
+		mapping[k] = v
+	}
+	for k, v := range opts.Columns {
+		if _, known := defaultImportColumns[k]; !known {
+			return nil, fmt.Errorf("%w: kolom %s tidak dikenal", ErrInvalidImportFile, k)
+		}
+		mapping[k] = v
+	}
+
+	im := &importer{
+		svc:     s,
+		opts:    opts,
+		mapping: mapping,
+		report:  &ImportReport{Errors: []ImportRowError{}},
+		devices: map[string]*importDevice{},
+	}
+
+	var err error
+	switch strings.ToLower(opts.Format) {
+	case ImportFormatCSV:
+		err = im.readCSV(r)
+	case ImportFormatNDJSON, "jsonl":
+		err = im.readNDJSON(r)
+	default:
+		return nil, fmt.Errorf("%w: format %q tidak didukung (csv / ndjson)", ErrInvalidImportFile, opts.Format)
+	}
+	if errors.Is(err, ErrInvalidImportFile) {
+		return nil, err
+	}
+	if err == nil {
+		err = im.flush()
+	}
+	return im.report, err
+}
+
+type importer struct {
+	svc     *Service
+	opts    ImportOptions
+	mapping map[string]string
+	report  *ImportReport
+	devices map[string]*importDevice
+	batch   []batchItem
+}
+
+// importDevice cache device beserta seluruh riwayat mapping vehicle-nya
+type importDevice struct {
+	dev      device.Device
+	mappings []device.VehicleDevice
+	err      error
+}
+
+func (im *importer) readCSV(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("%w: file CSV kosong", ErrInvalidImportFile)
+		}
+		return fmt.Errorf("%w: header CSV tidak valid: %v", ErrInvalidImportFile, err)
+	}
+	cols := make([]string, len(header))
+	for i, h := range header {
+		cols[i] = strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))
+	}
+
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var pe *csv.ParseError
+			if errors.As(err, &pe) {
+				im.report.Rows++
+				im.reject(pe.StartLine, "invalid_row", pe.Err.Error())
+				continue
+			}
+			return err
+		}
+		line, _ := cr.FieldPos(0)
+
+		doc := make(map[string]interface{}, len(cols))
+		for i, v := range rec {
+			if v = strings.TrimSpace(v); v != "" {
+				doc[cols[i]] = v
+			}
+		}
+		if err := im.row(line, doc); err != nil {
+			return err
+		}
+	}
+}
+
+func (im *importer) readNDJSON(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal([]byte(text), &doc); err != nil {
+			im.report.Rows++
+			im.reject(line, "invalid_row", "baris bukan JSON object")
+			continue
+		}
+		if err := im.row(line, doc); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// row validasi satu baris lalu masukkan ke batch. Error yang dikembalikan hanya error database.
+func (im *importer) row(line int, doc map[string]interface{}) error {
+	im.report.Rows++
+
+	rawKey, _ := lookupPath(doc, im.mapping["deviceId"])
+	key := importKey(rawKey)
+	if key == "" {
+		im.reject(line, "invalid_row", "kolom "+im.mapping["deviceId"]+" wajib diisi")
+		return nil
+	}
+	if _, found := lookupPath(doc, im.mapping["ts"]); !found {
+		im.reject(line, "invalid_row", "kolom "+im.mapping["ts"]+" wajib diisi")
+		return nil
+	}
+	fix, err := decodeMappedFix(doc, im.mapping, im.opts.SpeedUnit)
+	if err != nil {
+		im.reject(line, "invalid_row", err.Error())
+		return nil
+	}
+
+	d, err := im.device(key)
+	if err != nil {
+		return err
+	}
+	if d.err != nil {
+		code, _ := resolveErrorCode(d.err)
+		im.reject(line, code, d.err.Error())
+		return nil
+	}
+	vehicleID, ok := d.vehicleAt(fix.TS)
+	if !ok {
+		im.reject(line, "device_unbound", ErrDeviceUnbound.Error())
+		return nil
+	}
+
+	fix.Raw = map[string]interface{}{
+		"protocol": ProtocolImport,
+		"format":   strings.ToLower(im.opts.Format),
+		"payload":  doc,
+	}
+	im.batch = append(im.batch, batchItem{
+		Target: &Target{Device: d.dev, VehicleID: vehicleID},
+		Fixes:  []Fix{fix},
+	})
+
+	if len(im.batch) >= im.opts.BatchSize {
+		return im.flush()
+	}
+	return nil
+}
+
+// flush tulis batch dengan multi-row insert (posisi terkini tidak pernah mundur)
+func (im *importer) flush() error {
+	if len(im.batch) == 0 {
+		return nil
+	}
+
+	results, err := im.svc.storeBatch(im.batch)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		im.report.Inserted += r.Inserted
+		im.report.Duplicates += r.Duplicates
+		im.report.Quarantined += r.Quarantined
+		im.report.Flagged += r.Flagged
+		im.report.Dropped += r.Dropped
+	}
+
+	im.batch = im.batch[:0]
+	return nil
+}
+
+func (im *importer) reject(line int, code, msg string) {
+	im.report.Failed++
+	if len(im.report.Errors) >= im.opts.MaxErrors {
+		im.report.ErrorsTruncated = true
+		return
+	}
+	im.report.Errors = append(im.report.Errors, ImportRowError{Line: line, Error: code, Message: msg})
+}
+
+// device resolve device sekali per key (hasil, termasuk error bisnis, di-cache)
+func (im *importer) device(key string) (*importDevice, error) {
+	if d, ok := im.devices[key]; ok {
+		return d, nil
+	}
+
+	d := &importDevice{}
+	var err error
+	if im.opts.DataSource != "" {
+		err = im.svc.DB.Table("devices d").
+			Select("d.*").
+			Joins("JOIN data_sources ds ON ds.id = d.data_source_id").
+			Where("ds.code = ? AND d.external_id = ?", im.opts.DataSource, key).
+			Take(&d.dev).Error
+	} else if id, perr := strconv.ParseInt(key, 10, 64); perr == nil {
+		err = im.svc.DB.Take(&d.dev, id).Error
+	} else {
+		err = gorm.ErrRecordNotFound
+	}
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		d.err = ErrUnknownDevice
+	case err != nil:
+		return nil, err
+	case !d.dev.Active:
+		d.err = ErrDeviceInactive
+	default:
+		if err := im.svc.DB.Where("device_id = ?", d.dev.ID).
+			Order("assigned_at DESC").
+			Find(&d.mappings).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	im.devices[key] = d
+	return d, nil
+}
+
+// vehicleAt cari kendaraan yang terikat ke device pada waktu ts.
+// Bila tidak ada mapping yang mencakup ts (riwayat sebelum device didaftarkan), pakai mapping aktif.
+func (d *importDevice) vehicleAt(ts time.Time) (int64, bool) {
+	for _, m := range d.mappings {
+		if !m.AssignedAt.After(ts) && (m.UnassignedAt == nil || m.UnassignedAt.After(ts)) {
+			return m.VehicleID, true
+		}
+	}
+	for _, m := range d.mappings {
+		if m.Active {
+			return m.VehicleID, true
+		}
+	}
+	return 0, false
+}
+
+// importKey ubah nilai kolom device ke string (angka besar seperti IMEI tidak boleh jadi notasi eksponen)
+func importKey(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// ========= HANDLER =========
+
+// ImportPositions upload file riwayat posisi (multipart field "file").
+// Form field opsional: format, dataSource, columns (JSON object), speedUnit, batchSize.
+func (h *Handler) ImportPositions(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok || !cu.IsSuperAdmin() {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "forbidden",
+			"message": "hanya SUPER_ADMIN yang boleh mengimport data posisi",
+		})
+		return
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "file wajib diupload"})
+		return
+	}
+
+	opts := ImportOptions{
+		Format:     c.PostForm("format"),
+		DataSource: c.PostForm("dataSource"),
+		SpeedUnit:  c.PostForm("speedUnit"),
+	}
+	if opts.Format == "" {
+		opts.Format = ImportFormatFromFilename(fh.Filename)
+	}
+	if v := c.PostForm("columns"); v != "" {
+		if err := json.Unmarshal([]byte(v), &opts.Columns); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "columns harus JSON object"})
+			return
+		}
+	}
+	if v := c.PostForm("batchSize"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "batchSize harus angka positif"})
+			return
+		}
+		opts.BatchSize = n
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "file tidak bisa dibaca"})
+		return
+	}
+	defer f.Close()
+
+	report, err := h.Service.Import(f, opts)
+	if errors.Is(err, ErrInvalidImportFile) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		// batch sebelumnya sudah tersimpan, laporan tetap dikirim
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "import_failed", "message": err.Error(), "report": report})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ImportFormatFromFilename tebak format dari ekstensi file (default csv)
+func ImportFormatFromFilename(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".ndjson", ".jsonl", ".json":
+		return ImportFormatNDJSON
+	}
+	return ImportFormatCSV
+}
@@ -0,0 +1,116 @@
+package ingest
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// Model GORM untuk tabel position_log
+type PositionLog struct {
+	ID         int64             `json:"id"                   gorm:"column:id;primaryKey"`
+	VehicleID  int64             `json:"vehicleId"            gorm:"column:vehicle_id"`
+	DeviceID   int64             `json:"deviceId"             gorm:"column:device_id;uniqueIndex:uq_device_ts"`
+	TS         time.Time         `json:"ts"                   gorm:"column:ts;uniqueIndex:uq_device_ts"`
+	Lat        float64           `json:"lat"                  gorm:"column:lat"`
+	Lon        float64           `json:"lon"                  gorm:"column:lon"`
+	SpeedKph   *float64          `json:"speedKph,omitempty"   gorm:"column:speed_kph"`
+	HeadingDeg *float64          `json:"headingDeg,omitempty" gorm:"column:heading_deg"`
+	AltitudeM  *float64          `json:"altitudeM,omitempty"  gorm:"column:altitude_m"`
+	IgnitionOn *bool             `json:"ignitionOn,omitempty" gorm:"column:ignition_on"`
+	OdometerKm *float64          `json:"odometerKm,omitempty" gorm:"column:odometer_km"`
+	RawPayload datatypes.JSONMap `json:"rawPayload,omitempty" gorm:"column:raw_payload"`
+	Quality    string            `json:"quality"              gorm:"column:quality;default:GOOD"`
+	CreatedAt  time.Time         `json:"createdAt"            gorm:"column:created_at"`
+}
+
+func (PositionLog) TableName() string {
+	return "position_log"
+}
+
+// Fix = satu titik posisi yang sudah di-decode dari protokol mana pun,
+// belum terikat ke vehicle/device tertentu.
+type Fix struct {
+	TS         time.Time              `json:"ts"`
+	Lat        float64                `json:"lat"`
+	Lon        float64                `json:"lon"`
+	SpeedKph   *float64               `json:"speedKph,omitempty"`
+	HeadingDeg *float64               `json:"headingDeg,omitempty"`
+	AltitudeM  *float64               `json:"altitudeM,omitempty"`
+	IgnitionOn *bool                  `json:"ignitionOn,omitempty"`
+	OdometerKm *float64               `json:"odometerKm,omitempty"`
+	Raw        map[string]interface{} `json:"raw,omitempty"`
+	Quality    string                 `json:"quality,omitempty"` // diisi QualityFilter saat disimpan
+
+	// History fix dari buffer / riwayat device (re-upload, pull connector), bukan posisi live.
+	// Tidak dipakai sebagai sampel ClockSkewFilter.
+	History bool `json:"history,omitempty"`
+
+	// ReceivedAt waktu paket diterima server bila bukan saat Store dipanggil (replay dead-letter),
+	// dipakai ClockSkewFilter
+	ReceivedAt *time.Time `json:"-"`
+}
+
+// Model GORM untuk tabel connector_states (cursor pull connector per data source)
+type ConnectorState struct {
+	DataSourceID  int64      `json:"dataSourceId"  gorm:"column:data_source_id;primaryKey;autoIncrement:false"`
+	Cursor        string     `json:"cursor"        gorm:"column:cursor"`
+	LastPolledAt  *time.Time `json:"lastPolledAt"  gorm:"column:last_polled_at"`
+	LastSuccessAt *time.Time `json:"lastSuccessAt" gorm:"column:last_success_at"`
+	LastError     *string    `json:"lastError"     gorm:"column:last_error"`
+	UpdatedAt     time.Time  `json:"updatedAt"     gorm:"column:updated_at"`
+}
+
+func (ConnectorState) TableName() string {
+	return "connector_states"
+}
+
+// Alasan karantina fix
+const QuarantineFutureTS = "FUTURE_TS"
+
+// Model GORM untuk tabel position_quarantine: fix yang ditahan karena ts tidak masuk akal
+type QuarantinedPosition struct {
+	ID         int64             `json:"id"                   gorm:"column:id;primaryKey"`
+	VehicleID  int64             `json:"vehicleId"            gorm:"column:vehicle_id"`
+	DeviceID   int64             `json:"deviceId"             gorm:"column:device_id"`
+	TS         time.Time         `json:"ts"                   gorm:"column:ts"`
+	Lat        float64           `json:"lat"                  gorm:"column:lat"`
+	Lon        float64           `json:"lon"                  gorm:"column:lon"`
+	SpeedKph   *float64          `json:"speedKph,omitempty"   gorm:"column:speed_kph"`
+	HeadingDeg *float64          `json:"headingDeg,omitempty" gorm:"column:heading_deg"`
+	AltitudeM  *float64          `json:"altitudeM,omitempty"  gorm:"column:altitude_m"`
+	IgnitionOn *bool             `json:"ignitionOn,omitempty" gorm:"column:ignition_on"`
+	OdometerKm *float64          `json:"odometerKm,omitempty" gorm:"column:odometer_km"`
+	RawPayload datatypes.JSONMap `json:"rawPayload,omitempty" gorm:"column:raw_payload"`
+	Reason     string            `json:"reason"               gorm:"column:reason"`
+	CreatedAt  time.Time         `json:"createdAt"            gorm:"column:created_at"`
+}
+
+func (QuarantinedPosition) TableName() string {
+	return "position_quarantine"
+}
+
+// Alasan paket masuk dead-letter
+const (
+	DeadLetterUnknownDevice = "UNKNOWN_DEVICE" // external id belum ada di devices, fix hasil decode ditahan
+	DeadLetterUnparsable    = "UNPARSABLE"     // paket tidak bisa di-decode
+)
+
+// Model GORM untuk tabel ingest_dead_letters: paket yang tidak bisa masuk position_log
+type DeadLetter struct {
+	ID             int64             `json:"id"                       gorm:"column:id;primaryKey"`
+	Reason         string            `json:"reason"                   gorm:"column:reason"`
+	Protocol       string            `json:"protocol"                 gorm:"column:protocol"`
+	DataSourceCode string            `json:"dataSourceCode,omitempty" gorm:"column:data_source_code"` // hanya untuk sumber yang dikunci data source (HTTP, MQTT, API)
+	ExternalID     string            `json:"externalId"               gorm:"column:external_id"`
+	Payload        datatypes.JSONMap `json:"payload,omitempty"        gorm:"column:payload"` // bentuk mentah (frame hex, parameter, pesan)
+	Fixes          datatypes.JSON    `json:"fixes,omitempty"          gorm:"column:fixes"`   // []Fix hasil decode, dipakai saat replay
+	Error          *string           `json:"error,omitempty"          gorm:"column:error"`
+	DeviceID       *int64            `json:"deviceId,omitempty"       gorm:"column:device_id"` // diisi saat device di-provision
+	ReceivedAt     time.Time         `json:"receivedAt"               gorm:"column:received_at"`
+	ReplayedAt     *time.Time        `json:"replayedAt,omitempty"     gorm:"column:replayed_at"`
+}
+
+func (DeadLetter) TableName() string {
+	return "ingest_dead_letters"
+}
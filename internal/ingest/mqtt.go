@@ -0,0 +1,440 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/username/fms-api/internal/device"
+)
+
+const (
+	DataSourceTypeMQTT = "MQTT"
+
+	// pola topic default, {dataSource} = data_sources.code, {externalId} = devices.external_id
+	DefaultMQTTTopicPattern = "fleet/{dataSource}/{externalId}/position"
+)
+
+// defaultMQTTFieldMapping: nama field Fix -> path field di payload JSON (juga default connector API)
+var defaultMQTTFieldMapping = map[string]string{
+	"ts":         "ts",
+	"lat":        "lat",
+	"lon":        "lon",
+	"speedKph":   "speed",
+	"headingDeg": "heading",
+	"altitudeM":  "altitude",
+	"ignitionOn": "ignition",
+	"odometerKm": "odometer",
+}
+
+// MQTTConfig dibaca dari data_sources.config untuk data source bertipe MQTT
+type MQTTConfig struct {
+	BrokerURL    string            `json:"brokerUrl"`
+	TopicPattern string            `json:"topicPattern"`
+	ClientID     string            `json:"clientId"`
+	Username     string            `json:"username"`
+	Password     string            `json:"password"`
+	QoS          byte              `json:"qos"`
+	FieldMapping map[string]string `json:"fieldMapping"` // path boleh pakai titik, misal "gps.lat"
+	SpeedUnit    string            `json:"speedUnit"`    // "kph" (default), "mps", "knots"
+}
+
+// ParseMQTTConfig baca config data source lalu isi default yang kosong
+func ParseMQTTConfig(ds device.DataSource) (MQTTConfig, error) {
+	var cfg MQTTConfig
+	if ds.Config != nil {
+		b, err := json.Marshal(ds.Config)
+		if err != nil {
+			return cfg, err
+		}
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return cfg, fmt.Errorf("config MQTT data source %s tidak valid: %w", ds.Code, err)
+		}
+	}
+
+	if cfg.BrokerURL == "" {
+		cfg.BrokerURL = "tcp://localhost:1883"
+	}
+	if cfg.TopicPattern == "" {
+		cfg.TopicPattern = DefaultMQTTTopicPattern
+	}
+	if !strings.Contains(cfg.TopicPattern, "{externalId}") {
+		return cfg, fmt.Errorf("topicPattern data source %s wajib mengandung {externalId}", ds.Code)
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "fms-api-" + ds.Code
+	}
+	if cfg.QoS > 2 {
+		cfg.QoS = 1
+	}
+
+	cfg.FieldMapping = mergeFieldMapping(cfg.FieldMapping)
+
+	return cfg, nil
+}
+
+// SubscribeTopic topic filter MQTT untuk satu data source ({externalId} jadi wildcard +)
+func (cfg MQTTConfig) SubscribeTopic(dataSourceCode string) string {
+	t := strings.ReplaceAll(cfg.TopicPattern, "{dataSource}", dataSourceCode)
+	return strings.ReplaceAll(t, "{externalId}", "+")
+}
+
+// MatchTopic cocokkan topic dengan pola, return data source code & external id
+func (cfg MQTTConfig) MatchTopic(topic string) (dataSourceCode, externalID string, ok bool) {
+	pattern := strings.Split(cfg.TopicPattern, "/")
+	parts := strings.Split(topic, "/")
+	if len(pattern) != len(parts) {
+		return "", "", false
+	}
+	for i, seg := range pattern {
+		switch seg {
+		case "{dataSource}":
+			dataSourceCode = parts[i]
+		case "{externalId}":
+			externalID = parts[i]
+		default:
+			if seg != parts[i] {
+				return "", "", false
+			}
+		}
+	}
+	return dataSourceCode, externalID, externalID != ""
+}
+
+// DecodePayload ubah payload JSON menjadi Fix sesuai field mapping
+func (cfg MQTTConfig) DecodePayload(payload []byte) (Fix, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return Fix{}, errors.New("payload bukan JSON object")
+	}
+
+	f, err := decodeMappedFix(doc, cfg.FieldMapping, cfg.SpeedUnit)
+	if err != nil {
+		return f, err
+	}
+	f.Raw = map[string]interface{}{
+		"protocol": DataSourceTypeMQTT,
+		"payload":  doc,
+	}
+	return f, nil
+}
+
+// mergeFieldMapping gabungkan mapping default dengan override dari config
+func mergeFieldMapping(override map[string]string) map[string]string {
+	mapping := map[string]string{}
+	for k, v := range defaultMQTTFieldMapping {
+		mapping[k] = v
+	}
+	for k, v := range override {
+		mapping[k] = v
+	}
+	return mapping
+}
+
+// decodeMappedFix ambil field Fix dari dokumen JSON sesuai mapping (dipakai MQTT & connector API)
+func decodeMappedFix(doc map[string]interface{}, mapping map[string]string, speedUnit string) (Fix, error) {
+	var f Fix
+
+	lat, okLat := lookupFloat(doc, mapping["lat"])
+	lon, okLon := lookupFloat(doc, mapping["lon"])
+	if !okLat || !okLon {
+		return f, errors.New("lat/lon tidak ditemukan di payload")
+	}
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return f, errors.New("lat/lon di luar jangkauan")
+	}
+	f.Lat, f.Lon = lat, lon
+
+	f.TS = time.Now().UTC()
+	if v, found := lookupPath(doc, mapping["ts"]); found {
+		ts, err := parseAnyTimestamp(v)
+		if err != nil {
+			return f, err
+		}
+		f.TS = ts
+	}
+
+	if v, ok := lookupFloat(doc, mapping["speedKph"]); ok {
+		switch strings.ToLower(speedUnit) {
+		case "mps":
+			v *= 3.6
+		case "knots":
+			v *= knotToKph
+		}
+		f.SpeedKph = &v
+	}
+	if v, ok := lookupFloat(doc, mapping["headingDeg"]); ok {
+		f.HeadingDeg = &v
+	}
+	if v, ok := lookupFloat(doc, mapping["altitudeM"]); ok {
+		f.AltitudeM = &v
+	}
+	if v, ok := lookupFloat(doc, mapping["odometerKm"]); ok {
+		f.OdometerKm = &v
+	}
+	if v, found := lookupPath(doc, mapping["ignitionOn"]); found {
+		if on, ok := toBool(v); ok {
+			f.IgnitionOn = &on
+		}
+	}
+
+	return f, nil
+}
+
+// lookupPath ambil nilai dari dokumen JSON dengan path bertitik ("gps.lat")
+func lookupPath(doc map[string]interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return nil, false
+	}
+	var cur interface{} = doc
+	for _, key := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		cur, ok = m[key]
+		if !ok || cur == nil {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func lookupFloat(doc map[string]interface{}, path string) (float64, bool) {
+	v, found := lookupPath(doc, path)
+	if !found {
+		return 0, false
+	}
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case string:
+		f, err := strconv.ParseFloat(x, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toBool(v interface{}) (bool, bool) {
+	switch x := v.(type) {
+	case bool:
+		return x, true
+	case float64:
+		return x != 0, true
+	case string:
+		b, err := strconv.ParseBool(x)
+		return b, err == nil
+	}
+	return false, false
+}
+
+// parseAnyTimestamp terima angka unix (detik / milidetik) atau string RFC3339
+func parseAnyTimestamp(v interface{}) (time.Time, error) {
+	switch x := v.(type) {
+	case float64:
+		if x > 1e12 {
+			return time.UnixMilli(int64(x)).UTC(), nil
+		}
+		return time.Unix(int64(x), 0).UTC(), nil
+	case string:
+		return parseOsmAndTimestamp(x)
+	}
+	return time.Time{}, errors.New("format timestamp tidak dikenali")
+}
+
+// ========= BACKOFF =========
+
+// Backoff exponential sederhana: Min, 2*Min, 4*Min ... maksimal Max
+type Backoff struct {
+	Min     time.Duration
+	Max     time.Duration
+	attempt int
+}
+
+func (b *Backoff) Next() time.Duration {
+	d := b.Min << b.attempt
+	if d <= 0 || d > b.Max {
+		d = b.Max
+	} else {
+		b.attempt++
+	}
+	return d
+}
+
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
+
+// ========= SUBSCRIBER =========
+
+// MQTTSubscriber satu koneksi broker untuk satu data source bertipe MQTT
+type MQTTSubscriber struct {
+	Source  device.DataSource
+	Config  MQTTConfig
+	Service *Service
+	Backoff Backoff
+}
+
+func NewMQTTSubscriber(ds device.DataSource, svc *Service) (*MQTTSubscriber, error) {
+	cfg, err := ParseMQTTConfig(ds)
+	if err != nil {
+		return nil, err
+	}
+	return &MQTTSubscriber{
+		Source:  ds,
+		Config:  cfg,
+		Service: svc,
+		Backoff: Backoff{Min: time.Second, Max: time.Minute},
+	}, nil
+}
+
+// HandleMessage proses satu pesan: topic -> device, payload -> Fix, lalu simpan
+func (s *MQTTSubscriber) HandleMessage(topic string, payload []byte) error {
+	code, externalID, ok := s.Config.MatchTopic(topic)
+	if !ok {
+		return fmt.Errorf("topic %s tidak sesuai pola %s", topic, s.Config.TopicPattern)
+	}
+	if code == "" {
+		code = s.Source.Code
+	}
+	if code != s.Source.Code {
+		return fmt.Errorf("topic %s bukan milik data source %s", topic, s.Source.Code)
+	}
+
+	fix, err := s.Config.DecodePayload(payload)
+	if err != nil {
+		s.Service.HoldUnparsable(DataSourceTypeMQTT, externalID, mqttPayload(topic, payload), err)
+		return err
+	}
+	fix.Raw["topic"] = topic
+
+	target, err := s.Service.ResolveByDataSource(code, externalID)
+	if errors.Is(err, ErrUnknownDevice) {
+		s.Service.HoldUnknown(DataSourceTypeMQTT, code, externalID, []Fix{fix}, mqttPayload(topic, payload))
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.Service.Store(target, []Fix{fix})
+	return err
+}
+
+// mqttPayload payload dead-letter: topic + isi pesan (JSON bila valid, selain itu string)
+func mqttPayload(topic string, payload []byte) map[string]interface{} {
+	var msg interface{}
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		msg = string(payload)
+	}
+	return map[string]interface{}{"topic": topic, "message": msg}
+}
+
+// Run connect ke broker & subscribe; kalau koneksi gagal / putus, coba lagi dengan backoff.
+// Berhenti saat channel stop ditutup.
+func (s *MQTTSubscriber) Run(stop <-chan struct{}) {
+	lost := make(chan error, 1)
+	opts := mqtt.NewClientOptions().
+		AddBroker(s.Config.BrokerURL).
+		SetClientID(s.Config.ClientID).
+		SetUsername(s.Config.Username).
+		SetPassword(s.Config.Password).
+		SetCleanSession(true).
+		SetAutoReconnect(false).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			select {
+			case lost <- err:
+			default:
+			}
+		})
+
+	topic := s.Config.SubscribeTopic(s.Source.Code)
+	handler := func(_ mqtt.Client, msg mqtt.Message) {
+		if err := s.HandleMessage(msg.Topic(), msg.Payload()); err != nil {
+			log.Printf("mqtt %s: pesan di %s ditolak: %v", s.Source.Code, msg.Topic(), err)
+		}
+	}
+
+	for {
+		client := mqtt.NewClient(opts)
+		err := waitToken(client.Connect())
+		if err == nil {
+			err = waitToken(client.Subscribe(topic, s.Config.QoS, handler))
+			if err != nil {
+				client.Disconnect(250)
+			}
+		}
+
+		if err == nil {
+			log.Printf("mqtt %s: terhubung ke %s, subscribe %s", s.Source.Code, s.Config.BrokerURL, topic)
+			s.Backoff.Reset()
+			select {
+			case <-stop:
+				client.Disconnect(250)
+				return
+			case err = <-lost:
+			}
+		}
+
+		wait := s.Backoff.Next()
+		log.Printf("mqtt %s: koneksi gagal/putus (%v), coba lagi dalam %s", s.Source.Code, err, wait)
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func waitToken(t mqtt.Token) error {
+	if !t.WaitTimeout(30 * time.Second) {
+		return errors.New("timeout menunggu broker")
+	}
+	return t.Error()
+}
+
+// ========= MANAGER =========
+
+// MQTTManager menjalankan satu subscriber per data source bertipe MQTT
+type MQTTManager struct {
+	Service *Service
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func NewMQTTManager(svc *Service) *MQTTManager {
+	return &MQTTManager{Service: svc, stop: make(chan struct{})}
+}
+
+// Start baca semua data source MQTT lalu jalankan subscriber-nya di background
+func (m *MQTTManager) Start() error {
+	var sources []device.DataSource
+	if err := m.Service.DB.Where("UPPER(type) = ?", DataSourceTypeMQTT).Order("id").Find(&sources).Error; err != nil {
+		return err
+	}
+
+	for _, ds := range sources {
+		sub, err := NewMQTTSubscriber(ds, m.Service)
+		if err != nil {
+			log.Printf("mqtt %s: dilewati: %v", ds.Code, err)
+			continue
+		}
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			sub.Run(m.stop)
+		}()
+	}
+	return nil
+}
+
+// Stop putuskan semua subscriber dan tunggu sampai selesai
+func (m *MQTTManager) Stop() {
+	close(m.stop)
+	m.wg.Wait()
+}
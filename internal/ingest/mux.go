@@ -0,0 +1,325 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/username/fms-api/internal/device"
+)
+
+// batas byte yang diintip untuk mengenali protokol teks (request line HTTP)
+const muxMaxTextPeek = 2048
+
+// metode HTTP yang dipakai OsmAnd / Traccar Client
+var muxHTTPMethods = []string{"GET ", "POST ", "HEAD "}
+
+var errMuxUnknown = errors.New("mux: handshake tidak dikenal")
+
+// MuxServer listener TCP bersama untuk beberapa protokol di satu port. Protokol dikenali dari
+// byte pertama koneksi lalu koneksi diteruskan utuh ke decoder yang sesuai:
+//   - 0x00 + panjang + IMEI ASCII  -> Teltonika
+//   - 0x7878 / 0x7979              -> GT06
+//   - request line HTTP (teks)      -> OsmAnd lewat HTTP
+type MuxServer struct {
+	Addr         string
+	Service      *Service
+	Teltonika    *TeltonikaServer
+	GT06         *GT06Server
+	HTTP         http.Handler // nil = koneksi teks ditolak
+	SniffTimeout time.Duration
+	IdleTimeout  time.Duration
+
+	tcpListener
+}
+
+func NewMuxServer(addr string, svc *Service) *MuxServer {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	NewHandlerWithService(svc).RegisterOsmAndRoutes(router.Group("/"))
+
+	return &MuxServer{
+		Addr:         addr,
+		Service:      svc,
+		Teltonika:    NewTeltonikaServer("", svc),
+		GT06:         NewGT06Server("", svc),
+		HTTP:         router,
+		SniffTimeout: 30 * time.Second,
+		IdleTimeout:  10 * time.Minute,
+	}
+}
+
+func (s *MuxServer) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+func (s *MuxServer) Serve(ln net.Listener) error {
+	return s.serve(ln, s.HandleConn)
+}
+
+// HandleConn kenali protokol, cocokkan dengan devices.protocol bila device dikenal, lalu serahkan koneksi
+func (s *MuxServer) HandleConn(conn net.Conn) {
+	r := bufio.NewReaderSize(conn, muxMaxTextPeek)
+	touchDeadline(conn, s.SniffTimeout)
+
+	protocol, externalID, err := sniff(r)
+	if err != nil {
+		head, _ := r.Peek(min(r.Buffered(), 64))
+		log.Printf("mux: %s: %v\n%s", conn.RemoteAddr(), err, hex.Dump(head))
+		conn.Close()
+		return
+	}
+
+	if externalID != "" {
+		registered, err := s.registeredProtocol(protocol, externalID)
+		if err != nil {
+			log.Printf("mux: %s: gagal mengecek protokol device %s: %v", conn.RemoteAddr(), externalID, err)
+			conn.Close()
+			return
+		}
+		if registered != "" {
+			log.Printf("mux: %s: device %s terdaftar dengan protokol %s tapi terdeteksi %s, koneksi ditutup",
+				conn.RemoteAddr(), externalID, registered, protocol)
+			conn.Close()
+			return
+		}
+	}
+
+	conn.SetReadDeadline(time.Time{})
+	sniffed := &sniffedConn{Conn: conn, r: r}
+	switch protocol {
+	case ProtocolTeltonika:
+		s.Teltonika.HandleConn(sniffed)
+	case ProtocolGT06:
+		s.GT06.HandleConn(sniffed)
+	case ProtocolOsmAnd:
+		s.serveHTTP(sniffed)
+	}
+}
+
+// registeredProtocol protokol device yang terdaftar bila TIDAK cocok dengan hasil deteksi ("" = cocok,
+// device belum dikenal, atau devices.protocol kosong). Device yang dicari lewat IMEI bisa ada di
+// beberapa data source, cukup salah satu yang cocok.
+func (s *MuxServer) registeredProtocol(detected, externalID string) (string, error) {
+	var devs []device.Device
+	if err := s.Service.DB.Select("id", "protocol").Where("external_id = ? AND active = ?", externalID, true).
+		Find(&devs).Error; err != nil {
+		return "", err
+	}
+	mismatch := ""
+	for _, d := range devs {
+		if d.Protocol == "" || strings.EqualFold(d.Protocol, detected) {
+			return "", nil
+		}
+		mismatch = d.Protocol
+	}
+	return mismatch, nil
+}
+
+// serveHTTP layani koneksi teks sebagai HTTP (OsmAnd), selesai saat koneksi ditutup
+func (s *MuxServer) serveHTTP(conn net.Conn) {
+	if s.HTTP == nil {
+		log.Printf("mux: %s: koneksi HTTP ditolak (handler tidak dipasang)", conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+	srv := &http.Server{Handler: s.HTTP, ReadHeaderTimeout: s.SniffTimeout, IdleTimeout: s.IdleTimeout}
+	srv.Serve(newSingleConnListener(conn))
+}
+
+// sniff intip byte pertama koneksi tanpa mengonsumsinya. Mengembalikan protokol + IMEI / id
+// device bila bisa dibaca dari handshake.
+func sniff(r *bufio.Reader) (protocol, externalID string, err error) {
+	head, err := r.Peek(2)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch {
+	case head[0] == 0x00 && head[1] > 0 && head[1] <= 32:
+		hs, err := r.Peek(2 + int(head[1]))
+		if err != nil {
+			return "", "", err
+		}
+		imei, err := ReadTeltonikaIMEI(bytes.NewReader(hs))
+		if err != nil {
+			return "", "", fmt.Errorf("%w: %v", errMuxUnknown, err)
+		}
+		return ProtocolTeltonika, imei, nil
+
+	case head[0] == 0x78 && head[1] == 0x78, head[0] == 0x79 && head[1] == 0x79:
+		return ProtocolGT06, peekGT06Login(r), nil
+
+	case isText(head):
+		line, err := peekLine(r)
+		if err != nil {
+			return "", "", err
+		}
+		for _, m := range muxHTTPMethods {
+			if strings.HasPrefix(line, m) {
+				return ProtocolOsmAnd, osmAndIDFromRequestLine(line), nil
+			}
+		}
+		return "", "", fmt.Errorf("%w: protokol teks %q", errMuxUnknown, truncate(line, 40))
+	}
+	return "", "", errMuxUnknown
+}
+
+// peekGT06Login IMEI dari frame pertama bila frame itu paket login ("" bila bukan / belum lengkap)
+func peekGT06Login(r *bufio.Reader) string {
+	lenSize := 1
+	if b, _ := r.Peek(1); len(b) == 1 && b[0] == 0x79 {
+		lenSize = 2
+	}
+	hdr, err := r.Peek(2 + lenSize)
+	if err != nil {
+		return ""
+	}
+	length := int(hdr[2])
+	if lenSize == 2 {
+		length = int(binary.BigEndian.Uint16(hdr[2:4]))
+	}
+	total := 2 + lenSize + length + 2
+	if total > r.Size() {
+		return ""
+	}
+	frame, err := r.Peek(total)
+	if err != nil {
+		return ""
+	}
+	pkt, err := DecodeGT06Frame(frame)
+	if err != nil || pkt.Protocol != GT06Login {
+		return ""
+	}
+	imei, _ := pkt.IMEI()
+	return imei
+}
+
+// peekLine intip satu baris teks (sampai \n) tanpa mengonsumsinya
+func peekLine(r *bufio.Reader) (string, error) {
+	n := max(r.Buffered(), 1)
+	for {
+		if n > muxMaxTextPeek {
+			return "", fmt.Errorf("%w: baris pertama lebih dari %d byte", errMuxUnknown, muxMaxTextPeek)
+		}
+		buf, err := r.Peek(n)
+		if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+			return strings.TrimRight(string(buf[:i]), "\r"), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		// cek semua yang sudah di-buffer dulu, baru tunggu byte berikutnya
+		if r.Buffered() > n {
+			n = r.Buffered()
+		} else {
+			n++
+		}
+	}
+}
+
+// osmAndIDFromRequestLine parameter id / deviceid dari query string request line
+func osmAndIDFromRequestLine(line string) string {
+	parts := strings.Fields(line)
+	if len(parts) < 2 {
+		return ""
+	}
+	u, err := url.ParseRequestURI(parts[1])
+	if err != nil {
+		return ""
+	}
+	q := u.Query()
+	if id := q.Get("id"); id != "" {
+		return id
+	}
+	return q.Get("deviceid")
+}
+
+func isText(b []byte) bool {
+	for _, ch := range b {
+		if ch < 0x20 || ch > 0x7E {
+			return false
+		}
+	}
+	return true
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// sniffedConn koneksi yang byte awalnya sudah diintip: baca lewat buffer dulu
+type sniffedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *sniffedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// singleConnListener net.Listener berisi satu koneksi, dipakai untuk menjalankan http.Server
+// pada koneksi hasil sniff. Accept kedua menunggu sampai koneksi itu ditutup.
+type singleConnListener struct {
+	conn net.Conn
+	once sync.Once
+	done chan struct{}
+	mu   sync.Mutex
+	used bool
+}
+
+func newSingleConnListener(conn net.Conn) *singleConnListener {
+	return &singleConnListener{conn: conn, done: make(chan struct{})}
+}
+
+func (l *singleConnListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	used := l.used
+	l.used = true
+	l.mu.Unlock()
+	if !used {
+		return &closeNotifyConn{Conn: l.conn, closed: l.Close}, nil
+	}
+	<-l.done
+	return nil, net.ErrClosed
+}
+
+func (l *singleConnListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *singleConnListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// closeNotifyConn beri tahu listener saat http.Server menutup koneksi
+type closeNotifyConn struct {
+	net.Conn
+	closed func() error
+}
+
+func (c *closeNotifyConn) Close() error {
+	err := c.Conn.Close()
+	c.closed()
+	return err
+}
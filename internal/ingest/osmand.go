@@ -0,0 +1,175 @@
+package ingest
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ProtocolOsmAnd = "OSMAND"
+
+// 1 knot = 1.852 km/h (OsmAnd / Traccar Client mengirim speed dalam knot)
+const knotToKph = 1.852
+
+// RegisterOsmAndRoutes daftarkan endpoint protokol OsmAnd.
+// Group ini TIDAK memakai JWT, device dikenali dari parameter id.
+func (h *Handler) RegisterOsmAndRoutes(r gin.IRoutes) {
+	r.GET("", h.OsmAnd)
+	r.POST("", h.OsmAnd)
+}
+
+// OsmAnd menerima satu fix format OsmAnd (?id=...&lat=...&lon=...&timestamp=...&speed=...)
+func (h *Handler) OsmAnd(c *gin.Context) {
+	// gabungkan query string & form body (Traccar Client bisa kirim keduanya)
+	if err := c.Request.ParseForm(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "parameter tidak valid"})
+		return
+	}
+	params := c.Request.Form
+
+	id := params.Get("id")
+	if id == "" {
+		id = params.Get("deviceid")
+	}
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "id wajib diisi"})
+		return
+	}
+
+	fix, err := ParseOsmAndFix(params)
+	if err != nil {
+		// endpoint tanpa autentikasi: paket rusak hanya ditahan bila AcceptUnknown
+		if h.Service.AcceptUnknown {
+			h.Service.HoldUnparsable(ProtocolOsmAnd, id, osmAndPayload(params), err)
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": err.Error()})
+		return
+	}
+
+	target, err := h.Service.ResolveByProtocol(ProtocolOsmAnd, id)
+	if errors.Is(err, ErrUnknownDevice) {
+		h.Service.HoldUnknown(ProtocolOsmAnd, "", id, []Fix{fix}, osmAndPayload(params))
+	}
+	if err != nil {
+		code, status := resolveErrorCode(err)
+		c.JSON(status, gin.H{"error": code, "message": err.Error()})
+		return
+	}
+
+	if _, err := h.Service.Store(target, []Fix{fix}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// ParseOsmAndFix konversi parameter OsmAnd ke Fix. Semua parameter asli disimpan di raw payload.
+func ParseOsmAndFix(params url.Values) (Fix, error) {
+	var f Fix
+
+	latStr, lonStr := params.Get("lat"), params.Get("lon")
+	if loc := params.Get("location"); loc != "" && (latStr == "" || lonStr == "") {
+		parts := strings.Split(loc, ",")
+		if len(parts) == 2 {
+			latStr, lonStr = parts[0], parts[1]
+		}
+	}
+	lat, err1 := strconv.ParseFloat(latStr, 64)
+	lon, err2 := strconv.ParseFloat(lonStr, 64)
+	if err1 != nil || err2 != nil {
+		return f, errors.New("lat dan lon wajib berupa angka")
+	}
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return f, errors.New("lat/lon di luar jangkauan")
+	}
+	f.Lat, f.Lon = lat, lon
+
+	ts, err := parseOsmAndTimestamp(params.Get("timestamp"))
+	if err != nil {
+		return f, err
+	}
+	f.TS = ts
+
+	if v, ok := optFloat(params, "speed"); ok {
+		kph := v * knotToKph
+		f.SpeedKph = &kph
+	}
+	if v, ok := optFloat(params, "bearing"); ok {
+		f.HeadingDeg = &v
+	} else if v, ok := optFloat(params, "heading"); ok {
+		f.HeadingDeg = &v
+	}
+	if v, ok := optFloat(params, "altitude"); ok {
+		f.AltitudeM = &v
+	}
+	if v := params.Get("ignition"); v != "" {
+		if on, err := strconv.ParseBool(v); err == nil {
+			f.IgnitionOn = &on
+		}
+	}
+	if v, ok := optFloat(params, "odometer"); ok {
+		km := v / 1000 // odometer OsmAnd dalam meter
+		f.OdometerKm = &km
+	}
+
+	f.Raw = map[string]interface{}{
+		"protocol": ProtocolOsmAnd,
+		"params":   osmAndQuery(params),
+	}
+	return f, nil
+}
+
+// osmAndQuery parameter OsmAnd (nilai pertama per key) dalam bentuk yang disimpan di raw payload
+func osmAndQuery(params url.Values) map[string]interface{} {
+	query := map[string]interface{}{}
+	for k, vs := range params {
+		if len(vs) > 0 {
+			query[k] = vs[0]
+		}
+	}
+	return query
+}
+
+// osmAndPayload payload dead-letter untuk request OsmAnd
+func osmAndPayload(params url.Values) map[string]interface{} {
+	return map[string]interface{}{"params": osmAndQuery(params)}
+}
+
+// parseOsmAndTimestamp menerima unix detik, unix milidetik, RFC3339 atau "yyyy-MM-dd HH:mm:ss" (UTC).
+// Kosong berarti waktu server.
+func parseOsmAndTimestamp(s string) (time.Time, error) {
+	if s == "" {
+		return time.Now().UTC(), nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n > 1e12 {
+			return time.UnixMilli(n).UTC(), nil
+		}
+		return time.Unix(n, 0).UTC(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse("2006-01-02 15:04:05", s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, errors.New("format timestamp tidak dikenali")
+}
+
+func optFloat(params url.Values, key string) (float64, bool) {
+	s := params.Get(key)
+	if s == "" {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
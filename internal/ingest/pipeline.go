@@ -0,0 +1,244 @@
+package ingest
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/username/fms-api/internal/auth"
+)
+
+// ErrPipelineClosed dikembalikan Store setelah pipeline dihentikan
+var ErrPipelineClosed = errors.New("pipeline ingestion sudah dihentikan")
+
+// PipelineConfig ukuran antrian & batch pipeline ingestion
+type PipelineConfig struct {
+	Workers       int           // jumlah worker penulis (default 4)
+	QueueSize     int           // kapasitas antrian per worker dalam item (default 1024)
+	BatchSize     int           // jumlah row maksimal per batch insert (default 500)
+	FlushInterval time.Duration // batas tunggu sebelum batch yang belum penuh ditulis (default 200ms)
+}
+
+// PipelineStats kondisi pipeline untuk monitoring
+type PipelineStats struct {
+	Workers       int   `json:"workers"`
+	QueueDepth    int   `json:"queueDepth"`    // item yang menunggu ditulis
+	QueueCapacity int   `json:"queueCapacity"` // total kapasitas antrian
+	Inserted      int64 `json:"inserted"`
+	Duplicates    int64 `json:"duplicates"`
+	Late          int64 `json:"late"`
+	Quarantined   int64 `json:"quarantined"`
+	Flagged       int64 `json:"flagged"`
+	Dropped       int64 `json:"dropped"`
+	Batches       int64 `json:"batches"`
+	Errors        int64 `json:"errors"` // batch yang gagal ditulis
+}
+
+// Pipeline mengantrikan fix dari listener lalu menulisnya per batch oleh beberapa worker.
+// Item dibagi ke worker berdasarkan vehicle_id sehingga urutan per kendaraan tetap terjaga.
+// Antrian yang penuh membuat Store menunggu (backpressure ke listener).
+type Pipeline struct {
+	Service *Service
+	cfg     PipelineConfig
+	queues  []chan *pipelineItem
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+
+	inserted   atomic.Int64
+	duplicates atomic.Int64
+	late       atomic.Int64
+	quarantine atomic.Int64
+	flagged    atomic.Int64
+	dropped    atomic.Int64
+	batches    atomic.Int64
+	failed     atomic.Int64
+}
+
+type pipelineItem struct {
+	batchItem
+	done chan pipelineResult
+}
+
+type pipelineResult struct {
+	res Result
+	err error
+}
+
+// NewPipeline buat pipeline dan langsung jalankan worker-nya
+func NewPipeline(svc *Service, cfg PipelineConfig) *Pipeline {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1024
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 200 * time.Millisecond
+	}
+
+	p := &Pipeline{Service: svc, cfg: cfg, queues: make([]chan *pipelineItem, cfg.Workers)}
+	for i := range p.queues {
+		p.queues[i] = make(chan *pipelineItem, cfg.QueueSize)
+		p.wg.Add(1)
+		go p.worker(p.queues[i])
+	}
+	return p
+}
+
+// Store masukkan fix ke antrian lalu tunggu sampai batch-nya ditulis.
+// Bila antrian worker penuh, pemanggil tertahan sampai ada ruang.
+func (p *Pipeline) Store(t *Target, fixes []Fix) (Result, error) {
+	if len(fixes) == 0 {
+		return Result{}, nil
+	}
+
+	it := &pipelineItem{
+		batchItem: batchItem{Target: t, Fixes: fixes},
+		done:      make(chan pipelineResult, 1),
+	}
+
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return Result{}, ErrPipelineClosed
+	}
+	p.queues[uint64(t.VehicleID)%uint64(len(p.queues))] <- it
+	p.mu.RUnlock()
+
+	r := <-it.done
+	return r.res, r.err
+}
+
+// QueueDepth jumlah item yang sedang menunggu di semua antrian
+func (p *Pipeline) QueueDepth() int {
+	n := 0
+	for _, q := range p.queues {
+		n += len(q)
+	}
+	return n
+}
+
+// Stats snapshot antrian & counter sejak pipeline dijalankan
+func (p *Pipeline) Stats() PipelineStats {
+	return PipelineStats{
+		Workers:       len(p.queues),
+		QueueDepth:    p.QueueDepth(),
+		QueueCapacity: len(p.queues) * p.cfg.QueueSize,
+		Inserted:      p.inserted.Load(),
+		Duplicates:    p.duplicates.Load(),
+		Late:          p.late.Load(),
+		Quarantined:   p.quarantine.Load(),
+		Flagged:       p.flagged.Load(),
+		Dropped:       p.dropped.Load(),
+		Batches:       p.batches.Load(),
+		Errors:        p.failed.Load(),
+	}
+}
+
+// Close tolak item baru, tulis semua yang masih di antrian, lalu tunggu worker selesai
+func (p *Pipeline) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	for _, q := range p.queues {
+		close(q)
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+func (p *Pipeline) worker(q chan *pipelineItem) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	var pending []*pipelineItem
+	rows := 0
+	flush := func() {
+		if len(pending) > 0 {
+			p.flush(pending)
+			pending, rows = nil, 0
+		}
+	}
+
+	for {
+		select {
+		case it, ok := <-q:
+			if !ok {
+				flush()
+				return
+			}
+			pending = append(pending, it)
+			rows += len(it.Fixes)
+			if rows >= p.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// flush tulis satu batch lalu kabari setiap pemanggil Store
+func (p *Pipeline) flush(pending []*pipelineItem) {
+	items := make([]batchItem, len(pending))
+	for i, it := range pending {
+		items[i] = it.batchItem
+	}
+
+	p.batches.Add(1)
+	results, err := p.Service.storeBatch(items)
+	if err != nil {
+		p.failed.Add(1)
+		log.Printf("pipeline: gagal menulis batch %d item: %v", len(items), err)
+		for _, it := range pending {
+			it.done <- pipelineResult{err: err}
+		}
+		return
+	}
+
+	for i, it := range pending {
+		p.inserted.Add(int64(results[i].Inserted))
+		p.duplicates.Add(int64(results[i].Duplicates))
+		p.late.Add(int64(results[i].Late))
+		p.quarantine.Add(int64(results[i].Quarantined))
+		p.flagged.Add(int64(results[i].Flagged))
+		p.dropped.Add(int64(results[i].Dropped))
+		it.done <- pipelineResult{res: results[i]}
+	}
+}
+
+// ========= HANDLER =========
+
+// PipelineStatus GET /admin/ingest/pipeline: kedalaman antrian & counter pipeline (SUPER_ADMIN)
+func (h *Handler) PipelineStatus(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok || !cu.IsSuperAdmin() {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "forbidden",
+			"message": "hanya SUPER_ADMIN yang boleh melihat status pipeline",
+		})
+		return
+	}
+
+	if h.Service.Pipeline == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": true, "stats": h.Service.Pipeline.Stats()})
+}
@@ -0,0 +1,250 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/alert"
+	"github.com/username/fms-api/internal/device"
+)
+
+const (
+	// AlertDeviceOffline kode alert_types saat device diam melewati jendela offline
+	AlertDeviceOffline = "DEVICE_OFFLINE"
+
+	// SeenSourceHTTP sumber untuk fix tanpa raw_payload.protocol (POST /admin/ingest/positions)
+	SeenSourceHTTP = "HTTP"
+
+	// DefaultOfflineAfter jendela diam default sebelum device dianggap offline
+	DefaultOfflineAfter = 30 * time.Minute
+
+	// key jendela offline (detik) di data_sources.config dan devices.metadata, metadata device menang
+	offlineAfterKey = "offlineAfterSeconds"
+)
+
+// deviceSeen kontak terakhir satu device di dalam batch
+type deviceSeen struct {
+	source  string
+	lastFix *time.Time
+}
+
+type deviceSeenSet map[int64]*deviceSeen
+
+// add catat kontak dari satu fix. Fix hasil import tidak dihitung karena bukan koneksi live;
+// hasFix = false untuk fix yang dikarantina / dibuang (device tetap terhitung terlihat).
+func (s deviceSeenSet) add(deviceID int64, f *Fix, hasFix bool) {
+	source, _ := f.Raw["protocol"].(string)
+	if source == ProtocolImport {
+		return
+	}
+	if source == "" {
+		source = SeenSourceHTTP
+	}
+
+	d, ok := s[deviceID]
+	if !ok {
+		d = &deviceSeen{}
+		s[deviceID] = d
+	}
+	d.source = source
+	if hasFix && (d.lastFix == nil || f.TS.After(*d.lastFix)) {
+		ts := f.TS.UTC()
+		d.lastFix = &ts
+	}
+}
+
+// markSeen perbarui last_seen_at / last_fix_at / last_source dan tandai device online lagi.
+// Device yang sebelumnya offline alert DEVICE_OFFLINE-nya di-clear.
+func markSeen(tx *gorm.DB, seen deviceSeenSet, now time.Time) error {
+	if len(seen) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	// device yang belum pernah terlihat juga online = false, tapi tidak mungkin punya alert offline
+	var offline []int64
+	if err := tx.Model(&device.Device{}).Where("id IN ? AND online = ? AND last_seen_at IS NOT NULL", ids, false).Pluck("id", &offline).Error; err != nil {
+		return err
+	}
+
+	for id, d := range seen {
+		updates := map[string]interface{}{
+			"last_seen_at": now,
+			"last_source":  d.source,
+			"online":       true,
+		}
+		if d.lastFix != nil {
+			// last_fix_at tidak pernah mundur karena fix terlambat
+			updates["last_fix_at"] = gorm.Expr("CASE WHEN last_fix_at IS NULL OR last_fix_at < ? THEN ? ELSE last_fix_at END", *d.lastFix, *d.lastFix)
+		}
+		if err := tx.Model(&device.Device{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(offline) == 0 {
+		return nil
+	}
+	return tx.Model(&alert.Alert{}).
+		Where("device_id IN ? AND status = ?", offline, "ACTIVE").
+		Where("alert_type_id IN (?)", tx.Model(&alert.AlertType{}).Select("id").Where("code = ?", AlertDeviceOffline)).
+		Updates(map[string]interface{}{"status": "CLEARED", "ended_at": now}).Error
+}
+
+// Seen catat kontak device tanpa fix (login, handshake, heartbeat)
+func (s *Service) Seen(deviceID int64, source string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		return markSeen(tx, deviceSeenSet{deviceID: {source: source}}, time.Now().UTC())
+	})
+}
+
+// ========= OFFLINE CHECKER =========
+
+// OfflineChecker berkala menandai device yang diam melewati jendela offline, lalu membuat
+// alert DEVICE_OFFLINE pada kendaraan yang sedang terikat. Jendela bisa diatur per data source
+// (config.offlineAfterSeconds) atau per device (metadata.offlineAfterSeconds).
+type OfflineChecker struct {
+	DB           *gorm.DB
+	Interval     time.Duration // default 1 menit
+	OfflineAfter time.Duration // jendela default, DefaultOfflineAfter bila 0
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewOfflineChecker(db *gorm.DB, offlineAfter time.Duration) *OfflineChecker {
+	return &OfflineChecker{DB: db, Interval: time.Minute, OfflineAfter: offlineAfter}
+}
+
+// CheckOnce tandai offline semua device yang diam lebih lama dari jendelanya per now.
+// Return jumlah device yang baru ditandai offline.
+func (c *OfflineChecker) CheckOnce(now time.Time) (int, error) {
+	var devices []device.Device
+	if err := c.DB.Where("active = ? AND online = ? AND last_seen_at IS NOT NULL", true, true).Find(&devices).Error; err != nil {
+		return 0, err
+	}
+	if len(devices) == 0 {
+		return 0, nil
+	}
+
+	var sources []device.DataSource
+	if err := c.DB.Find(&sources).Error; err != nil {
+		return 0, err
+	}
+	byID := make(map[int64]device.DataSource, len(sources))
+	for _, ds := range sources {
+		byID[ds.ID] = ds
+	}
+
+	marked := 0
+	for _, dev := range devices {
+		window := c.window(dev, byID[dev.DataSourceID])
+		if now.Sub(*dev.LastSeenAt) <= window {
+			continue
+		}
+
+		ok, err := c.markOffline(dev, window, now)
+		if err != nil {
+			return marked, err
+		}
+		if ok {
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+// window jendela offline device: metadata device > config data source > default checker
+func (c *OfflineChecker) window(dev device.Device, ds device.DataSource) time.Duration {
+	for _, doc := range []map[string]interface{}{dev.Metadata, ds.Config} {
+		if v, ok := anyFloat(doc[offlineAfterKey]); ok && v > 0 {
+			return time.Duration(v * float64(time.Second))
+		}
+	}
+	if c.OfflineAfter > 0 {
+		return c.OfflineAfter
+	}
+	return DefaultOfflineAfter
+}
+
+func (c *OfflineChecker) markOffline(dev device.Device, window time.Duration, now time.Time) (bool, error) {
+	marked := false
+	err := c.DB.Transaction(func(tx *gorm.DB) error {
+		// guard last_seen_at: device yang baru saja mengirim data di antara query & update tidak ikut ditandai
+		res := tx.Model(&device.Device{}).
+			Where("id = ? AND online = ? AND last_seen_at < ?", dev.ID, true, now.Add(-window)).
+			Update("online", false)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		marked = true
+
+		var vd device.VehicleDevice
+		err := tx.Where("device_id = ? AND active = ?", dev.ID, true).Order("assigned_at DESC").Limit(1).Find(&vd).Error
+		if err != nil || vd.ID == 0 {
+			return err
+		}
+
+		payload := map[string]interface{}{
+			"lastSeenAt":    dev.LastSeenAt.UTC().Format(time.RFC3339),
+			"silentSeconds": int64(now.Sub(*dev.LastSeenAt).Seconds()),
+			"windowSeconds": int64(window.Seconds()),
+		}
+		if dev.LastFixAt != nil {
+			payload["lastFixAt"] = dev.LastFixAt.UTC().Format(time.RFC3339)
+		}
+		if dev.LastSource != nil {
+			payload["lastSource"] = *dev.LastSource
+		}
+		deviceID := dev.ID
+		msg := fmt.Sprintf("device %s tidak mengirim data sejak %s", dev.ExternalID, dev.LastSeenAt.UTC().Format(time.RFC3339))
+		_, err = alert.Raise(tx, AlertDeviceOffline, vd.VehicleID, &deviceID, now, msg, payload)
+		return err
+	})
+	return marked && err == nil, err
+}
+
+// Start jalankan pengecekan berkala di background
+func (c *OfflineChecker) Start() {
+	interval := c.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n, err := c.CheckOnce(time.Now().UTC()); err != nil {
+					log.Printf("offline checker: %v", err)
+				} else if n > 0 {
+					log.Printf("offline checker: %d device ditandai offline", n)
+				}
+			}
+		}
+	}()
+}
+
+// Stop hentikan pengecekan dan tunggu goroutine selesai
+func (c *OfflineChecker) Stop() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.wg.Wait()
+}
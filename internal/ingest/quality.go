@@ -0,0 +1,327 @@
+package ingest
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/geocode"
+)
+
+// Marker kualitas fix di position_log.quality. Hanya GOOD yang dipakai posisi terkini, trip & odometer.
+const (
+	QualityGood         = "GOOD"
+	QualityInvalidCoord = "INVALID_COORD" // (0,0) atau di luar jangkauan
+	QualityLowAccuracy  = "LOW_ACCURACY"  // HDOP terlalu besar / satelit terlalu sedikit / GPS belum fix
+	QualitySpeedSpike   = "SPEED_SPIKE"   // kecepatan dilaporkan atau tersirat tidak masuk akal (teleport)
+	QualityDrift        = "DRIFT"         // kendaraan diam tapi koordinat bergeser sedikit
+	QualityClockSkew    = "CLOCK_SKEW"    // jam device meleset kronis (ClockSkewFilter mode MARK)
+)
+
+// QualityConfig ambang batas filter kualitas GPS
+type QualityConfig struct {
+	MaxSpeedKph        float64 // kecepatan yang dilaporkan device (default 250)
+	MaxImpliedSpeedKph float64 // kecepatan dari jarak / selisih waktu antar fix (default 300)
+	MaxHDOP            float64 // default 5
+	MinSatellites      int     // default 4
+	DriftRadiusM       float64 // pergeseran di bawah radius ini saat diam dianggap drift (default 30)
+	DriftMaxSpeedKph   float64 // kecepatan yang dilaporkan device yang masih dianggap diam (default 0)
+	// ReanchorAfter jumlah fix berurutan yang spike terhadap fix GOOD terakhir tapi konsisten satu sama lain
+	// sebelum fix GOOD itu dianggap salah dan diganti (default 3, 0 = tidak pernah)
+	ReanchorAfter int
+	Drop          []string // marker yang fix-nya dibuang, bukan hanya ditandai
+}
+
+func DefaultQualityConfig() QualityConfig {
+	return QualityConfig{
+		MaxSpeedKph:        250,
+		MaxImpliedSpeedKph: 300,
+		MaxHDOP:            5,
+		MinSatellites:      4,
+		DriftRadiusM:       30,
+		ReanchorAfter:      3,
+	}
+}
+
+// QualityFilter menilai fix sebelum disimpan. Fix GOOD terakhir per device di-cache
+// supaya pengecekan kecepatan tersirat & drift tidak perlu query untuk data live.
+type QualityFilter struct {
+	Config QualityConfig
+
+	mu   sync.Mutex
+	last map[int64]qualityState
+}
+
+func NewQualityFilter(cfg QualityConfig) *QualityFilter {
+	return &QualityFilter{Config: cfg, last: map[int64]qualityState{}}
+}
+
+// qualityState pembanding per device: anchor = fix GOOD terakhir, chain = fix sesudahnya yang
+// spike terhadap anchor tapi konsisten satu sama lain (calon anchor baru)
+type qualityState struct {
+	anchor *Fix
+	chain  []Fix
+}
+
+// latest ts fix terakhir yang tercatat di state
+func (st qualityState) latest() time.Time {
+	if n := len(st.chain); n > 0 {
+		return st.chain[n-1].TS
+	}
+	if st.anchor != nil {
+		return st.anchor.TS
+	}
+	return time.Time{}
+}
+
+// Assess beri marker untuk satu fix. prev = fix GOOD sebelumnya dari device yang sama (boleh nil).
+func (c QualityConfig) Assess(f *Fix, prev *Fix) string {
+	if !validCoord(f.Lat, f.Lon) {
+		return QualityInvalidCoord
+	}
+
+	if hdop, ok := rawAccuracy(f.Raw, "hdop"); ok && c.MaxHDOP > 0 && hdop > c.MaxHDOP {
+		return QualityLowAccuracy
+	}
+	if sats, ok := rawAccuracy(f.Raw, "satellites"); ok && c.MinSatellites > 0 && sats < float64(c.MinSatellites) {
+		return QualityLowAccuracy
+	}
+	if positioned, ok := f.Raw["positioned"].(bool); ok && !positioned {
+		return QualityLowAccuracy
+	}
+
+	if f.SpeedKph != nil && c.MaxSpeedKph > 0 && *f.SpeedKph > c.MaxSpeedKph {
+		return QualitySpeedSpike
+	}
+
+	if prev == nil || !f.TS.After(prev.TS) {
+		return QualityGood
+	}
+	distKm := geocode.HaversineKm(prev.Lat, prev.Lon, f.Lat, f.Lon)
+	hours := f.TS.Sub(prev.TS).Hours()
+	// lompatan < 50 m diabaikan supaya noise GPS pada interval rapat tidak dianggap spike
+	if c.MaxImpliedSpeedKph > 0 && distKm > 0.05 && distKm/hours > c.MaxImpliedSpeedKph {
+		return QualitySpeedSpike
+	}
+
+	// diam hanya menurut device sendiri (ignition off / kecepatan device ~0); kecepatan tersirat tidak
+	// dipakai supaya kendaraan yang merayap pelan (macet) tidak ditandai drift
+	stationary := (f.IgnitionOn != nil && !*f.IgnitionOn) || (f.SpeedKph != nil && *f.SpeedKph <= c.DriftMaxSpeedKph)
+	if stationary && distKm > 0 && distKm*1000 < c.DriftRadiusM {
+		return QualityDrift
+	}
+
+	return QualityGood
+}
+
+// reanchor catat fix yang spike terhadap anchor. Setelah ReanchorAfter fix berurutan yang konsisten
+// satu sama lain, anchor dianggap fix buruk yang lolos (mis. fix pertama setelah cold start)
+// dan fix ini jadi anchor baru.
+func (c QualityConfig) reanchor(st *qualityState, f *Fix) string {
+	// spike karena fix itu sendiri (kecepatan dilaporkan), bukan karena anchor
+	if c.ReanchorAfter <= 0 || c.Assess(f, nil) != QualityGood {
+		return QualitySpeedSpike
+	}
+	if n := len(st.chain); n > 0 && c.Assess(f, &st.chain[n-1]) == QualitySpeedSpike {
+		st.chain = nil
+	}
+	st.chain = append(st.chain, *f)
+	if len(st.chain) < c.ReanchorAfter {
+		return QualitySpeedSpike
+	}
+	st.anchor, st.chain = f, nil
+	return QualityGood
+}
+
+func (c QualityConfig) dropped(quality string) bool {
+	for _, d := range c.Drop {
+		if d == quality {
+			return true
+		}
+	}
+	return false
+}
+
+// qualityRef menunjuk satu fix di dalam batch (item ke-i, fix ke-j)
+type qualityRef struct {
+	item, fix int
+}
+
+// Apply isi Fix.Quality untuk semua fix di batch, per device berurutan ts.
+// Return set fix yang harus dibuang sesuai Config.Drop.
+func (q *QualityFilter) Apply(db *gorm.DB, items []batchItem, skip func(f *Fix) bool) (map[qualityRef]bool, error) {
+	byDevice := map[int64][]qualityRef{}
+	var devices []int64
+	for i, it := range items {
+		for j := range it.Fixes {
+			if skip(&it.Fixes[j]) {
+				continue
+			}
+			id := it.Target.Device.ID
+			if _, ok := byDevice[id]; !ok {
+				devices = append(devices, id)
+			}
+			byDevice[id] = append(byDevice[id], qualityRef{i, j})
+		}
+	}
+
+	drop := map[qualityRef]bool{}
+	for _, deviceID := range devices {
+		refs := byDevice[deviceID]
+		fixAt := func(r qualityRef) *Fix { return &items[r.item].Fixes[r.fix] }
+		sort.SliceStable(refs, func(a, b int) bool { return fixAt(refs[a]).TS.Before(fixAt(refs[b]).TS) })
+
+		st, err := q.state(db, deviceID, fixAt(refs[0]).TS)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range refs {
+			f := fixAt(r)
+			f.Quality = q.Config.Assess(f, st.anchor)
+			switch f.Quality {
+			case QualityGood:
+				st.anchor, st.chain = f, nil
+			case QualitySpeedSpike:
+				f.Quality = q.Config.reanchor(&st, f)
+			}
+			if q.Config.dropped(f.Quality) {
+				drop[r] = true
+			}
+		}
+
+		if st.anchor != nil || len(st.chain) > 0 {
+			// salin: anchor menunjuk ke fix di dalam batch
+			saved := qualityState{chain: append([]Fix(nil), st.chain...)}
+			if st.anchor != nil {
+				anchor := *st.anchor
+				saved.anchor = &anchor
+			}
+			q.mu.Lock()
+			if cur, ok := q.last[deviceID]; !ok || saved.latest().After(cur.latest()) {
+				q.last[deviceID] = saved
+			}
+			q.mu.Unlock()
+		}
+	}
+	return drop, nil
+}
+
+// state pembanding sebelum ts: dari cache bila cukup, kalau tidak dari position_log
+// (fix GOOD terakhir + fix SPEED_SPIKE sesudahnya sebagai chain)
+func (q *QualityFilter) state(db *gorm.DB, deviceID int64, before time.Time) (qualityState, error) {
+	q.mu.Lock()
+	cached, ok := q.last[deviceID]
+	q.mu.Unlock()
+	if ok && cached.latest().Before(before) {
+		st := qualityState{anchor: cached.anchor, chain: append([]Fix(nil), cached.chain...)}
+		return st, nil
+	}
+
+	var st qualityState
+	var rows []PositionLog
+	err := db.Where("device_id = ? AND quality = ? AND ts < ?", deviceID, QualityGood, before).
+		Order("ts DESC").
+		Limit(1).
+		Find(&rows).Error
+	if err != nil {
+		return st, err
+	}
+	spikes := db.Where("device_id = ? AND quality = ? AND ts < ?", deviceID, QualitySpeedSpike, before)
+	if len(rows) == 1 {
+		st.anchor = rowFix(&rows[0])
+		spikes = spikes.Where("ts > ?", rows[0].TS)
+	}
+	if q.Config.ReanchorAfter > 1 {
+		rows = nil
+		if err := spikes.Order("ts DESC").Limit(q.Config.ReanchorAfter - 1).Find(&rows).Error; err != nil {
+			return st, err
+		}
+		for i := len(rows) - 1; i >= 0; i-- {
+			f := rowFix(&rows[i])
+			if f.SpeedKph != nil && q.Config.MaxSpeedKph > 0 && *f.SpeedKph > q.Config.MaxSpeedKph {
+				st.chain = nil
+				continue
+			}
+			if n := len(st.chain); n > 0 && q.Config.Assess(f, &st.chain[n-1]) == QualitySpeedSpike {
+				st.chain = nil
+			}
+			st.chain = append(st.chain, *f)
+		}
+	}
+	return st, nil
+}
+
+func rowFix(row *PositionLog) *Fix {
+	return &Fix{TS: row.TS, Lat: row.Lat, Lon: row.Lon, SpeedKph: row.SpeedKph, IgnitionOn: row.IgnitionOn}
+}
+
+func validCoord(lat, lon float64) bool {
+	if math.IsNaN(lat) || math.IsNaN(lon) || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return false
+	}
+	return !(math.Abs(lat) < 1e-6 && math.Abs(lon) < 1e-6)
+}
+
+// rawAccuracy cari HDOP / jumlah satelit di raw payload protokol mana pun:
+// field langsung, params (OsmAnd), payload (MQTT / API / import), atau IO 182 Teltonika (HDOP x10).
+func rawAccuracy(raw map[string]interface{}, kind string) (float64, bool) {
+	keys := map[string][]string{
+		"hdop":       {"hdop", "HDOP"},
+		"satellites": {"satellites", "sats", "sat"},
+	}[kind]
+
+	for _, doc := range []interface{}{raw, raw["params"], raw["payload"]} {
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, k := range keys {
+			if v, ok := anyFloat(m[k]); ok {
+				return v, true
+			}
+		}
+	}
+
+	if kind == "hdop" {
+		if io, ok := raw["io"].(map[string]interface{}); ok {
+			if v, ok := anyFloat(io["182"]); ok {
+				return v / 10, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// anyFloat konversi angka dari tipe Go apa pun (hasil decoder protokol, JSON, maupun kolom JSONB)
+func anyFloat(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case float32:
+		return float64(x), true
+	case int:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case uint8:
+		return float64(x), true
+	case uint16:
+		return float64(x), true
+	case uint32:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	case json.Number: // datatypes.JSONMap dari database di-decode dengan UseNumber
+		f, err := x.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(x, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,412 @@
+package ingest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/device"
+	"github.com/username/fms-api/internal/vehicle"
+)
+
+// ErrReprocessUnsupported raw_payload tidak bisa diputar ulang (kosong, atau protokol tanpa decoder seperti IMPORT)
+var ErrReprocessUnsupported = errors.New("raw_payload tidak bisa di-decode ulang")
+
+// ReprocessOptions pilih row position_log yang raw_payload-nya diputar ulang lewat decoder saat ini
+type ReprocessOptions struct {
+	DeviceID   int64 // 0 = semua device
+	From, To   *time.Time
+	DryRun     bool // hanya laporkan perubahan, tidak menulis apa pun
+	BatchSize  int  // row per transaksi (default 500)
+	MaxChanges int  // jumlah perubahan & error maksimal di laporan (default 1000)
+}
+
+type ReprocessChange struct {
+	ID       int64     `json:"id"`
+	DeviceID int64     `json:"deviceId"`
+	TS       time.Time `json:"ts"`
+	Fields   []string  `json:"fields"` // kolom yang berubah
+}
+
+type ReprocessError struct {
+	ID      int64  `json:"id"`
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+type ReprocessReport struct {
+	DryRun           bool              `json:"dryRun"`
+	Scanned          int               `json:"scanned"`
+	Changed          int               `json:"changed"`
+	Unchanged        int               `json:"unchanged"`
+	Skipped          int               `json:"skipped"` // raw_payload kosong / protokol tanpa decoder
+	Failed           int               `json:"failed"`  // raw_payload gagal di-decode ulang
+	Changes          []ReprocessChange `json:"changes"`
+	Errors           []ReprocessError  `json:"errors"`
+	ChangesTruncated bool              `json:"changesTruncated"`
+}
+
+// Reprocess decode ulang raw_payload position_log (per device dan/atau rentang waktu) dengan decoder
+// protokol saat ini, lalu tulis ulang lat/lon/speed/heading/altitude/ignition/odometer di tempat.
+// Kualitas row yang ditulis ulang dinilai ulang; posisi terkini kendaraan ikut diperbarui bila row
+// yang berubah adalah posisi terkininya. ts tidak pernah ditulis ulang karena bagian dari kunci (device_id, ts).
+func (s *Service) Reprocess(opts ReprocessOptions) (*ReprocessReport, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.MaxChanges <= 0 {
+		opts.MaxChanges = 1000
+	}
+
+	rp := &reprocessor{
+		db:      s.DB,
+		opts:    opts,
+		quality: DefaultQualityConfig(),
+		report:  &ReprocessReport{DryRun: opts.DryRun, Changes: []ReprocessChange{}, Errors: []ReprocessError{}},
+		devices: map[int64]*device.DataSource{},
+	}
+	if s.Quality != nil {
+		rp.quality = s.Quality.Config
+	}
+
+	var lastID int64
+	for {
+		q := s.DB.Where("id > ?", lastID)
+		if opts.DeviceID != 0 {
+			q = q.Where("device_id = ?", opts.DeviceID)
+		}
+		if opts.From != nil {
+			q = q.Where("ts >= ?", *opts.From)
+		}
+		if opts.To != nil {
+			q = q.Where("ts <= ?", *opts.To)
+		}
+
+		var rows []PositionLog
+		if err := q.Order("id ASC").Limit(opts.BatchSize).Find(&rows).Error; err != nil {
+			return rp.report, err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		lastID = rows[len(rows)-1].ID
+
+		if err := s.DB.Transaction(func(tx *gorm.DB) error { return rp.batch(tx, rows) }); err != nil {
+			return rp.report, err
+		}
+	}
+
+	return rp.report, nil
+}
+
+type reprocessor struct {
+	db      *gorm.DB
+	opts    ReprocessOptions
+	report  *ReprocessReport
+	quality QualityConfig
+
+	// data source per device, untuk field mapping MQTT / API
+	devices map[int64]*device.DataSource
+}
+
+func (rp *reprocessor) batch(tx *gorm.DB, rows []PositionLog) error {
+	for _, row := range rows {
+		rp.report.Scanned++
+
+		f, err := rp.decode(row)
+		if errors.Is(err, ErrReprocessUnsupported) {
+			rp.report.Skipped++
+			continue
+		}
+		if err != nil {
+			rp.fail(row.ID, "decode_failed", err.Error())
+			continue
+		}
+		// fix yang digeser ClockSkewFilter (mode CORRECT) dibandingkan dengan ts asli device
+		want := row.TS
+		if ts, ok := storedDeviceTS(row.RawPayload); ok {
+			want = ts
+			if ts.Nanosecond() == 0 {
+				// deviceTs lama disimpan dengan presisi detik
+				f.TS = f.TS.Truncate(time.Second)
+			}
+		}
+		if !f.TS.Truncate(time.Microsecond).Equal(want.Truncate(time.Microsecond)) {
+			rp.fail(row.ID, "ts_mismatch", fmt.Sprintf("ts hasil decode %s berbeda dengan ts tersimpan %s",
+				f.TS.UTC().Format(time.RFC3339Nano), want.UTC().Format(time.RFC3339Nano)))
+			continue
+		}
+		f.TS = row.TS
+
+		changes := map[string]interface{}{}
+		if !sameFloat(&row.Lat, &f.Lat, 1e-9) {
+			changes["lat"] = f.Lat
+		}
+		if !sameFloat(&row.Lon, &f.Lon, 1e-9) {
+			changes["lon"] = f.Lon
+		}
+		// kolom NUMERIC(x,2): bandingkan setelah dibulatkan 2 desimal
+		for col, pair := range map[string][2]*float64{
+			"speed_kph":   {row.SpeedKph, f.SpeedKph},
+			"heading_deg": {row.HeadingDeg, f.HeadingDeg},
+			"altitude_m":  {row.AltitudeM, f.AltitudeM},
+			"odometer_km": {row.OdometerKm, f.OdometerKm},
+		} {
+			if !sameFloat(pair[0], pair[1], 0.005) {
+				changes[col] = pair[1]
+			}
+		}
+		if (row.IgnitionOn == nil) != (f.IgnitionOn == nil) || (row.IgnitionOn != nil && *row.IgnitionOn != *f.IgnitionOn) {
+			changes["ignition_on"] = f.IgnitionOn
+		}
+
+		if len(changes) == 0 {
+			rp.report.Unchanged++
+			continue
+		}
+		quality, err := rp.assess(tx, row, &f)
+		if err != nil {
+			return err
+		}
+		if quality != row.Quality {
+			changes["quality"] = quality
+		}
+
+		rp.report.Changed++
+		rp.record(ReprocessChange{ID: row.ID, DeviceID: row.DeviceID, TS: row.TS, Fields: sortedKeys(changes)})
+		if rp.opts.DryRun {
+			continue
+		}
+
+		if err := tx.Model(&PositionLog{}).Where("id = ?", row.ID).Updates(changes).Error; err != nil {
+			return err
+		}
+
+		if quality != row.Quality {
+			if err := rp.refreshCurrent(tx, row, &f, quality); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// posisi terkini tidak punya altitude_m
+		delete(changes, "altitude_m")
+		if len(changes) == 0 {
+			continue
+		}
+		changes["updated_at"] = time.Now().UTC()
+		if err := tx.Table("vehicle_current_position").
+			Where("vehicle_id = ? AND device_id = ? AND ts = ?", row.VehicleID, row.DeviceID, row.TS).
+			Updates(changes).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assess nilai ulang kualitas row yang ditulis ulang, dengan fix GOOD sebelumnya di position_log
+// sebagai pembanding. CLOCK_SKEW dipertahankan selama fix-nya sendiri valid.
+func (rp *reprocessor) assess(tx *gorm.DB, row PositionLog, f *Fix) (string, error) {
+	var prev []PositionLog
+	if err := tx.Where("device_id = ? AND quality = ? AND ts < ?", row.DeviceID, QualityGood, row.TS).
+		Order("ts DESC").Limit(1).Find(&prev).Error; err != nil {
+		return "", err
+	}
+	var p *Fix
+	if len(prev) == 1 {
+		p = rowFix(&prev[0])
+	}
+	f.Raw = row.RawPayload // HDOP / satelit dibaca dari raw yang tersimpan
+	quality := rp.quality.Assess(f, p)
+	if quality == QualityGood && row.Quality == QualityClockSkew {
+		return QualityClockSkew, nil
+	}
+	return quality, nil
+}
+
+// refreshCurrent sesuaikan posisi terkini setelah kualitas row berubah: row yang jadi GOOD boleh menjadi
+// posisi terkini (bila paling baru), row posisi terkini yang tidak lagi GOOD diganti fix GOOD terakhir kendaraan.
+func (rp *reprocessor) refreshCurrent(tx *gorm.DB, row PositionLog, f *Fix, quality string) error {
+	if quality == QualityGood {
+		return upsertCurrentPosition(tx, &Target{Device: device.Device{ID: row.DeviceID}, VehicleID: row.VehicleID}, f)
+	}
+
+	res := tx.Where("vehicle_id = ? AND device_id = ? AND ts = ?", row.VehicleID, row.DeviceID, row.TS).
+		Delete(&vehicle.VehicleCurrentPositionDB{})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return res.Error
+	}
+	var last []PositionLog
+	if err := tx.Where("vehicle_id = ? AND quality = ?", row.VehicleID, QualityGood).
+		Order("ts DESC").Limit(1).Find(&last).Error; err != nil || len(last) == 0 {
+		return err
+	}
+	lf := rowFix(&last[0])
+	lf.HeadingDeg, lf.OdometerKm = last[0].HeadingDeg, last[0].OdometerKm
+	return upsertCurrentPosition(tx, &Target{Device: device.Device{ID: last[0].DeviceID}, VehicleID: row.VehicleID}, lf)
+}
+
+// decode putar ulang raw_payload lewat decoder sesuai raw_payload.protocol
+func (rp *reprocessor) decode(row PositionLog) (Fix, error) {
+	raw := map[string]interface{}(row.RawPayload)
+	protocol, _ := raw["protocol"].(string)
+
+	switch protocol {
+	case ProtocolTeltonika:
+		codec := TeltonikaCodec8
+		if raw["codec"] == "8E" {
+			codec = TeltonikaCodec8E
+		}
+		b, err := hexField(raw, "record")
+		if err != nil {
+			return Fix{}, err
+		}
+		rec, err := DecodeTeltonikaRecord(codec, b)
+		if err != nil {
+			return Fix{}, err
+		}
+		return rec.Fix(codec), nil
+
+	case ProtocolGT06:
+		b, err := hexField(raw, "frame")
+		if err != nil {
+			return Fix{}, err
+		}
+		pkt, err := DecodeGT06Frame(b)
+		if err != nil {
+			return Fix{}, err
+		}
+		loc, err := pkt.Location()
+		if err != nil {
+			return Fix{}, err
+		}
+		return loc.Fix(pkt), nil
+
+	case ProtocolOsmAnd:
+		params, ok := raw["params"].(map[string]interface{})
+		if !ok {
+			return Fix{}, ErrReprocessUnsupported
+		}
+		q := url.Values{}
+		for k, v := range params {
+			q.Set(k, fmt.Sprint(v))
+		}
+		// tanpa timestamp OsmAnd pakai waktu server, tidak bisa direproduksi
+		if q.Get("timestamp") == "" {
+			return Fix{}, ErrReprocessUnsupported
+		}
+		return ParseOsmAndFix(q)
+
+	case DataSourceTypeMQTT, DataSourceTypeAPI:
+		doc, err := plainJSON(raw["payload"])
+		if err != nil {
+			return Fix{}, ErrReprocessUnsupported
+		}
+		ds, err := rp.dataSource(row.DeviceID)
+		if err != nil {
+			return Fix{}, err
+		}
+		var mapping map[string]string
+		var speedUnit string
+		if protocol == DataSourceTypeMQTT {
+			cfg, err := ParseMQTTConfig(*ds)
+			if err != nil {
+				return Fix{}, err
+			}
+			mapping, speedUnit = cfg.FieldMapping, cfg.SpeedUnit
+		} else {
+			cfg, err := ParseHTTPConnectorConfig(*ds)
+			if err != nil {
+				return Fix{}, err
+			}
+			mapping, speedUnit = cfg.FieldMapping, cfg.SpeedUnit
+		}
+		// tanpa ts di payload decoder pakai waktu server, tidak bisa direproduksi
+		if _, found := lookupPath(doc, mapping["ts"]); !found {
+			return Fix{}, ErrReprocessUnsupported
+		}
+		return decodeMappedFix(doc, mapping, speedUnit)
+	}
+
+	// IMPORT (mapping kolom tidak disimpan) dan raw bebas dari /ingest/positions
+	return Fix{}, ErrReprocessUnsupported
+}
+
+// dataSource milik device, di-cache per device
+func (rp *reprocessor) dataSource(deviceID int64) (*device.DataSource, error) {
+	if ds, ok := rp.devices[deviceID]; ok {
+		return ds, nil
+	}
+	var ds device.DataSource
+	err := rp.db.Joins("JOIN devices d ON d.data_source_id = data_sources.id").
+		Where("d.id = ?", deviceID).
+		Take(&ds).Error
+	if err != nil {
+		return nil, fmt.Errorf("data source device %d: %w", deviceID, err)
+	}
+	rp.devices[deviceID] = &ds
+	return &ds, nil
+}
+
+func (rp *reprocessor) fail(id int64, code, msg string) {
+	rp.report.Failed++
+	if len(rp.report.Errors)+len(rp.report.Changes) >= rp.opts.MaxChanges {
+		rp.report.ChangesTruncated = true
+		return
+	}
+	rp.report.Errors = append(rp.report.Errors, ReprocessError{ID: id, Error: code, Message: msg})
+}
+
+func (rp *reprocessor) record(ch ReprocessChange) {
+	if len(rp.report.Errors)+len(rp.report.Changes) >= rp.opts.MaxChanges {
+		rp.report.ChangesTruncated = true
+		return
+	}
+	rp.report.Changes = append(rp.report.Changes, ch)
+}
+
+// plainJSON decode ulang dokumen JSONB tanpa UseNumber, supaya angka kembali float64
+// seperti saat payload pertama kali di-decode oleh subscriber / connector
+func plainJSON(v interface{}) (map[string]interface{}, error) {
+	if _, ok := v.(map[string]interface{}); !ok {
+		return nil, ErrReprocessUnsupported
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	err = json.Unmarshal(b, &doc)
+	return doc, err
+}
+
+func hexField(raw map[string]interface{}, key string) ([]byte, error) {
+	s, ok := raw[key].(string)
+	if !ok || s == "" {
+		return nil, ErrReprocessUnsupported
+	}
+	return hex.DecodeString(s)
+}
+
+func sameFloat(a, b *float64, eps float64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return math.Abs(*a-*b) < eps
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,450 @@
+package ingest
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/username/fms-api/internal/device"
+	"github.com/username/fms-api/internal/vehicle"
+)
+
+var (
+	ErrUnknownDevice  = errors.New("device tidak ditemukan")
+	ErrDeviceInactive = errors.New("device tidak aktif")
+	ErrDeviceUnbound  = errors.New("device belum terikat ke kendaraan")
+)
+
+// Target = device yang sudah di-resolve beserta kendaraan yang sedang terikat (vehicle_devices aktif)
+type Target struct {
+	Device    device.Device
+	VehicleID int64
+}
+
+// Result ringkasan hasil penyimpanan satu batch fix
+type Result struct {
+	Inserted    int `json:"inserted"`
+	Duplicates  int `json:"duplicates"`
+	Late        int `json:"late"`        // tersimpan di position_log tapi lebih lama dari posisi terkini
+	Quarantined int `json:"quarantined"` // ts terlalu jauh di masa depan, masuk position_quarantine
+	Flagged     int `json:"flagged"`     // tersimpan dengan quality selain GOOD (tidak dipakai posisi terkini)
+	Dropped     int `json:"dropped"`     // dibuang filter kualitas (QualityConfig.Drop)
+}
+
+// Service menulis fix ke position_log & vehicle_current_position.
+// Dipakai oleh endpoint HTTP maupun listener protokol.
+type Service struct {
+	DB       *gorm.DB
+	Pipeline *Pipeline // opsional, nil = tulis langsung per panggilan Store
+
+	// MaxFutureSkew batas ts fix di depan jam server sebelum dikarantina.
+	// 0 = DefaultMaxFutureSkew, negatif = tanpa karantina.
+	MaxFutureSkew time.Duration
+
+	// Quality filter kualitas GPS, nil = semua fix dianggap GOOD
+	Quality *QualityFilter
+
+	// ClockSkew estimasi jam device vs jam server, nil = ts device dipakai apa adanya
+	ClockSkew *ClockSkewFilter
+
+	// Commands antrian command downlink ke koneksi TCP device, nil = tanpa command
+	Commands *CommandHub
+
+	// AcceptUnknown listener TCP menerima handshake/login IMEI yang belum terdaftar dan semua jalur ingest
+	// menahan paket dari external id yang belum terdaftar di dead-letter (bisa di-replay setelah provisioning).
+	// false = koneksi ditolak dan paketnya tidak disimpan.
+	AcceptUnknown bool
+
+	// DeadLetterCap batas paket yang ditahan per protokol + external id yang belum di-provision,
+	// paket terlama dibuang lebih dulu. 0 = tanpa batas.
+	DeadLetterCap int
+
+	// DeadLetterTTL umur dead-letter sebelum dihapus (dicek saat paket baru ditahan). 0 = disimpan selamanya.
+	DeadLetterTTL time.Duration
+
+	// DeadLetterRate batas dead-letter yang disimpan per menit dari semua jalur, sisanya dibuang.
+	// 0 = tanpa batas.
+	DeadLetterRate int
+
+	deadLetterMu sync.Mutex
+	prunedAt     time.Time
+	rateWindow   time.Time // awal menit berjalan untuk DeadLetterRate
+	rateCount    int
+}
+
+// DefaultMaxFutureSkew toleransi jam device yang lebih cepat dari jam server
+const DefaultMaxFutureSkew = 5 * time.Minute
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{DB: db}
+}
+
+func (s *Service) maxFutureSkew() time.Duration {
+	if s.MaxFutureSkew == 0 {
+		return DefaultMaxFutureSkew
+	}
+	return s.MaxFutureSkew
+}
+
+// ResolveByDataSource mencari device berdasarkan data_sources.code + devices.external_id
+func (s *Service) ResolveByDataSource(dataSourceCode, externalID string) (*Target, error) {
+	var dev device.Device
+	err := s.DB.Table("devices d").
+		Select("d.*").
+		Joins("JOIN data_sources ds ON ds.id = d.data_source_id").
+		Where("ds.code = ? AND d.external_id = ?", dataSourceCode, externalID).
+		Take(&dev).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnknownDevice
+		}
+		return nil, err
+	}
+	return s.bind(dev)
+}
+
+// ResolveByDataSourceType mencari device berdasarkan data_sources.type + devices.external_id
+// (misal semua data source bertipe GT06).
+func (s *Service) ResolveByDataSourceType(dataSourceType, externalID string) (*Target, error) {
+	var dev device.Device
+	err := s.DB.Table("devices d").
+		Select("d.*").
+		Joins("JOIN data_sources ds ON ds.id = d.data_source_id").
+		Where("UPPER(ds.type) = ? AND d.external_id = ?", strings.ToUpper(dataSourceType), externalID).
+		Order("d.active DESC, d.id").
+		Take(&dev).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnknownDevice
+		}
+		return nil, err
+	}
+	return s.bind(dev)
+}
+
+// ResolveByProtocol mencari device berdasarkan devices.protocol + devices.external_id
+// (dipakai listener TCP yang hanya tahu IMEI).
+func (s *Service) ResolveByProtocol(protocol, externalID string) (*Target, error) {
+	var dev device.Device
+	err := s.DB.Where("UPPER(protocol) = ? AND external_id = ?", strings.ToUpper(protocol), externalID).
+		Order("active DESC, id").
+		Take(&dev).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnknownDevice
+		}
+		return nil, err
+	}
+	return s.bind(dev)
+}
+
+// bind cek device aktif lalu cari kendaraan lewat mapping vehicle_devices yang aktif
+func (s *Service) bind(dev device.Device) (*Target, error) {
+	if !dev.Active {
+		return nil, ErrDeviceInactive
+	}
+
+	var mapping device.VehicleDevice
+	if err := s.DB.Where("device_id = ? AND active = TRUE", dev.ID).
+		Order("assigned_at DESC").
+		Take(&mapping).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDeviceUnbound
+		}
+		return nil, err
+	}
+
+	return &Target{Device: dev, VehicleID: mapping.VehicleID}, nil
+}
+
+// Store insert semua fix ke position_log (duplikat (device_id, ts) dilewati)
+// lalu upsert vehicle_current_position dengan fix terbaru.
+// Bila Pipeline terpasang, penulisan diantrikan dan digabung dengan fix device lain.
+func (s *Service) Store(t *Target, fixes []Fix) (Result, error) {
+	if len(fixes) == 0 {
+		return Result{}, nil
+	}
+	if s.Pipeline != nil {
+		return s.Pipeline.Store(t, fixes)
+	}
+
+	results, err := s.storeBatch([]batchItem{{Target: t, Fixes: fixes}})
+	if err != nil {
+		return Result{}, err
+	}
+	return results[0], nil
+}
+
+// batchItem = fix milik satu target di dalam satu batch penulisan
+type batchItem struct {
+	Target *Target
+	Fixes  []Fix
+}
+
+// positionKey = kunci unik position_log (uq_device_ts), ts dalam mikrodetik (presisi TIMESTAMPTZ)
+type positionKey struct {
+	DeviceID int64
+	TS       int64
+}
+
+// storeBatch tulis banyak item dalam satu transaksi dengan aturan:
+//   - ts fix dari device yang jamnya meleset kronis dikoreksi atau ditandai CLOCK_SKEW (ClockSkewFilter)
+//   - fix dengan ts lebih jauh dari MaxFutureSkew ke depan masuk position_quarantine, bukan position_log
+//   - fix dinilai filter kualitas; yang tidak GOOD tetap disimpan (atau dibuang sesuai config)
+//   - duplikat (device_id, ts) dilewati dan dihitung
+//   - fix terlambat tetap masuk position_log, tapi vehicle_current_position hanya maju bila ts lebih baru
+//     dan quality GOOD
+//
+// position_log ditulis dengan multi-row insert dan posisi terkini cukup satu upsert per vehicle.
+// Hasil dikembalikan per item sesuai urutan input.
+func (s *Service) storeBatch(items []batchItem) ([]Result, error) {
+	results := make([]Result, len(items))
+
+	now := time.Now().UTC()
+	maxTS := now.Add(s.maxFutureSkew())
+	future := func(f *Fix) bool { return s.MaxFutureSkew >= 0 && f.TS.After(maxTS) }
+
+	// skew jam device: dihitung dari ts asli, sebelum karantina & filter kualitas
+	var skew map[int64]ClockSkewState
+	if s.ClockSkew != nil {
+		skew = s.ClockSkew.Apply(s.DB, items, now)
+	}
+
+	// filter kualitas GPS: isi Fix.Quality, fix dengan marker di Config.Drop dibuang.
+	// Fix yang sudah ditandai CLOCK_SKEW tidak dinilai ulang.
+	var drop map[qualityRef]bool
+	if s.Quality != nil {
+		var err error
+		skip := func(f *Fix) bool { return future(f) || f.Quality == QualityClockSkew }
+		if drop, err = s.Quality.Apply(s.DB, items, skip); err != nil {
+			return nil, err
+		}
+	}
+
+	var rows []PositionLog
+	var quarantined []QuarantinedPosition
+	vehicleIDs := map[int64]bool{}
+	seen := deviceSeenSet{}
+	for i, it := range items {
+		for j := range it.Fixes {
+			f := &it.Fixes[j]
+			seen.add(it.Target.Device.ID, f, !future(f) && !drop[qualityRef{i, j}])
+			row := PositionLog{
+				VehicleID:  it.Target.VehicleID,
+				DeviceID:   it.Target.Device.ID,
+				TS:         f.TS.UTC().Truncate(time.Microsecond),
+				Lat:        f.Lat,
+				Lon:        f.Lon,
+				SpeedKph:   f.SpeedKph,
+				HeadingDeg: f.HeadingDeg,
+				AltitudeM:  f.AltitudeM,
+				IgnitionOn: f.IgnitionOn,
+				OdometerKm: f.OdometerKm,
+				RawPayload: f.Raw,
+				Quality:    fixQuality(f),
+				CreatedAt:  now,
+			}
+			if future(f) {
+				quarantined = append(quarantined, QuarantinedPosition{
+					VehicleID: row.VehicleID, DeviceID: row.DeviceID, TS: row.TS, Lat: row.Lat, Lon: row.Lon,
+					SpeedKph: row.SpeedKph, HeadingDeg: row.HeadingDeg, AltitudeM: row.AltitudeM,
+					IgnitionOn: row.IgnitionOn, OdometerKm: row.OdometerKm, RawPayload: row.RawPayload,
+					Reason: QuarantineFutureTS, CreatedAt: now,
+				})
+				results[i].Quarantined++
+				continue
+			}
+			if drop[qualityRef{i, j}] {
+				results[i].Dropped++
+				continue
+			}
+			rows = append(rows, row)
+			vehicleIDs[it.Target.VehicleID] = true
+		}
+	}
+	if len(rows) == 0 && len(quarantined) == 0 && len(seen) == 0 && len(skew) == 0 {
+		return results, nil
+	}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := markSeen(tx, seen, now); err != nil {
+			return err
+		}
+		if err := saveClockSkew(tx, skew); err != nil {
+			return err
+		}
+		if len(quarantined) > 0 {
+			if err := tx.Create(&quarantined).Error; err != nil {
+				return err
+			}
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		inserted, err := insertPositionRows(tx, rows)
+		if err != nil {
+			return err
+		}
+
+		// ts posisi terkini sebelum batch ini, untuk menandai fix yang terlambat
+		ids := make([]int64, 0, len(vehicleIDs))
+		for id := range vehicleIDs {
+			ids = append(ids, id)
+		}
+		var current []vehicle.VehicleCurrentPositionDB
+		if err := tx.Select("vehicle_id", "ts").Where("vehicle_id IN ?", ids).Find(&current).Error; err != nil {
+			return err
+		}
+		currentTS := make(map[int64]time.Time, len(current))
+		for _, c := range current {
+			currentTS[c.VehicleID] = c.TS
+		}
+
+		type latestFix struct {
+			target *Target
+			fix    *Fix
+		}
+		latest := map[int64]latestFix{}
+		var order []int64
+
+		for i, it := range items {
+			for j := range it.Fixes {
+				f := &it.Fixes[j]
+				if future(f) || drop[qualityRef{i, j}] {
+					continue
+				}
+				key := positionKey{DeviceID: it.Target.Device.ID, TS: f.TS.UTC().UnixMicro()}
+				if !inserted[key] {
+					results[i].Duplicates++
+					continue
+				}
+				// duplikat di dalam batch yang sama hanya dihitung sekali sebagai inserted
+				delete(inserted, key)
+				results[i].Inserted++
+				if fixQuality(f) != QualityGood {
+					results[i].Flagged++
+					continue
+				}
+
+				if cur, found := currentTS[it.Target.VehicleID]; found && !f.TS.After(cur) {
+					results[i].Late++
+					continue
+				}
+				l, found := latest[it.Target.VehicleID]
+				if !found {
+					order = append(order, it.Target.VehicleID)
+				}
+				if !found || f.TS.After(l.fix.TS) {
+					latest[it.Target.VehicleID] = latestFix{target: it.Target, fix: f}
+				}
+			}
+		}
+
+		for _, vehicleID := range order {
+			l := latest[vehicleID]
+			if err := upsertCurrentPosition(tx, l.target, l.fix); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// fixQuality marker fix, kosong (filter tidak aktif) dianggap GOOD
+func fixQuality(f *Fix) string {
+	if f.Quality == "" {
+		return QualityGood
+	}
+	return f.Quality
+}
+
+// kolom position_log yang ditulis insertPositionRows (urutan harus sama dengan args)
+const positionLogInsertColumns = "vehicle_id, device_id, ts, lat, lon, speed_kph, heading_deg, " +
+	"altitude_m, ignition_on, odometer_km, raw_payload, quality, created_at"
+
+// maksimal row per statement INSERT (13 parameter per row, jauh di bawah batas parameter Postgres)
+const positionLogInsertChunk = 1000
+
+// insertPositionRows multi-row INSERT ... ON CONFLICT DO NOTHING RETURNING device_id, ts.
+// Return kunci row yang benar-benar tersimpan (yang tidak ada di map = duplikat).
+func insertPositionRows(tx *gorm.DB, rows []PositionLog) (map[positionKey]bool, error) {
+	inserted := make(map[positionKey]bool, len(rows))
+
+	for start := 0; start < len(rows); start += positionLogInsertChunk {
+		end := start + positionLogInsertChunk
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		var sb strings.Builder
+		args := make([]interface{}, 0, (end-start)*13)
+		sb.WriteString("INSERT INTO position_log (" + positionLogInsertColumns + ") VALUES ")
+		for i, r := range rows[start:end] {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString("(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+			args = append(args, r.VehicleID, r.DeviceID, r.TS, r.Lat, r.Lon, r.SpeedKph, r.HeadingDeg,
+				r.AltitudeM, r.IgnitionOn, r.OdometerKm, r.RawPayload, r.Quality, r.CreatedAt)
+		}
+		sb.WriteString(" ON CONFLICT (device_id, ts) DO NOTHING RETURNING device_id, ts")
+
+		res, err := tx.Raw(sb.String(), args...).Rows()
+		if err != nil {
+			return nil, err
+		}
+		for res.Next() {
+			var deviceID int64
+			var ts time.Time
+			if err := res.Scan(&deviceID, &ts); err != nil {
+				res.Close()
+				return nil, err
+			}
+			inserted[positionKey{DeviceID: deviceID, TS: ts.UTC().UnixMicro()}] = true
+		}
+		err = res.Err()
+		res.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return inserted, nil
+}
+
+// upsertCurrentPosition menulis posisi terkini kendaraan (satu row per vehicle).
+// Row yang sudah ada hanya ditimpa bila ts fix lebih baru, jadi fix lama tidak pernah memundurkan posisi.
+func upsertCurrentPosition(tx *gorm.DB, t *Target, f *Fix) error {
+	deviceID := t.Device.ID
+	rec := vehicle.VehicleCurrentPositionDB{
+		VehicleID:  t.VehicleID,
+		DeviceID:   &deviceID,
+		TS:         f.TS.UTC(),
+		Lat:        f.Lat,
+		Lon:        f.Lon,
+		SpeedKph:   f.SpeedKph,
+		HeadingDeg: f.HeadingDeg,
+		IgnitionOn: f.IgnitionOn,
+		OdometerKm: f.OdometerKm,
+		UpdatedAt:  time.Now().UTC(),
+	}
+
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "vehicle_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"device_id", "ts", "lat", "lon", "speed_kph", "heading_deg",
+			"ignition_on", "odometer_km", "updated_at",
+		}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "vehicle_current_position.ts < excluded.ts"},
+		}},
+	}).Create(&rec).Error
+}
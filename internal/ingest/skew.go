@@ -0,0 +1,424 @@
+package ingest
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/device"
+	"github.com/username/fms-api/internal/pagination"
+)
+
+// Mode penanganan fix dari device yang jamnya meleset kronis
+const (
+	ClockSkewCorrect = "CORRECT" // ts digeser sebesar estimasi skew, ts asli disimpan di raw_payload.deviceTs
+	ClockSkewMark    = "MARK"    // ts dibiarkan, fix ditandai quality CLOCK_SKEW
+	ClockSkewOff     = "OFF"     // estimasi tetap dihitung tapi fix tidak diubah
+)
+
+const (
+	// key state estimasi skew di devices.metadata
+	clockSkewKey = "clockSkew"
+	// key override mode per device di devices.metadata (CORRECT / MARK / OFF)
+	clockSkewModeKey = "clockSkewMode"
+	// state yang estimasi & status kroniknya tidak berubah tetap ditulis ke devices.metadata tiap N sampel
+	clockSkewSaveEvery = 10
+)
+
+// ClockSkewConfig ambang deteksi jam device yang meleset
+type ClockSkewConfig struct {
+	Mode       string        // mode default bila devices.metadata.clockSkewMode kosong (default MARK)
+	Threshold  time.Duration // |estimasi| di bawah ini dianggap normal (default 2 menit)
+	MinSamples int           // sampel minimal sebelum estimasi dipakai (default 5)
+	Window     int           // jumlah sampel terakhir yang diambil mediannya (default 15)
+}
+
+func DefaultClockSkewConfig() ClockSkewConfig {
+	return ClockSkewConfig{
+		Mode:       ClockSkewMark,
+		Threshold:  2 * time.Minute,
+		MinSamples: 5,
+		Window:     15,
+	}
+}
+
+// ClockSkewState estimasi skew satu device, disimpan di devices.metadata.clockSkew.
+// Skew = ts device - waktu terima server, positif berarti jam device lebih cepat.
+type ClockSkewState struct {
+	EstimateSeconds int64     `json:"estimateSeconds"` // median jendela sampel
+	Samples         []int64   `json:"samples"`         // sampel terakhir dalam detik, paling lama di depan
+	Total           int64     `json:"total"`           // jumlah sampel sejak awal
+	UpdatedAt       time.Time `json:"updatedAt"`
+	// LastDeviceTS ts device (sebelum koreksi) dari fix terbaru yang diterima. Sampel hanya diambil
+	// dari fix yang lebih baru, supaya riwayat yang di-buffer device tidak terbaca sebagai jam meleset.
+	LastDeviceTS *time.Time `json:"lastDeviceTs,omitempty"`
+}
+
+// chronic estimasi sudah cukup sampel dan melewati ambang
+func (st *ClockSkewState) chronic(c ClockSkewConfig) bool {
+	return len(st.Samples) >= c.MinSamples && time.Duration(abs64(st.EstimateSeconds))*time.Second >= c.Threshold
+}
+
+// correction geseran ts dari estimasi. Estimasi yang dekat kelipatan 15 menit (salah zona waktu)
+// dibulatkan supaya latensi jaringan tidak ikut terbawa ke ts hasil koreksi.
+func (st *ClockSkewState) correction() time.Duration {
+	d := time.Duration(st.EstimateSeconds) * time.Second
+	if snapped := d.Round(15 * time.Minute); snapped != 0 && (d-snapped).Abs() <= time.Minute {
+		return snapped
+	}
+	return d
+}
+
+// ClockSkewFilter bandingkan ts device dengan waktu terima server, perbarui estimasi per device
+// lalu koreksi / tandai fix dari device yang skew-nya kronis. State di-cache di memori dan
+// diisi dari devices.metadata saat device pertama kali terlihat.
+type ClockSkewFilter struct {
+	Config ClockSkewConfig
+
+	mu    sync.Mutex
+	state map[int64]*deviceSkew
+}
+
+// deviceSkew state di memori satu device beserta state yang terakhir ditulis ke devices.metadata
+type deviceSkew struct {
+	ClockSkewState
+	savedEstimate int64
+	savedChronic  bool
+	savedTotal    int64
+}
+
+func NewClockSkewFilter(cfg ClockSkewConfig) *ClockSkewFilter {
+	return &ClockSkewFilter{Config: cfg, state: map[int64]*deviceSkew{}}
+}
+
+// Apply ambil satu sampel per device dari fix live terbaru di batch, lalu terapkan mode device ke
+// semua fix-nya (kecuali hasil import). Fix riwayat (Fix.History) dan fix yang tidak lebih baru dari
+// fix terakhir device tidak jadi sampel. Return state yang perlu ditulis ke devices.metadata:
+// hanya bila estimasi / status kronik berubah, atau tiap clockSkewSaveEvery sampel.
+func (k *ClockSkewFilter) Apply(db *gorm.DB, items []batchItem, now time.Time) map[int64]ClockSkewState {
+	type deviceFixes struct {
+		target *Target
+		fixes  []*Fix
+	}
+	byDevice := map[int64]*deviceFixes{}
+	var order []int64
+	for _, it := range items {
+		for j := range it.Fixes {
+			f := &it.Fixes[j]
+			if source, _ := f.Raw["protocol"].(string); source == ProtocolImport {
+				continue
+			}
+			id := it.Target.Device.ID
+			d, ok := byDevice[id]
+			if !ok {
+				d = &deviceFixes{target: it.Target}
+				byDevice[id] = d
+				order = append(order, id)
+			}
+			d.fixes = append(d.fixes, f)
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	updated := make(map[int64]ClockSkewState, len(order))
+	for _, id := range order {
+		d := byDevice[id]
+		ds := k.load(db, d.target.Device)
+		st := &ds.ClockSkewState
+
+		var sample, newest *Fix
+		for _, f := range d.fixes {
+			if newest == nil || f.TS.After(newest.TS) {
+				newest = f
+			}
+			if f.History || (st.LastDeviceTS != nil && !f.TS.After(*st.LastDeviceTS)) {
+				continue
+			}
+			if sample == nil || f.TS.After(sample.TS) {
+				sample = f
+			}
+		}
+		if st.LastDeviceTS == nil || newest.TS.After(*st.LastDeviceTS) {
+			ts := newest.TS.UTC()
+			st.LastDeviceTS = &ts
+		}
+
+		if sample != nil {
+			received := now
+			if sample.ReceivedAt != nil {
+				received = *sample.ReceivedAt
+			}
+			st.add(int64(sample.TS.Sub(received).Round(time.Second)/time.Second), k.window(), now)
+		}
+		chronic := st.chronic(k.Config)
+		if sample != nil && (st.EstimateSeconds != ds.savedEstimate || chronic != ds.savedChronic ||
+			st.Total-ds.savedTotal >= clockSkewSaveEvery) {
+			snapshot := *st
+			snapshot.Samples = append([]int64(nil), st.Samples...)
+			updated[id] = snapshot
+			ds.savedEstimate, ds.savedChronic, ds.savedTotal = st.EstimateSeconds, chronic, st.Total
+		}
+
+		if !chronic {
+			continue
+		}
+		mode := k.currentMode(db, d.target.Device)
+		for _, f := range d.fixes {
+			switch mode {
+			case ClockSkewCorrect:
+				raw := copyRaw(f.Raw)
+				raw["deviceTs"] = f.TS.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano)
+				raw["clockSkewSeconds"] = st.EstimateSeconds
+				f.Raw = raw
+				f.TS = f.TS.Add(-st.correction())
+			case ClockSkewMark:
+				raw := copyRaw(f.Raw)
+				raw["clockSkewSeconds"] = st.EstimateSeconds
+				f.Raw = raw
+				f.Quality = QualityClockSkew
+			}
+		}
+	}
+	return updated
+}
+
+// load state device dari cache, atau dari devices.metadata saat pertama terlihat. State lama tanpa
+// lastDeviceTs diisi dari ts terbaru di position_log selama ts tersimpan belum mungkin digeser (CORRECT).
+func (k *ClockSkewFilter) load(db *gorm.DB, dev device.Device) *deviceSkew {
+	if ds, ok := k.state[dev.ID]; ok {
+		return ds
+	}
+	st := clockSkewFromMetadata(dev.Metadata)
+	if st.LastDeviceTS == nil && db != nil && !(st.chronic(k.Config) && k.mode(dev) == ClockSkewCorrect) {
+		var last []PositionLog
+		if err := db.Select("ts").Where("device_id = ?", dev.ID).Order("ts DESC").Limit(1).Find(&last).Error; err != nil {
+			log.Printf("clock skew: device %d: gagal membaca fix terakhir: %v", dev.ID, err)
+		} else if len(last) == 1 {
+			ts := last[0].TS.UTC()
+			st.LastDeviceTS = &ts
+		}
+	}
+	ds := &deviceSkew{ClockSkewState: *st, savedEstimate: st.EstimateSeconds, savedChronic: st.chronic(k.Config), savedTotal: st.Total}
+	k.state[dev.ID] = ds
+	return ds
+}
+
+// clockSkewFromMetadata decode devices.metadata.clockSkew (state kosong bila belum ada)
+func clockSkewFromMetadata(meta map[string]interface{}) *ClockSkewState {
+	st := &ClockSkewState{}
+	if v, ok := meta[clockSkewKey]; ok {
+		if b, err := json.Marshal(v); err == nil {
+			json.Unmarshal(b, st)
+		}
+	}
+	return st
+}
+
+// currentMode mode dari devices.metadata yang dibaca ulang, karena Target.Device di-cache selama koneksi
+// sehingga perubahan clockSkewMode oleh admin baru terlihat setelah reconnect
+func (k *ClockSkewFilter) currentMode(db *gorm.DB, dev device.Device) string {
+	if db == nil {
+		return k.mode(dev)
+	}
+	var fresh device.Device
+	if err := db.Select("id", "metadata").Where("id = ?", dev.ID).Limit(1).Find(&fresh).Error; err != nil || fresh.ID == 0 {
+		return k.mode(dev)
+	}
+	return k.mode(fresh)
+}
+
+// mode override devices.metadata.clockSkewMode, default Config.Mode
+func (k *ClockSkewFilter) mode(dev device.Device) string {
+	if m, ok := dev.Metadata[clockSkewModeKey].(string); ok && m != "" {
+		return strings.ToUpper(m)
+	}
+	if k.Config.Mode == "" {
+		return ClockSkewMark
+	}
+	return k.Config.Mode
+}
+
+func (k *ClockSkewFilter) window() int {
+	if k.Config.Window <= 0 {
+		return DefaultClockSkewConfig().Window
+	}
+	return k.Config.Window
+}
+
+// add masukkan sampel baru ke jendela lalu hitung ulang median
+func (st *ClockSkewState) add(sample int64, window int, now time.Time) {
+	st.Samples = append(st.Samples, sample)
+	if len(st.Samples) > window {
+		st.Samples = append([]int64(nil), st.Samples[len(st.Samples)-window:]...)
+	}
+	st.Total++
+	st.UpdatedAt = now
+
+	sorted := append([]int64(nil), st.Samples...)
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a] < sorted[b] })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		st.EstimateSeconds = sorted[mid]
+	} else {
+		st.EstimateSeconds = (sorted[mid-1] + sorted[mid]) / 2
+	}
+}
+
+// saveClockSkew tulis state estimasi ke devices.metadata.clockSkew. Metadata dibaca ulang di dalam
+// transaksi supaya key lain (yang mungkin baru diubah admin) tidak tertimpa.
+func saveClockSkew(tx *gorm.DB, states map[int64]ClockSkewState) error {
+	for id, st := range states {
+		var dev device.Device
+		if err := tx.Select("id", "metadata").Where("id = ?", id).Limit(1).Find(&dev).Error; err != nil {
+			return err
+		}
+		if dev.ID == 0 {
+			continue
+		}
+		meta := dev.Metadata
+		if meta == nil {
+			meta = map[string]interface{}{}
+		}
+		meta[clockSkewKey] = st
+		if err := tx.Model(&device.Device{}).Where("id = ?", id).Update("metadata", meta).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storedDeviceTS ts asli device dari raw_payload.deviceTs (fix yang digeser mode CORRECT)
+func storedDeviceTS(raw map[string]interface{}) (time.Time, bool) {
+	v, ok := raw["deviceTs"].(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	ts, err := time.Parse(time.RFC3339Nano, v)
+	return ts, err == nil
+}
+
+func copyRaw(raw map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(raw)+2)
+	for k, v := range raw {
+		out[k] = v
+	}
+	return out
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// ========= HANDLER =========
+
+// ClockSkewDevice satu device dengan jam yang meleset kronis
+type ClockSkewDevice struct {
+	DeviceID        int64      `json:"deviceId"`
+	DataSourceID    int64      `json:"dataSourceId"`
+	ExternalID      string     `json:"externalId"`
+	Protocol        string     `json:"protocol"`
+	Mode            string     `json:"mode"`
+	EstimateSeconds int64      `json:"estimateSeconds"`
+	Samples         int        `json:"samples"`
+	Total           int64      `json:"total"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+	LastSeenAt      *time.Time `json:"lastSeenAt"`
+}
+
+// ListClockSkew GET /admin/ingest/clock-skew
+// Device dengan |estimasi skew| >= ambang (query minSeconds, default ambang filter) dan sampel cukup,
+// urut dari skew terbesar.
+func (h *Handler) ListClockSkew(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok || !cu.IsSuperAdmin() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "message": "hanya SUPER_ADMIN"})
+		return
+	}
+
+	filter := h.Service.ClockSkew
+	if filter == nil {
+		filter = NewClockSkewFilter(DefaultClockSkewConfig())
+	}
+	cfg := filter.Config
+	if v := c.Query("minSeconds"); v != "" {
+		sec, err := strconv.Atoi(v)
+		if err != nil || sec < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "minSeconds tidak valid"})
+			return
+		}
+		cfg.Threshold = time.Duration(sec) * time.Second
+	}
+
+	p := pagination.ParsePagination(c)
+	if c.IsAborted() {
+		return
+	}
+
+	// state ada di JSONB devices.metadata.clockSkew: disaring, diurutkan & dipaging di database
+	present, magnitude, samples := clockSkewColumns(h.DB)
+	minSamples := cfg.MinSamples
+	if minSamples < 1 {
+		minSamples = 1
+	}
+	query := h.DB.Model(&device.Device{}).
+		Where(present).
+		Where(samples+" >= ?", minSamples).
+		Where(magnitude+" >= ?", int64(cfg.Threshold/time.Second))
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	var devs []device.Device
+	if err := query.Order(magnitude + " DESC, id").Limit(p.Limit).Offset(p.Offset).
+		Find(&devs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	rows := make([]ClockSkewDevice, 0, len(devs))
+	for _, dev := range devs {
+		st := clockSkewFromMetadata(dev.Metadata)
+		rows = append(rows, ClockSkewDevice{
+			DeviceID:        dev.ID,
+			DataSourceID:    dev.DataSourceID,
+			ExternalID:      dev.ExternalID,
+			Protocol:        dev.Protocol,
+			Mode:            filter.mode(dev),
+			EstimateSeconds: st.EstimateSeconds,
+			Samples:         len(st.Samples),
+			Total:           st.Total,
+			UpdatedAt:       st.UpdatedAt,
+			LastSeenAt:      dev.LastSeenAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": rows, "pagination": gin.H{"total": total, "limit": p.Limit, "page": p.Page, "max_limit": p.MaxLimit}})
+}
+
+// clockSkewColumns ekspresi SQL state skew di devices.metadata.clockSkew: syarat state ada, |estimasi|,
+// dan jumlah sampel. PostgreSQL memakai operator JSONB (sesuai idx_devices_clock_skew), sqlite (test) json_extract.
+func clockSkewColumns(db *gorm.DB) (present, magnitude, samples string) {
+	if db.Dialector.Name() == "sqlite" {
+		return "json_extract(metadata, '$.clockSkew') IS NOT NULL",
+			"ABS(CAST(json_extract(metadata, '$.clockSkew.estimateSeconds') AS INTEGER))",
+			"json_array_length(metadata, '$.clockSkew.samples')"
+	}
+	return "metadata->'clockSkew' IS NOT NULL",
+		"ABS((metadata->'clockSkew'->>'estimateSeconds')::BIGINT)",
+		"jsonb_array_length(metadata->'clockSkew'->'samples')"
+}
@@ -0,0 +1,53 @@
+package ingest
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// tcpListener menyimpan listener aktif supaya server protokol bisa ditutup saat shutdown
+type tcpListener struct {
+	mu sync.Mutex
+	ln net.Listener
+}
+
+func (l *tcpListener) serve(ln net.Listener, handle func(net.Conn)) error {
+	l.mu.Lock()
+	l.ln = ln
+	l.mu.Unlock()
+	return acceptLoop(ln, handle)
+}
+
+// Close berhenti menerima koneksi baru (koneksi yang sudah ada tetap berjalan)
+func (l *tcpListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ln == nil {
+		return nil
+	}
+	return l.ln.Close()
+}
+
+// acceptLoop menerima koneksi dan menjalankan handler per koneksi di goroutine sendiri.
+// Return nil kalau listener ditutup dengan normal.
+func acceptLoop(ln net.Listener, handle func(net.Conn)) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go handle(conn)
+	}
+}
+
+// touchDeadline memperpanjang read deadline koneksi (idle timeout)
+func touchDeadline(conn net.Conn, idle time.Duration) {
+	if idle > 0 {
+		conn.SetReadDeadline(time.Now().Add(idle))
+	}
+}
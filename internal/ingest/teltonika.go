@@ -0,0 +1,501 @@
+package ingest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/username/fms-api/internal/command"
+)
+
+const (
+	ProtocolTeltonika = "TELTONIKA"
+
+	TeltonikaCodec8  byte = 0x08
+	TeltonikaCodec8E byte = 0x8E
+	TeltonikaCodec12 byte = 0x0C // command GPRS (server -> device) dan balasannya
+
+	teltonikaCommandType  byte = 0x05
+	teltonikaResponseType byte = 0x06
+
+	// IO element ID yang dipetakan ke kolom position_log
+	teltonikaIOIgnition = 239
+	teltonikaIOOdometer = 16 // total odometer, meter
+)
+
+var (
+	ErrTeltonikaCRC   = errors.New("teltonika: CRC tidak cocok")
+	ErrTeltonikaCodec = errors.New("teltonika: codec tidak didukung")
+)
+
+// TeltonikaRecord = satu AVL record hasil decode
+type TeltonikaRecord struct {
+	Timestamp  time.Time
+	Priority   byte
+	Lon        float64
+	Lat        float64
+	Altitude   int16
+	Angle      uint16
+	Satellites byte
+	Speed      uint16
+	EventIOID  uint16
+	IO         map[uint16]uint64 // elemen IO 1/2/4/8 byte
+	IOX        map[uint16][]byte // elemen IO variable length (Codec 8E)
+	Raw        []byte            // byte mentah record, disimpan untuk reprocessing
+}
+
+// TeltonikaPacket = satu AVL data packet (preamble s/d CRC)
+type TeltonikaPacket struct {
+	Codec   byte
+	Records []TeltonikaRecord
+}
+
+// TeltonikaCRC16 menghitung CRC-16/IBM (poly 0xA001) seperti yang dipakai di AVL packet
+func TeltonikaCRC16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 == 1 {
+				crc = (crc >> 1) ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// ReadTeltonikaIMEI membaca handshake awal: 2 byte panjang + IMEI ASCII
+func ReadTeltonikaIMEI(r io.Reader) (string, error) {
+	var lenBuf [2]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return "", err
+	}
+	n := binary.BigEndian.Uint16(lenBuf[:])
+	if n == 0 || n > 32 {
+		return "", fmt.Errorf("teltonika: panjang IMEI tidak valid (%d)", n)
+	}
+	imei := make([]byte, n)
+	if _, err := io.ReadFull(r, imei); err != nil {
+		return "", err
+	}
+	for _, ch := range imei {
+		if ch < '0' || ch > '9' {
+			return "", fmt.Errorf("teltonika: IMEI bukan angka (%q)", imei)
+		}
+	}
+	return string(imei), nil
+}
+
+// ReadTeltonikaFrame membaca satu AVL packet utuh (preamble, length, data, CRC)
+func ReadTeltonikaFrame(r io.Reader) ([]byte, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(header[0:4]) != 0 {
+		return nil, errors.New("teltonika: preamble bukan nol")
+	}
+	dataLen := binary.BigEndian.Uint32(header[4:8])
+	if dataLen < 3 || dataLen > 1<<20 {
+		return nil, fmt.Errorf("teltonika: panjang data tidak valid (%d)", dataLen)
+	}
+
+	frame := make([]byte, 8+int(dataLen)+4)
+	copy(frame, header[:])
+	if _, err := io.ReadFull(r, frame[8:]); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// DecodeTeltonikaPacket decode frame Codec 8 / Codec 8 Extended beserta cek CRC
+func DecodeTeltonikaPacket(frame []byte) (*TeltonikaPacket, error) {
+	if len(frame) < 8+3+4 {
+		return nil, errors.New("teltonika: frame terlalu pendek")
+	}
+	dataLen := int(binary.BigEndian.Uint32(frame[4:8]))
+	if len(frame) != 8+dataLen+4 {
+		return nil, errors.New("teltonika: panjang frame tidak sesuai header")
+	}
+
+	data := frame[8 : 8+dataLen]
+	crc := binary.BigEndian.Uint32(frame[8+dataLen:])
+	if uint32(TeltonikaCRC16(data)) != crc {
+		return nil, ErrTeltonikaCRC
+	}
+
+	codec := data[0]
+	if codec != TeltonikaCodec8 && codec != TeltonikaCodec8E {
+		return nil, ErrTeltonikaCodec
+	}
+
+	count := int(data[1])
+	if int(data[len(data)-1]) != count {
+		return nil, errors.New("teltonika: jumlah record awal dan akhir berbeda")
+	}
+
+	pkt := &TeltonikaPacket{Codec: codec}
+	body := data[2 : len(data)-1]
+	for i := 0; i < count; i++ {
+		rec, n, err := decodeTeltonikaRecord(codec, body)
+		if err != nil {
+			return nil, fmt.Errorf("teltonika: record %d: %w", i, err)
+		}
+		pkt.Records = append(pkt.Records, rec)
+		body = body[n:]
+	}
+	if len(body) != 0 {
+		return nil, errors.New("teltonika: ada sisa byte setelah record terakhir")
+	}
+
+	return pkt, nil
+}
+
+// EncodeTeltonikaCommand membuat frame Codec 12 berisi satu command teks
+func EncodeTeltonikaCommand(text string) []byte {
+	data := make([]byte, 0, 8+len(text))
+	data = append(data, TeltonikaCodec12, 0x01, teltonikaCommandType)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(text)))
+	data = append(data, text...)
+	data = append(data, 0x01)
+
+	frame := make([]byte, 8, 8+len(data)+4)
+	binary.BigEndian.PutUint32(frame[4:8], uint32(len(data)))
+	frame = append(frame, data...)
+	return binary.BigEndian.AppendUint32(frame, uint32(TeltonikaCRC16(data)))
+}
+
+// DecodeTeltonikaResponse ambil teks balasan command dari frame Codec 12 (type 0x06)
+func DecodeTeltonikaResponse(frame []byte) (string, error) {
+	if len(frame) < 8+8+4 {
+		return "", errors.New("teltonika: frame codec 12 terlalu pendek")
+	}
+	dataLen := int(binary.BigEndian.Uint32(frame[4:8]))
+	if len(frame) != 8+dataLen+4 {
+		return "", errors.New("teltonika: panjang frame tidak sesuai header")
+	}
+	data := frame[8 : 8+dataLen]
+	if uint32(TeltonikaCRC16(data)) != binary.BigEndian.Uint32(frame[8+dataLen:]) {
+		return "", ErrTeltonikaCRC
+	}
+	if data[0] != TeltonikaCodec12 || data[2] != teltonikaResponseType {
+		return "", fmt.Errorf("teltonika: bukan balasan command (codec 0x%02x type 0x%02x)", data[0], data[2])
+	}
+	size := int(binary.BigEndian.Uint32(data[3:7]))
+	if 7+size+1 != len(data) {
+		return "", errors.New("teltonika: panjang balasan command tidak sesuai")
+	}
+	return string(data[7 : 7+size]), nil
+}
+
+// DecodeTeltonikaRecord decode satu record mentah (misal dari raw_payload saat reprocessing)
+func DecodeTeltonikaRecord(codec byte, raw []byte) (TeltonikaRecord, error) {
+	rec, n, err := decodeTeltonikaRecord(codec, raw)
+	if err != nil {
+		return rec, err
+	}
+	if n != len(raw) {
+		return rec, errors.New("teltonika: panjang record tidak sesuai")
+	}
+	return rec, nil
+}
+
+// byteCursor pembaca big-endian sederhana dengan cek batas
+type byteCursor struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (c *byteCursor) next(n int) []byte {
+	if c.err != nil {
+		return nil
+	}
+	if c.pos+n > len(c.buf) {
+		c.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := c.buf[c.pos : c.pos+n]
+	c.pos += n
+	return b
+}
+
+func (c *byteCursor) uint(n int) uint64 {
+	b := c.next(n)
+	var v uint64
+	for _, x := range b {
+		v = v<<8 | uint64(x)
+	}
+	return v
+}
+
+func decodeTeltonikaRecord(codec byte, buf []byte) (TeltonikaRecord, int, error) {
+	c := &byteCursor{buf: buf}
+	var rec TeltonikaRecord
+
+	ms := int64(c.uint(8))
+	rec.Timestamp = time.UnixMilli(ms).UTC()
+	rec.Priority = byte(c.uint(1))
+	rec.Lon = float64(int32(c.uint(4))) / 1e7
+	rec.Lat = float64(int32(c.uint(4))) / 1e7
+	rec.Altitude = int16(c.uint(2))
+	rec.Angle = uint16(c.uint(2))
+	rec.Satellites = byte(c.uint(1))
+	rec.Speed = uint16(c.uint(2))
+
+	// Codec 8 pakai ID & counter 1 byte, Codec 8E pakai 2 byte
+	idSize := 1
+	if codec == TeltonikaCodec8E {
+		idSize = 2
+	}
+
+	rec.EventIOID = uint16(c.uint(idSize))
+	c.uint(idSize) // total jumlah IO, tidak dipakai
+	rec.IO = map[uint16]uint64{}
+	for _, valSize := range []int{1, 2, 4, 8} {
+		n := int(c.uint(idSize))
+		for i := 0; i < n && c.err == nil; i++ {
+			id := uint16(c.uint(idSize))
+			rec.IO[id] = c.uint(valSize)
+		}
+	}
+	if codec == TeltonikaCodec8E {
+		n := int(c.uint(2))
+		for i := 0; i < n && c.err == nil; i++ {
+			id := uint16(c.uint(2))
+			l := int(c.uint(2))
+			if rec.IOX == nil {
+				rec.IOX = map[uint16][]byte{}
+			}
+			rec.IOX[id] = append([]byte(nil), c.next(l)...)
+		}
+	}
+
+	if c.err != nil {
+		return rec, 0, c.err
+	}
+	rec.Raw = append([]byte(nil), buf[:c.pos]...)
+	return rec, c.pos, nil
+}
+
+// teltonikaCodecName nama codec untuk disimpan di raw_payload
+func teltonikaCodecName(codec byte) string {
+	if codec == TeltonikaCodec8E {
+		return "8E"
+	}
+	return "8"
+}
+
+// Fix konversi record ke Fix, IO element ikut disimpan di raw payload
+func (r TeltonikaRecord) Fix(codec byte) Fix {
+	speed := float64(r.Speed)
+	heading := float64(r.Angle)
+	alt := float64(r.Altitude)
+
+	io := map[string]interface{}{}
+	for id, v := range r.IO {
+		io[strconv.Itoa(int(id))] = v
+	}
+	for id, v := range r.IOX {
+		io[strconv.Itoa(int(id))] = hex.EncodeToString(v)
+	}
+
+	f := Fix{
+		TS:         r.Timestamp,
+		Lat:        r.Lat,
+		Lon:        r.Lon,
+		SpeedKph:   &speed,
+		HeadingDeg: &heading,
+		AltitudeM:  &alt,
+		Raw: map[string]interface{}{
+			"protocol":   ProtocolTeltonika,
+			"codec":      teltonikaCodecName(codec),
+			"record":     hex.EncodeToString(r.Raw),
+			"priority":   r.Priority,
+			"satellites": r.Satellites,
+			"eventIoId":  r.EventIOID,
+			"io":         io,
+		},
+	}
+
+	if v, ok := r.IO[teltonikaIOIgnition]; ok {
+		on := v != 0
+		f.IgnitionOn = &on
+	}
+	if v, ok := r.IO[teltonikaIOOdometer]; ok {
+		km := float64(v) / 1000
+		f.OdometerKm = &km
+	}
+
+	return f
+}
+
+// ========= TCP SERVER =========
+
+// TeltonikaServer listener TCP untuk device Teltonika (Codec 8 / 8E, command lewat Codec 12)
+type TeltonikaServer struct {
+	Addr        string
+	Service     *Service
+	IdleTimeout time.Duration
+
+	tcpListener
+}
+
+func NewTeltonikaServer(addr string, svc *Service) *TeltonikaServer {
+	return &TeltonikaServer{Addr: addr, Service: svc, IdleTimeout: 10 * time.Minute}
+}
+
+// ListenAndServe buka port lalu layani koneksi sampai listener ditutup
+func (s *TeltonikaServer) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+func (s *TeltonikaServer) Serve(ln net.Listener) error {
+	return s.serve(ln, s.HandleConn)
+}
+
+// HandleConn menjalankan handshake IMEI lalu loop baca AVL packet + kirim ACK
+func (s *TeltonikaServer) HandleConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	s.touchDeadline(conn)
+	imei, err := ReadTeltonikaIMEI(r)
+	if err != nil {
+		log.Printf("teltonika: handshake gagal dari %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+
+	target, err := s.Service.ResolveByProtocol(ProtocolTeltonika, imei)
+	if errors.Is(err, ErrUnknownDevice) && s.Service.AcceptUnknown {
+		log.Printf("teltonika: IMEI %s belum terdaftar, paket ditahan di dead-letter", imei)
+		s.holdUnknown(conn, r, imei)
+		return
+	}
+	if err != nil {
+		log.Printf("teltonika: IMEI %s ditolak: %v", imei, err)
+		conn.Write([]byte{0x00})
+		return
+	}
+	if _, err := conn.Write([]byte{0x01}); err != nil {
+		return
+	}
+	if err := s.Service.Seen(target.Device.ID, ProtocolTeltonika); err != nil {
+		log.Printf("teltonika: IMEI %s: gagal mencatat last seen: %v", imei, err)
+	}
+
+	// setelah handshake semua tulisan lewat session supaya tidak bentrok dengan command downlink
+	sess := s.Service.Commands.attach(target.Device.ID, conn, func(cmd *command.DeviceCommand) []byte {
+		return EncodeTeltonikaCommand(cmd.Text)
+	})
+	defer s.Service.Commands.detach(sess)
+
+	for {
+		s.touchDeadline(conn)
+		frame, err := ReadTeltonikaFrame(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("teltonika: IMEI %s: gagal membaca frame: %v", imei, err)
+			}
+			return
+		}
+
+		if frame[8] == TeltonikaCodec12 {
+			// balasan command, tidak di-ACK
+			text, err := DecodeTeltonikaResponse(frame)
+			if err != nil {
+				log.Printf("teltonika: IMEI %s: %v", imei, err)
+				continue
+			}
+			s.Service.Commands.ack(target.Device.ID, nil, text)
+			continue
+		}
+
+		pkt, err := DecodeTeltonikaPacket(frame)
+		if err != nil {
+			// ACK 0 record supaya device mengirim ulang packet yang sama
+			log.Printf("teltonika: IMEI %s: frame tidak valid: %v", imei, err)
+			s.Service.HoldUnparsable(ProtocolTeltonika, imei, map[string]interface{}{"frame": hex.EncodeToString(frame)}, err)
+			if err := writeTeltonikaAck(sess, 0); err != nil {
+				return
+			}
+			continue
+		}
+
+		fixes := make([]Fix, 0, len(pkt.Records))
+		for _, rec := range pkt.Records {
+			f := rec.Fix(pkt.Codec)
+			f.Raw["imei"] = imei
+			fixes = append(fixes, f)
+		}
+
+		if _, err := s.Service.Store(target, fixes); err != nil {
+			// jangan ACK, device akan kirim ulang
+			log.Printf("teltonika: IMEI %s: gagal menyimpan posisi: %v", imei, err)
+			return
+		}
+
+		if err := writeTeltonikaAck(sess, len(pkt.Records)); err != nil {
+			return
+		}
+	}
+}
+
+// holdUnknown terima koneksi IMEI yang belum terdaftar: setiap AVL packet di-decode, ditahan
+// di dead-letter lalu di-ACK supaya device tidak menumpuk data di memorinya.
+func (s *TeltonikaServer) holdUnknown(conn net.Conn, r io.Reader, imei string) {
+	if _, err := conn.Write([]byte{0x01}); err != nil {
+		return
+	}
+	for {
+		s.touchDeadline(conn)
+		frame, err := ReadTeltonikaFrame(r)
+		if err != nil {
+			return
+		}
+		payload := map[string]interface{}{"frame": hex.EncodeToString(frame)}
+
+		pkt, err := DecodeTeltonikaPacket(frame)
+		if err != nil {
+			s.Service.HoldUnparsable(ProtocolTeltonika, imei, payload, err)
+			if err := writeTeltonikaAck(conn, 0); err != nil {
+				return
+			}
+			continue
+		}
+		fixes := make([]Fix, 0, len(pkt.Records))
+		for _, rec := range pkt.Records {
+			f := rec.Fix(pkt.Codec)
+			f.Raw["imei"] = imei
+			fixes = append(fixes, f)
+		}
+		s.Service.HoldUnknown(ProtocolTeltonika, "", imei, fixes, payload)
+		if err := writeTeltonikaAck(conn, len(pkt.Records)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *TeltonikaServer) touchDeadline(conn net.Conn) {
+	touchDeadline(conn, s.IdleTimeout)
+}
+
+func writeTeltonikaAck(w io.Writer, n int) error {
+	var ack [4]byte
+	binary.BigEndian.PutUint32(ack[:], uint32(n))
+	_, err := w.Write(ack[:])
+	return err
+}
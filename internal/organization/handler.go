@@ -2,6 +2,7 @@ package organization
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
@@ -23,6 +24,7 @@ func NewHandler(db *gorm.DB) *Handler {
 type CreateOrgRequest struct {
 	Name          string  `json:"name"`
 	Code          *string `json:"code"`
+	Timezone      *string `json:"timezone"`
 	AdminEmail    string  `json:"adminEmail"`
 	AdminPassword string  `json:"adminPassword"`
 	AdminFullName string  `json:"adminFullName"`
@@ -53,6 +55,8 @@ func (h *Handler) RegisterAdminRoutes(r gin.IRoutes) {
 type UpdateOrgRequest struct {
 	Name *string `json:"name,omitempty"`
 	Code *string `json:"code,omitempty"`
+	// Timezone nama IANA (mis. Asia/Jakarta); rollup harian lama perlu fmsctl refresh-daily-stats
+	Timezone *string `json:"timezone,omitempty"`
 	// Active can be toggled by SUPER_ADMIN
 	Active *bool `json:"active,omitempty"`
 }
@@ -148,6 +152,13 @@ func (h *Handler) UpdateOrganization(c *gin.Context) {
 	if req.Code != nil {
 		org.Code = req.Code
 	}
+	if req.Timezone != nil {
+		if !validTimezone(*req.Timezone) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "timezone tidak dikenal"})
+			return
+		}
+		org.Timezone = *req.Timezone
+	}
 	if req.Active != nil {
 		org.Active = *req.Active
 	}
@@ -215,6 +226,17 @@ func (h *Handler) CreateOrganizationWithAdmin(c *gin.Context) {
 		})
 		return
 	}
+	timezone := DefaultTimezone
+	if req.Timezone != nil {
+		if !validTimezone(*req.Timezone) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "bad_request",
+				"message": "timezone tidak dikenal",
+			})
+			return
+		}
+		timezone = *req.Timezone
+	}
 
 	// 2. Hash password admin
 	hash, err := bcrypt.GenerateFromPassword([]byte(req.AdminPassword), bcrypt.DefaultCost)
@@ -230,9 +252,10 @@ func (h *Handler) CreateOrganizationWithAdmin(c *gin.Context) {
 	err = h.DB.Transaction(func(tx *gorm.DB) error {
 		// 3a. Buat organization
 		org := Organization{
-			Name:   req.Name,
-			Code:   req.Code,
-			Active: true,
+			Name:     req.Name,
+			Code:     req.Code,
+			Active:   true,
+			Timezone: timezone,
 		}
 		if err := tx.Create(&org).Error; err != nil {
 			return err
@@ -289,3 +312,12 @@ func (h *Handler) CreateOrganizationWithAdmin(c *gin.Context) {
 
 	c.JSON(http.StatusCreated, resp)
 }
+
+// validTimezone nama zona waktu IANA yang dikenal
+func validTimezone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
@@ -2,11 +2,15 @@ package organization
 
 import "time"
 
+// DefaultTimezone zona waktu organisasi bila tidak diisi
+const DefaultTimezone = "UTC"
+
 type Organization struct {
 	ID        int64     `json:"id"        gorm:"column:id;primaryKey"`
 	Name      string    `json:"name"      gorm:"column:name"`
 	Code      *string   `json:"code"      gorm:"column:code"`
 	Active    bool      `json:"active"    gorm:"column:active"`
+	Timezone  string    `json:"timezone"  gorm:"column:timezone;default:UTC"` // nama IANA, batas hari laporan harian
 	CreatedAt time.Time `json:"createdAt" gorm:"column:created_at"`
 }
 
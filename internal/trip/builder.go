@@ -0,0 +1,378 @@
+package trip
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// jumlah fix position_log yang dibaca per query saat membangun trip
+const builderPointBatch = 1000
+
+// pagedPoint fix beserta id position_log. Batch dibaca urut (ts, id) supaya fix dengan ts sama
+// (beberapa device di satu kendaraan) di batas batch tidak terlewat.
+type pagedPoint struct {
+	ID    int64 `gorm:"column:id"`
+	Point `gorm:"embedded"`
+}
+
+// afterPoint saring fix sesudah cursor (ts, id); id 0 = semua fix sesudah ts
+func afterPoint(q *gorm.DB, ts time.Time, id int64) *gorm.DB {
+	if id == 0 {
+		return q.Where("ts > ?", ts)
+	}
+	return q.Where("(ts > ? OR (ts = ? AND id > ?))", ts, ts, id)
+}
+
+// Builder mengisi tabel trips dari position_log secara incremental. Tiap putaran hanya kendaraan
+// yang posisi terkininya maju (atau sedang trip) yang diproses, mulai dari fix sesudah
+// trip_builder_states.last_ts. Hanya fix GOOD yang dipakai; fix terlambat (ts lebih lama dari
+// yang sudah diproses) tidak mengubah trip.
+type Builder struct {
+	DB       *gorm.DB
+	Rules    Rules         // default, ditimpa aturan organisasi / kendaraan di trip_rules
+	Interval time.Duration // default 30 detik
+	Lookback time.Duration // kendaraan yang belum punya state mulai dari now - Lookback (default 24 jam)
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewBuilder(db *gorm.DB) *Builder {
+	return &Builder{DB: db, Rules: DefaultRules(), Interval: 30 * time.Second, Lookback: 24 * time.Hour}
+}
+
+// RunOnce proses semua kendaraan yang punya fix baru atau trip terbuka per now. Kendaraan yang
+// gagal dibangun dicatat di log dan dilewati (dicoba lagi putaran berikutnya), kendaraan lain tetap diproses.
+// Return jumlah trip yang ditutup.
+func (b *Builder) RunOnce(now time.Time) (int, error) {
+	var ids []int64
+	err := b.DB.Table("vehicle_current_position p").
+		Joins("LEFT JOIN trip_builder_states s ON s.vehicle_id = p.vehicle_id").
+		Where("s.vehicle_id IS NULL OR p.ts > s.last_ts OR s.open IS NOT NULL").
+		Order("p.vehicle_id").
+		Pluck("p.vehicle_id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	closed := 0
+	for _, id := range ids {
+		n, err := b.BuildVehicle(id, now)
+		if err != nil {
+			log.Printf("trip builder: kendaraan %d: %v", id, err)
+			continue
+		}
+		closed += n
+	}
+	return closed, nil
+}
+
+// BuildVehicle lanjutkan segmentasi satu kendaraan dalam satu transaksi. Return jumlah trip yang ditutup.
+func (b *Builder) BuildVehicle(vehicleID int64, now time.Time) (int, error) {
+	closed := 0
+	err := b.DB.Transaction(func(tx *gorm.DB) error {
+		// kunci yang sama dengan Rebuilder; kendaraan yang sudah dihapus dilewati
+		found, err := lockVehicle(tx, vehicleID)
+		if err != nil || !found {
+			return err
+		}
+
+		var st BuilderState
+		if err := tx.Where("vehicle_id = ?", vehicleID).Limit(1).Find(&st).Error; err != nil {
+			return err
+		}
+		st.VehicleID = vehicleID
+
+		rules, err := ResolveRules(tx, b.Rules, vehicleID)
+		if err != nil {
+			return err
+		}
+		seg, err := st.segmenter(rules)
+		if err != nil {
+			return err
+		}
+		from := now.Add(-b.lookback())
+		if st.LastTS != nil {
+			from = *st.LastTS
+		}
+		// rollup harian dihitung ulang mulai dari trip / stop yang sedang berjalan atau cursor
+		statsFrom, busy := from, seg.open != nil || seg.stop != nil
+		if seg.open != nil && seg.open.StartTS.Before(statsFrom) {
+			statsFrom = seg.open.StartTS
+		}
+		if seg.stop != nil && seg.stop.StartTS.Before(statsFrom) {
+			statsFrom = seg.stop.StartTS
+		}
+		processed := 0
+
+		var lastID int64
+		for {
+			var points []pagedPoint
+			q := tx.Table("position_log").
+				Select("id", "ts", "lat", "lon", "speed_kph", "ignition_on").
+				Where("vehicle_id = ? AND quality = ?", vehicleID, "GOOD")
+			if err := afterPoint(q, from, lastID).Order("ts, id").Limit(builderPointBatch).
+				Find(&points).Error; err != nil {
+				return err
+			}
+			for _, p := range points {
+				seg.add(p.Point)
+			}
+			processed += len(points)
+			if len(points) < builderPointBatch {
+				break
+			}
+			from, lastID = points[len(points)-1].TS, points[len(points)-1].ID
+		}
+		seg.closeSilent(now)
+
+		for i := range seg.closed {
+			if err := saveTrip(tx, vehicleID, &seg.closed[i], StatusClosed); err != nil {
+				return err
+			}
+		}
+		if len(seg.discarded) > 0 {
+			if err := tx.Where("id IN ?", seg.discarded).Delete(&Trip{}).Error; err != nil {
+				return err
+			}
+		}
+		if seg.open != nil && seg.open.qualifies(rules) {
+			if err := saveTrip(tx, vehicleID, seg.open, StatusOpen); err != nil {
+				return err
+			}
+		}
+		closed = len(seg.closed)
+		if _, err := saveStops(tx, vehicleID, seg, true); err != nil {
+			return err
+		}
+		if processed > 0 || busy {
+			if err := refreshDailyStats(tx, vehicleID, statsFrom, now); err != nil {
+				return err
+			}
+		}
+
+		// belum ada fix yang diproses: cursor tetap maju supaya kendaraan tidak diproses ulang tiap putaran
+		if seg.prev == nil && st.LastTS == nil {
+			st.LastTS = &from
+		}
+		return st.save(tx, seg, now)
+	})
+	return closed, err
+}
+
+func (b *Builder) lookback() time.Duration {
+	if b.Lookback <= 0 {
+		return 24 * time.Hour
+	}
+	return b.Lookback
+}
+
+// segmenter pulihkan state machine dari row state
+func (st *BuilderState) segmenter(rules Rules) (*segmenter, error) {
+	seg := &segmenter{rules: rules}
+	if st.LastTS != nil && st.LastLat != nil && st.LastLon != nil {
+		seg.prev = &Point{TS: *st.LastTS, Lat: *st.LastLat, Lon: *st.LastLon}
+	}
+	if len(st.Open) > 0 {
+		seg.open = &Segment{}
+		if err := json.Unmarshal(st.Open, seg.open); err != nil {
+			return nil, err
+		}
+	}
+	if len(st.Stop) > 0 {
+		seg.stop = &StopSegment{}
+		if err := json.Unmarshal(st.Stop, seg.stop); err != nil {
+			return nil, err
+		}
+	}
+	return seg, nil
+}
+
+// save tulis balik state machine ke trip_builder_states
+func (st *BuilderState) save(tx *gorm.DB, seg *segmenter, now time.Time) error {
+	st.Open, st.Stop = nil, nil
+	if seg.open != nil {
+		b, err := json.Marshal(seg.open)
+		if err != nil {
+			return err
+		}
+		st.Open = datatypes.JSON(b)
+	}
+	if seg.stop != nil {
+		b, err := json.Marshal(seg.stop)
+		if err != nil {
+			return err
+		}
+		st.Stop = datatypes.JSON(b)
+	}
+	if seg.prev != nil {
+		ts, lat, lon := seg.prev.TS.UTC(), seg.prev.Lat, seg.prev.Lon
+		st.LastTS, st.LastLat, st.LastLon = &ts, &lat, &lon
+	}
+	st.UpdatedAt = now
+
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "vehicle_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_ts", "last_lat", "last_lon", "open", "stop", "updated_at"}),
+	}).Create(st).Error
+}
+
+// saveTrip insert / update row trips dari segmen. TripID segmen diisi setelah insert.
+// Trip yang ditutup langsung diklasifikasi dengan aturan klasifikasi organisasi.
+func saveTrip(tx *gorm.DB, vehicleID int64, s *Segment, status string) error {
+	duration := int64(s.Duration() / time.Second)
+	distance := round2(s.DistanceKm)
+	maxSpeed := round2(s.MaxSpeedKph)
+	var avgSpeed float64
+	if duration > 0 {
+		avgSpeed = round2(s.DistanceKm / s.Duration().Hours())
+	}
+	startLat, startLon, endLat, endLon := s.StartLat, s.StartLon, s.EndLat, s.EndLon
+
+	tr := Trip{
+		VehicleID:       vehicleID,
+		StartTs:         s.StartTS.UTC(),
+		EndTs:           s.EndTS.UTC(),
+		StartLat:        &startLat,
+		StartLon:        &startLon,
+		EndLat:          &endLat,
+		EndLon:          &endLon,
+		DistanceKm:      &distance,
+		DurationSeconds: &duration,
+		MaxSpeedKph:     &maxSpeed,
+		AvgSpeedKph:     &avgSpeed,
+		Metadata: datatypes.JSONMap{
+			"status":    status,
+			"detection": s.Detection,
+			"points":    s.Points,
+		},
+	}
+
+	if s.TripID == nil {
+		tr.CreatedAt = time.Now().UTC()
+		if err := tx.Create(&tr).Error; err != nil {
+			return err
+		}
+		s.TripID = &tr.ID
+	} else if err := tx.Model(&Trip{}).Where("id = ?", *s.TripID).Updates(map[string]interface{}{
+		"start_ts":         tr.StartTs,
+		"end_ts":           tr.EndTs,
+		"start_lat":        tr.StartLat,
+		"start_lon":        tr.StartLon,
+		"end_lat":          tr.EndLat,
+		"end_lon":          tr.EndLon,
+		"distance_km":      tr.DistanceKm,
+		"duration_seconds": tr.DurationSeconds,
+		"max_speed_kph":    tr.MaxSpeedKph,
+		"avg_speed_kph":    tr.AvgSpeedKph,
+		"metadata":         tr.Metadata,
+	}).Error; err != nil {
+		return err
+	}
+
+	if status != StatusClosed {
+		return nil
+	}
+	tr.ID = *s.TripID
+	return classifyTrip(tx, &tr)
+}
+
+// saveStops tulis stop yang sudah selesai, dan stop yang masih berlangsung (ongoing) bila sudah
+// melewati durasi minimal. Return jumlah row stop baru.
+func saveStops(tx *gorm.DB, vehicleID int64, seg *segmenter, ongoing bool) (int, error) {
+	created := 0
+	for i := range seg.stops {
+		if seg.stops[i].StopID == nil {
+			created++
+		}
+		if err := saveStop(tx, vehicleID, &seg.stops[i], false); err != nil {
+			return created, err
+		}
+	}
+	if ongoing && seg.stop != nil && seg.stop.Duration() >= seg.rules.MinStop {
+		if seg.stop.StopID == nil {
+			created++
+		}
+		if err := saveStop(tx, vehicleID, seg.stop, true); err != nil {
+			return created, err
+		}
+	}
+	return created, nil
+}
+
+// saveStop insert / update row stops dari segmen stop. StopID diisi setelah insert.
+func saveStop(tx *gorm.DB, vehicleID int64, s *StopSegment, ongoing bool) error {
+	row := Stop{
+		VehicleID:       vehicleID,
+		StartTs:         s.StartTS.UTC(),
+		EndTs:           s.EndTS.UTC(),
+		Lat:             s.Lat,
+		Lon:             s.Lon,
+		DurationSeconds: int64(s.Duration() / time.Second),
+		IgnitionOn:      s.IgnitionOn,
+		Ongoing:         ongoing,
+	}
+	if s.StopID == nil {
+		row.CreatedAt = time.Now().UTC()
+		if err := tx.Create(&row).Error; err != nil {
+			return err
+		}
+		s.StopID = &row.ID
+		return nil
+	}
+	return tx.Model(&Stop{}).Where("id = ?", *s.StopID).Updates(map[string]interface{}{
+		"end_ts":           row.EndTs,
+		"duration_seconds": row.DurationSeconds,
+		"ongoing":          row.Ongoing,
+	}).Error
+}
+
+// round2 pembulatan 2 desimal sesuai kolom NUMERIC(…,2)
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// Start jalankan builder berkala di background
+func (b *Builder) Start() {
+	interval := b.Interval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n, err := b.RunOnce(time.Now().UTC()); err != nil {
+					log.Printf("trip builder: %v", err)
+				} else if n > 0 {
+					log.Printf("trip builder: %d trip ditutup", n)
+				}
+			}
+		}
+	}()
+}
+
+// Stop hentikan builder dan tunggu putaran yang sedang berjalan selesai
+func (b *Builder) Stop() {
+	if b.cancel != nil {
+		b.cancel()
+	}
+	b.wg.Wait()
+}
@@ -0,0 +1,411 @@
+package trip
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/geocode"
+)
+
+// Klasifikasi trip untuk logbook
+const (
+	ClassBusiness = "BUSINESS"
+	ClassPrivate  = "PRIVATE"
+)
+
+// Sumber klasifikasi trip
+const (
+	SourceManual = "MANUAL" // diisi user
+	SourceRule   = "RULE"   // aturan klasifikasi saat trip ditutup
+)
+
+// Titik trip yang dicek terhadap geofence aturan
+const (
+	GeofenceStart = "START" // titik awal di dalam geofence
+	GeofenceEnd   = "END"   // titik akhir di dalam geofence
+	GeofenceAny   = "ANY"   // salah satu
+	GeofenceBoth  = "BOTH"  // keduanya
+)
+
+// ClassificationRule aturan klasifikasi otomatis. Kondisi yang diisi harus cocok semua:
+// hari (ISO 1 = Senin .. 7 = Minggu) dan jam mulai trip di zona waktu aturan, serta geofence lingkaran.
+type ClassificationRule struct {
+	ID              int64                    `json:"id"              gorm:"column:id;primaryKey"`
+	OrganizationID  int64                    `json:"organizationId"  gorm:"column:organization_id"`
+	VehicleID       *int64                   `json:"vehicleId"       gorm:"column:vehicle_id"` // nil = semua kendaraan organisasi
+	Name            string                   `json:"name"            gorm:"column:name"`
+	Classification  string                   `json:"classification"  gorm:"column:classification"`
+	Purpose         *string                  `json:"purpose"         gorm:"column:purpose"`
+	Priority        int                      `json:"priority"        gorm:"column:priority"` // kecil = dicek lebih dulu
+	DaysOfWeek      datatypes.JSONSlice[int] `json:"daysOfWeek"      gorm:"column:days_of_week"`
+	StartTime       *string                  `json:"startTime"       gorm:"column:start_time"` // HH:MM, boleh melewati tengah malam
+	EndTime         *string                  `json:"endTime"         gorm:"column:end_time"`
+	Timezone        *string                  `json:"timezone"        gorm:"column:timezone"` // nil = UTC
+	GeofenceLat     *float64                 `json:"geofenceLat"     gorm:"column:geofence_lat"`
+	GeofenceLon     *float64                 `json:"geofenceLon"     gorm:"column:geofence_lon"`
+	GeofenceRadiusM *float64                 `json:"geofenceRadiusM" gorm:"column:geofence_radius_m"`
+	GeofenceMatch   string                   `json:"geofenceMatch"   gorm:"column:geofence_match"`
+	Active          bool                     `json:"active"          gorm:"column:active"`
+	CreatedBy       *int64                   `json:"createdBy"       gorm:"column:created_by"`
+	CreatedAt       time.Time                `json:"createdAt"       gorm:"column:created_at"`
+	UpdatedAt       time.Time                `json:"updatedAt"       gorm:"column:updated_at"`
+}
+
+func (ClassificationRule) TableName() string {
+	return "trip_classification_rules"
+}
+
+// matches cek trip terhadap semua kondisi aturan
+func (r *ClassificationRule) matches(tr *Trip) bool {
+	loc := time.UTC
+	if r.Timezone != nil {
+		l, err := time.LoadLocation(*r.Timezone)
+		if err != nil {
+			return false
+		}
+		loc = l
+	}
+	start := tr.StartTs.In(loc)
+
+	if len(r.DaysOfWeek) > 0 {
+		day := int(start.Weekday())
+		if day == 0 {
+			day = 7
+		}
+		found := false
+		for _, d := range r.DaysOfWeek {
+			found = found || d == day
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.StartTime != nil && r.EndTime != nil {
+		from, _ := parseClock(*r.StartTime)
+		to, _ := parseClock(*r.EndTime)
+		m := start.Hour()*60 + start.Minute()
+		inside := m >= from && m < to
+		if from > to {
+			inside = m >= from || m < to
+		}
+		if !inside {
+			return false
+		}
+	}
+	if r.GeofenceLat != nil && r.GeofenceLon != nil && r.GeofenceRadiusM != nil {
+		in := func(lat, lon *float64) bool {
+			return lat != nil && lon != nil &&
+				geocode.HaversineKm(*r.GeofenceLat, *r.GeofenceLon, *lat, *lon)*1000 <= *r.GeofenceRadiusM
+		}
+		startIn, endIn := in(tr.StartLat, tr.StartLon), in(tr.EndLat, tr.EndLon)
+		switch r.GeofenceMatch {
+		case GeofenceStart:
+			return startIn
+		case GeofenceEnd:
+			return endIn
+		case GeofenceBoth:
+			return startIn && endIn
+		default:
+			return startIn || endIn
+		}
+	}
+	return true
+}
+
+// parseClock "HH:MM" -> menit sejak tengah malam
+func parseClock(s string) (int, bool) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// classifyTrip klasifikasi trip yang baru ditutup dengan aturan pertama yang cocok.
+// Trip yang sudah diklasifikasi (mis. manual selagi masih berjalan) tidak ditimpa.
+func classifyTrip(tx *gorm.DB, tr *Trip) error {
+	orgID, err := vehicleOrg(tx, tr.VehicleID)
+	if err != nil {
+		return err
+	}
+	var rules []ClassificationRule
+	if err := tx.Where("organization_id = ? AND active = ? AND (vehicle_id IS NULL OR vehicle_id = ?)", orgID, true, tr.VehicleID).
+		Order("priority, id").Find(&rules).Error; err != nil {
+		return err
+	}
+	for i := range rules {
+		if !rules[i].matches(tr) {
+			continue
+		}
+		return tx.Model(&Trip{}).Where("id = ? AND classification IS NULL", tr.ID).Updates(map[string]interface{}{
+			"classification":         rules[i].Classification,
+			"purpose":                rules[i].Purpose,
+			"classification_source":  SourceRule,
+			"classification_rule_id": rules[i].ID,
+			"classified_at":          time.Now().UTC(),
+		}).Error
+	}
+	return nil
+}
+
+// ClassificationRuleRequest body POST / PUT aturan klasifikasi
+type ClassificationRuleRequest struct {
+	VehicleID       *int64   `json:"vehicleId"`
+	Name            string   `json:"name"`
+	Classification  string   `json:"classification"`
+	Purpose         *string  `json:"purpose"`
+	Priority        *int     `json:"priority"`
+	DaysOfWeek      []int    `json:"daysOfWeek"`
+	StartTime       *string  `json:"startTime"`
+	EndTime         *string  `json:"endTime"`
+	Timezone        *string  `json:"timezone"`
+	GeofenceLat     *float64 `json:"geofenceLat"`
+	GeofenceLon     *float64 `json:"geofenceLon"`
+	GeofenceRadiusM *float64 `json:"geofenceRadiusM"`
+	GeofenceMatch   *string  `json:"geofenceMatch"`
+	Active          *bool    `json:"active"`
+}
+
+// validate return pesan error ("" = valid)
+func (req *ClassificationRuleRequest) validate() string {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return "name wajib diisi"
+	}
+	req.Classification = strings.ToUpper(req.Classification)
+	if req.Classification != ClassBusiness && req.Classification != ClassPrivate {
+		return "classification harus BUSINESS atau PRIVATE"
+	}
+	for _, d := range req.DaysOfWeek {
+		if d < 1 || d > 7 {
+			return "daysOfWeek berisi 1 (Senin) sampai 7 (Minggu)"
+		}
+	}
+	if (req.StartTime == nil) != (req.EndTime == nil) {
+		return "startTime dan endTime harus diisi bersamaan"
+	}
+	if req.StartTime != nil {
+		from, ok1 := parseClock(*req.StartTime)
+		to, ok2 := parseClock(*req.EndTime)
+		if !ok1 || !ok2 {
+			return "startTime dan endTime harus berformat HH:MM"
+		}
+		if from == to {
+			return "startTime dan endTime tidak boleh sama"
+		}
+	}
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil {
+			return "timezone tidak dikenal: " + *req.Timezone
+		}
+	}
+	geo := 0
+	for _, v := range []*float64{req.GeofenceLat, req.GeofenceLon, req.GeofenceRadiusM} {
+		if v != nil {
+			geo++
+		}
+	}
+	if geo != 0 && geo != 3 {
+		return "geofenceLat, geofenceLon dan geofenceRadiusM harus diisi bersamaan"
+	}
+	if geo == 3 {
+		if *req.GeofenceLat < -90 || *req.GeofenceLat > 90 || *req.GeofenceLon < -180 || *req.GeofenceLon > 180 {
+			return "koordinat geofence tidak valid"
+		}
+		if *req.GeofenceRadiusM <= 0 {
+			return "geofenceRadiusM harus lebih dari 0"
+		}
+	}
+	if req.GeofenceMatch != nil {
+		m := strings.ToUpper(*req.GeofenceMatch)
+		if m != GeofenceStart && m != GeofenceEnd && m != GeofenceAny && m != GeofenceBoth {
+			return "geofenceMatch harus START, END, ANY atau BOTH"
+		}
+		req.GeofenceMatch = &m
+	}
+	if len(req.DaysOfWeek) == 0 && req.StartTime == nil && geo == 0 {
+		return "aturan butuh minimal satu kondisi: daysOfWeek, startTime/endTime atau geofence"
+	}
+	return ""
+}
+
+// ========= HANDLER =========
+
+// ListClassificationRules GET /trip-classification-rules?vehicleId=
+func (h *Handler) ListClassificationRules(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	orgID, ok := orgScope(c, cu)
+	if !ok {
+		return
+	}
+
+	query := h.DB.Where("organization_id = ?", orgID)
+	if v := c.Query("vehicleId"); v != "" {
+		vehicleID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "vehicleId harus berupa angka"})
+			return
+		}
+		query = query.Where("vehicle_id IS NULL OR vehicle_id = ?", vehicleID)
+	}
+	var rules []ClassificationRule
+	if err := query.Order("priority, id").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rules})
+}
+
+// CreateClassificationRule POST /trip-classification-rules
+func (h *Handler) CreateClassificationRule(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if !canEditRules(c, cu) {
+		return
+	}
+	orgID, ok := orgScope(c, cu)
+	if !ok {
+		return
+	}
+
+	userID := cu.ID
+	rule := ClassificationRule{OrganizationID: orgID, CreatedBy: &userID, CreatedAt: time.Now().UTC()}
+	if !h.bindClassificationRule(c, &rule) {
+		return
+	}
+	if err := h.DB.Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateClassificationRule PUT /trip-classification-rules/:ruleId (ganti seluruh isi aturan)
+func (h *Handler) UpdateClassificationRule(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if !canEditRules(c, cu) {
+		return
+	}
+	rule, ok := h.loadClassificationRule(c, cu)
+	if !ok {
+		return
+	}
+	if !h.bindClassificationRule(c, &rule) {
+		return
+	}
+	if err := h.DB.Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteClassificationRule DELETE /trip-classification-rules/:ruleId. Trip yang sudah
+// diklasifikasi aturan ini tidak berubah.
+func (h *Handler) DeleteClassificationRule(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if !canEditRules(c, cu) {
+		return
+	}
+	rule, ok := h.loadClassificationRule(c, cu)
+	if !ok {
+		return
+	}
+	if err := h.DB.Delete(&ClassificationRule{}, rule.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// loadClassificationRule aturan dari param ruleId, ditolak bila bukan milik organisasi user
+func (h *Handler) loadClassificationRule(c *gin.Context, cu auth.CurrentUser) (ClassificationRule, bool) {
+	var rule ClassificationRule
+	id, err := strconv.ParseInt(c.Param("ruleId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "ruleId harus berupa angka"})
+		return rule, false
+	}
+	if err := h.DB.Where("id = ?", id).Limit(1).Find(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return rule, false
+	}
+	if rule.ID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+		return rule, false
+	}
+	if !cu.IsSuperAdmin() && (cu.OrganizationID == nil || *cu.OrganizationID != rule.OrganizationID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return rule, false
+	}
+	return rule, true
+}
+
+// bindClassificationRule isi aturan dari body request. Response error sudah ditulis bila false.
+func (h *Handler) bindClassificationRule(c *gin.Context, rule *ClassificationRule) bool {
+	var req ClassificationRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "body bukan JSON valid"})
+		return false
+	}
+	if msg := req.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": msg})
+		return false
+	}
+	if req.VehicleID != nil {
+		orgID, err := vehicleOrg(h.DB, *req.VehicleID)
+		if err != nil && err != errVehicleNotFound {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+			return false
+		}
+		if err != nil || orgID != rule.OrganizationID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "vehicleId bukan kendaraan organisasi ini"})
+			return false
+		}
+	}
+
+	rule.VehicleID = req.VehicleID
+	rule.Name = req.Name
+	rule.Classification = req.Classification
+	rule.Purpose = req.Purpose
+	rule.Priority = 100
+	if req.Priority != nil {
+		rule.Priority = *req.Priority
+	}
+	rule.DaysOfWeek = req.DaysOfWeek
+	rule.StartTime = req.StartTime
+	rule.EndTime = req.EndTime
+	rule.Timezone = req.Timezone
+	rule.GeofenceLat = req.GeofenceLat
+	rule.GeofenceLon = req.GeofenceLon
+	rule.GeofenceRadiusM = req.GeofenceRadiusM
+	rule.GeofenceMatch = GeofenceAny
+	if req.GeofenceMatch != nil {
+		rule.GeofenceMatch = *req.GeofenceMatch
+	}
+	rule.Active = req.Active == nil || *req.Active
+	rule.UpdatedAt = time.Now().UTC()
+	return true
+}
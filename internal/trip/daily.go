@@ -0,0 +1,435 @@
+package trip
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/pagination"
+)
+
+// rentang laporan harian maksimal per request
+const dailyStatsMaxDays = 366
+
+// LocalDate tanggal kalender tanpa jam (kolom DATE), JSON "2006-01-02"
+type LocalDate struct {
+	time.Time
+}
+
+// DateOf tanggal kalender t di zona waktunya sendiri
+func DateOf(t time.Time) LocalDate {
+	y, m, d := t.Date()
+	return LocalDate{time.Date(y, m, d, 0, 0, 0, 0, time.UTC)}
+}
+
+func (d LocalDate) String() string {
+	return d.Format("2006-01-02")
+}
+
+func (LocalDate) GormDataType() string {
+	return "date"
+}
+
+func (d LocalDate) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+func (d *LocalDate) Scan(v interface{}) error {
+	switch v := v.(type) {
+	case time.Time:
+		*d = DateOf(v)
+	case string:
+		return d.parse(v)
+	case []byte:
+		return d.parse(string(v))
+	default:
+		return fmt.Errorf("LocalDate: tipe %T tidak didukung", v)
+	}
+	return nil
+}
+
+func (d *LocalDate) parse(s string) error {
+	if len(s) > 10 {
+		s = s[:10]
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return err
+	}
+	*d = LocalDate{t}
+	return nil
+}
+
+func (d LocalDate) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + d.String() + `"`), nil
+}
+
+func (d *LocalDate) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+// in 00:00 tanggal d di zona waktu loc
+func (d LocalDate) in(loc *time.Location) time.Time {
+	y, m, day := d.Date()
+	return time.Date(y, m, day, 0, 0, 0, 0, loc)
+}
+
+// ParseLocalDate tanggal "2006-01-02"
+func ParseLocalDate(s string) (LocalDate, error) {
+	var d LocalDate
+	if len(s) != 10 {
+		return d, fmt.Errorf("tanggal harus YYYY-MM-DD: %q", s)
+	}
+	err := d.parse(s)
+	return d, err
+}
+
+// DailyStat rollup harian satu kendaraan. Trip yang melewati tengah malam dibagi proporsional terhadap
+// waktu; tripCount dihitung di hari trip dimulai. idleSeconds = stop dengan mesin hidup.
+type DailyStat struct {
+	VehicleID      int64     `json:"vehicleId"      gorm:"column:vehicle_id;primaryKey"`
+	Day            LocalDate `json:"day"            gorm:"column:day;primaryKey"` // tanggal lokal organisasi
+	Timezone       string    `json:"timezone"       gorm:"column:timezone"`
+	DistanceKm     float64   `json:"distanceKm"     gorm:"column:distance_km"`
+	DrivingSeconds int64     `json:"drivingSeconds" gorm:"column:driving_seconds"`
+	IdleSeconds    int64     `json:"idleSeconds"    gorm:"column:idle_seconds"`
+	TripCount      int       `json:"tripCount"      gorm:"column:trip_count"`
+	MaxSpeedKph    *float64  `json:"maxSpeedKph"    gorm:"column:max_speed_kph"`
+	UpdatedAt      time.Time `json:"updatedAt"      gorm:"column:updated_at"`
+}
+
+func (DailyStat) TableName() string {
+	return "vehicle_daily_stats"
+}
+
+// loadLocation zona waktu IANA, UTC bila kosong / tidak dikenal
+func loadLocation(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// vehicleLocation zona waktu organisasi pemilik kendaraan
+func vehicleLocation(db *gorm.DB, vehicleID int64) (*time.Location, error) {
+	var names []string
+	err := db.Table("vehicles v").Joins("JOIN organizations o ON o.id = v.organization_id").
+		Where("v.id = ?", vehicleID).Limit(1).Pluck("o.timezone", &names).Error
+	if err != nil || len(names) == 0 {
+		return time.UTC, err
+	}
+	return loadLocation(names[0]), nil
+}
+
+// orgLocation zona waktu organisasi
+func orgLocation(db *gorm.DB, orgID int64) (*time.Location, error) {
+	var names []string
+	if err := db.Table("organizations").Where("id = ?", orgID).Limit(1).Pluck("timezone", &names).Error; err != nil || len(names) == 0 {
+		return time.UTC, err
+	}
+	return loadLocation(names[0]), nil
+}
+
+// startOfDay 00:00 lokal hari t
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// overlap durasi irisan [start, end) dengan [from, to)
+func overlap(start, end, from, to time.Time) time.Duration {
+	if start.Before(from) {
+		start = from
+	}
+	if end.After(to) {
+		end = to
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+// refreshDailyStats hitung ulang rollup kendaraan untuk semua hari lokal yang beririsan [from, to].
+// Dipanggil di dalam transaksi yang sudah memegang lock kendaraan (builder / rebuild).
+func refreshDailyStats(tx *gorm.DB, vehicleID int64, from, to time.Time) error {
+	loc, err := vehicleLocation(tx, vehicleID)
+	if err != nil {
+		return err
+	}
+	first := startOfDay(from.In(loc))
+	end := startOfDay(to.In(loc)).AddDate(0, 0, 1)
+
+	var trips []Trip
+	if err := tx.Where("vehicle_id = ? AND start_ts < ? AND end_ts >= ?", vehicleID, end, first).
+		Find(&trips).Error; err != nil {
+		return err
+	}
+	var stops []Stop
+	if err := tx.Where("vehicle_id = ? AND ignition_on = ? AND start_ts < ? AND end_ts > ?", vehicleID, true, end, first).
+		Find(&stops).Error; err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	var rows []DailyStat
+	for day := first; day.Before(end); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		stat := DailyStat{VehicleID: vehicleID, Day: DateOf(day), Timezone: loc.String(), UpdatedAt: now}
+		for i := range trips {
+			tr := &trips[i]
+			started := !tr.StartTs.Before(day) && tr.StartTs.Before(next)
+			part := overlap(tr.StartTs, tr.EndTs, day, next)
+			if !started && part == 0 {
+				continue
+			}
+			if started {
+				stat.TripCount++
+			}
+			stat.DrivingSeconds += int64(part / time.Second)
+			if tr.DistanceKm != nil {
+				if total := tr.EndTs.Sub(tr.StartTs); total > 0 {
+					stat.DistanceKm += *tr.DistanceKm * float64(part) / float64(total)
+				} else {
+					stat.DistanceKm += *tr.DistanceKm
+				}
+			}
+			if tr.MaxSpeedKph != nil && (stat.MaxSpeedKph == nil || *tr.MaxSpeedKph > *stat.MaxSpeedKph) {
+				v := *tr.MaxSpeedKph
+				stat.MaxSpeedKph = &v
+			}
+		}
+		for i := range stops {
+			stat.IdleSeconds += int64(overlap(stops[i].StartTs, stops[i].EndTs, day, next) / time.Second)
+		}
+		stat.DistanceKm = round2(stat.DistanceKm)
+		if stat.TripCount == 0 && stat.DrivingSeconds == 0 && stat.IdleSeconds == 0 && stat.DistanceKm == 0 {
+			continue
+		}
+		rows = append(rows, stat)
+	}
+
+	if err := tx.Where("vehicle_id = ? AND day >= ? AND day < ?", vehicleID, DateOf(first), DateOf(end)).
+		Delete(&DailyStat{}).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return tx.Create(&rows).Error
+}
+
+// RefreshDailyStats hitung ulang rollup harian satu kendaraan untuk tanggal lokal from s/d to (inklusif),
+// mis. sesudah zona waktu organisasi diganti
+func RefreshDailyStats(db *gorm.DB, vehicleID int64, from, to LocalDate) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		found, err := lockVehicle(tx, vehicleID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errVehicleNotFound
+		}
+		loc, err := vehicleLocation(tx, vehicleID)
+		if err != nil {
+			return err
+		}
+		return refreshDailyStats(tx, vehicleID, from.in(loc), to.in(loc))
+	})
+}
+
+// parseDayRange ?from=&to= tanggal (YYYY-MM-DD, inklusif). Default 30 hari terakhir s/d hari ini di loc.
+// Response 400 sudah ditulis bila false.
+func parseDayRange(c *gin.Context, loc *time.Location) (from, to LocalDate, ok bool) {
+	to = DateOf(time.Now().In(loc))
+	from = LocalDate{to.AddDate(0, 0, -29)}
+	for _, q := range []struct {
+		name string
+		dst  *LocalDate
+	}{{"from", &from}, {"to", &to}} {
+		if v := c.Query(q.name); v != "" {
+			d, err := ParseLocalDate(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "invalid " + q.name + " parameter, must be YYYY-MM-DD"})
+				return from, to, false
+			}
+			*q.dst = d
+		}
+	}
+	if to.Before(from.Time) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "to must be after from"})
+		return from, to, false
+	}
+	if to.Sub(from.Time) >= dailyStatsMaxDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "requested range exceeds max range"})
+		return from, to, false
+	}
+	return from, to, true
+}
+
+// dailyTotals jumlah rollup dalam query
+type dailyTotals struct {
+	DistanceKm     float64  `json:"distanceKm"     gorm:"column:distance_km"`
+	DrivingSeconds int64    `json:"drivingSeconds" gorm:"column:driving_seconds"`
+	IdleSeconds    int64    `json:"idleSeconds"    gorm:"column:idle_seconds"`
+	TripCount      int64    `json:"tripCount"      gorm:"column:trip_count"`
+	MaxSpeedKph    *float64 `json:"maxSpeedKph"    gorm:"column:max_speed_kph"`
+}
+
+func sumDailyStats(query *gorm.DB, prefix string) (dailyTotals, error) {
+	var totals dailyTotals
+	err := query.Select(fmt.Sprintf("COALESCE(SUM(%[1]sdistance_km), 0) AS distance_km, "+
+		"COALESCE(SUM(%[1]sdriving_seconds), 0) AS driving_seconds, COALESCE(SUM(%[1]sidle_seconds), 0) AS idle_seconds, "+
+		"COALESCE(SUM(%[1]strip_count), 0) AS trip_count, MAX(%[1]smax_speed_kph) AS max_speed_kph", prefix)).
+		Scan(&totals).Error
+	totals.DistanceKm = round2(totals.DistanceKm)
+	return totals, err
+}
+
+// listVehicleDailyStats GET /vehicles/:id/daily-stats?from=&to=: rollup per hari lokal organisasi,
+// urut tanggal. Hari tanpa trip / idle tidak ada di data.
+func (h *Handler) listVehicleDailyStats(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	vehicleID, orgID, ok := h.vehicleScope(c, cu)
+	if !ok {
+		return
+	}
+	loc, err := orgLocation(h.DB, orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	from, to, ok := parseDayRange(c, loc)
+	if !ok {
+		return
+	}
+
+	query := func() *gorm.DB {
+		return h.DB.Model(&DailyStat{}).Where("vehicle_id = ? AND day >= ? AND day <= ?", vehicleID, from, to)
+	}
+	var stats []DailyStat
+	if err := query().Order("day ASC").Find(&stats).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	totals, err := sumDailyStats(query(), "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"vehicleId": vehicleID,
+		"timezone":  loc.String(),
+		"from":      from,
+		"to":        to,
+		"totals":    totals,
+		"data":      stats,
+	})
+}
+
+// listDailyStatsReport GET /reports/daily-stats?from=&to=&vehicleId=&organizationId=
+// Rollup semua kendaraan yang bisa diakses user (seperti /trips), urut tanggal terbaru lalu kendaraan.
+// SUPER_ADMIN boleh menyaring organizationId.
+func (h *Handler) listDailyStatsReport(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	p := pagination.ParsePagination(c)
+	if c.IsAborted() {
+		return
+	}
+
+	var orgID *int64
+	if !cu.IsSuperAdmin() {
+		if cu.OrganizationID == nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "no_org_access"})
+			return
+		}
+		orgID = cu.OrganizationID
+	} else if v := c.Query("organizationId"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "organizationId harus berupa angka"})
+			return
+		}
+		orgID = &id
+	}
+	loc := time.UTC
+	if orgID != nil {
+		var err error
+		if loc, err = orgLocation(h.DB, *orgID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+			return
+		}
+	}
+	from, to, ok := parseDayRange(c, loc)
+	if !ok {
+		return
+	}
+	var vehicleID *int64
+	if v := c.Query("vehicleId"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "vehicleId harus berupa angka"})
+			return
+		}
+		vehicleID = &id
+	}
+
+	query := func() *gorm.DB {
+		q := h.DB.Table("vehicle_daily_stats s").Joins("JOIN vehicles v ON v.id = s.vehicle_id").
+			Where("s.day >= ? AND s.day <= ?", from, to)
+		if orgID != nil {
+			q = q.Where("v.organization_id = ?", *orgID)
+		}
+		if vehicleID != nil {
+			q = q.Where("s.vehicle_id = ?", *vehicleID)
+		}
+		return q
+	}
+
+	var total int64
+	if err := query().Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	var stats []DailyStat
+	if err := query().Select("s.*").Order("s.day DESC, s.vehicle_id").Limit(p.Limit).Offset(p.Offset).
+		Scan(&stats).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	totals, err := sumDailyStats(query(), "s.")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":       from,
+		"to":         to,
+		"totals":     totals,
+		"data":       stats,
+		"pagination": gin.H{"total": total, "limit": p.Limit, "page": p.Page, "max_limit": p.MaxLimit},
+	})
+}
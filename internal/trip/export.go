@@ -0,0 +1,393 @@
+package trip
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/username/fms-api/internal/auth"
+)
+
+// Format export track
+const (
+	ExportGPX     = "gpx"
+	ExportKML     = "kml"
+	ExportGeoJSON = "geojson"
+)
+
+var exportContentTypes = map[string]string{
+	ExportGPX:     "application/gpx+xml",
+	ExportKML:     "application/vnd.google-earth.kml+xml",
+	ExportGeoJSON: "application/geo+json",
+}
+
+// positionScanner jalankan query posisi satu trip dan panggil fn per row tanpa menampung semua posisi.
+// Boleh dipanggil lebih dari sekali (KML & GeoJSON menulis tiap atribut per titik sebagai array terpisah).
+type positionScanner func(fn func(p *positionRecord)) error
+
+// exportWriter bufio.Writer dengan error pertama disimpan, supaya encoder tidak perlu cek error per tulis
+type exportWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (w *exportWriter) printf(format string, args ...interface{}) {
+	if w.err == nil {
+		_, w.err = fmt.Fprintf(w.w, format, args...)
+	}
+}
+
+func (w *exportWriter) text(s string) {
+	if w.err == nil {
+		w.err = xml.EscapeText(w.w, []byte(s))
+	}
+}
+
+func (w *exportWriter) json(v interface{}) {
+	if w.err != nil {
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		w.err = err
+		return
+	}
+	_, w.err = w.w.Write(b)
+}
+
+// trackEncoder satu format export; trips ditulis berurutan di antara header dan footer
+type trackEncoder interface {
+	header(w *exportWriter)
+	trip(w *exportWriter, tr *Trip, index int, scan positionScanner) error
+	footer(w *exportWriter)
+}
+
+func newTrackEncoder(format string) trackEncoder {
+	switch format {
+	case ExportGPX:
+		return gpxEncoder{}
+	case ExportKML:
+		return kmlEncoder{}
+	case ExportGeoJSON:
+		return geojsonEncoder{}
+	}
+	return nil
+}
+
+func tripName(tr *Trip) string {
+	return fmt.Sprintf("Trip %d (%s)", tr.ID, tr.StartTs.UTC().Format(time.RFC3339))
+}
+
+// ========= GPX =========
+
+// gpxEncoder GPX 1.1, satu <trk> per trip. Speed / ignition / heading di <extensions> namespace fms.
+type gpxEncoder struct{}
+
+func (gpxEncoder) header(w *exportWriter) {
+	w.printf("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	w.printf("<gpx version=\"1.1\" creator=\"fms-api\" xmlns=\"http://www.topografix.com/GPX/1/1\" xmlns:fms=\"urn:fms-api:gpx:1\">\n")
+}
+
+func (gpxEncoder) trip(w *exportWriter, tr *Trip, _ int, scan positionScanner) error {
+	w.printf("<trk><name>")
+	w.text(tripName(tr))
+	w.printf("</name><trkseg>\n")
+	err := scan(func(p *positionRecord) {
+		w.printf("<trkpt lat=\"%s\" lon=\"%s\">", formatFloat(p.Lat), formatFloat(p.Lon))
+		if p.AltitudeM != nil {
+			w.printf("<ele>%s</ele>", formatFloat(*p.AltitudeM))
+		}
+		w.printf("<time>%s</time>", p.TS.UTC().Format(time.RFC3339))
+		if p.SpeedKph != nil || p.IgnitionOn != nil || p.HeadingDeg != nil {
+			w.printf("<extensions>")
+			if p.SpeedKph != nil {
+				w.printf("<fms:speedKph>%s</fms:speedKph>", formatFloat(*p.SpeedKph))
+			}
+			if p.HeadingDeg != nil {
+				w.printf("<fms:headingDeg>%s</fms:headingDeg>", formatFloat(*p.HeadingDeg))
+			}
+			if p.IgnitionOn != nil {
+				w.printf("<fms:ignitionOn>%t</fms:ignitionOn>", *p.IgnitionOn)
+			}
+			w.printf("</extensions>")
+		}
+		w.printf("</trkpt>\n")
+	})
+	w.printf("</trkseg></trk>\n")
+	return err
+}
+
+func (gpxEncoder) footer(w *exportWriter) {
+	w.printf("</gpx>\n")
+}
+
+// ========= KML =========
+
+// kmlEncoder KML 2.2, satu Placemark gx:Track per trip. Skema gx:Track menaruh semua <when> sebelum
+// <gx:coord> dan tiap atribut sebagai array terpisah, jadi posisi di-scan sekali per bagian.
+type kmlEncoder struct{}
+
+func (kmlEncoder) header(w *exportWriter) {
+	w.printf("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	w.printf("<kml xmlns=\"http://www.opengis.net/kml/2.2\" xmlns:gx=\"http://www.google.com/kml/ext/2.2\">\n<Document>\n")
+	w.printf("<name>fms-api</name>\n")
+	w.printf("<Schema id=\"trackData\">")
+	w.printf("<gx:SimpleArrayField name=\"speedKph\" type=\"float\"><displayName>Speed (km/h)</displayName></gx:SimpleArrayField>")
+	w.printf("<gx:SimpleArrayField name=\"ignitionOn\" type=\"bool\"><displayName>Ignition</displayName></gx:SimpleArrayField>")
+	w.printf("</Schema>\n")
+}
+
+func (kmlEncoder) trip(w *exportWriter, tr *Trip, _ int, scan positionScanner) error {
+	w.printf("<Placemark><name>")
+	w.text(tripName(tr))
+	w.printf("</name>\n<gx:Track><altitudeMode>clampToGround</altitudeMode>\n")
+	passes := []func(p *positionRecord){
+		func(p *positionRecord) { w.printf("<when>%s</when>\n", p.TS.UTC().Format(time.RFC3339)) },
+		func(p *positionRecord) {
+			alt := 0.0
+			if p.AltitudeM != nil {
+				alt = *p.AltitudeM
+			}
+			w.printf("<gx:coord>%s %s %s</gx:coord>\n", formatFloat(p.Lon), formatFloat(p.Lat), formatFloat(alt))
+		},
+		func(p *positionRecord) {
+			if p.SpeedKph != nil {
+				w.printf("<gx:value>%s</gx:value>", formatFloat(*p.SpeedKph))
+			} else {
+				w.printf("<gx:value/>")
+			}
+		},
+		func(p *positionRecord) {
+			if p.IgnitionOn != nil {
+				w.printf("<gx:value>%t</gx:value>", *p.IgnitionOn)
+			} else {
+				w.printf("<gx:value/>")
+			}
+		},
+	}
+	for i, pass := range passes {
+		switch i {
+		case 2:
+			w.printf("<ExtendedData><SchemaData schemaUrl=\"#trackData\">\n<gx:SimpleArrayData name=\"speedKph\">")
+		case 3:
+			w.printf("</gx:SimpleArrayData>\n<gx:SimpleArrayData name=\"ignitionOn\">")
+		}
+		if err := scan(pass); err != nil {
+			return err
+		}
+	}
+	w.printf("</gx:SimpleArrayData>\n</SchemaData></ExtendedData>\n</gx:Track></Placemark>\n")
+	return nil
+}
+
+func (kmlEncoder) footer(w *exportWriter) {
+	w.printf("</Document>\n</kml>\n")
+}
+
+// ========= GeoJSON =========
+
+// geojsonEncoder FeatureCollection, satu Feature LineString per trip. Atribut per titik di properties
+// sebagai array sejajar coordinates (coordTimes, speedsKph, ignitionOn).
+type geojsonEncoder struct{}
+
+func (geojsonEncoder) header(w *exportWriter) {
+	w.printf("{\"type\":\"FeatureCollection\",\"features\":[\n")
+}
+
+func (geojsonEncoder) trip(w *exportWriter, tr *Trip, index int, scan positionScanner) error {
+	if index > 0 {
+		w.printf(",\n")
+	}
+	w.printf("{\"type\":\"Feature\",\"id\":%d,\"geometry\":{\"type\":\"LineString\",\"coordinates\":[", tr.ID)
+
+	// separator per pass: koma sebelum elemen kedua dan seterusnya
+	array := func(write func(p *positionRecord)) func(p *positionRecord) {
+		first := true
+		return func(p *positionRecord) {
+			if !first {
+				w.printf(",")
+			}
+			first = false
+			write(p)
+		}
+	}
+	if err := scan(array(func(p *positionRecord) {
+		if p.AltitudeM != nil {
+			w.printf("[%s,%s,%s]", formatFloat(p.Lon), formatFloat(p.Lat), formatFloat(*p.AltitudeM))
+		} else {
+			w.printf("[%s,%s]", formatFloat(p.Lon), formatFloat(p.Lat))
+		}
+	})); err != nil {
+		return err
+	}
+
+	w.printf("]},\"properties\":{\"tripId\":%d,\"vehicleId\":%d,\"name\":", tr.ID, tr.VehicleID)
+	w.json(tripName(tr))
+	w.printf(",\"startTs\":")
+	w.json(tr.StartTs.UTC())
+	w.printf(",\"endTs\":")
+	w.json(tr.EndTs.UTC())
+	w.printf(",\"distanceKm\":")
+	w.json(tr.DistanceKm)
+	w.printf(",\"durationSeconds\":")
+	w.json(tr.DurationSeconds)
+	w.printf(",\"maxSpeedKph\":")
+	w.json(tr.MaxSpeedKph)
+	w.printf(",\"avgSpeedKph\":")
+	w.json(tr.AvgSpeedKph)
+
+	fields := []struct {
+		name  string
+		write func(p *positionRecord)
+	}{
+		{"coordTimes", func(p *positionRecord) { w.printf("%q", p.TS.UTC().Format(time.RFC3339)) }},
+		{"speedsKph", func(p *positionRecord) { w.json(p.SpeedKph) }},
+		{"ignitionOn", func(p *positionRecord) { w.json(p.IgnitionOn) }},
+	}
+	for _, f := range fields {
+		w.printf(",%q:[", f.name)
+		if err := scan(array(f.write)); err != nil {
+			return err
+		}
+		w.printf("]")
+	}
+	w.printf("}}")
+	return nil
+}
+
+func (geojsonEncoder) footer(w *exportWriter) {
+	w.printf("\n]}\n")
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// ========= HANDLER =========
+
+// parseExportFormat baca ?format=. Response 400 sudah ditulis bila nil.
+func parseExportFormat(c *gin.Context) (string, trackEncoder) {
+	format := c.Query("format")
+	enc := newTrackEncoder(format)
+	if enc == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "format harus gpx, kml atau geojson"})
+	}
+	return format, enc
+}
+
+// scanPositions positionScanner untuk satu trip, query sama dengan GetTripDetail. Row sesudah maxID
+// (masuk selama export berjalan) dilewati supaya tiap pass membaca titik yang sama.
+func (h *Handler) scanPositions(tr *Trip, includeFlagged bool, maxID int64) positionScanner {
+	return func(fn func(p *positionRecord)) error {
+		rows, err := positionQuery(h.DB, tr, includeFlagged).Where("id <= ?", maxID).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var p positionRecord
+			if err := h.DB.ScanRows(rows, &p); err != nil {
+				return err
+			}
+			fn(&p)
+		}
+		return rows.Err()
+	}
+}
+
+// streamExport tulis header download lalu trips satu per satu langsung ke response
+func (h *Handler) streamExport(c *gin.Context, format string, enc trackEncoder, filename string, trips []Trip) {
+	includeFlagged := c.Query("includeFlagged") == "true"
+	var maxID int64
+	if err := h.DB.Table("position_log").Select("COALESCE(MAX(id), 0)").Scan(&maxID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", exportContentTypes[format])
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+"."+format))
+	c.Status(http.StatusOK)
+
+	w := &exportWriter{w: bufio.NewWriter(c.Writer)}
+	enc.header(w)
+	for i := range trips {
+		if err := enc.trip(w, &trips[i], i, h.scanPositions(&trips[i], includeFlagged, maxID)); err != nil {
+			// status 200 sudah terkirim: berhenti tanpa footer supaya file jelas tidak utuh
+			log.Printf("trip export: trip %d: %v", trips[i].ID, err)
+			w.w.Flush()
+			return
+		}
+		if w.err == nil {
+			w.err = w.w.Flush()
+		}
+	}
+	enc.footer(w)
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+	if w.err != nil {
+		log.Printf("trip export: %v", w.err)
+	}
+}
+
+// ExportTrip GET /trips/:id/export?format=gpx|kml|geojson
+func (h *Handler) ExportTrip(c *gin.Context) {
+	format, enc := parseExportFormat(c)
+	if enc == nil {
+		return
+	}
+	tr, ok := h.loadTrip(c)
+	if !ok {
+		return
+	}
+	h.streamExport(c, format, enc, fmt.Sprintf("trip-%d", tr.ID), []Trip{tr})
+}
+
+// ExportVehicleTrips GET /vehicles/:id/trips/export?format=&from=&to=: semua trip kendaraan yang
+// dimulai dalam rentang, dibatasi MAX_RANGE_DAYS seperti daftar trip
+func (h *Handler) ExportVehicleTrips(c *gin.Context) {
+	format, enc := parseExportFormat(c)
+	if enc == nil {
+		return
+	}
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	vehicleID, _, ok := h.vehicleScope(c, cu)
+	if !ok {
+		return
+	}
+
+	from, errFrom := time.Parse(time.RFC3339, c.Query("from"))
+	to, errTo := time.Parse(time.RFC3339, c.Query("to"))
+	if errFrom != nil || errTo != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "from dan to wajib diisi (RFC3339)"})
+		return
+	}
+	if !to.After(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "to must be after from"})
+		return
+	}
+	if to.Sub(from) > maxRange() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "requested range exceeds max range"})
+		return
+	}
+
+	var trips []Trip
+	if err := h.DB.Where("vehicle_id = ? AND start_ts >= ? AND start_ts <= ?", vehicleID, from, to).
+		Order("start_ts ASC").Find(&trips).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	filename := fmt.Sprintf("vehicle-%d-%s-%s", vehicleID, from.UTC().Format("20060102"), to.UTC().Format("20060102"))
+	h.streamExport(c, format, enc, filename, trips)
+}
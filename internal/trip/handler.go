@@ -8,12 +8,14 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/geocode"
 	"github.com/username/fms-api/internal/pagination"
 	"gorm.io/gorm"
 )
 
 type Handler struct {
-	DB *gorm.DB
+	DB       *gorm.DB
+	Geocoder geocode.Geocoder // nil = response trip tanpa alamat
 }
 
 func NewHandler(db *gorm.DB) *Handler {
@@ -28,6 +30,30 @@ func (h *Handler) RegisterRoutes(router gin.IRoutes) {
 	router.GET("/trips", h.listTrips)
 	// get trip detail including position logs
 	router.GET("/trips/:id", h.GetTripDetail)
+	// export track GPX / KML / GeoJSON satu trip atau semua trip kendaraan dalam rentang
+	router.GET("/trips/:id/export", h.ExportTrip)
+	router.GET("/vehicles/:id/trips/export", h.ExportVehicleTrips)
+	// stop & idle kendaraan hasil deteksi trip builder
+	router.GET("/vehicles/:id/stops", h.listVehicleStops)
+	// rollup harian jarak / waktu mengemudi per kendaraan
+	router.GET("/vehicles/:id/daily-stats", h.listVehicleDailyStats)
+	router.GET("/reports/daily-stats", h.listDailyStatsReport)
+	// aturan deteksi trip per organisasi + override per kendaraan
+	router.GET("/trip-rules", h.GetOrgRules)
+	router.PUT("/trip-rules", h.UpdateOrgRules)
+	router.GET("/vehicles/:id/trip-rules", h.GetVehicleRules)
+	router.PUT("/vehicles/:id/trip-rules", h.UpdateVehicleRules)
+	router.DELETE("/vehicles/:id/trip-rules", h.DeleteVehicleRules)
+	// klasifikasi BUSINESS / PRIVATE, logbook terkunci + koreksi teraudit
+	router.PATCH("/trips/:id/classification", h.ClassifyTrip)
+	router.POST("/trips/:id/corrections", h.CorrectTrip)
+	router.GET("/trips/:id/corrections", h.ListCorrections)
+	router.GET("/vehicles/:id/logbook", h.GetLogbook)
+	router.POST("/vehicles/:id/logbook/finalize", h.FinalizeLogbook)
+	router.GET("/trip-classification-rules", h.ListClassificationRules)
+	router.POST("/trip-classification-rules", h.CreateClassificationRule)
+	router.PUT("/trip-classification-rules/:ruleId", h.UpdateClassificationRule)
+	router.DELETE("/trip-classification-rules/:ruleId", h.DeleteClassificationRule)
 }
 
 // helper ambil id vehicle dari param
@@ -131,6 +157,7 @@ func (h *Handler) listVehicleTrips(c *gin.Context) {
 		return
 	}
 
+	h.addAddresses(trips)
 	c.JSON(http.StatusOK, gin.H{
 		"data":       trips,
 		"pagination": gin.H{"total": total, "limit": p.Limit, "page": p.Page, "max_limit": p.MaxLimit},
@@ -227,70 +254,107 @@ func (h *Handler) listTrips(c *gin.Context) {
 		return
 	}
 
+	h.addAddresses(trips)
 	c.JSON(http.StatusOK, gin.H{"data": trips, "pagination": gin.H{"total": total, "limit": p.Limit, "page": p.Page, "max_limit": p.MaxLimit}})
 }
 
+// addAddress isi alamat awal / akhir trip lewat h.Geocoder
+func (h *Handler) addAddress(tr *Trip) {
+	if h.Geocoder == nil {
+		return
+	}
+	if tr.StartLat != nil && tr.StartLon != nil {
+		tr.StartAddress = geocode.Lookup(h.Geocoder, *tr.StartLat, *tr.StartLon)
+	}
+	if tr.EndLat != nil && tr.EndLon != nil {
+		tr.EndAddress = geocode.Lookup(h.Geocoder, *tr.EndLat, *tr.EndLon)
+	}
+}
+
+func (h *Handler) addAddresses(trips []Trip) {
+	for i := range trips {
+		h.addAddress(&trips[i])
+	}
+}
+
 // GetTripDetail returns a trip by id and includes position_log entries between start and end timestamps
 func (h *Handler) GetTripDetail(c *gin.Context) {
-	// parse id
-	idStr := c.Param("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	opts, ok := parseRouteOptions(c)
+	if !ok {
+		return
+	}
+	tr, ok := h.loadTrip(c)
+	if !ok {
+		return
+	}
+	posQry := positionQuery(h.DB, &tr, c.Query("includeFlagged") == "true")
+
+	var positions []positionRecord
+	if err := posQry.Find(&positions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+
+	total := len(positions)
+	positions = opts.apply(positions)
+	h.addAddress(&tr)
+	if opts.Polyline {
+		c.JSON(http.StatusOK, gin.H{"trip": tr, "polyline": EncodePolyline(coordsOf(positions)), "points": len(positions), "positionsTotal": total})
+		return
+	}
+	if len(opts.Fields) > 0 {
+		c.JSON(http.StatusOK, gin.H{"trip": tr, "positions": opts.project(positions), "positionsTotal": total})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"trip": tr, "positions": positions, "positionsTotal": total})
+}
+
+// loadTrip ambil trip dari param id dan cek akses user. Response error sudah ditulis bila false.
+func (h *Handler) loadTrip(c *gin.Context) (Trip, bool) {
+	var tr Trip
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "id harus berupa angka"})
-		return
+		return tr, false
 	}
 
 	// fetch trip
-	var tr Trip
 	if err := h.DB.First(&tr, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
-			return
+			return tr, false
 		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
-		return
+		return tr, false
 	}
 
 	// auth: check access
 	cu, ok := auth.GetCurrentUser(c)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-		return
+		return tr, false
 	}
 	if !cu.IsSuperAdmin() {
 		// fetch vehicle org
 		var v struct{ OrganizationID *int64 }
 		if err := h.DB.Table("vehicles").Select("organization_id").Where("id = ?", tr.VehicleID).First(&v).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
-			return
+			return tr, false
 		}
 		if v.OrganizationID == nil || cu.OrganizationID == nil || *v.OrganizationID != *cu.OrganizationID {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
+			return tr, false
 		}
 	}
+	return tr, true
+}
 
-	// query position_log between start_ts and end_ts
-	type positionRecord struct {
-		ID         int64     `json:"id" gorm:"column:id"`
-		VehicleID  int64     `json:"vehicleId" gorm:"column:vehicle_id"`
-		DeviceID   *int64    `json:"deviceId" gorm:"column:device_id"`
-		TS         time.Time `json:"ts" gorm:"column:ts"`
-		Lat        float64   `json:"lat" gorm:"column:lat"`
-		Lon        float64   `json:"lon" gorm:"column:lon"`
-		SpeedKph   *float64  `json:"speedKph,omitempty" gorm:"column:speed_kph"`
-		HeadingDeg *float64  `json:"headingDeg,omitempty" gorm:"column:heading_deg"`
-		AltitudeM  *float64  `json:"altitudeM,omitempty" gorm:"column:altitude_m"`
-		IgnitionOn *bool     `json:"ignitionOn,omitempty" gorm:"column:ignition_on"`
-		OdometerKm *float64  `json:"odometerKm,omitempty" gorm:"column:odometer_km"`
-		CreatedAt  time.Time `json:"createdAt" gorm:"column:created_at"`
-	}
-
-	var positions []positionRecord
-	if err := h.DB.Table("position_log").Where("vehicle_id = ? AND ts >= ? AND ts <= ?", tr.VehicleID, tr.StartTs, tr.EndTs).Order("ts ASC").Find(&positions).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
-		return
+// positionQuery position_log antara start_ts dan end_ts trip. Default hanya fix GOOD;
+// includeFlagged ikut fix yang ditandai filter kualitas.
+func positionQuery(db *gorm.DB, tr *Trip, includeFlagged bool) *gorm.DB {
+	q := db.Table("position_log").Where("vehicle_id = ? AND ts >= ? AND ts <= ?", tr.VehicleID, tr.StartTs, tr.EndTs)
+	if !includeFlagged {
+		q = q.Where("quality = ?", "GOOD")
 	}
-
-	c.JSON(http.StatusOK, gin.H{"trip": tr, "positions": positions})
+	return q.Order("ts ASC")
 }
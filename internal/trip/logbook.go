@@ -0,0 +1,423 @@
+package trip
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/geocode"
+)
+
+// rentang logbook maksimal per request (satu tahun pajak)
+const logbookMaxRange = 366 * 24 * time.Hour
+
+// TripCorrection audit koreksi klasifikasi trip yang sudah difinalisasi
+type TripCorrection struct {
+	ID        int64             `json:"id"        gorm:"column:id;primaryKey"`
+	TripID    int64             `json:"tripId"    gorm:"column:trip_id"`
+	UserID    *int64            `json:"userId"    gorm:"column:user_id"`
+	Reason    string            `json:"reason"    gorm:"column:reason"`
+	Before    datatypes.JSONMap `json:"before"    gorm:"column:before"`
+	After     datatypes.JSONMap `json:"after"     gorm:"column:after"`
+	CreatedAt time.Time         `json:"createdAt" gorm:"column:created_at"`
+}
+
+func (TripCorrection) TableName() string {
+	return "trip_corrections"
+}
+
+// ClassificationRequest body PATCH /trips/:id/classification
+type ClassificationRequest struct {
+	Classification string  `json:"classification"`
+	Purpose        *string `json:"purpose"`
+}
+
+// CorrectionRequest body POST /trips/:id/corrections. Field yang tidak diisi tetap.
+type CorrectionRequest struct {
+	Classification *string `json:"classification"`
+	Purpose        *string `json:"purpose"`
+	Reason         string  `json:"reason"`
+}
+
+// FinalizeRequest body POST /vehicles/:id/logbook/finalize
+type FinalizeRequest struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// normalizeClassification uppercase + cek nilai, "" bila tidak valid
+func normalizeClassification(v string) string {
+	v = strings.ToUpper(strings.TrimSpace(v))
+	if v != ClassBusiness && v != ClassPrivate {
+		return ""
+	}
+	return v
+}
+
+// classificationSnapshot nilai klasifikasi trip untuk audit koreksi
+func classificationSnapshot(tr *Trip) datatypes.JSONMap {
+	return datatypes.JSONMap{
+		"classification":       tr.Classification,
+		"purpose":              tr.Purpose,
+		"classificationSource": tr.ClassificationSource,
+	}
+}
+
+// ClassifyTrip PATCH /trips/:id/classification: driver / user organisasi tandai trip BUSINESS atau
+// PRIVATE beserta tujuan. Trip yang sudah difinalisasi hanya bisa diubah lewat koreksi.
+func (h *Handler) ClassifyTrip(c *gin.Context) {
+	tr, ok := h.loadTrip(c)
+	if !ok {
+		return
+	}
+	cu, _ := auth.GetCurrentUser(c)
+
+	var req ClassificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "body bukan JSON valid"})
+		return
+	}
+	class := normalizeClassification(req.Classification)
+	if class == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "classification harus BUSINESS atau PRIVATE"})
+		return
+	}
+
+	userID, now := cu.ID, time.Now().UTC()
+	res := h.DB.Model(&Trip{}).Where("id = ? AND finalized_at IS NULL", tr.ID).Updates(map[string]interface{}{
+		"classification":         class,
+		"purpose":                req.Purpose,
+		"classification_source":  SourceManual,
+		"classification_rule_id": nil,
+		"classified_by":          userID,
+		"classified_at":          now,
+	})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "trip_finalized", "message": "trip sudah difinalisasi, ubah lewat koreksi"})
+		return
+	}
+
+	source := SourceManual
+	tr.Classification, tr.Purpose, tr.ClassificationSource = &class, req.Purpose, &source
+	tr.ClassificationRuleID, tr.ClassifiedBy, tr.ClassifiedAt = nil, &userID, &now
+	c.JSON(http.StatusOK, tr)
+}
+
+// CorrectTrip POST /trips/:id/corrections: ubah klasifikasi trip terfinalisasi dengan alasan.
+// Hanya ORG ADMIN / SUPER_ADMIN; nilai sebelum & sesudah dicatat di trip_corrections.
+func (h *Handler) CorrectTrip(c *gin.Context) {
+	tr, ok := h.loadTrip(c)
+	if !ok {
+		return
+	}
+	cu, _ := auth.GetCurrentUser(c)
+	if !cu.IsSuperAdmin() && !cu.IsOrgAdmin() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "message": "hanya ORG ADMIN yang boleh mengoreksi logbook"})
+		return
+	}
+
+	var req CorrectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "body bukan JSON valid"})
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "reason wajib diisi"})
+		return
+	}
+	if req.Classification == nil && req.Purpose == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "classification atau purpose wajib diisi"})
+		return
+	}
+	if req.Classification != nil {
+		class := normalizeClassification(*req.Classification)
+		if class == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "classification harus BUSINESS atau PRIVATE"})
+			return
+		}
+		req.Classification = &class
+	}
+	if tr.FinalizedAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "not_finalized", "message": "trip belum difinalisasi, ubah lewat PATCH classification"})
+		return
+	}
+
+	userID, now := cu.ID, time.Now().UTC()
+	correction := TripCorrection{TripID: tr.ID, UserID: &userID, Reason: req.Reason, Before: classificationSnapshot(&tr), CreatedAt: now}
+	if req.Classification != nil {
+		tr.Classification = req.Classification
+	}
+	if req.Purpose != nil {
+		tr.Purpose = req.Purpose
+	}
+	source := SourceManual
+	tr.ClassificationSource, tr.ClassificationRuleID, tr.ClassifiedBy, tr.ClassifiedAt = &source, nil, &userID, &now
+	correction.After = classificationSnapshot(&tr)
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Trip{}).Where("id = ?", tr.ID).Updates(map[string]interface{}{
+			"classification":         tr.Classification,
+			"purpose":                tr.Purpose,
+			"classification_source":  SourceManual,
+			"classification_rule_id": nil,
+			"classified_by":          userID,
+			"classified_at":          now,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&correction).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"trip": tr, "correction": correction})
+}
+
+// ListCorrections GET /trips/:id/corrections
+func (h *Handler) ListCorrections(c *gin.Context) {
+	tr, ok := h.loadTrip(c)
+	if !ok {
+		return
+	}
+	var corrections []TripCorrection
+	if err := h.DB.Where("trip_id = ?", tr.ID).Order("id").Find(&corrections).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": corrections})
+}
+
+// logbookRange from & to RFC3339 dari query, maksimal logbookMaxRange. Response 400 sudah ditulis bila false.
+func logbookRange(c *gin.Context, from, to time.Time) bool {
+	if from.IsZero() || to.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "from dan to wajib diisi (RFC3339)"})
+		return false
+	}
+	if !to.After(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "to must be after from"})
+		return false
+	}
+	if to.Sub(from) > logbookMaxRange {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "requested range exceeds max range"})
+		return false
+	}
+	return true
+}
+
+// logbookTrips trip kendaraan yang dimulai dalam [from, to), urut waktu
+func logbookTrips(db *gorm.DB, vehicleID int64, from, to time.Time) ([]Trip, error) {
+	var trips []Trip
+	err := db.Where("vehicle_id = ? AND start_ts >= ? AND start_ts < ?", vehicleID, from, to).
+		Order("start_ts ASC").Find(&trips).Error
+	return trips, err
+}
+
+// GetLogbook GET /vehicles/:id/logbook?from=&to=&format=json|csv. locked = semua trip dalam rentang
+// sudah difinalisasi.
+func (h *Handler) GetLogbook(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	vehicleID, _, ok := h.vehicleScope(c, cu)
+	if !ok {
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "format harus json atau csv"})
+		return
+	}
+	from, _ := time.Parse(time.RFC3339, c.Query("from"))
+	to, _ := time.Parse(time.RFC3339, c.Query("to"))
+	if !logbookRange(c, from, to) {
+		return
+	}
+
+	trips, err := logbookTrips(h.DB, vehicleID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+
+	locked := len(trips) > 0
+	totals := map[string]float64{"businessKm": 0, "privateKm": 0, "unclassifiedKm": 0}
+	for i := range trips {
+		locked = locked && trips[i].FinalizedAt != nil
+		var km float64
+		if trips[i].DistanceKm != nil {
+			km = *trips[i].DistanceKm
+		}
+		switch {
+		case trips[i].Classification == nil:
+			totals["unclassifiedKm"] += km
+		case *trips[i].Classification == ClassBusiness:
+			totals["businessKm"] += km
+		default:
+			totals["privateKm"] += km
+		}
+	}
+	for k, v := range totals {
+		totals[k] = round2(v)
+	}
+
+	h.addAddresses(trips)
+	if format == "json" {
+		c.JSON(http.StatusOK, gin.H{
+			"vehicleId": vehicleID,
+			"from":      from,
+			"to":        to,
+			"locked":    locked,
+			"totals":    totals,
+			"data":      trips,
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("logbook-%d-%s-%s.csv", vehicleID, from.UTC().Format("20060102"), to.UTC().Format("20060102"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("X-Logbook-Locked", strconv.FormatBool(locked))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write([]string{"trip_id", "start_ts", "end_ts", "start_lat", "start_lon", "end_lat", "end_lon",
+		"distance_km", "duration_seconds", "classification", "purpose", "classification_source", "finalized_at", "start_address", "end_address"})
+	for i := range trips {
+		tr := &trips[i]
+		_ = w.Write([]string{
+			strconv.FormatInt(tr.ID, 10),
+			tr.StartTs.UTC().Format(time.RFC3339),
+			tr.EndTs.UTC().Format(time.RFC3339),
+			csvFloat(tr.StartLat), csvFloat(tr.StartLon), csvFloat(tr.EndLat), csvFloat(tr.EndLon),
+			csvFloat(tr.DistanceKm),
+			csvInt(tr.DurationSeconds),
+			csvString(tr.Classification),
+			csvString(tr.Purpose),
+			csvString(tr.ClassificationSource),
+			csvTime(tr.FinalizedAt),
+			csvAddress(tr.StartAddress),
+			csvAddress(tr.EndAddress),
+		})
+	}
+	w.Flush()
+}
+
+func csvFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return formatFloat(*v)
+}
+
+func csvInt(v *int64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatInt(*v, 10)
+}
+
+func csvString(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
+
+func csvAddress(v *geocode.Address) string {
+	if v == nil {
+		return ""
+	}
+	return v.Label
+}
+
+func csvTime(v *time.Time) string {
+	if v == nil {
+		return ""
+	}
+	return v.UTC().Format(time.RFC3339)
+}
+
+// FinalizeLogbook POST /vehicles/:id/logbook/finalize: kunci semua trip yang dimulai dalam [from, to).
+// Ditolak bila masih ada trip yang belum diklasifikasi atau masih berjalan.
+func (h *Handler) FinalizeLogbook(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	vehicleID, _, ok := h.vehicleScope(c, cu)
+	if !ok {
+		return
+	}
+	var req FinalizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "body harus berisi from dan to (RFC3339)"})
+		return
+	}
+	if !logbookRange(c, req.From, req.To) {
+		return
+	}
+
+	var finalized int64
+	var unclassified, open []int64
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// kunci yang sama dengan builder & rebuild supaya trip tidak berubah selagi difinalisasi
+		if _, err := lockVehicle(tx, vehicleID); err != nil {
+			return err
+		}
+		trips, err := logbookTrips(tx, vehicleID, req.From, req.To)
+		if err != nil {
+			return err
+		}
+		var ids []int64
+		for i := range trips {
+			switch {
+			case trips[i].Metadata["status"] == StatusOpen:
+				open = append(open, trips[i].ID)
+			case trips[i].Classification == nil:
+				unclassified = append(unclassified, trips[i].ID)
+			case trips[i].FinalizedAt == nil:
+				ids = append(ids, trips[i].ID)
+			}
+		}
+		if len(open) > 0 || len(unclassified) > 0 || len(ids) == 0 {
+			return nil
+		}
+		res := tx.Model(&Trip{}).Where("id IN ? AND finalized_at IS NULL", ids).Updates(map[string]interface{}{
+			"finalized_at": time.Now().UTC(),
+			"finalized_by": cu.ID,
+		})
+		finalized = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	if len(open) > 0 || len(unclassified) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":               "logbook_incomplete",
+			"message":             "semua trip dalam rentang harus sudah selesai dan diklasifikasi",
+			"openTripIds":         open,
+			"unclassifiedTripIds": unclassified,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"vehicleId": vehicleID, "from": req.From, "to": req.To, "finalized": finalized})
+}
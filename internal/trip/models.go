@@ -4,6 +4,8 @@ import (
 	"time"
 
 	"gorm.io/datatypes"
+
+	"github.com/username/fms-api/internal/geocode"
 )
 
 type Trip struct {
@@ -21,9 +23,59 @@ type Trip struct {
 	AvgSpeedKph     *float64          `json:"avgSpeedKph"      gorm:"column:avg_speed_kph"`
 	Metadata        datatypes.JSONMap `json:"metadata"         gorm:"column:metadata"` // mapping JSONB
 	CreatedAt       time.Time         `json:"createdAt"        gorm:"column:created_at"`
+
+	// klasifikasi logbook: BUSINESS / PRIVATE, diisi driver (MANUAL) atau aturan klasifikasi (RULE)
+	Classification       *string    `json:"classification"       gorm:"column:classification"`
+	Purpose              *string    `json:"purpose"              gorm:"column:purpose"`
+	ClassificationSource *string    `json:"classificationSource" gorm:"column:classification_source"`
+	ClassificationRuleID *int64     `json:"classificationRuleId" gorm:"column:classification_rule_id"`
+	ClassifiedBy         *int64     `json:"classifiedBy"         gorm:"column:classified_by"`
+	ClassifiedAt         *time.Time `json:"classifiedAt"         gorm:"column:classified_at"`
+	FinalizedAt          *time.Time `json:"finalizedAt"          gorm:"column:finalized_at"` // terkunci, perubahan hanya lewat koreksi
+	FinalizedBy          *int64     `json:"finalizedBy"          gorm:"column:finalized_by"`
+
+	// alamat titik awal / akhir dari reverse geocoding, diisi saat response (tidak disimpan)
+	StartAddress *geocode.Address `json:"startAddress,omitempty" gorm:"-"`
+	EndAddress   *geocode.Address `json:"endAddress,omitempty"   gorm:"-"`
 }
 
 // nama tabel di DB
 func (Trip) TableName() string {
 	return "trips"
 }
+
+// BuilderState posisi terakhir trip builder per kendaraan: fix GOOD terakhir yang sudah diproses,
+// trip yang sedang dibangun (open, JSON Segment; NULL = kendaraan tidak sedang trip) dan stop
+// yang sedang berlangsung (stop, JSON StopSegment).
+type BuilderState struct {
+	VehicleID int64          `json:"vehicleId" gorm:"column:vehicle_id;primaryKey;autoIncrement:false"`
+	LastTS    *time.Time     `json:"lastTs"    gorm:"column:last_ts"`
+	LastLat   *float64       `json:"lastLat"   gorm:"column:last_lat"`
+	LastLon   *float64       `json:"lastLon"   gorm:"column:last_lon"`
+	Open      datatypes.JSON `json:"open"      gorm:"column:open"`
+	Stop      datatypes.JSON `json:"stop"      gorm:"column:stop"`
+	UpdatedAt time.Time      `json:"updatedAt" gorm:"column:updated_at"`
+}
+
+func (BuilderState) TableName() string {
+	return "trip_builder_states"
+}
+
+// Stop kendaraan diam di satu lokasi, hasil deteksi trip builder. ignition_on true = idle
+// (mesin hidup), false = parkir, NULL = device tidak mengirim ignition.
+type Stop struct {
+	ID              int64     `json:"id"              gorm:"column:id;primaryKey"`
+	VehicleID       int64     `json:"vehicleId"       gorm:"column:vehicle_id"`
+	StartTs         time.Time `json:"startTs"         gorm:"column:start_ts"`
+	EndTs           time.Time `json:"endTs"           gorm:"column:end_ts"`
+	Lat             float64   `json:"lat"             gorm:"column:lat"`
+	Lon             float64   `json:"lon"             gorm:"column:lon"`
+	DurationSeconds int64     `json:"durationSeconds" gorm:"column:duration_seconds"`
+	IgnitionOn      *bool     `json:"ignitionOn"      gorm:"column:ignition_on"`
+	Ongoing         bool      `json:"ongoing"         gorm:"column:ongoing"` // masih berlangsung, end_ts = fix terakhir
+	CreatedAt       time.Time `json:"createdAt"       gorm:"column:created_at"`
+}
+
+func (Stop) TableName() string {
+	return "stops"
+}
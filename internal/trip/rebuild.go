@@ -0,0 +1,658 @@
+package trip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/username/fms-api/internal/auth"
+)
+
+// Status job rebuild trip
+const (
+	RebuildQueued  = "QUEUED"
+	RebuildRunning = "RUNNING"
+	RebuildDone    = "DONE"
+	RebuildFailed  = "FAILED"
+)
+
+// ErrRebuildTaken job sudah diambil worker lain (atau sudah selesai)
+var ErrRebuildTaken = errors.New("job rebuild sudah diproses")
+
+// ErrRebuildFinalized rentang rebuild berisi trip logbook yang sudah difinalisasi
+var ErrRebuildFinalized = errors.New("rentang berisi trip yang sudah difinalisasi di logbook")
+
+// errOrganizationNotFound organizationId job rebuild tidak ada
+var errOrganizationNotFound = errors.New("organisasi tidak ditemukan")
+
+// RebuildJob job hitung ulang trips dari position_log untuk satu kendaraan (vehicle_id diisi)
+// atau semua kendaraan organisasi dalam rentang [from_ts, to_ts)
+type RebuildJob struct {
+	ID             int64      `json:"id"             gorm:"column:id;primaryKey"`
+	OrganizationID int64      `json:"organizationId" gorm:"column:organization_id"`
+	VehicleID      *int64     `json:"vehicleId"      gorm:"column:vehicle_id"`
+	FromTS         time.Time  `json:"from"           gorm:"column:from_ts"`
+	ToTS           time.Time  `json:"to"             gorm:"column:to_ts"`
+	Status         string     `json:"status"         gorm:"column:status"`
+	TotalVehicles  int        `json:"totalVehicles"  gorm:"column:total_vehicles"`
+	DoneVehicles   int        `json:"doneVehicles"   gorm:"column:done_vehicles"`
+	TripsDeleted   int        `json:"tripsDeleted"   gorm:"column:trips_deleted"`
+	TripsCreated   int        `json:"tripsCreated"   gorm:"column:trips_created"`
+	Error          *string    `json:"error"          gorm:"column:error"`
+	CreatedBy      *int64     `json:"createdBy"      gorm:"column:created_by"`
+	CreatedAt      time.Time  `json:"createdAt"      gorm:"column:created_at"`
+	StartedAt      *time.Time `json:"startedAt"      gorm:"column:started_at"`
+	FinishedAt     *time.Time `json:"finishedAt"     gorm:"column:finished_at"`
+}
+
+func (RebuildJob) TableName() string {
+	return "trip_rebuild_jobs"
+}
+
+// RebuildRequest body POST /admin/trips/rebuild. Isi salah satu dari vehicleId / organizationId.
+type RebuildRequest struct {
+	VehicleID      *int64    `json:"vehicleId"`
+	OrganizationID *int64    `json:"organizationId"`
+	From           time.Time `json:"from" binding:"required"`
+	To             time.Time `json:"to"   binding:"required"`
+}
+
+// validate cek isi request, return pesan error ("" = valid)
+func (req *RebuildRequest) validate() string {
+	if (req.VehicleID == nil) == (req.OrganizationID == nil) {
+		return "isi salah satu dari vehicleId atau organizationId"
+	}
+	if !req.From.Before(req.To) {
+		return "from harus sebelum to"
+	}
+	return ""
+}
+
+// CreateRebuildJob antrekan job QUEUED. Organisasi job diambil dari kendaraan bila vehicleId diisi.
+func CreateRebuildJob(db *gorm.DB, req RebuildRequest, createdBy *int64) (*RebuildJob, error) {
+	if msg := req.validate(); msg != "" {
+		return nil, errors.New(msg)
+	}
+	job := &RebuildJob{
+		VehicleID: req.VehicleID,
+		FromTS:    req.From.UTC(),
+		ToTS:      req.To.UTC(),
+		Status:    RebuildQueued,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UTC(),
+	}
+	if req.VehicleID != nil {
+		orgID, err := vehicleOrg(db, *req.VehicleID)
+		if err != nil {
+			return nil, err
+		}
+		job.OrganizationID = orgID
+		job.TotalVehicles = 1
+	} else {
+		job.OrganizationID = *req.OrganizationID
+		var n int64
+		if err := db.Table("organizations").Where("id = ?", job.OrganizationID).Count(&n).Error; err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, errOrganizationNotFound
+		}
+		if err := db.Table("vehicles").Where("organization_id = ?", job.OrganizationID).Count(&n).Error; err != nil {
+			return nil, err
+		}
+		job.TotalVehicles = int(n)
+	}
+	if err := db.Create(job).Error; err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// RebuildResult hasil rebuild satu kendaraan
+type RebuildResult struct {
+	Deleted int `json:"deleted"`
+	Created int `json:"created"`
+}
+
+// Rebuilder memproses job di trip_rebuild_jobs. Tiap kendaraan dihapus & dibangun ulang trips-nya
+// dalam satu transaksi yang mengunci row kendaraan, sehingga tidak bentrok dengan Builder live;
+// fix sesudah cursor builder (trip_builder_states.last_ts) tetap menjadi bagian builder live.
+type Rebuilder struct {
+	DB       *gorm.DB
+	Rules    Rules         // default, ditimpa aturan organisasi / kendaraan di trip_rules
+	Interval time.Duration // default 10 detik
+	// StaleAfter job RUNNING yang started_at-nya lebih lama dari ini dianggap ditinggal proses
+	// yang mati dan diantrekan ulang saat Start. Default 1 jam.
+	StaleAfter time.Duration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewRebuilder(db *gorm.DB) *Rebuilder {
+	return &Rebuilder{DB: db, Rules: DefaultRules(), Interval: 10 * time.Second, StaleAfter: time.Hour}
+}
+
+// RequeueStale kembalikan job RUNNING yang dimulai sebelum now - StaleAfter ke QUEUED dengan progres
+// direset. Rebuild per kendaraan menimpa hasil sebelumnya, jadi job aman diulang dari awal.
+// Return jumlah job yang diantrekan ulang.
+func (r *Rebuilder) RequeueStale(now time.Time) (int, error) {
+	staleAfter := r.StaleAfter
+	if staleAfter <= 0 {
+		staleAfter = time.Hour
+	}
+	res := r.DB.Model(&RebuildJob{}).
+		Where("status = ? AND (started_at IS NULL OR started_at < ?)", RebuildRunning, now.UTC().Add(-staleAfter)).
+		Updates(map[string]interface{}{
+			"status":        RebuildQueued,
+			"started_at":    nil,
+			"done_vehicles": 0,
+			"trips_deleted": 0,
+			"trips_created": 0,
+		})
+	return int(res.RowsAffected), res.Error
+}
+
+// RunOnce proses job QUEUED satu per satu sampai antrean kosong. Return jumlah job yang diproses.
+func (r *Rebuilder) RunOnce() (int, error) {
+	processed := 0
+	for {
+		var jobs []RebuildJob
+		if err := r.DB.Where("status = ?", RebuildQueued).Order("id").Limit(1).Find(&jobs).Error; err != nil {
+			return processed, err
+		}
+		if len(jobs) == 0 {
+			return processed, nil
+		}
+		err := r.Run(&jobs[0], nil)
+		if errors.Is(err, ErrRebuildTaken) {
+			continue
+		}
+		processed++
+		if err != nil {
+			log.Printf("trip rebuild job %d gagal: %v", jobs[0].ID, err)
+		}
+	}
+}
+
+// Run ambil job QUEUED lalu proses semua kendaraannya. Progres ditulis ke job setelah tiap
+// kendaraan (dan dilaporkan ke progress bila tidak nil). Kendaraan yang sudah selesai tetap
+// tersimpan walaupun kendaraan berikutnya gagal.
+func (r *Rebuilder) Run(job *RebuildJob, progress func(*RebuildJob)) error {
+	started := time.Now().UTC()
+	res := r.DB.Model(&RebuildJob{}).
+		Where("id = ? AND status = ?", job.ID, RebuildQueued).
+		Updates(map[string]interface{}{"status": RebuildRunning, "started_at": started})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRebuildTaken
+	}
+	job.Status, job.StartedAt = RebuildRunning, &started
+
+	vehicleIDs := []int64{}
+	if job.VehicleID != nil {
+		vehicleIDs = append(vehicleIDs, *job.VehicleID)
+	} else if err := r.DB.Table("vehicles").Where("organization_id = ?", job.OrganizationID).
+		Order("id").Pluck("id", &vehicleIDs).Error; err != nil {
+		return r.finish(job, err)
+	}
+	job.TotalVehicles = len(vehicleIDs)
+
+	for _, id := range vehicleIDs {
+		result, err := r.RebuildVehicle(id, job.FromTS, job.ToTS, time.Now().UTC())
+		if err != nil {
+			return r.finish(job, err)
+		}
+		job.DoneVehicles++
+		job.TripsDeleted += result.Deleted
+		job.TripsCreated += result.Created
+		if err := r.saveProgress(job); err != nil {
+			return r.finish(job, err)
+		}
+		if progress != nil {
+			progress(job)
+		}
+	}
+	return r.finish(job, nil)
+}
+
+// saveProgress tulis progres & status job
+func (r *Rebuilder) saveProgress(job *RebuildJob) error {
+	return r.DB.Model(&RebuildJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+		"status":         job.Status,
+		"total_vehicles": job.TotalVehicles,
+		"done_vehicles":  job.DoneVehicles,
+		"trips_deleted":  job.TripsDeleted,
+		"trips_created":  job.TripsCreated,
+		"error":          job.Error,
+		"finished_at":    job.FinishedAt,
+	}).Error
+}
+
+// finish tandai job DONE / FAILED. Return cause (atau error saat menulis job).
+func (r *Rebuilder) finish(job *RebuildJob, cause error) error {
+	finished := time.Now().UTC()
+	job.Status, job.FinishedAt = RebuildDone, &finished
+	if cause != nil {
+		msg := cause.Error()
+		job.Status, job.Error = RebuildFailed, &msg
+	}
+	if err := r.saveProgress(job); err != nil && cause == nil {
+		return err
+	}
+	return cause
+}
+
+// RebuildVehicle hapus lalu bangun ulang trips & stops satu kendaraan dalam [from, to) dalam satu
+// transaksi. Awal rentang dimundurkan ke awal trip / stop yang terpotong from; akhir rentang dimajukan
+// sampai trip yang masih berjalan di to selesai. Fix sesudah cursor builder tidak dibaca. Bila rentang mencapai
+// cursor, state builder ikut diganti supaya builder live melanjutkan trip hasil rebuild. Rollup harian
+// rentang tersebut ikut dihitung ulang. Rentang yang berisi trip logbook terfinalisasi ditolak dengan
+// ErrRebuildFinalized.
+func (r *Rebuilder) RebuildVehicle(vehicleID int64, from, to, now time.Time) (RebuildResult, error) {
+	var result RebuildResult
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		found, err := lockVehicle(tx, vehicleID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errVehicleNotFound
+		}
+
+		var st BuilderState
+		if err := tx.Where("vehicle_id = ?", vehicleID).Limit(1).Find(&st).Error; err != nil {
+			return err
+		}
+		hasState := st.VehicleID != 0
+		st.VehicleID = vehicleID
+
+		rules, err := ResolveRules(tx, r.Rules, vehicleID)
+		if err != nil {
+			return err
+		}
+
+		// from di tengah trip / stop: mulai dari awal trip / stop tersebut, termasuk yang sedang
+		// dibangun builder live
+		var liveStart *time.Time
+		if len(st.Open) > 0 {
+			var open Segment
+			if err := json.Unmarshal(st.Open, &open); err != nil {
+				return err
+			}
+			liveStart = &open.StartTS
+		}
+		if len(st.Stop) > 0 {
+			var stop StopSegment
+			if err := json.Unmarshal(st.Stop, &stop); err != nil {
+				return err
+			}
+			if liveStart == nil || stop.StartTS.Before(*liveStart) {
+				liveStart = &stop.StartTS
+			}
+		}
+		if liveStart != nil && liveStart.Before(from) {
+			from = *liveStart
+		}
+		for {
+			start, err := coveringStart(tx, vehicleID, from, true)
+			if err != nil {
+				return err
+			}
+			if start == nil {
+				break
+			}
+			from = *start
+		}
+
+		seg := &segmenter{rules: rules}
+		var before []Point
+		if err := tx.Table("position_log").
+			Select("ts", "lat", "lon", "speed_kph", "ignition_on").
+			Where("vehicle_id = ? AND quality = ? AND ts < ?", vehicleID, "GOOD", from).
+			Order("ts DESC").Limit(1).
+			Find(&before).Error; err != nil {
+			return err
+		}
+		if len(before) > 0 {
+			seg.prev = &before[0]
+		}
+
+		// end = batas potong, row yang dimulai sejak end tidak disentuh (nil = dibaca sampai cursor builder)
+		var end *time.Time
+		cursor := from
+		var cursorID int64
+		for end == nil {
+			q := tx.Table("position_log").
+				Select("id", "ts", "lat", "lon", "speed_kph", "ignition_on").
+				Where("vehicle_id = ? AND quality = ?", vehicleID, "GOOD")
+			if cursorID == 0 {
+				q = q.Where("ts >= ?", cursor)
+			} else {
+				q = afterPoint(q, cursor, cursorID)
+			}
+			if hasState && st.LastTS != nil {
+				q = q.Where("ts <= ?", *st.LastTS)
+			}
+			var points []pagedPoint
+			if err := q.Order("ts, id").Limit(builderPointBatch).Find(&points).Error; err != nil {
+				return err
+			}
+			for i := range points {
+				if !points[i].TS.Before(to) && seg.open == nil {
+					// stop yang sedang berlangsung dibiarkan utuh: potong di awal stop
+					cut := points[i].TS
+					if seg.stop != nil {
+						cut = seg.stop.StartTS
+					}
+					ok, err := rebuildBoundary(tx, vehicleID, from, cut, liveStart)
+					if err != nil {
+						return err
+					}
+					if ok {
+						end = &cut
+						break
+					}
+				}
+				seg.add(points[i].Point)
+			}
+			if len(points) < builderPointBatch {
+				break
+			}
+			cursor, cursorID = points[len(points)-1].TS, points[len(points)-1].ID
+		}
+
+		window := func() *gorm.DB {
+			q := tx.Where("vehicle_id = ? AND start_ts >= ?", vehicleID, from)
+			if end != nil {
+				q = q.Where("start_ts < ?", *end)
+			}
+			return q
+		}
+		// trip terfinalisasi tidak boleh berubah; klasifikasi manual dipindah ke trip hasil rebuild
+		var classified []Trip
+		if err := window().Where("finalized_at IS NOT NULL OR classification_source = ?", SourceManual).
+			Order("start_ts").Find(&classified).Error; err != nil {
+			return err
+		}
+		for _, tr := range classified {
+			if tr.FinalizedAt != nil {
+				return ErrRebuildFinalized
+			}
+		}
+
+		res := window().Delete(&Trip{})
+		if res.Error != nil {
+			return res.Error
+		}
+		result.Deleted = int(res.RowsAffected)
+		if err := window().Delete(&Stop{}).Error; err != nil {
+			return err
+		}
+
+		if end == nil {
+			seg.closeSilent(now)
+		}
+		for i := range seg.closed {
+			if err := saveTrip(tx, vehicleID, &seg.closed[i], StatusClosed); err != nil {
+				return err
+			}
+		}
+		result.Created = len(seg.closed)
+		if _, err := saveStops(tx, vehicleID, seg, end == nil); err != nil {
+			return err
+		}
+		rebuilt := make([]*Segment, 0, len(seg.closed)+1)
+		for i := range seg.closed {
+			rebuilt = append(rebuilt, &seg.closed[i])
+		}
+		if end != nil {
+			if err := carryClassifications(tx, classified, rebuilt); err != nil {
+				return err
+			}
+			return refreshDailyStats(tx, vehicleID, from, *end)
+		}
+
+		// sampai cursor: trip & stop yang masih berjalan menjadi milik builder live
+		if seg.open != nil && seg.open.qualifies(rules) {
+			if err := saveTrip(tx, vehicleID, seg.open, StatusOpen); err != nil {
+				return err
+			}
+			result.Created++
+			rebuilt = append(rebuilt, seg.open)
+		}
+		if err := carryClassifications(tx, classified, rebuilt); err != nil {
+			return err
+		}
+		if err := refreshDailyStats(tx, vehicleID, from, now); err != nil {
+			return err
+		}
+		if !hasState && seg.prev == nil {
+			return nil
+		}
+		return st.save(tx, seg, now)
+	})
+	return result, err
+}
+
+// carryClassifications pindahkan klasifikasi manual trip lama ke trip hasil rebuild yang paling banyak
+// beririsan waktunya. Trip baru yang sudah menerima klasifikasi manual tidak ditimpa lagi.
+func carryClassifications(tx *gorm.DB, manual []Trip, rebuilt []*Segment) error {
+	taken := make(map[int64]bool)
+	for _, old := range manual {
+		var best *Segment
+		var bestOverlap time.Duration
+		for _, s := range rebuilt {
+			if s.TripID == nil || taken[*s.TripID] {
+				continue
+			}
+			start, end := s.StartTS, s.EndTS
+			if old.StartTs.After(start) {
+				start = old.StartTs
+			}
+			if old.EndTs.Before(end) {
+				end = old.EndTs
+			}
+			if overlap := end.Sub(start); overlap > bestOverlap {
+				best, bestOverlap = s, overlap
+			}
+		}
+		if best == nil {
+			continue
+		}
+		taken[*best.TripID] = true
+		if err := tx.Model(&Trip{}).Where("id = ?", *best.TripID).Updates(map[string]interface{}{
+			"classification":         old.Classification,
+			"purpose":                old.Purpose,
+			"classification_source":  SourceManual,
+			"classification_rule_id": nil,
+			"classified_by":          old.ClassifiedBy,
+			"classified_at":          old.ClassifiedAt,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildBoundary rebuild boleh dipotong di cut bila cut sesudah from, sebelum trip / stop builder
+// live, dan tidak ada trip / stop lama yang masih berjalan melewati cut (yang dimulai sebelum cut
+// ikut dihapus).
+func rebuildBoundary(tx *gorm.DB, vehicleID int64, from, cut time.Time, liveStart *time.Time) (bool, error) {
+	if !cut.After(from) || (liveStart != nil && !cut.Before(*liveStart)) {
+		return false, nil
+	}
+	start, err := coveringStart(tx, vehicleID, cut, false)
+	return start == nil, err
+}
+
+// coveringStart awal trip / stop paling awal yang dimulai sebelum ts dan berakhir sesudah ts
+// (inclusive: atau tepat di ts). nil bila tidak ada.
+func coveringStart(tx *gorm.DB, vehicleID int64, ts time.Time, inclusive bool) (*time.Time, error) {
+	cond := "vehicle_id = ? AND start_ts < ? AND end_ts > ?"
+	if inclusive {
+		cond = "vehicle_id = ? AND start_ts < ? AND end_ts >= ?"
+	}
+	var earliest *time.Time
+	for _, table := range []string{"trips", "stops"} {
+		var rows []struct {
+			StartTs time.Time `gorm:"column:start_ts"`
+		}
+		if err := tx.Table(table).Select("start_ts").Where(cond, vehicleID, ts, ts).
+			Order("start_ts").Limit(1).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		if len(rows) > 0 && (earliest == nil || rows[0].StartTs.Before(*earliest)) {
+			earliest = &rows[0].StartTs
+		}
+	}
+	return earliest, nil
+}
+
+// lockVehicle kunci row kendaraan sampai transaksi selesai supaya Builder dan Rebuilder tidak
+// memproses kendaraan yang sama bersamaan. NO KEY UPDATE tidak menahan insert position_log (FK).
+func lockVehicle(tx *gorm.DB, vehicleID int64) (bool, error) {
+	var ids []int64
+	err := tx.Table("vehicles").Clauses(clause.Locking{Strength: "NO KEY UPDATE"}).
+		Where("id = ?", vehicleID).Pluck("id", &ids).Error
+	return len(ids) > 0, err
+}
+
+// Start jalankan rebuilder berkala di background
+func (r *Rebuilder) Start() {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	if n, err := r.RequeueStale(time.Now()); err != nil {
+		log.Printf("trip rebuild: %v", err)
+	} else if n > 0 {
+		log.Printf("trip rebuild: %d job RUNNING yang terhenti diantrekan ulang", n)
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n, err := r.RunOnce(); err != nil {
+					log.Printf("trip rebuild: %v", err)
+				} else if n > 0 {
+					log.Printf("trip rebuild: %d job diproses", n)
+				}
+			}
+		}
+	}()
+}
+
+// Stop hentikan rebuilder dan tunggu job yang sedang berjalan selesai
+func (r *Rebuilder) Stop() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.wg.Wait()
+}
+
+// ========= HANDLER =========
+
+// RegisterAdminRoutes route /admin untuk rebuild trip
+func (h *Handler) RegisterAdminRoutes(r gin.IRoutes) {
+	r.POST("/trips/rebuild", h.CreateRebuild)
+	r.GET("/trips/rebuild/:jobId", h.GetRebuild)
+}
+
+// CreateRebuild POST /admin/trips/rebuild: antrekan rebuild trip, diproses Rebuilder di background
+func (h *Handler) CreateRebuild(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok || (!cu.IsSuperAdmin() && !cu.IsOrgAdmin()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "message": "hanya SUPER_ADMIN atau admin organisasi yang boleh rebuild trip"})
+		return
+	}
+	var req RebuildRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": err.Error()})
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": msg})
+		return
+	}
+	if req.OrganizationID != nil && !cu.IsSuperAdmin() && (cu.OrganizationID == nil || *cu.OrganizationID != *req.OrganizationID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return
+	}
+	if req.VehicleID != nil {
+		orgID, err := vehicleOrg(h.DB, *req.VehicleID)
+		if errors.Is(err, errVehicleNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+			return
+		}
+		if !cu.IsSuperAdmin() && (cu.OrganizationID == nil || *cu.OrganizationID != orgID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+	}
+
+	userID := cu.ID
+	job, err := CreateRebuildJob(h.DB, req, &userID)
+	if errors.Is(err, errVehicleNotFound) || errors.Is(err, errOrganizationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetRebuild GET /admin/trips/rebuild/:jobId: status & progres job
+func (h *Handler) GetRebuild(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok || (!cu.IsSuperAdmin() && !cu.IsOrgAdmin()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "message": "hanya SUPER_ADMIN atau admin organisasi yang boleh melihat rebuild trip"})
+		return
+	}
+	jobID, err := strconv.ParseInt(c.Param("jobId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "jobId harus berupa angka"})
+		return
+	}
+	var jobs []RebuildJob
+	if err := h.DB.Where("id = ?", jobID).Limit(1).Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	if len(jobs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": "job rebuild tidak ditemukan"})
+		return
+	}
+	if !cu.IsSuperAdmin() && (cu.OrganizationID == nil || *cu.OrganizationID != jobs[0].OrganizationID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return
+	}
+	c.JSON(http.StatusOK, jobs[0])
+}
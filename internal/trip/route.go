@@ -0,0 +1,131 @@
+package trip
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// positionRecord satu row position_log di detail trip
+type positionRecord struct {
+	ID         int64     `json:"id" gorm:"column:id"`
+	VehicleID  int64     `json:"vehicleId" gorm:"column:vehicle_id"`
+	DeviceID   *int64    `json:"deviceId" gorm:"column:device_id"`
+	TS         time.Time `json:"ts" gorm:"column:ts"`
+	Lat        float64   `json:"lat" gorm:"column:lat"`
+	Lon        float64   `json:"lon" gorm:"column:lon"`
+	SpeedKph   *float64  `json:"speedKph,omitempty" gorm:"column:speed_kph"`
+	HeadingDeg *float64  `json:"headingDeg,omitempty" gorm:"column:heading_deg"`
+	AltitudeM  *float64  `json:"altitudeM,omitempty" gorm:"column:altitude_m"`
+	IgnitionOn *bool     `json:"ignitionOn,omitempty" gorm:"column:ignition_on"`
+	OdometerKm *float64  `json:"odometerKm,omitempty" gorm:"column:odometer_km"`
+	Quality    string    `json:"quality" gorm:"column:quality"`
+	CreatedAt  time.Time `json:"createdAt" gorm:"column:created_at"`
+}
+
+// positionFields field yang boleh dipilih lewat ?fields=
+var positionFields = map[string]func(p *positionRecord) interface{}{
+	"id":         func(p *positionRecord) interface{} { return p.ID },
+	"vehicleId":  func(p *positionRecord) interface{} { return p.VehicleID },
+	"deviceId":   func(p *positionRecord) interface{} { return p.DeviceID },
+	"ts":         func(p *positionRecord) interface{} { return p.TS },
+	"lat":        func(p *positionRecord) interface{} { return p.Lat },
+	"lon":        func(p *positionRecord) interface{} { return p.Lon },
+	"speedKph":   func(p *positionRecord) interface{} { return p.SpeedKph },
+	"headingDeg": func(p *positionRecord) interface{} { return p.HeadingDeg },
+	"altitudeM":  func(p *positionRecord) interface{} { return p.AltitudeM },
+	"ignitionOn": func(p *positionRecord) interface{} { return p.IgnitionOn },
+	"odometerKm": func(p *positionRecord) interface{} { return p.OdometerKm },
+	"quality":    func(p *positionRecord) interface{} { return p.Quality },
+	"createdAt":  func(p *positionRecord) interface{} { return p.CreatedAt },
+}
+
+// routeOptions opsi bentuk rute di GET /trips/:id
+type routeOptions struct {
+	SimplifyM float64  // toleransi Douglas-Peucker dalam meter (0 = tidak disederhanakan)
+	MaxPoints int      // jumlah titik maksimal sesudah simplify (0 = tanpa batas)
+	Fields    []string // field per posisi (kosong = semua)
+	Polyline  bool     // format=polyline: rute sebagai encoded polyline saja
+}
+
+// parseRouteOptions baca ?simplify=&maxPoints=&fields=&format=. Response 400 sudah ditulis bila false.
+func parseRouteOptions(c *gin.Context) (routeOptions, bool) {
+	var opts routeOptions
+	bad := func(msg string) (routeOptions, bool) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": msg})
+		return opts, false
+	}
+
+	if v := c.Query("simplify"); v != "" {
+		m, err := strconv.ParseFloat(v, 64)
+		if err != nil || m <= 0 {
+			return bad("simplify harus angka meter > 0")
+		}
+		opts.SimplifyM = m
+	}
+	if v := c.Query("maxPoints"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 2 {
+			return bad("maxPoints harus angka >= 2")
+		}
+		opts.MaxPoints = n
+	}
+	if v := c.Query("fields"); v != "" {
+		for _, f := range strings.Split(v, ",") {
+			f = strings.TrimSpace(f)
+			if f == "" {
+				continue
+			}
+			if _, ok := positionFields[f]; !ok {
+				return bad("field tidak dikenal: " + f)
+			}
+			opts.Fields = append(opts.Fields, f)
+		}
+	}
+	switch c.Query("format") {
+	case "", "json":
+	case "polyline":
+		opts.Polyline = true
+	default:
+		return bad("format harus json atau polyline")
+	}
+	return opts, true
+}
+
+// apply simplify lalu downsample posisi
+func (o routeOptions) apply(positions []positionRecord) []positionRecord {
+	if o.SimplifyM <= 0 && (o.MaxPoints <= 0 || len(positions) <= o.MaxPoints) {
+		return positions
+	}
+	idx := simplifyIndices(coordsOf(positions), o.SimplifyM)
+	idx = sampleIndices(idx, o.MaxPoints)
+	out := make([]positionRecord, len(idx))
+	for i, j := range idx {
+		out[i] = positions[j]
+	}
+	return out
+}
+
+// project posisi hanya dengan field yang dipilih
+func (o routeOptions) project(positions []positionRecord) []map[string]interface{} {
+	out := make([]map[string]interface{}, len(positions))
+	for i := range positions {
+		row := make(map[string]interface{}, len(o.Fields))
+		for _, f := range o.Fields {
+			row[f] = positionFields[f](&positions[i])
+		}
+		out[i] = row
+	}
+	return out
+}
+
+func coordsOf(positions []positionRecord) [][2]float64 {
+	out := make([][2]float64, len(positions))
+	for i, p := range positions {
+		out[i] = [2]float64{p.Lat, p.Lon}
+	}
+	return out
+}
@@ -0,0 +1,389 @@
+package trip
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/auth"
+)
+
+var errVehicleNotFound = errors.New("kendaraan tidak ditemukan")
+
+// RuleSet aturan trip tersimpan: level organisasi (vehicle_id NULL) atau override per kendaraan.
+// Field NULL berarti ikut level di atasnya (kendaraan -> organisasi -> default).
+type RuleSet struct {
+	ID                 int64     `json:"id"                 gorm:"column:id;primaryKey"`
+	OrganizationID     int64     `json:"organizationId"     gorm:"column:organization_id"`
+	VehicleID          *int64    `json:"vehicleId"          gorm:"column:vehicle_id"`
+	Detection          *string   `json:"detection"          gorm:"column:detection"`
+	MinDurationSeconds *int64    `json:"minDurationSeconds" gorm:"column:min_duration_seconds"`
+	MinDistanceKm      *float64  `json:"minDistanceKm"      gorm:"column:min_distance_km"`
+	IdleTimeoutSeconds *int64    `json:"idleTimeoutSeconds" gorm:"column:idle_timeout_seconds"`
+	MovingSpeedKph     *float64  `json:"movingSpeedKph"     gorm:"column:moving_speed_kph"`
+	MaxGapSeconds      *int64    `json:"maxGapSeconds"      gorm:"column:max_gap_seconds"`
+	MinStopSeconds     *int64    `json:"minStopSeconds"     gorm:"column:min_stop_seconds"`
+	UpdatedBy          *int64    `json:"updatedBy"          gorm:"column:updated_by"`
+	UpdatedAt          time.Time `json:"updatedAt"          gorm:"column:updated_at"`
+}
+
+func (RuleSet) TableName() string {
+	return "trip_rules"
+}
+
+// RulesRequest body PUT aturan trip. Field yang tidak diisi / null ikut level di atasnya.
+type RulesRequest struct {
+	Detection          *string  `json:"detection"`
+	MinDurationSeconds *int64   `json:"minDurationSeconds"`
+	MinDistanceKm      *float64 `json:"minDistanceKm"`
+	IdleTimeoutSeconds *int64   `json:"idleTimeoutSeconds"`
+	MovingSpeedKph     *float64 `json:"movingSpeedKph"`
+	MaxGapSeconds      *int64   `json:"maxGapSeconds"`
+	MinStopSeconds     *int64   `json:"minStopSeconds"`
+}
+
+// RulesView aturan efektif dalam satuan API
+type RulesView struct {
+	Detection          string  `json:"detection"`
+	MinDurationSeconds int64   `json:"minDurationSeconds"`
+	MinDistanceKm      float64 `json:"minDistanceKm"`
+	IdleTimeoutSeconds int64   `json:"idleTimeoutSeconds"`
+	MovingSpeedKph     float64 `json:"movingSpeedKph"`
+	MaxGapSeconds      int64   `json:"maxGapSeconds"`
+	MinStopSeconds     int64   `json:"minStopSeconds"`
+}
+
+func (r Rules) View() RulesView {
+	return RulesView{
+		Detection:          r.Detection,
+		MinDurationSeconds: int64(r.MinDuration / time.Second),
+		MinDistanceKm:      r.MinDistanceKm,
+		IdleTimeoutSeconds: int64(r.IdleTimeout / time.Second),
+		MovingSpeedKph:     r.MovingSpeedKph,
+		MaxGapSeconds:      int64(r.MaxGap / time.Second),
+		MinStopSeconds:     int64(r.MinStop / time.Second),
+	}
+}
+
+// apply timpa aturan dengan field yang diisi di rule set
+func (r Rules) apply(rs *RuleSet) Rules {
+	if rs == nil {
+		return r
+	}
+	if rs.Detection != nil {
+		r.Detection = *rs.Detection
+	}
+	if rs.MinDurationSeconds != nil {
+		r.MinDuration = time.Duration(*rs.MinDurationSeconds) * time.Second
+	}
+	if rs.MinDistanceKm != nil {
+		r.MinDistanceKm = *rs.MinDistanceKm
+	}
+	if rs.IdleTimeoutSeconds != nil {
+		r.IdleTimeout = time.Duration(*rs.IdleTimeoutSeconds) * time.Second
+	}
+	if rs.MovingSpeedKph != nil {
+		r.MovingSpeedKph = *rs.MovingSpeedKph
+	}
+	if rs.MaxGapSeconds != nil {
+		r.MaxGap = time.Duration(*rs.MaxGapSeconds) * time.Second
+	}
+	if rs.MinStopSeconds != nil {
+		r.MinStop = time.Duration(*rs.MinStopSeconds) * time.Second
+	}
+	return r
+}
+
+// validate return pesan error ("" = valid)
+func (req *RulesRequest) validate() string {
+	if req.Detection != nil {
+		d := strings.ToUpper(*req.Detection)
+		if d != DetectionIgnition && d != DetectionMovement {
+			return "detection harus IGNITION atau MOVEMENT"
+		}
+		req.Detection = &d
+	}
+	for name, v := range map[string]*int64{
+		"minDurationSeconds": req.MinDurationSeconds,
+		"idleTimeoutSeconds": req.IdleTimeoutSeconds,
+		"maxGapSeconds":      req.MaxGapSeconds,
+		"minStopSeconds":     req.MinStopSeconds,
+	} {
+		if v != nil && *v < 0 {
+			return name + " tidak boleh negatif"
+		}
+	}
+	if req.MinDistanceKm != nil && *req.MinDistanceKm < 0 {
+		return "minDistanceKm tidak boleh negatif"
+	}
+	if req.MovingSpeedKph != nil && *req.MovingSpeedKph <= 0 {
+		return "movingSpeedKph harus lebih dari 0"
+	}
+	if req.IdleTimeoutSeconds != nil && *req.IdleTimeoutSeconds == 0 {
+		return "idleTimeoutSeconds harus lebih dari 0"
+	}
+	if req.MaxGapSeconds != nil && *req.MaxGapSeconds == 0 {
+		return "maxGapSeconds harus lebih dari 0"
+	}
+	return ""
+}
+
+// ruleSets rule set organisasi & override kendaraan (nil bila belum diatur)
+func ruleSets(db *gorm.DB, orgID int64, vehicleID *int64) (org, veh *RuleSet, err error) {
+	query := db.Where("organization_id = ? AND vehicle_id IS NULL", orgID)
+	if vehicleID != nil {
+		query = db.Where("(organization_id = ? AND vehicle_id IS NULL) OR vehicle_id = ?", orgID, *vehicleID)
+	}
+	var rows []RuleSet
+	if err := query.Find(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+	for i := range rows {
+		if rows[i].VehicleID == nil {
+			org = &rows[i]
+		} else {
+			veh = &rows[i]
+		}
+	}
+	return org, veh, nil
+}
+
+// vehicleOrg organisasi pemilik kendaraan
+func vehicleOrg(db *gorm.DB, vehicleID int64) (int64, error) {
+	var orgIDs []int64
+	if err := db.Table("vehicles").Where("id = ?", vehicleID).Limit(1).Pluck("organization_id", &orgIDs).Error; err != nil {
+		return 0, err
+	}
+	if len(orgIDs) == 0 {
+		return 0, errVehicleNotFound
+	}
+	return orgIDs[0], nil
+}
+
+// ResolveRules aturan efektif satu kendaraan: defaults <- organisasi <- override kendaraan
+func ResolveRules(db *gorm.DB, defaults Rules, vehicleID int64) (Rules, error) {
+	orgID, err := vehicleOrg(db, vehicleID)
+	if err != nil {
+		return defaults, err
+	}
+	org, veh, err := ruleSets(db, orgID, &vehicleID)
+	if err != nil {
+		return defaults, err
+	}
+	return defaults.apply(org).apply(veh), nil
+}
+
+// ========= HANDLER =========
+
+// orgScope organisasi yang boleh diakses user: org user = organisasinya sendiri,
+// SUPER_ADMIN lewat query organizationId
+func orgScope(c *gin.Context, cu auth.CurrentUser) (int64, bool) {
+	if !cu.IsSuperAdmin() {
+		if cu.OrganizationID == nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "no_org_access"})
+			return 0, false
+		}
+		return *cu.OrganizationID, true
+	}
+	orgID, err := strconv.ParseInt(c.Query("organizationId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "organizationId wajib diisi untuk SUPER_ADMIN"})
+		return 0, false
+	}
+	return orgID, true
+}
+
+// vehicleScope kendaraan dari path + organisasinya, ditolak bila bukan milik organisasi user
+func (h *Handler) vehicleScope(c *gin.Context, cu auth.CurrentUser) (vehicleID, orgID int64, ok bool) {
+	vehicleID, ok = parseVehicleID(c)
+	if !ok {
+		return 0, 0, false
+	}
+	orgID, err := vehicleOrg(h.DB, vehicleID)
+	if errors.Is(err, errVehicleNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": err.Error()})
+		return 0, 0, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return 0, 0, false
+	}
+	if !cu.IsSuperAdmin() && (cu.OrganizationID == nil || *cu.OrganizationID != orgID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return 0, 0, false
+	}
+	return vehicleID, orgID, true
+}
+
+// canEditRules ORG ADMIN organisasinya sendiri atau SUPER_ADMIN
+func canEditRules(c *gin.Context, cu auth.CurrentUser) bool {
+	if cu.IsSuperAdmin() || cu.IsOrgAdmin() {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "message": "hanya ORG ADMIN yang boleh mengubah aturan trip"})
+	return false
+}
+
+// GetOrgRules GET /trip-rules
+func (h *Handler) GetOrgRules(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	orgID, ok := orgScope(c, cu)
+	if !ok {
+		return
+	}
+
+	org, _, err := ruleSets(h.DB, orgID, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"organizationId": orgID,
+		"rules":          org,
+		"effective":      DefaultRules().apply(org).View(),
+		"defaults":       DefaultRules().View(),
+	})
+}
+
+// UpdateOrgRules PUT /trip-rules
+func (h *Handler) UpdateOrgRules(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if !canEditRules(c, cu) {
+		return
+	}
+	orgID, ok := orgScope(c, cu)
+	if !ok {
+		return
+	}
+	h.saveRules(c, cu, orgID, nil)
+}
+
+// GetVehicleRules GET /vehicles/:id/trip-rules
+func (h *Handler) GetVehicleRules(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	vehicleID, orgID, ok := h.vehicleScope(c, cu)
+	if !ok {
+		return
+	}
+
+	org, veh, err := ruleSets(h.DB, orgID, &vehicleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"organizationId": orgID,
+		"vehicleId":      vehicleID,
+		"rules":          veh,
+		"organization":   org,
+		"effective":      DefaultRules().apply(org).apply(veh).View(),
+	})
+}
+
+// UpdateVehicleRules PUT /vehicles/:id/trip-rules
+func (h *Handler) UpdateVehicleRules(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if !canEditRules(c, cu) {
+		return
+	}
+	vehicleID, orgID, ok := h.vehicleScope(c, cu)
+	if !ok {
+		return
+	}
+	h.saveRules(c, cu, orgID, &vehicleID)
+}
+
+// DeleteVehicleRules DELETE /vehicles/:id/trip-rules (kendaraan kembali ikut aturan organisasi)
+func (h *Handler) DeleteVehicleRules(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if !canEditRules(c, cu) {
+		return
+	}
+	vehicleID, _, ok := h.vehicleScope(c, cu)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.Where("vehicle_id = ?", vehicleID).Delete(&RuleSet{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// saveRules ganti seluruh isi rule set organisasi / kendaraan dengan body request
+func (h *Handler) saveRules(c *gin.Context, cu auth.CurrentUser, orgID int64, vehicleID *int64) {
+	var req RulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "body bukan JSON valid"})
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": msg})
+		return
+	}
+
+	var saved RuleSet
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("organization_id = ? AND vehicle_id IS NULL", orgID)
+		if vehicleID != nil {
+			query = tx.Where("vehicle_id = ?", *vehicleID)
+		}
+		if err := query.Limit(1).Find(&saved).Error; err != nil {
+			return err
+		}
+
+		userID := cu.ID
+		saved.OrganizationID = orgID
+		saved.VehicleID = vehicleID
+		saved.Detection = req.Detection
+		saved.MinDurationSeconds = req.MinDurationSeconds
+		saved.MinDistanceKm = req.MinDistanceKm
+		saved.IdleTimeoutSeconds = req.IdleTimeoutSeconds
+		saved.MovingSpeedKph = req.MovingSpeedKph
+		saved.MaxGapSeconds = req.MaxGapSeconds
+		saved.MinStopSeconds = req.MinStopSeconds
+		saved.UpdatedBy = &userID
+		saved.UpdatedAt = time.Now().UTC()
+		return tx.Save(&saved).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+
+	effective := DefaultRules().apply(&saved)
+	if vehicleID != nil {
+		effective, err = ResolveRules(h.DB, DefaultRules(), *vehicleID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": saved, "effective": effective.View()})
+}
@@ -0,0 +1,225 @@
+package trip
+
+import (
+	"math"
+	"time"
+
+	"github.com/username/fms-api/internal/geocode"
+)
+
+// Cara deteksi trip
+const (
+	DetectionIgnition = "IGNITION" // buka/tutup dari ignition on/off, fix tanpa ignition jatuh ke pergerakan
+	DetectionMovement = "MOVEMENT" // kecepatan + idle timeout saja
+)
+
+// Status trip di trips.metadata.status
+const (
+	StatusOpen   = "OPEN"   // masih berjalan, end_ts = fix aktif terakhir
+	StatusClosed = "CLOSED" // sudah ditutup builder
+)
+
+// Rules aturan segmentasi trip
+type Rules struct {
+	Detection      string        // IGNITION (default) atau MOVEMENT
+	MinDuration    time.Duration // trip lebih singkat dari ini dibuang (default 1 menit)
+	MinDistanceKm  float64       // trip lebih pendek dari ini dibuang (default 0.2 km)
+	IdleTimeout    time.Duration // deteksi pergerakan: diam selama ini menutup trip (default 5 menit)
+	MovingSpeedKph float64       // kecepatan minimal dianggap bergerak (default 5)
+	MaxGap         time.Duration // jeda tanpa fix lebih dari ini menutup trip (default 15 menit)
+	MinStop        time.Duration // diam lebih singkat dari ini tidak dicatat sebagai stop (default 2 menit)
+}
+
+func DefaultRules() Rules {
+	return Rules{
+		Detection:      DetectionIgnition,
+		MinDuration:    time.Minute,
+		MinDistanceKm:  0.2,
+		IdleTimeout:    5 * time.Minute,
+		MovingSpeedKph: 5,
+		MaxGap:         15 * time.Minute,
+		MinStop:        2 * time.Minute,
+	}
+}
+
+// Point satu fix GOOD dari position_log
+type Point struct {
+	TS         time.Time `gorm:"column:ts"`
+	Lat        float64   `gorm:"column:lat"`
+	Lon        float64   `gorm:"column:lon"`
+	SpeedKph   *float64  `gorm:"column:speed_kph"`
+	IgnitionOn *bool     `gorm:"column:ignition_on"`
+}
+
+// Segment trip yang sedang dibangun. Disimpan sebagai JSON di trip_builder_states.open
+// selama trip belum ditutup.
+type Segment struct {
+	TripID      *int64    `json:"tripId,omitempty"` // row trips bila sudah ditulis
+	Detection   string    `json:"detection"`
+	StartTS     time.Time `json:"startTs"`
+	StartLat    float64   `json:"startLat"`
+	StartLon    float64   `json:"startLon"`
+	EndTS       time.Time `json:"endTs"` // fix aktif terakhir
+	EndLat      float64   `json:"endLat"`
+	EndLon      float64   `json:"endLon"`
+	DistanceKm  float64   `json:"distanceKm"`  // sampai fix aktif terakhir
+	PendingKm   float64   `json:"pendingKm"`   // sesudah fix aktif terakhir, ikut dihitung bila trip lanjut
+	MaxSpeedKph float64   `json:"maxSpeedKph"` // dari speed device, atau tersirat dari jarak/waktu
+	Points      int       `json:"points"`
+}
+
+func (s *Segment) Duration() time.Duration {
+	return s.EndTS.Sub(s.StartTS)
+}
+
+// qualifies trip memenuhi durasi & jarak minimal
+func (s *Segment) qualifies(r Rules) bool {
+	return s.Duration() >= r.MinDuration && s.DistanceKm >= r.MinDistanceKm
+}
+
+func (s *Segment) extend(p Point, speed float64) {
+	s.EndTS, s.EndLat, s.EndLon = p.TS, p.Lat, p.Lon
+	s.MaxSpeedKph = math.Max(s.MaxSpeedKph, speed)
+	s.Points++
+}
+
+// stop selesai bila kendaraan bergeser lebih dari ini dari lokasi awal stop
+const stopRadiusKm = 0.1
+
+// StopSegment periode kendaraan diam di satu lokasi dengan status ignition yang sama
+// (ignition on = idle). Disimpan sebagai JSON di trip_builder_states.stop selama masih berlangsung.
+type StopSegment struct {
+	StopID     *int64    `json:"stopId,omitempty"` // row stops bila sudah ditulis
+	StartTS    time.Time `json:"startTs"`
+	EndTS      time.Time `json:"endTs"`
+	Lat        float64   `json:"lat"`
+	Lon        float64   `json:"lon"`
+	IgnitionOn *bool     `json:"ignitionOn,omitempty"`
+}
+
+func (s *StopSegment) Duration() time.Duration {
+	return s.EndTS.Sub(s.StartTS)
+}
+
+// segmenter state machine segmentasi per kendaraan. Fix diberikan berurutan ts; trip yang
+// ditutup dan memenuhi aturan dikumpulkan di closed, trip yang sudah ditulis tapi ternyata
+// tidak memenuhi aturan di discarded. Stop dideteksi terpisah dari trip (idle bisa terjadi di
+// tengah trip) dan yang selesai dikumpulkan di stops.
+type segmenter struct {
+	rules     Rules
+	prev      *Point
+	open      *Segment
+	closed    []Segment
+	discarded []int64
+	stop      *StopSegment
+	stops     []StopSegment
+}
+
+// add proses fix berikutnya. Fix yang tidak lebih baru dari fix sebelumnya dilewati.
+func (s *segmenter) add(p Point) {
+	if s.prev != nil && !p.TS.After(s.prev.TS) {
+		return
+	}
+	if s.open != nil && s.prev != nil && p.TS.Sub(s.prev.TS) > s.rules.MaxGap {
+		s.close()
+	}
+
+	var km, implied float64
+	if s.prev != nil {
+		km = geocode.HaversineKm(s.prev.Lat, s.prev.Lon, p.Lat, p.Lon)
+		implied = km / p.TS.Sub(s.prev.TS).Hours()
+	}
+	speed := implied
+	if p.SpeedKph != nil {
+		speed = *p.SpeedKph
+	}
+
+	detection := DetectionMovement
+	active := speed >= s.rules.MovingSpeedKph
+	if s.rules.Detection != DetectionMovement && p.IgnitionOn != nil {
+		detection = DetectionIgnition
+		active = *p.IgnitionOn
+	}
+
+	switch {
+	case s.open != nil && active:
+		s.open.DistanceKm += s.open.PendingKm + km
+		s.open.PendingKm = 0
+		s.open.extend(p, speed)
+
+	case s.open != nil && detection == DetectionIgnition:
+		// ignition off: kendaraan berhenti di fix ini
+		s.open.DistanceKm += s.open.PendingKm + km
+		s.open.PendingKm = 0
+		s.open.extend(p, speed)
+		s.close()
+
+	case s.open != nil:
+		s.open.PendingKm += km
+		if p.TS.Sub(s.open.EndTS) >= s.rules.IdleTimeout {
+			s.close()
+		}
+
+	case active:
+		s.open = &Segment{Detection: detection, StartTS: p.TS, StartLat: p.Lat, StartLon: p.Lon}
+		// deteksi pergerakan: kendaraan mulai bergerak dari fix diam sebelumnya
+		if detection == DetectionMovement && s.prev != nil && p.TS.Sub(s.prev.TS) <= s.rules.MaxGap {
+			s.open.StartTS, s.open.StartLat, s.open.StartLon = s.prev.TS, s.prev.Lat, s.prev.Lon
+			s.open.DistanceKm = km
+		}
+		s.open.extend(p, speed)
+	}
+
+	s.trackStop(p, speed)
+	s.prev = &p
+}
+
+// trackStop lanjutkan stop yang sedang berlangsung atau mulai stop baru. Fix yang menutup stop
+// tapi masih di lokasi stop (mis. ignition berubah, atau fix pertama sesudah device tidur)
+// dihitung sebagai akhir stop.
+func (s *segmenter) trackStop(p Point, speed float64) {
+	stationary := speed < s.rules.MovingSpeedKph
+	if s.stop != nil {
+		near := geocode.HaversineKm(s.stop.Lat, s.stop.Lon, p.Lat, p.Lon) <= stopRadiusKm
+		if stationary && near && sameIgnition(s.stop.IgnitionOn, p.IgnitionOn) {
+			s.stop.EndTS = p.TS
+			return
+		}
+		if near {
+			s.stop.EndTS = p.TS
+		}
+		if s.stop.Duration() >= s.rules.MinStop {
+			s.stops = append(s.stops, *s.stop)
+		}
+		s.stop = nil
+	}
+	if stationary {
+		s.stop = &StopSegment{StartTS: p.TS, EndTS: p.TS, Lat: p.Lat, Lon: p.Lon, IgnitionOn: p.IgnitionOn}
+	}
+}
+
+func sameIgnition(a, b *bool) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// closeSilent tutup trip bila kendaraan tidak mengirim fix lebih dari MaxGap per now
+func (s *segmenter) closeSilent(now time.Time) {
+	if s.open != nil && s.prev != nil && now.Sub(s.prev.TS) > s.rules.MaxGap {
+		s.close()
+	}
+}
+
+func (s *segmenter) close() {
+	if s.open == nil {
+		return
+	}
+	if s.open.qualifies(s.rules) {
+		s.closed = append(s.closed, *s.open)
+	} else if s.open.TripID != nil {
+		s.discarded = append(s.discarded, *s.open.TripID)
+	}
+	s.open = nil
+}
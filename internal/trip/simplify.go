@@ -0,0 +1,112 @@
+package trip
+
+import (
+	"math"
+	"strings"
+)
+
+// simplifyIndices Douglas-Peucker: index titik yang dipertahankan supaya rute tidak menyimpang
+// lebih dari toleranceM meter. Titik pertama & terakhir selalu ikut. coords berisi [lat, lon].
+func simplifyIndices(coords [][2]float64, toleranceM float64) []int {
+	n := len(coords)
+	if n <= 2 || toleranceM <= 0 {
+		return allIndices(n)
+	}
+
+	// proyeksi equirectangular lokal ke meter, cukup akurat untuk satu rute
+	const metersPerDeg = 111320.0
+	cosLat := math.Cos(coords[0][0] * math.Pi / 180)
+	xy := make([][2]float64, n)
+	for i, c := range coords {
+		xy[i] = [2]float64{c[1] * metersPerDeg * cosLat, c[0] * metersPerDeg}
+	}
+
+	keep := make([]bool, n)
+	keep[0], keep[n-1] = true, true
+	stack := [][2]int{{0, n - 1}}
+	for len(stack) > 0 {
+		seg := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		first, last := seg[0], seg[1]
+
+		maxDist, index := 0.0, -1
+		for i := first + 1; i < last; i++ {
+			if d := segmentDistance(xy[i], xy[first], xy[last]); d > maxDist {
+				maxDist, index = d, i
+			}
+		}
+		if index >= 0 && maxDist > toleranceM {
+			keep[index] = true
+			stack = append(stack, [2]int{first, index}, [2]int{index, last})
+		}
+	}
+
+	out := make([]int, 0, n)
+	for i, k := range keep {
+		if k {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// segmentDistance jarak titik p ke ruas a-b (koordinat meter)
+func segmentDistance(p, a, b [2]float64) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p[0]-a[0], p[1]-a[1])
+	}
+	t := ((p[0]-a[0])*dx + (p[1]-a[1])*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p[0]-(a[0]+t*dx), p[1]-(a[1]+t*dy))
+}
+
+// sampleIndices ambil maksimal max index dari idx dengan jarak rata, titik pertama & terakhir selalu ikut
+func sampleIndices(idx []int, max int) []int {
+	if max <= 0 || len(idx) <= max {
+		return idx
+	}
+	if max == 1 {
+		return idx[:1]
+	}
+	out := make([]int, max)
+	step := float64(len(idx)-1) / float64(max-1)
+	for i := range out {
+		out[i] = idx[int(math.Round(float64(i)*step))]
+	}
+	return out
+}
+
+func allIndices(n int) []int {
+	out := make([]int, n)
+	for i := range out {
+		out[i] = i
+	}
+	return out
+}
+
+// EncodePolyline encoded polyline format Google (presisi 5 desimal). coords berisi [lat, lon].
+func EncodePolyline(coords [][2]float64) string {
+	var sb strings.Builder
+	var prevLat, prevLon int64
+	for _, c := range coords {
+		lat := int64(math.Round(c[0] * 1e5))
+		lon := int64(math.Round(c[1] * 1e5))
+		encodePolylineValue(&sb, lat-prevLat)
+		encodePolylineValue(&sb, lon-prevLon)
+		prevLat, prevLon = lat, lon
+	}
+	return sb.String()
+}
+
+func encodePolylineValue(sb *strings.Builder, v int64) {
+	u := uint64(v) << 1
+	if v < 0 {
+		u = ^u
+	}
+	for u >= 0x20 {
+		sb.WriteByte(byte((0x20 | (u & 0x1f)) + 63))
+		u >>= 5
+	}
+	sb.WriteByte(byte(u + 63))
+}
@@ -0,0 +1,104 @@
+package trip
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/pagination"
+)
+
+// maxRange rentang query maksimal dari env MAX_RANGE_DAYS (default 7 hari)
+func maxRange() time.Duration {
+	maxDays := 7
+	if v := os.Getenv("MAX_RANGE_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			maxDays = n
+		}
+	}
+	return time.Duration(maxDays) * 24 * time.Hour
+}
+
+// listVehicleStops GET /vehicles/:id/stops?from=&to=&ignition=
+// Stop yang beririsan dengan rentang, urut terbaru dulu. Tanpa from/to = 1 hari terakhir;
+// rentang maksimal MAX_RANGE_DAYS seperti daftar trip. ignition=true hanya idle (mesin hidup),
+// ignition=false hanya parkir.
+func (h *Handler) listVehicleStops(c *gin.Context) {
+	cu, ok := auth.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	vehicleID, _, ok := h.vehicleScope(c, cu)
+	if !ok {
+		return
+	}
+	p := pagination.ParsePagination(c)
+	if c.IsAborted() {
+		return
+	}
+
+	var fromTime, toTime time.Time
+	for _, q := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &fromTime}, {"to", &toTime}} {
+		if v := c.Query(q.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "invalid " + q.name + " parameter, must be RFC3339"})
+				return
+			}
+			*q.dst = t
+		}
+	}
+	switch {
+	case fromTime.IsZero() && toTime.IsZero():
+		toTime = time.Now().UTC()
+		fromTime = toTime.Add(-24 * time.Hour)
+	case fromTime.IsZero():
+		fromTime = toTime.Add(-24 * time.Hour)
+	case toTime.IsZero():
+		toTime = fromTime.Add(24 * time.Hour)
+	}
+	if toTime.Before(fromTime) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "to must be after from"})
+		return
+	}
+	if toTime.Sub(fromTime) > maxRange() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "requested range exceeds max range"})
+		return
+	}
+
+	query := h.DB.Model(&Stop{}).Where("vehicle_id = ? AND start_ts <= ? AND end_ts >= ?", vehicleID, toTime, fromTime)
+	switch c.Query("ignition") {
+	case "":
+	case "true":
+		query = query.Where("ignition_on = ?", true)
+	case "false":
+		query = query.Where("ignition_on = ?", false)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "message": "ignition harus true atau false"})
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+	var stops []Stop
+	if err := query.Order("start_ts DESC").Limit(p.Limit).Offset(p.Offset).Find(&stops).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       stops,
+		"pagination": gin.H{"total": total, "limit": p.Limit, "page": p.Page, "max_limit": p.MaxLimit},
+	})
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/username/fms-api/internal/auth"
 	"github.com/username/fms-api/internal/device"
+	"github.com/username/fms-api/internal/geocode"
 	"github.com/username/fms-api/internal/organization"
 	"github.com/username/fms-api/internal/pagination"
 )
@@ -62,7 +63,8 @@ func requireAdmin(c *gin.Context) (*CurrentUser, bool) {
 
 // Handler menampung dependency untuk handler kendaraan
 type Handler struct {
-	DB *gorm.DB
+	DB       *gorm.DB
+	Geocoder geocode.Geocoder // nil = posisi terkini tanpa alamat
 }
 
 // NewHandler membuat handler baru
@@ -392,6 +394,7 @@ func (h *Handler) getVehicleByID(c *gin.Context) {
 				"lon":       rec.Lon,
 				"ts":        rec.TS.Format(time.RFC3339),
 				"updatedAt": rec.UpdatedAt.Format(time.RFC3339),
+				"address":   geocode.Lookup(h.Geocoder, rec.Lat, rec.Lon),
 			},
 		}
 		c.JSON(http.StatusOK, resp)
@@ -567,6 +570,7 @@ func (h *Handler) getCurrentPosition(c *gin.Context) {
 		IgnitionOn: rec.IgnitionOn,
 		OdometerKm: rec.OdometerKm,
 		UpdatedAt:  rec.UpdatedAt.Format(time.RFC3339),
+		Address:    geocode.Lookup(h.Geocoder, rec.Lat, rec.Lon),
 	}
 
 	c.JSON(http.StatusOK, resp)
@@ -1,6 +1,10 @@
 package vehicle
 
-import "time"
+import (
+	"time"
+
+	"github.com/username/fms-api/internal/geocode"
+)
 
 // Constants for odometer sources
 const (
@@ -64,7 +68,7 @@ type VehicleUpdateRequest struct {
 
 // Model GORM untuk tabel vehicle_current_position
 type VehicleCurrentPositionDB struct {
-	VehicleID  int64     `gorm:"column:vehicle_id"`
+	VehicleID  int64     `gorm:"column:vehicle_id;primaryKey;autoIncrement:false"`
 	DeviceID   *int64    `gorm:"column:device_id"`
 	TS         time.Time `gorm:"column:ts"`
 	Lat        float64   `gorm:"column:lat"`
@@ -92,4 +96,6 @@ type VehicleCurrentPosition struct {
 	IgnitionOn *bool    `json:"ignitionOn,omitempty"`
 	OdometerKm *float64 `json:"odometerKm,omitempty"`
 	UpdatedAt  string   `json:"updatedAt"`
+
+	Address *geocode.Address `json:"address,omitempty"` // reverse geocoding lat/lon, kosong bila tidak ada tempat terdekat
 }
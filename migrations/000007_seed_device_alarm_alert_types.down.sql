@@ -0,0 +1,5 @@
+-- 000007_seed_device_alarm_alert_types.down.sql
+
+DELETE FROM alert_types
+WHERE code IN ('SOS', 'POWER_CUT')
+  AND NOT EXISTS (SELECT 1 FROM alerts a WHERE a.alert_type_id = alert_types.id);
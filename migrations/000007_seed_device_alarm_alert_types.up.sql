@@ -0,0 +1,7 @@
+-- 000007_seed_device_alarm_alert_types.up.sql
+
+-- Alert yang dibangkitkan langsung dari paket alarm device (GT06 dll)
+INSERT INTO alert_types (code, name, default_severity, description) VALUES
+    ('SOS',       'SOS',        'CRITICAL', 'Tombol SOS ditekan pada device'),
+    ('POWER_CUT', 'Power Cut',  'HIGH',     'Catu daya utama device terputus')
+ON CONFLICT (code) DO NOTHING;
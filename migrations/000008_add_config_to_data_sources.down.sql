@@ -0,0 +1,4 @@
+-- 000008_add_config_to_data_sources.down.sql
+
+ALTER TABLE data_sources
+DROP COLUMN IF EXISTS config;
@@ -0,0 +1,5 @@
+-- 000008_add_config_to_data_sources.up.sql
+
+-- Konfigurasi per data source (broker MQTT, field mapping, URL API vendor, dll)
+ALTER TABLE data_sources
+ADD COLUMN IF NOT EXISTS config JSONB;
@@ -0,0 +1,3 @@
+-- 000009_create_connector_states.down.sql
+
+DROP TABLE IF EXISTS connector_states;
@@ -0,0 +1,11 @@
+-- 000009_create_connector_states.up.sql
+
+-- Cursor / high-watermark per data source tipe API (pull connector)
+CREATE TABLE IF NOT EXISTS connector_states (
+    data_source_id   BIGINT PRIMARY KEY REFERENCES data_sources(id),
+    cursor           TEXT,
+    last_polled_at   TIMESTAMPTZ,
+    last_success_at  TIMESTAMPTZ,
+    last_error       TEXT,
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+-- 000010_create_position_quarantine.down.sql
+
+DROP TABLE IF EXISTS position_quarantine;
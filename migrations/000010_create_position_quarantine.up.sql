@@ -0,0 +1,21 @@
+-- 000010_create_position_quarantine.up.sql
+
+-- Fix yang ditahan (tidak masuk position_log), misal ts jauh di masa depan karena jam device salah
+CREATE TABLE IF NOT EXISTS position_quarantine (
+    id           BIGSERIAL PRIMARY KEY,
+    vehicle_id   BIGINT NOT NULL REFERENCES vehicles(id),
+    device_id    BIGINT NOT NULL REFERENCES devices(id),
+    ts           TIMESTAMPTZ NOT NULL,
+    lat          DOUBLE PRECISION NOT NULL,
+    lon          DOUBLE PRECISION NOT NULL,
+    speed_kph    NUMERIC(6,2),
+    heading_deg  NUMERIC(6,2),
+    altitude_m   NUMERIC(8,2),
+    ignition_on  BOOLEAN,
+    odometer_km  NUMERIC(10,2),
+    raw_payload  JSONB,
+    reason       TEXT NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_position_quarantine_device_ts ON position_quarantine (device_id, ts);
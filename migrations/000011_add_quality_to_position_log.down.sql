@@ -0,0 +1,4 @@
+-- 000011_add_quality_to_position_log.down.sql
+
+DROP INDEX IF EXISTS idx_position_log_vehicle_ts_good;
+ALTER TABLE position_log DROP COLUMN IF EXISTS quality;
@@ -0,0 +1,6 @@
+-- 000011_add_quality_to_position_log.up.sql
+
+-- Marker hasil filter kualitas GPS. Hanya GOOD yang dipakai posisi terkini, trip & odometer.
+ALTER TABLE position_log ADD COLUMN IF NOT EXISTS quality TEXT NOT NULL DEFAULT 'GOOD';
+
+CREATE INDEX IF NOT EXISTS idx_position_log_vehicle_ts_good ON position_log (vehicle_id, ts) WHERE quality = 'GOOD';
@@ -0,0 +1,13 @@
+-- 000012_add_presence_to_devices.down.sql
+
+DELETE FROM alert_types
+WHERE code = 'DEVICE_OFFLINE'
+  AND NOT EXISTS (SELECT 1 FROM alerts a WHERE a.alert_type_id = alert_types.id);
+
+DROP INDEX IF EXISTS idx_devices_online_last_seen;
+
+ALTER TABLE devices
+DROP COLUMN IF EXISTS online,
+DROP COLUMN IF EXISTS last_source,
+DROP COLUMN IF EXISTS last_fix_at,
+DROP COLUMN IF EXISTS last_seen_at;
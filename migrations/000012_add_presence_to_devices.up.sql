@@ -0,0 +1,14 @@
+-- 000012_add_presence_to_devices.up.sql
+
+-- Kontak terakhir device, diisi ingestion (fix, login, heartbeat)
+ALTER TABLE devices
+ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ,
+ADD COLUMN IF NOT EXISTS last_fix_at TIMESTAMPTZ,
+ADD COLUMN IF NOT EXISTS last_source TEXT,
+ADD COLUMN IF NOT EXISTS online BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_devices_online_last_seen ON devices (online, last_seen_at);
+
+INSERT INTO alert_types (code, name, default_severity, description) VALUES
+    ('DEVICE_OFFLINE', 'Device Offline', 'MEDIUM', 'Device tidak mengirim data melewati jendela offline')
+ON CONFLICT (code) DO NOTHING;
@@ -0,0 +1,4 @@
+-- 000013_create_device_commands.down.sql
+
+DROP TABLE IF EXISTS device_command_audit;
+DROP TABLE IF EXISTS device_commands;
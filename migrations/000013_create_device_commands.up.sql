@@ -0,0 +1,39 @@
+-- 000013_create_device_commands.up.sql
+
+-- Antrian command downlink ke device (TCP listener / SMS)
+CREATE TABLE IF NOT EXISTS device_commands (
+    id            BIGSERIAL PRIMARY KEY,
+    device_id     BIGINT NOT NULL REFERENCES devices(id),
+    vehicle_id    BIGINT REFERENCES vehicles(id),
+    type          TEXT NOT NULL,
+    params        JSONB,
+    text          TEXT NOT NULL,
+    channel       TEXT NOT NULL DEFAULT 'AUTO',
+    status        TEXT NOT NULL DEFAULT 'QUEUED',
+    response      TEXT,
+    error         TEXT,
+    requested_by  BIGINT REFERENCES users(id),
+    attempts      INT NOT NULL DEFAULT 0,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    sent_at       TIMESTAMPTZ,
+    acked_at      TIMESTAMPTZ,
+    expires_at    TIMESTAMPTZ NOT NULL,
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_commands_device_status ON device_commands (device_id, status);
+CREATE INDEX IF NOT EXISTS idx_device_commands_expires ON device_commands (expires_at) WHERE status IN ('QUEUED', 'SENT');
+
+-- Audit trail: setiap perubahan status + permintaan yang ditolak (command_id NULL)
+CREATE TABLE IF NOT EXISTS device_command_audit (
+    id          BIGSERIAL PRIMARY KEY,
+    command_id  BIGINT REFERENCES device_commands(id),
+    device_id   BIGINT NOT NULL REFERENCES devices(id),
+    user_id     BIGINT REFERENCES users(id),
+    action      TEXT NOT NULL,
+    detail      JSONB,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_command_audit_command ON device_command_audit (command_id);
+CREATE INDEX IF NOT EXISTS idx_device_command_audit_device ON device_command_audit (device_id, created_at);
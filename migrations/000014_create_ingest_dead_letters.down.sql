@@ -0,0 +1,3 @@
+-- 000014_create_ingest_dead_letters.down.sql
+
+DROP TABLE IF EXISTS ingest_dead_letters;
@@ -0,0 +1,23 @@
+-- 000014_create_ingest_dead_letters.up.sql
+
+-- Paket yang tidak bisa masuk position_log: dari external id yang belum terdaftar (fix hasil decode
+-- ditahan untuk replay setelah provisioning) atau yang gagal di-decode
+CREATE TABLE IF NOT EXISTS ingest_dead_letters (
+    id                BIGSERIAL PRIMARY KEY,
+    reason            TEXT NOT NULL,
+    protocol          TEXT NOT NULL,
+    data_source_code  TEXT NOT NULL DEFAULT '',
+    external_id       TEXT NOT NULL DEFAULT '',
+    payload           JSONB,
+    fixes             JSONB,
+    error             TEXT,
+    device_id         BIGINT REFERENCES devices(id),
+    received_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    replayed_at       TIMESTAMPTZ,
+    CONSTRAINT ingest_dead_letters_reason_check CHECK (reason IN ('UNKNOWN_DEVICE', 'UNPARSABLE'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_ingest_dead_letters_unknown
+    ON ingest_dead_letters (external_id, protocol) WHERE reason = 'UNKNOWN_DEVICE' AND device_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_ingest_dead_letters_device ON ingest_dead_letters (device_id) WHERE device_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ingest_dead_letters_received ON ingest_dead_letters (received_at);
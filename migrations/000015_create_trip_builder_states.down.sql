@@ -0,0 +1,3 @@
+-- 000015_create_trip_builder_states.down.sql
+
+DROP TABLE IF EXISTS trip_builder_states;
@@ -0,0 +1,12 @@
+-- 000015_create_trip_builder_states.up.sql
+
+-- Cursor trip builder per kendaraan: fix GOOD terakhir yang sudah diproses dan trip yang sedang
+-- dibangun (JSON, NULL = kendaraan tidak sedang trip)
+CREATE TABLE IF NOT EXISTS trip_builder_states (
+    vehicle_id  BIGINT PRIMARY KEY REFERENCES vehicles(id) ON DELETE CASCADE,
+    last_ts     TIMESTAMPTZ,
+    last_lat    DOUBLE PRECISION,
+    last_lon    DOUBLE PRECISION,
+    open        JSONB,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+-- 000016_create_trip_rules.down.sql
+
+DROP TABLE IF EXISTS trip_rules;
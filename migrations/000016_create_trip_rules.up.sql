@@ -0,0 +1,21 @@
+-- 000016_create_trip_rules.up.sql
+
+-- Aturan deteksi trip per organisasi (vehicle_id NULL) dengan override opsional per kendaraan.
+-- Kolom NULL = ikut level di atasnya (kendaraan -> organisasi -> default builder).
+CREATE TABLE IF NOT EXISTS trip_rules (
+    id                    BIGSERIAL PRIMARY KEY,
+    organization_id       BIGINT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    vehicle_id            BIGINT REFERENCES vehicles(id) ON DELETE CASCADE,
+    detection             TEXT,
+    min_duration_seconds  INTEGER,
+    min_distance_km       NUMERIC(10,2),
+    idle_timeout_seconds  INTEGER,
+    moving_speed_kph      NUMERIC(6,2),
+    max_gap_seconds       INTEGER,
+    updated_by            BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    updated_at            TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT trip_rules_detection_check CHECK (detection IN ('IGNITION', 'MOVEMENT'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_trip_rules_org ON trip_rules (organization_id) WHERE vehicle_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_trip_rules_vehicle ON trip_rules (vehicle_id) WHERE vehicle_id IS NOT NULL;
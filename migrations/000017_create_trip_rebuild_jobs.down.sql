@@ -0,0 +1,3 @@
+-- 000017_create_trip_rebuild_jobs.down.sql
+
+DROP TABLE IF EXISTS trip_rebuild_jobs;
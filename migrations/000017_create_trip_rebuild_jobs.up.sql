@@ -0,0 +1,25 @@
+-- 000017_create_trip_rebuild_jobs.up.sql
+
+-- Job hitung ulang trips dari position_log untuk satu kendaraan atau satu organisasi dalam rentang waktu.
+-- Diproses trip rebuilder di background (atau fmsctl rebuild-trips), satu transaksi per kendaraan.
+CREATE TABLE IF NOT EXISTS trip_rebuild_jobs (
+    id               BIGSERIAL PRIMARY KEY,
+    organization_id  BIGINT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    vehicle_id       BIGINT REFERENCES vehicles(id) ON DELETE CASCADE,
+    from_ts          TIMESTAMPTZ NOT NULL,
+    to_ts            TIMESTAMPTZ NOT NULL,
+    status           TEXT NOT NULL DEFAULT 'QUEUED',
+    total_vehicles   INTEGER NOT NULL DEFAULT 0,
+    done_vehicles    INTEGER NOT NULL DEFAULT 0,
+    trips_deleted    INTEGER NOT NULL DEFAULT 0,
+    trips_created    INTEGER NOT NULL DEFAULT 0,
+    error            TEXT,
+    created_by       BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at       TIMESTAMPTZ,
+    finished_at      TIMESTAMPTZ,
+    CONSTRAINT trip_rebuild_jobs_status_check CHECK (status IN ('QUEUED', 'RUNNING', 'DONE', 'FAILED')),
+    CONSTRAINT trip_rebuild_jobs_range_check CHECK (from_ts < to_ts)
+);
+
+CREATE INDEX IF NOT EXISTS idx_trip_rebuild_jobs_status ON trip_rebuild_jobs (status, id);
@@ -0,0 +1,5 @@
+-- 000018_create_stops.down.sql
+
+ALTER TABLE trip_rules DROP COLUMN IF EXISTS min_stop_seconds;
+ALTER TABLE trip_builder_states DROP COLUMN IF EXISTS stop;
+DROP TABLE IF EXISTS stops;
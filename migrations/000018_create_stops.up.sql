@@ -0,0 +1,24 @@
+-- 000018_create_stops.up.sql
+
+-- Stop & idle kendaraan hasil deteksi trip builder: periode diam di satu lokasi dengan status
+-- ignition yang sama. ignition_on TRUE = idle (mesin hidup), FALSE = parkir, NULL = tanpa data ignition.
+CREATE TABLE IF NOT EXISTS stops (
+    id                BIGSERIAL PRIMARY KEY,
+    vehicle_id        BIGINT NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    start_ts          TIMESTAMPTZ NOT NULL,
+    end_ts            TIMESTAMPTZ NOT NULL,
+    lat               DOUBLE PRECISION NOT NULL,
+    lon               DOUBLE PRECISION NOT NULL,
+    duration_seconds  BIGINT NOT NULL DEFAULT 0,
+    ignition_on       BOOLEAN,
+    ongoing           BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_stops_vehicle_start ON stops (vehicle_id, start_ts DESC);
+
+-- stop yang sedang berlangsung per kendaraan (JSON, NULL = kendaraan sedang bergerak)
+ALTER TABLE trip_builder_states ADD COLUMN IF NOT EXISTS stop JSONB;
+
+-- durasi minimal stop, NULL = ikut level di atasnya
+ALTER TABLE trip_rules ADD COLUMN IF NOT EXISTS min_stop_seconds INTEGER;
@@ -0,0 +1,13 @@
+-- 000019_add_trip_classification.down.sql
+
+DROP TABLE IF EXISTS trip_corrections;
+DROP TABLE IF EXISTS trip_classification_rules;
+ALTER TABLE trips
+DROP COLUMN IF EXISTS finalized_by,
+DROP COLUMN IF EXISTS finalized_at,
+DROP COLUMN IF EXISTS classified_at,
+DROP COLUMN IF EXISTS classified_by,
+DROP COLUMN IF EXISTS classification_rule_id,
+DROP COLUMN IF EXISTS classification_source,
+DROP COLUMN IF EXISTS purpose,
+DROP COLUMN IF EXISTS classification;
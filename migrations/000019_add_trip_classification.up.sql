@@ -0,0 +1,52 @@
+-- 000019_add_trip_classification.up.sql
+
+-- Klasifikasi logbook (pajak) per trip: BUSINESS / PRIVATE + tujuan perjalanan.
+-- Trip yang sudah difinalisasi (finalized_at) hanya bisa diubah lewat trip_corrections.
+ALTER TABLE trips
+ADD COLUMN IF NOT EXISTS classification TEXT CHECK (classification IN ('BUSINESS', 'PRIVATE')),
+ADD COLUMN IF NOT EXISTS purpose TEXT,
+ADD COLUMN IF NOT EXISTS classification_source TEXT CHECK (classification_source IN ('MANUAL', 'RULE')),
+ADD COLUMN IF NOT EXISTS classification_rule_id BIGINT,
+ADD COLUMN IF NOT EXISTS classified_by BIGINT REFERENCES users(id),
+ADD COLUMN IF NOT EXISTS classified_at TIMESTAMPTZ,
+ADD COLUMN IF NOT EXISTS finalized_at TIMESTAMPTZ,
+ADD COLUMN IF NOT EXISTS finalized_by BIGINT REFERENCES users(id);
+
+-- Aturan klasifikasi otomatis saat trip ditutup: jendela waktu (hari + jam lokal) dan / atau geofence
+-- lingkaran. Aturan dengan priority terkecil yang cocok dipakai; vehicle_id NULL = semua kendaraan organisasi.
+CREATE TABLE IF NOT EXISTS trip_classification_rules (
+    id                 BIGSERIAL PRIMARY KEY,
+    organization_id    BIGINT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    vehicle_id         BIGINT REFERENCES vehicles(id) ON DELETE CASCADE,
+    name               TEXT NOT NULL,
+    classification     TEXT NOT NULL CHECK (classification IN ('BUSINESS', 'PRIVATE')),
+    purpose            TEXT,
+    priority           INTEGER NOT NULL DEFAULT 100,
+    days_of_week       JSONB,
+    start_time         TEXT,
+    end_time           TEXT,
+    timezone           TEXT,
+    geofence_lat       DOUBLE PRECISION,
+    geofence_lon       DOUBLE PRECISION,
+    geofence_radius_m  DOUBLE PRECISION,
+    geofence_match     TEXT NOT NULL DEFAULT 'ANY' CHECK (geofence_match IN ('START', 'END', 'ANY', 'BOTH')),
+    active             BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by         BIGINT REFERENCES users(id),
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at         TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_trip_classification_rules_org ON trip_classification_rules (organization_id, priority, id);
+
+-- Audit koreksi trip yang sudah difinalisasi: nilai sebelum & sesudah + alasan
+CREATE TABLE IF NOT EXISTS trip_corrections (
+    id          BIGSERIAL PRIMARY KEY,
+    trip_id     BIGINT NOT NULL REFERENCES trips(id) ON DELETE CASCADE,
+    user_id     BIGINT REFERENCES users(id),
+    reason      TEXT NOT NULL,
+    before      JSONB,
+    after       JSONB,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_trip_corrections_trip ON trip_corrections (trip_id, created_at);
@@ -0,0 +1,4 @@
+-- 000020_create_vehicle_daily_stats.down.sql
+
+DROP TABLE IF EXISTS vehicle_daily_stats;
+ALTER TABLE organizations DROP COLUMN IF EXISTS timezone;
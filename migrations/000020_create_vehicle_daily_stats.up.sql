@@ -0,0 +1,21 @@
+-- 000020_create_vehicle_daily_stats.up.sql
+
+-- Zona waktu organisasi (nama IANA), dipakai untuk batas hari rollup harian
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'UTC';
+
+-- Rollup harian per kendaraan, diperbarui trip builder & rebuild. day = tanggal lokal di zona waktu
+-- organisasi; trip yang melewati tengah malam dibagi proporsional terhadap waktu.
+CREATE TABLE IF NOT EXISTS vehicle_daily_stats (
+    vehicle_id       BIGINT NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    day              DATE NOT NULL,
+    timezone         TEXT NOT NULL,
+    distance_km      NUMERIC(10,2) NOT NULL DEFAULT 0,
+    driving_seconds  BIGINT NOT NULL DEFAULT 0,
+    idle_seconds     BIGINT NOT NULL DEFAULT 0,
+    trip_count       INTEGER NOT NULL DEFAULT 0,
+    max_speed_kph    NUMERIC(6,2),
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (vehicle_id, day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_vehicle_daily_stats_day ON vehicle_daily_stats (day);
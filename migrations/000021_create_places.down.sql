@@ -0,0 +1,3 @@
+-- 000021_create_places.down.sql
+
+DROP TABLE IF EXISTS places;
@@ -0,0 +1,21 @@
+-- 000021_create_places.up.sql
+
+-- Dataset tempat untuk reverse geocoding offline (mis. dump GeoNames / batas administrasi),
+-- diisi lewat `fmsctl import-places`. Alamat diambil dari tempat terdekat.
+CREATE TABLE IF NOT EXISTS places (
+    id            BIGSERIAL PRIMARY KEY,
+    source        TEXT NOT NULL,
+    external_id   TEXT NOT NULL,
+    name          TEXT NOT NULL,
+    admin1        TEXT,
+    admin2        TEXT,
+    country_code  TEXT,
+    feature_code  TEXT,
+    population    BIGINT,
+    lat           DOUBLE PRECISION NOT NULL,
+    lon           DOUBLE PRECISION NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (source, external_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_places_lat_lon ON places (lat, lon);
@@ -0,0 +1,3 @@
+-- 000022_add_devices_clock_skew_index.down.sql
+
+DROP INDEX IF EXISTS idx_devices_clock_skew;
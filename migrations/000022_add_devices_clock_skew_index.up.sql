@@ -0,0 +1,7 @@
+-- 000022_add_devices_clock_skew_index.up.sql
+
+-- Daftar device dengan jam meleset (GET /admin/ingest/clock-skew) diurutkan dari |estimasi skew| terbesar.
+-- Estimasi disimpan ClockSkewFilter di devices.metadata.clockSkew.
+CREATE INDEX IF NOT EXISTS idx_devices_clock_skew
+    ON devices ((ABS((metadata->'clockSkew'->>'estimateSeconds')::BIGINT)) DESC)
+    WHERE metadata->'clockSkew' IS NOT NULL;
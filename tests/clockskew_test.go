@@ -0,0 +1,244 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/device"
+	"github.com/username/fms-api/internal/ingest"
+)
+
+func TestClockSkew_CorrectMarkAndList(t *testing.T) {
+	db := setupTestDB(t)
+	tz, _ := seedBoundDevice(t, db, "SKEW-TZ", ingest.ProtocolGT06, "skew-tz", ingest.ProtocolGT06)
+	rtc, _ := seedBoundDevice(t, db, "SKEW-RTC", ingest.ProtocolGT06, "skew-rtc", ingest.ProtocolGT06)
+	ok, _ := seedBoundDevice(t, db, "SKEW-OK", ingest.ProtocolGT06, "skew-ok", ingest.ProtocolGT06)
+	// device yang salah zona waktu dikoreksi, sisanya ikut mode default (MARK)
+	db.Model(&tz).Update("metadata", datatypes.JSONMap{"clockSkewMode": "correct"})
+
+	cfg := ingest.DefaultClockSkewConfig()
+	cfg.MinSamples = 3
+	svc := ingest.NewService(db)
+	svc.ClockSkew = ingest.NewClockSkewFilter(cfg)
+
+	send := func(code, ext string, lag time.Duration, i int) {
+		t.Helper()
+		target, err := svc.ResolveByDataSource(code, ext)
+		if err != nil {
+			t.Fatalf("resolve %s: %v", ext, err)
+		}
+		fix := ingest.Fix{TS: time.Now().Add(lag + time.Duration(i)*time.Second), Lat: -6.2, Lon: 106.8, Raw: map[string]interface{}{"protocol": ingest.ProtocolGT06}}
+		if _, err := svc.Store(target, []ingest.Fix{fix}); err != nil {
+			t.Fatalf("store %s: %v", ext, err)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		send("SKEW-TZ", "skew-tz", -7*time.Hour, i)
+		send("SKEW-RTC", "skew-rtc", -3*time.Hour-17*time.Minute, i)
+		send("SKEW-OK", "skew-ok", -2*time.Second, i)
+	}
+
+	// dua fix pertama dipakai apa adanya, sisanya (estimasi sudah cukup sampel) digeser tepat 7 jam
+	var logs []ingest.PositionLog
+	db.Where("device_id = ?", tz.ID).Order("id").Find(&logs)
+	if len(logs) != 4 {
+		t.Fatalf("expected 4 rows, got %d", len(logs))
+	}
+	deviceTS, _ := time.Parse(time.RFC3339, logs[3].RawPayload["deviceTs"].(string))
+	if shift := logs[3].TS.Sub(deviceTS); shift < 7*time.Hour || shift >= 7*time.Hour+time.Second {
+		t.Fatalf("expected ts corrected by 7h, got %v (%+v)", shift, logs[3])
+	}
+	if logs[0].RawPayload["deviceTs"] != nil || logs[3].Quality != ingest.QualityGood {
+		t.Fatalf("unexpected rows: %+v", logs)
+	}
+
+	var marked, good int64
+	db.Model(&ingest.PositionLog{}).Where("device_id = ? AND quality = ?", rtc.ID, ingest.QualityClockSkew).Count(&marked)
+	db.Model(&ingest.PositionLog{}).Where("device_id = ? AND quality = ?", ok.ID, ingest.QualityGood).Count(&good)
+	if marked != 2 || good != 4 {
+		t.Fatalf("expected 2 CLOCK_SKEW fixes and 4 GOOD, got %d / %d", marked, good)
+	}
+
+	// estimasi tersimpan di metadata tanpa menimpa key lain
+	var stored device.Device
+	db.First(&stored, tz.ID)
+	skew, _ := stored.Metadata["clockSkew"].(map[string]interface{})
+	if stored.Metadata["clockSkewMode"] != "correct" || skew == nil {
+		t.Fatalf("unexpected metadata: %+v", stored.Metadata)
+	}
+	if est, _ := skew["estimateSeconds"].(json.Number).Int64(); est < -7*3600-5 || est > -7*3600+5 {
+		t.Fatalf("expected estimate around -25200, got %v", skew["estimateSeconds"])
+	}
+
+	router := gin.New()
+	cu := auth.CurrentUser{ID: 1, UserType: auth.UserTypeSuperAdmin}
+	ingest.NewHandlerWithService(svc).RegisterAdminRoutes(router.Group("/admin", func(c *gin.Context) { c.Set(auth.ContextUserKey, cu) }))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/ingest/clock-skew", nil))
+	var list struct {
+		Data []ingest.ClockSkewDevice `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if w.Code != http.StatusOK || len(list.Data) != 2 {
+		t.Fatalf("expected 2 skewed devices, got %d: %s", w.Code, w.Body.String())
+	}
+	if list.Data[0].DeviceID != tz.ID || list.Data[0].Mode != ingest.ClockSkewCorrect ||
+		list.Data[1].DeviceID != rtc.ID || list.Data[1].Mode != ingest.ClockSkewMark || list.Data[1].Samples != 4 {
+		t.Fatalf("unexpected list: %+v", list.Data)
+	}
+
+	// paging di database: halaman kedua berisi device dengan skew terbesar berikutnya
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/ingest/clock-skew?limit=1&page=2", nil))
+	var paged struct {
+		Data       []ingest.ClockSkewDevice `json:"data"`
+		Pagination struct {
+			Total int64 `json:"total"`
+		} `json:"pagination"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &paged)
+	if len(paged.Data) != 1 || paged.Data[0].DeviceID != rtc.ID || paged.Pagination.Total != 2 {
+		t.Fatalf("unexpected second page: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/ingest/clock-skew?minSeconds=14400", nil))
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Data) != 1 || list.Data[0].DeviceID != tz.ID {
+		t.Fatalf("expected only the 7h device above 4h, got %+v", list.Data)
+	}
+}
+
+func TestClockSkew_BufferedHistoryIsNotSampled(t *testing.T) {
+	db := setupTestDB(t)
+	dev, v := seedBoundDevice(t, db, "SKEW-BUF", ingest.ProtocolTeltonika, "skew-buf", ingest.ProtocolTeltonika)
+	fresh, fv := seedBoundDevice(t, db, "SKEW-NEW", ingest.ProtocolGT06, "skew-new", ingest.ProtocolGT06)
+
+	cfg := ingest.DefaultClockSkewConfig()
+	cfg.MinSamples = 3
+	svc := ingest.NewService(db)
+	svc.ClockSkew = ingest.NewClockSkewFilter(cfg)
+	target := &ingest.Target{Device: dev, VehicleID: v.ID}
+
+	now := time.Now().UTC()
+	fix := func(ts time.Time) ingest.Fix {
+		return ingest.Fix{TS: ts, Lat: -6.2, Lon: 106.8, Raw: map[string]interface{}{"protocol": ingest.ProtocolTeltonika}}
+	}
+	// device sempat online dengan jam yang benar
+	if _, err := svc.Store(target, []ingest.Fix{fix(now.Add(-time.Second))}); err != nil {
+		t.Fatalf("store live: %v", err)
+	}
+	// reconnect setelah 6 jam tanpa sinyal: isi buffer dikirim satu per satu, lebih lama dari fix terakhir
+	for i := 0; i < 6; i++ {
+		if _, err := svc.Store(target, []ingest.Fix{fix(now.Add(-8*time.Hour + time.Duration(i)*time.Minute))}); err != nil {
+			t.Fatalf("store history: %v", err)
+		}
+	}
+	// riwayat yang ditandai protokol (GT06 re-upload / pull connector) dari device yang baru terlihat
+	for i := 0; i < 6; i++ {
+		h := ingest.Fix{TS: now.Add(-5*time.Hour + time.Duration(i)*time.Minute), Lat: -6.2, Lon: 106.8, History: true,
+			Raw: map[string]interface{}{"protocol": ingest.ProtocolGT06, "realtime": false}}
+		if _, err := svc.Store(&ingest.Target{Device: fresh, VehicleID: fv.ID}, []ingest.Fix{h}); err != nil {
+			t.Fatalf("store flagged history: %v", err)
+		}
+	}
+
+	var marked int64
+	db.Model(&ingest.PositionLog{}).Where("quality = ?", ingest.QualityClockSkew).Count(&marked)
+	if marked != 0 {
+		t.Fatalf("expected no CLOCK_SKEW rows from buffered history, got %d", marked)
+	}
+	for _, id := range []int64{dev.ID, fresh.ID} {
+		var stored device.Device
+		db.First(&stored, id)
+		skew, _ := stored.Metadata["clockSkew"].(map[string]interface{})
+		if skew == nil {
+			continue
+		}
+		if est, _ := skew["estimateSeconds"].(json.Number).Int64(); est < -5 || est > 5 {
+			t.Fatalf("device %d: expected no skew from history, got %v", id, skew)
+		}
+	}
+}
+
+func TestClockSkew_ModeChangeAndThrottledSave(t *testing.T) {
+	db := setupTestDB(t)
+	dev, v := seedBoundDevice(t, db, "SKEW-MODE", "DEVICE", "skew-mode", ingest.ProtocolOsmAnd)
+
+	cfg := ingest.DefaultClockSkewConfig()
+	cfg.MinSamples = 3
+	svc := ingest.NewService(db)
+	svc.ClockSkew = ingest.NewClockSkewFilter(cfg)
+	// Target di-cache seperti selama koneksi TCP: metadata di sini tidak ikut berubah
+	target := &ingest.Target{Device: dev, VehicleID: v.ID}
+
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	send := func(i int) ingest.Fix {
+		t.Helper()
+		received := base.Add(time.Duration(i) * time.Minute)
+		f, err := ingest.ParseOsmAndFix(url.Values{
+			"id": {"skew-mode"}, "lat": {"-6.2"}, "lon": {"106.8"}, "speed": {"10"},
+			"timestamp": {strconv.FormatInt(received.Add(-3*time.Hour).Unix(), 10)},
+		})
+		if err != nil {
+			t.Fatalf("osmand: %v", err)
+		}
+		f.ReceivedAt = &received
+		if _, err := svc.Store(target, []ingest.Fix{f}); err != nil {
+			t.Fatalf("store: %v", err)
+		}
+		return f
+	}
+	storedTotal := func() int64 {
+		var stored device.Device
+		db.First(&stored, dev.ID)
+		skew, _ := stored.Metadata["clockSkew"].(map[string]interface{})
+		n, _ := skew["total"].(json.Number).Int64()
+		return n
+	}
+
+	for i := 0; i < 3; i++ {
+		send(i)
+	}
+	if got := storedTotal(); got != 3 {
+		t.Fatalf("expected state saved when device turns chronic, total %d", got)
+	}
+	// estimasi tidak berubah: metadata tidak ditulis tiap batch
+	for i := 3; i < 6; i++ {
+		send(i)
+	}
+	if got := storedTotal(); got != 3 {
+		t.Fatalf("expected unchanged estimate not saved every batch, total %d", got)
+	}
+
+	// admin ganti mode tanpa reconnect: fix berikutnya langsung dikoreksi
+	db.Model(&device.Device{}).Where("id = ?", dev.ID).Update("metadata", datatypes.JSONMap{"clockSkewMode": "CORRECT"})
+	f := send(6)
+	var row ingest.PositionLog
+	db.Where("device_id = ? AND raw_payload IS NOT NULL", dev.ID).Order("ts DESC").Limit(1).Find(&row)
+	if row.Quality != ingest.QualityGood || !row.TS.Equal(f.TS.Add(3*time.Hour)) || row.RawPayload["deviceTs"] == nil {
+		t.Fatalf("expected fix corrected by 3h after mode change, got %+v", row)
+	}
+
+	// reprocess membandingkan ts hasil decode dengan ts asli device, bukan ts hasil koreksi
+	db.Model(&ingest.PositionLog{}).Where("id = ?", row.ID).Update("speed_kph", 99)
+	report, err := svc.Reprocess(ingest.ReprocessOptions{DeviceID: dev.ID})
+	if err != nil || report.Failed != 0 || report.Changed != 1 {
+		t.Fatalf("unexpected reprocess report: %+v, %v", report, err)
+	}
+	var rewritten ingest.PositionLog
+	db.First(&rewritten, row.ID)
+	if !rewritten.TS.Equal(row.TS) || *rewritten.SpeedKph == 99 {
+		t.Fatalf("corrected row not rewritten in place: %+v", rewritten)
+	}
+}
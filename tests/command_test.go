@@ -0,0 +1,248 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/command"
+	"github.com/username/fms-api/internal/ingest"
+)
+
+func setupCommandDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := setupTestDB(t)
+	if err := db.AutoMigrate(&command.DeviceCommand{}, &command.CommandAudit{}); err != nil {
+		t.Fatalf("automigrate command tables: %v", err)
+	}
+	return db
+}
+
+type fakeSMS struct {
+	to, text string
+}
+
+func (f *fakeSMS) SendSMS(_ context.Context, to, text string) error {
+	f.to, f.text = to, text
+	return nil
+}
+
+func commandRouter(h *command.Handler, cu auth.CurrentUser) *gin.Engine {
+	router := gin.New()
+	admin := router.Group("/admin", func(c *gin.Context) { c.Set(auth.ContextUserKey, cu) })
+	h.RegisterAdminRoutes(admin)
+	return router
+}
+
+func postCommand(t *testing.T, router *gin.Engine, deviceID int64, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/admin/devices/"+strconv.FormatInt(deviceID, 10)+"/commands", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func auditActions(t *testing.T, db *gorm.DB, commandID int64) []string {
+	t.Helper()
+	var rows []command.CommandAudit
+	db.Where("command_id = ?", commandID).Order("id").Find(&rows)
+	actions := make([]string, 0, len(rows))
+	for _, r := range rows {
+		actions = append(actions, r.Action)
+	}
+	return actions
+}
+
+// waitFor tunggu kondisi yang dipenuhi goroutine listener / hub
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// teltonikaResponseFrame balasan Codec 12 (type 0x06) seperti yang dikirim device
+func teltonikaResponseFrame(text string) []byte {
+	data := []byte{ingest.TeltonikaCodec12, 0x01, 0x06}
+	data = binary.BigEndian.AppendUint32(data, uint32(len(text)))
+	data = append(data, text...)
+	data = append(data, 0x01)
+	frame := make([]byte, 8)
+	binary.BigEndian.PutUint32(frame[4:], uint32(len(data)))
+	frame = append(frame, data...)
+	return binary.BigEndian.AppendUint32(frame, uint32(ingest.TeltonikaCRC16(data)))
+}
+
+func TestCommand_TeltonikaDeliveryAndAck(t *testing.T) {
+	db := setupCommandDB(t)
+	imei := "356307042441099"
+	dev, _ := seedBoundDevice(t, db, "TELTO-CMD", "DEVICE", imei, ingest.ProtocolTeltonika)
+
+	cmdSvc := command.NewService(db)
+	hub := ingest.NewCommandHub(cmdSvc)
+	cmdSvc.Transport = hub
+	ingestSvc := ingest.NewService(db)
+	ingestSvc.Commands = hub
+
+	srv := ingest.NewTeltonikaServer("", ingestSvc)
+	client, server := net.Pipe()
+	defer client.Close()
+	go srv.HandleConn(server)
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	hs := append([]byte{0x00, byte(len(imei))}, imei...)
+	client.Write(hs)
+	var accept [1]byte
+	if _, err := io.ReadFull(client, accept[:]); err != nil || accept[0] != 0x01 {
+		t.Fatalf("expected IMEI accepted, got %v (%v)", accept, err)
+	}
+	waitFor(t, func() bool { return hub.Connected(dev.ID) })
+
+	router := commandRouter(command.NewHandler(cmdSvc), auth.CurrentUser{ID: 1, UserType: auth.UserTypeSuperAdmin})
+	w := postCommand(t, router, dev.ID, `{"type":"engine_cut"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created command.DeviceCommand
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	frame, err := ingest.ReadTeltonikaFrame(client)
+	if err != nil {
+		t.Fatalf("read command frame: %v", err)
+	}
+	if !bytes.Equal(frame, ingest.EncodeTeltonikaCommand("setdigout 1")) {
+		t.Fatalf("unexpected codec 12 frame %x", frame)
+	}
+
+	if _, err := client.Write(teltonikaResponseFrame("DOUT1:1 DOUT2:0")); err != nil {
+		t.Fatalf("write response: %v", err)
+	}
+	var cmd command.DeviceCommand
+	waitFor(t, func() bool {
+		var got command.DeviceCommand
+		db.First(&got, created.ID)
+		cmd = got
+		return got.Status == command.StatusAcked
+	})
+	if cmd.Channel != command.ChannelTCP || cmd.Response == nil || *cmd.Response != "DOUT1:1 DOUT2:0" || cmd.Attempts != 1 {
+		t.Fatalf("unexpected acked command: %+v", cmd)
+	}
+	if got := auditActions(t, db, cmd.ID); len(got) != 3 || got[0] != command.ActionCreated || got[1] != command.ActionSent || got[2] != command.ActionAcked {
+		t.Fatalf("unexpected audit trail: %v", got)
+	}
+}
+
+func TestCommand_OrgWhitelistSMSAndExpiry(t *testing.T) {
+	db := setupCommandDB(t)
+	dev, v := seedBoundDevice(t, db, "TELTO-SMS", "DEVICE", "356307042441100", ingest.ProtocolTeltonika)
+	db.Model(&dev).Update("sim_number", "+628111")
+
+	sms := &fakeSMS{}
+	cmdSvc := command.NewService(db)
+	cmdSvc.SMS = sms
+	cmdSvc.Transport = ingest.NewCommandHub(cmdSvc)
+	h := command.NewHandler(cmdSvc)
+
+	role := auth.OrgRoleAdmin
+	orgID := v.OrganizationID
+	router := commandRouter(h, auth.CurrentUser{ID: 7, UserType: auth.UserTypeOrgUser, OrganizationID: &orgID, OrgRole: &role})
+
+	// di luar whitelist: ditolak + tercatat di audit
+	w := postCommand(t, router, dev.ID, `{"type":"CONFIG_SET","params":{"key":"1000","value":"30"}}`)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+	var rejected int64
+	db.Model(&command.CommandAudit{}).Where("device_id = ? AND action = ? AND user_id = ?", dev.ID, command.ActionRejected, 7).Count(&rejected)
+	if rejected != 1 {
+		t.Fatalf("expected 1 REJECTED audit row, got %d", rejected)
+	}
+
+	// admin organisasi lain tidak boleh mengakses device ini
+	otherOrg := orgID + 100
+	other := commandRouter(h, auth.CurrentUser{ID: 8, UserType: auth.UserTypeOrgUser, OrganizationID: &otherOrg, OrgRole: &role})
+	if w := postCommand(t, other, dev.ID, `{"type":"ENGINE_CUT"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for other org, got %d", w.Code)
+	}
+
+	// device tidak terhubung: AUTO jatuh ke SMS
+	w = postCommand(t, router, dev.ID, `{"type":"ENGINE_CUT"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var viaSMS command.DeviceCommand
+	json.Unmarshal(w.Body.Bytes(), &viaSMS)
+	if viaSMS.Status != command.StatusSent || viaSMS.Channel != command.ChannelSMS || sms.to != "+628111" || sms.text != "  setdigout 1" {
+		t.Fatalf("expected command sent via SMS, got %+v (sms %q -> %q)", viaSMS, sms.text, sms.to)
+	}
+
+	// TCP saja: tetap antre sampai expired
+	w = postCommand(t, router, dev.ID, `{"type":"REBOOT","channel":"TCP","ttlSeconds":60}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var queued command.DeviceCommand
+	json.Unmarshal(w.Body.Bytes(), &queued)
+	if queued.Status != command.StatusQueued {
+		t.Fatalf("expected QUEUED, got %s", queued.Status)
+	}
+
+	n, err := cmdSvc.ExpireDue(time.Now().Add(2 * time.Minute))
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 expired command, got %d (%v)", n, err)
+	}
+	var expired command.DeviceCommand
+	db.First(&expired, queued.ID)
+	if expired.Status != command.StatusExpired {
+		t.Fatalf("expected EXPIRED, got %s", expired.Status)
+	}
+
+	// jenis tidak dikenal dari admin org tertahan di whitelist
+	if w := postCommand(t, router, dev.ID, `{"type":"SELF_DESTRUCT"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for unknown type from org admin, got %d", w.Code)
+	}
+}
+
+func TestGT06CommandPacketAndReply(t *testing.T) {
+	frame := ingest.GT06CommandPacket(42, "DYD,000000#", 3)
+	pkt, err := ingest.DecodeGT06Frame(frame)
+	if err != nil {
+		t.Fatalf("decode command packet: %v", err)
+	}
+	if pkt.Protocol != ingest.GT06Command || pkt.Serial != 3 || string(pkt.Content[5:5+11]) != "DYD,000000#" {
+		t.Fatalf("unexpected command packet: %+v", pkt)
+	}
+
+	// balasan device memakai format isi yang sama dengan protocol 0x15
+	reply := append([]byte{0x78, 0x78, 0x00, ingest.GT06CommandReply}, pkt.Content...)
+	reply = append(reply, 0x00, 0x04)
+	reply[2] = byte(len(reply) - 3 + 2)
+	crc := ingest.GT06CRC(reply[2:])
+	reply = append(reply, byte(crc>>8), byte(crc), 0x0D, 0x0A)
+
+	rp, err := ingest.DecodeGT06Frame(reply)
+	if err != nil {
+		t.Fatalf("decode reply: %v", err)
+	}
+	flag, text, err := rp.CommandReply()
+	if err != nil || flag != 42 || text != "DYD,000000#" {
+		t.Fatalf("unexpected reply: %d %q (%v)", flag, text, err)
+	}
+}
@@ -0,0 +1,193 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/datatypes"
+
+	"github.com/username/fms-api/internal/device"
+	"github.com/username/fms-api/internal/ingest"
+)
+
+// fakeVendor meniru REST API vendor: request pertama kena rate limit, berikutnya mengembalikan data
+type fakeVendor struct {
+	mu      sync.Mutex
+	calls   int
+	cursors []string
+}
+
+func (f *fakeVendor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.calls++
+	call := f.calls
+	f.cursors = append(f.cursors, r.URL.Query().Get("since"))
+	f.mu.Unlock()
+
+	if r.Header.Get("X-Api-Key") != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if call == 1 {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"data":[
+		{"unit":"veh-1","pos":{"lat":-6.2,"lng":106.8},"time":"2025-01-01T10:00:00Z","speed":20},
+		{"unit":"veh-1","pos":{"lat":-6.21,"lng":106.81},"time":"2025-01-01T10:01:00Z","speed":25},
+		{"unit":"ghost","pos":{"lat":-6.3,"lng":106.9},"time":"2025-01-01T10:02:00Z"}
+	]}`))
+}
+
+func TestPoller_RetriesRateLimitAndPersistsCursor(t *testing.T) {
+	db := setupTestDB(t)
+	if err := db.AutoMigrate(&ingest.ConnectorState{}); err != nil {
+		t.Fatalf("failed to migrate connector_states: %v", err)
+	}
+	dev, v := seedBoundDevice(t, db, "VENDOR-X", "API", "veh-1", "API")
+
+	vendor := &fakeVendor{}
+	srv := httptest.NewServer(vendor)
+	defer srv.Close()
+
+	// config disimpan lalu dibaca ulang dari DB: angka di JSONMap jadi json.Number
+	db.Model(&device.DataSource{}).Where("id = ?", dev.DataSourceID).Update("config", datatypes.JSONMap{
+		"url":                 srv.URL,
+		"apiKey":              "secret",
+		"authHeader":          "X-Api-Key",
+		"itemsPath":           "data",
+		"externalIdField":     "unit",
+		"fieldMapping":        map[string]interface{}{"lat": "pos.lat", "lon": "pos.lng", "ts": "time"},
+		"pollIntervalSeconds": 15,
+		"timeoutSeconds":      5,
+	})
+	var ds device.DataSource
+	db.First(&ds, dev.DataSourceID)
+
+	conn, err := ingest.NewConnector(ds)
+	if err != nil {
+		t.Fatalf("new connector failed: %v", err)
+	}
+	p := ingest.NewPoller(ds, conn, ingest.NewService(db))
+	if p.Interval != 15*time.Second {
+		t.Fatalf("expected poll interval from config, got %s", p.Interval)
+	}
+	p.Backoff = ingest.Backoff{Min: time.Millisecond, Max: 10 * time.Millisecond}
+
+	summary, err := p.PollOnce(context.Background())
+	if err != nil {
+		t.Fatalf("poll failed: %v", err)
+	}
+	if summary.Inserted != 2 || summary.Unknown != 1 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	if vendor.calls != 2 {
+		t.Fatalf("expected 1 retry after rate limit, got %d calls", vendor.calls)
+	}
+
+	var cnt int64
+	db.Model(&ingest.PositionLog{}).Where("vehicle_id = ?", v.ID).Count(&cnt)
+	if cnt != 2 {
+		t.Fatalf("expected 2 position_log rows, got %d", cnt)
+	}
+
+	var state ingest.ConnectorState
+	if err := db.First(&state, "data_source_id = ?", ds.ID).Error; err != nil {
+		t.Fatalf("connector state not saved: %v", err)
+	}
+	if state.Cursor != "2025-01-01T10:02:00Z" || state.LastSuccessAt == nil || state.LastError != nil {
+		t.Fatalf("unexpected connector state: %+v", state)
+	}
+
+	// poll berikutnya harus mengirim cursor tersimpan dan tidak menggandakan data
+	summary, err = p.PollOnce(context.Background())
+	if err != nil {
+		t.Fatalf("second poll failed: %v", err)
+	}
+	if summary.Inserted != 0 || summary.Duplicates != 2 {
+		t.Fatalf("unexpected second summary: %+v", summary)
+	}
+	if got := vendor.cursors[len(vendor.cursors)-1]; got != "2025-01-01T10:02:00Z" {
+		t.Fatalf("expected cursor to be sent to vendor, got %q", got)
+	}
+}
+
+func TestPoller_RecordsPermanentError(t *testing.T) {
+	db := setupTestDB(t)
+	if err := db.AutoMigrate(&ingest.ConnectorState{}); err != nil {
+		t.Fatalf("failed to migrate connector_states: %v", err)
+	}
+	dev, _ := seedBoundDevice(t, db, "VENDOR-Y", "API", "veh-2", "API")
+
+	vendor := &fakeVendor{}
+	srv := httptest.NewServer(vendor)
+	defer srv.Close()
+
+	db.Model(&device.DataSource{}).Where("id = ?", dev.DataSourceID).
+		Update("config", datatypes.JSONMap{"url": srv.URL, "apiKey": "wrong", "authHeader": "X-Api-Key"})
+	var ds device.DataSource
+	db.First(&ds, dev.DataSourceID)
+
+	conn, err := ingest.NewConnector(ds)
+	if err != nil {
+		t.Fatalf("new connector failed: %v", err)
+	}
+	p := ingest.NewPoller(ds, conn, ingest.NewService(db))
+	if _, err := p.PollOnce(context.Background()); err == nil {
+		t.Fatalf("expected error for 401 response")
+	}
+	if vendor.calls != 1 {
+		t.Fatalf("401 must not be retried, got %d calls", vendor.calls)
+	}
+
+	var state ingest.ConnectorState
+	db.First(&state, "data_source_id = ?", ds.ID)
+	if state.LastError == nil || state.LastSuccessAt != nil {
+		t.Fatalf("expected last error to be recorded: %+v", state)
+	}
+}
+
+func TestHTTPConnector_CursorIgnoresUntimedItemsAndNeverMovesBack(t *testing.T) {
+	page := `[]`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(page))
+	}))
+	defer srv.Close()
+
+	conn, err := ingest.NewConnector(device.DataSource{Type: "API", Config: datatypes.JSONMap{
+		"url":             srv.URL,
+		"externalIdField": "unit",
+		"fieldMapping":    map[string]interface{}{"lat": "lat", "lon": "lon", "ts": "time"},
+	}})
+	if err != nil {
+		t.Fatalf("new connector failed: %v", err)
+	}
+
+	// item tanpa ts (dicap waktu terima) tidak boleh memajukan cursor ke waktu sekarang
+	page = `[
+		{"unit":"veh-1","lat":-6.2,"lon":106.8,"time":"2025-01-01T10:00:00Z"},
+		{"unit":"veh-1","lat":-6.2,"lon":106.8}
+	]`
+	res, err := conn.Poll(context.Background(), "")
+	if err != nil || len(res.Fixes) != 2 || res.Cursor != "2025-01-01T10:00:00Z" {
+		t.Fatalf("expected cursor from timed item only, got %+v (%v)", res, err)
+	}
+
+	// halaman berisi data terlambat: cursor tetap di posisi tersimpan
+	page = `[{"unit":"veh-1","lat":-6.2,"lon":106.8,"time":"2025-01-01T09:00:00Z"}]`
+	res, err = conn.Poll(context.Background(), "2025-01-01T10:00:00Z")
+	if err != nil || res.Cursor != "2025-01-01T10:00:00Z" {
+		t.Fatalf("expected cursor not to move backwards, got %+v (%v)", res, err)
+	}
+	res, err = conn.Poll(context.Background(), "")
+	if err != nil || res.Cursor != "2025-01-01T09:00:00Z" {
+		t.Fatalf("expected cursor from page without stored cursor, got %+v (%v)", res, err)
+	}
+}
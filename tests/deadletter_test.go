@@ -0,0 +1,229 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/device"
+	"github.com/username/fms-api/internal/ingest"
+)
+
+func TestDeadLetter_HoldListProvisionAndReplay(t *testing.T) {
+	db := setupTestDB(t)
+	_, v := seedBoundDevice(t, db, "OTHER", "DEVICE", "other-1", ingest.ProtocolTeltonika)
+	ds := device.DataSource{Name: "Teltonika", Code: "TELTO", Type: "TELTONIKA"}
+	db.Create(&ds)
+
+	svc := ingest.NewService(db)
+	svc.AcceptUnknown = true
+
+	// IMEI belum terdaftar: handshake diterima, packet di-ACK dan ditahan
+	srv := ingest.NewTeltonikaServer("", svc)
+	client, server := net.Pipe()
+	defer client.Close()
+	go srv.HandleConn(server)
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	imei := "356307042441777"
+	hs := make([]byte, 2+len(imei))
+	binary.BigEndian.PutUint16(hs, uint16(len(imei)))
+	copy(hs[2:], imei)
+	client.Write(hs)
+	var accept [1]byte
+	if _, err := io.ReadFull(client, accept[:]); err != nil || accept[0] != 0x01 {
+		t.Fatalf("expected unknown IMEI accepted, got %v (%v)", accept, err)
+	}
+	client.Write(mustHex(t, teltonikaCodec8EHex))
+	var ack [4]byte
+	if _, err := io.ReadFull(client, ack[:]); err != nil || binary.BigEndian.Uint32(ack[:]) != 1 {
+		t.Fatalf("expected ack for held packet, got %v (%v)", ack, err)
+	}
+	bad := mustHex(t, teltonikaCodec8Hex)
+	bad[len(bad)-1] ^= 0xFF
+	client.Write(bad)
+	if _, err := io.ReadFull(client, ack[:]); err != nil || binary.BigEndian.Uint32(ack[:]) != 0 {
+		t.Fatalf("expected ack 0 for corrupt packet, got %v (%v)", ack, err)
+	}
+
+	// OsmAnd dari id yang belum terdaftar tetap ditolak tapi paketnya ditahan
+	h := ingest.NewHandlerWithService(svc)
+	router := gin.New()
+	h.RegisterOsmAndRoutes(router.Group("/osmand"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/osmand?id=phone-x&lat=-6.2&lon=106.8&timestamp=1735725600", nil))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for unknown osmand id, got %d", w.Code)
+	}
+
+	var unparsable int64
+	db.Model(&ingest.DeadLetter{}).Where("reason = ? AND external_id = ?", ingest.DeadLetterUnparsable, imei).Count(&unparsable)
+	if unparsable != 1 {
+		t.Fatalf("expected 1 UNPARSABLE dead letter, got %d", unparsable)
+	}
+
+	cu := auth.CurrentUser{ID: 1, UserType: auth.UserTypeSuperAdmin}
+	admin := gin.New()
+	adminGroup := admin.Group("/admin", func(c *gin.Context) { c.Set(auth.ContextUserKey, cu) })
+	h.RegisterAdminRoutes(adminGroup)
+
+	// daftar external id yang belum terdaftar
+	w = httptest.NewRecorder()
+	admin.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/ingest/unknown", nil))
+	var list struct {
+		Data []ingest.UnknownDevice `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if w.Code != http.StatusOK || len(list.Data) != 2 {
+		t.Fatalf("expected 2 unknown devices, got %d: %s", w.Code, w.Body.String())
+	}
+	if list.Data[0].ExternalID != "phone-x" || list.Data[1].ExternalID != imei || list.Data[1].PacketCount != 1 ||
+		list.Data[1].SamplePayload["frame"] == nil || list.Data[1].FirstSeen.IsZero() {
+		t.Fatalf("unexpected unknown list: %+v", list.Data)
+	}
+
+	provision := func(externalID, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/admin/ingest/unknown/"+externalID+"/provision", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		admin.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := provision(imei, `{"dataSourceId":1,"replay":true}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for replay without vehicle, got %d", w.Code)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"dataSourceId": ds.ID, "vehicleId": v.ID, "replay": true})
+	w = provision(imei, string(body))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var res ingest.ProvisionResult
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if res.Device.Protocol != ingest.ProtocolTeltonika || res.Held != 1 || res.Replayed != 1 || res.Result.Inserted != 1 {
+		t.Fatalf("unexpected provision result: %+v", res)
+	}
+
+	var logs int64
+	db.Model(&ingest.PositionLog{}).Where("device_id = ? AND vehicle_id = ?", res.Device.ID, v.ID).Count(&logs)
+	if logs != 1 {
+		t.Fatalf("expected replayed fix in position_log, got %d", logs)
+	}
+	var pending int64
+	db.Model(&ingest.DeadLetter{}).Where("device_id = ? AND replayed_at IS NULL", res.Device.ID).Count(&pending)
+	if pending != 0 {
+		t.Fatalf("expected held packets marked replayed, %d pending", pending)
+	}
+
+	// sudah di-provision: hilang dari daftar dan tidak bisa di-provision lagi
+	w = httptest.NewRecorder()
+	admin.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/ingest/unknown", nil))
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Data) != 1 || list.Data[0].ExternalID != "phone-x" {
+		t.Fatalf("expected only phone-x left, got %+v", list.Data)
+	}
+	if w := provision(imei, string(body)); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 when nothing is held, got %d", w.Code)
+	}
+
+	// koneksi berikutnya dari IMEI ini langsung masuk position_log
+	if _, err := svc.ResolveByProtocol(ingest.ProtocolTeltonika, imei); err != nil {
+		t.Fatalf("provisioned device not resolvable: %v", err)
+	}
+}
+
+func TestDeadLetter_CapTTLAndDataSourceMismatch(t *testing.T) {
+	db := setupTestDB(t)
+	svc := ingest.NewService(db)
+	svc.AcceptUnknown = true
+	svc.DeadLetterCap = 3
+	svc.DeadLetterTTL = 24 * time.Hour
+
+	// paket kedaluwarsa dari external id lain ikut dihapus saat paket baru ditahan
+	db.Create(&ingest.DeadLetter{Reason: ingest.DeadLetterUnknownDevice, Protocol: ingest.ProtocolGT06,
+		ExternalID: "stale", ReceivedAt: time.Now().UTC().Add(-48 * time.Hour)})
+
+	imei := "868120000000001"
+	for i := 0; i < 5; i++ {
+		fix := ingest.Fix{TS: time.Unix(1735725600+int64(i), 0).UTC(), Lat: -6.2, Lon: 106.8}
+		svc.HoldUnknown(ingest.ProtocolGT06, "", imei, []ingest.Fix{fix}, map[string]interface{}{"seq": i})
+	}
+
+	var held []ingest.DeadLetter
+	db.Where("external_id = ?", imei).Order("id").Find(&held)
+	if len(held) != 3 || fmt.Sprint(held[0].Payload["seq"]) != "2" {
+		t.Fatalf("expected only 3 newest packets held, got %d: %+v", len(held), held)
+	}
+	var stale int64
+	db.Model(&ingest.DeadLetter{}).Where("external_id = ?", "stale").Count(&stale)
+	if stale != 0 {
+		t.Fatalf("expected expired dead letter pruned, got %d", stale)
+	}
+
+	// GT06 di-resolve lewat data_sources.type, jadi data source bertipe lain ditolak
+	wrong := device.DataSource{Name: "Teltonika", Code: "TELTO", Type: "TELTONIKA"}
+	db.Create(&wrong)
+	if _, err := svc.Provision(imei, ingest.ProvisionRequest{DataSourceID: wrong.ID}); !errors.Is(err, ingest.ErrDataSourceMismatch) {
+		t.Fatalf("expected ErrDataSourceMismatch, got %v", err)
+	}
+	gt06 := device.DataSource{Name: "GT06", Code: "GT06", Type: ingest.ProtocolGT06}
+	db.Create(&gt06)
+	res, err := svc.Provision(imei, ingest.ProvisionRequest{DataSourceID: gt06.ID})
+	if err != nil || res.Held != 3 {
+		t.Fatalf("expected provision into GT06 data source, got %+v (%v)", res, err)
+	}
+	// device ditemukan listener GT06 (belum terikat kendaraan karena tanpa vehicleId)
+	if _, err := svc.ResolveByDataSourceType(ingest.ProtocolGT06, imei); !errors.Is(err, ingest.ErrDeviceUnbound) {
+		t.Fatalf("expected provisioned GT06 device resolvable but unbound, got %v", err)
+	}
+}
+
+func TestDeadLetter_GatedOnAcceptUnknownAndRateLimited(t *testing.T) {
+	db := setupTestDB(t)
+	svc := ingest.NewService(db)
+	router := gin.New()
+	ingest.NewHandlerWithService(svc).RegisterOsmAndRoutes(router.Group("/osmand"))
+	send := func(query string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/osmand?"+query, nil))
+		if w.Code == http.StatusOK {
+			t.Fatalf("expected unknown / bad osmand request rejected, got %d", w.Code)
+		}
+	}
+	count := func() int64 {
+		var n int64
+		db.Model(&ingest.DeadLetter{}).Count(&n)
+		return n
+	}
+
+	// default: id yang belum terdaftar & paket rusak ditolak tanpa disimpan
+	send("id=phone-a&lat=-6.2&lon=106.8&timestamp=1735725600")
+	send("id=phone-b&lat=abc&lon=106.8")
+	svc.HoldUnknown(ingest.DataSourceTypeMQTT, "MQTT-X", "sensor-1", nil, map[string]interface{}{"topic": "t"})
+	if n := count(); n != 0 {
+		t.Fatalf("expected no dead letters without AcceptUnknown, got %d", n)
+	}
+
+	// id acak tiap request: dibatasi DeadLetterRate per menit, bukan per external id
+	svc.AcceptUnknown = true
+	svc.DeadLetterRate = 5
+	for i := 0; i < 20; i++ {
+		send(fmt.Sprintf("id=random-%d&lat=-6.2&lon=106.8&timestamp=1735725600", i))
+	}
+	if n := count(); n != 5 {
+		t.Fatalf("expected dead letters capped at 5 per minute, got %d", n)
+	}
+}
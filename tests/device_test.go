@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -61,3 +63,42 @@ func TestCreateDataSource_And_CreateDevice_ListUnassigned(t *testing.T) {
 		t.Fatalf("expected 200 for list devices, got %d", w3.Code)
 	}
 }
+
+func TestDataSource_RedactsCredentials(t *testing.T) {
+	db := setupTestDB(t)
+	h := device.NewHandler(db)
+	cu := auth.CurrentUser{ID: 1, UserType: auth.UserTypeSuperAdmin}
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set(auth.ContextUserKey, cu) })
+	h.RegisterAdminRoutes(router)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		r.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do(http.MethodPost, "/data-sources", `{"name":"Broker","code":"BRK","type":"MQTT","config":{"brokerUrl":"tcp://broker:1883","username":"fms","password":"rahasia"}}`)
+	var created device.DataSource
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if w.Code != http.StatusCreated || created.Config["password"] != device.RedactedSecret {
+		t.Fatalf("expected redacted password on create: %d %s", w.Code, w.Body.String())
+	}
+	path := "/data-sources/" + strconv.FormatInt(created.ID, 10)
+	for _, body := range []string{do(http.MethodGet, path, "").Body.String(), do(http.MethodGet, "/data-sources", "").Body.String()} {
+		if strings.Contains(body, "rahasia") {
+			t.Fatalf("password leaked: %s", body)
+		}
+	}
+
+	// PUT config hasil GET apa adanya: password lama tetap tersimpan
+	if w := do(http.MethodPut, path, `{"config":{"brokerUrl":"tcp://broker2:1883","username":"fms","password":"********"}}`); w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body.String())
+	}
+	var stored device.DataSource
+	db.First(&stored, created.ID)
+	if stored.Config["password"] != "rahasia" || stored.Config["brokerUrl"] != "tcp://broker2:1883" {
+		t.Fatalf("unexpected stored config: %+v", stored.Config)
+	}
+}
@@ -0,0 +1,193 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/geocode"
+	"github.com/username/fms-api/internal/ingest"
+	"github.com/username/fms-api/internal/trip"
+	"github.com/username/fms-api/internal/vehicle"
+)
+
+// potongan dump GeoNames (19 kolom tab); baris kelas A (wilayah) dilewati dengan kelas default P
+var geoNamesSample = strings.Join([]string{
+	geoNamesLine("1642911", "Jakarta", -6.21462, 106.84513, "P", "PPLC", "04", "", 8540121),
+	geoNamesLine("1625822", "Tangerang", -6.17806, 106.63, "P", "PPLA2", "33", "3671", 1372124),
+	geoNamesLine("1642907", "Jakarta Raya", -6.18333, 106.83333, "A", "ADM1", "04", "", 0),
+}, "\n")
+
+func geoNamesLine(id, name string, lat, lon float64, class, code, admin1, admin2 string, population int) string {
+	return strings.Join([]string{id, name, name, "", fmt.Sprint(lat), fmt.Sprint(lon), class, code, "ID", "",
+		admin1, admin2, "", "", fmt.Sprint(population), "", "8", "Asia/Jakarta", "2024-01-01"}, "\t")
+}
+
+func setupPlaceDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := setupTripDB(t)
+	if err := db.AutoMigrate(&geocode.Place{}); err != nil {
+		t.Fatalf("automigrate places: %v", err)
+	}
+	importSamplePlaces(t, db)
+	return db
+}
+
+func importSamplePlaces(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	admin1, _ := geocode.ReadAdminCodes(strings.NewReader("ID.04\tJakarta\tJakarta\t1642907\nID.33\tBanten\tBanten\t1923045\n"))
+	admin2, _ := geocode.ReadAdminCodes(strings.NewReader("ID.33.3671\tKota Tangerang\tKota Tangerang\t8224437\n"))
+	n, err := geocode.ImportGeoNames(db, strings.NewReader(geoNamesSample), geocode.ImportOptions{Admin1: admin1, Admin2: admin2})
+	if err != nil || n != 2 {
+		t.Fatalf("import geonames: %d %v", n, err)
+	}
+}
+
+func TestGeocode_ImportAndReverse(t *testing.T) {
+	db := setupPlaceDB(t)
+
+	// import ulang = update, bukan duplikat
+	importSamplePlaces(t, db)
+	var count int64
+	db.Model(&geocode.Place{}).Count(&count)
+	if count != 2 {
+		t.Fatalf("expected 2 places after reimport, got %d", count)
+	}
+
+	csvData := "id,name,lat,lon,admin1,country_code\nbdg,Bandung,-6.9175,107.6191,Jawa Barat,ID\n"
+	if n, err := geocode.ImportCSV(db, strings.NewReader(csvData), geocode.ImportOptions{Source: "kota"}); err != nil || n != 1 {
+		t.Fatalf("import csv: %d %v", n, err)
+	}
+	if _, err := geocode.ImportCSV(db, strings.NewReader("id,name,lat\n1,x,1\n"), geocode.ImportOptions{}); err == nil {
+		t.Fatalf("expected error for csv without lon column")
+	}
+
+	g := geocode.NewPlaceGeocoder(db)
+	addr, err := g.Reverse(-6.2, 106.8)
+	if err != nil || addr == nil || addr.Name != "Jakarta" || addr.DistanceKm == 0 || addr.DistanceKm > 6 {
+		t.Fatalf("expected Jakarta, got %+v (%v)", addr, err)
+	}
+	// koordinat lebih dekat ke Tangerang, nama admin dari file kode
+	addr, _ = g.Reverse(-6.18, 106.65)
+	if addr == nil || addr.Label != "Tangerang, Kota Tangerang, Banten, ID" {
+		t.Fatalf("unexpected Tangerang address: %+v", addr)
+	}
+	if addr, _ := g.Reverse(-6.91, 107.6); addr == nil || addr.Name != "Bandung" {
+		t.Fatalf("expected Bandung from csv import, got %+v", addr)
+	}
+	// tengah laut: lebih dari 25 km dari tempat mana pun
+	if addr, err := g.Reverse(-5.5, 106.8); addr != nil || err != nil {
+		t.Fatalf("expected no address far from places, got %+v (%v)", addr, err)
+	}
+}
+
+type countingGeocoder struct {
+	calls int
+}
+
+func (g *countingGeocoder) Reverse(lat, lon float64) (*geocode.Address, error) {
+	g.calls++
+	if lat > 0 {
+		return nil, nil
+	}
+	return &geocode.Address{Label: "X", Name: "X"}, nil
+}
+
+func TestGeocode_Cache(t *testing.T) {
+	next := &countingGeocoder{}
+	cache := geocode.NewCache(next, 2)
+
+	// titik dalam ~50 m berbagi entri cache
+	cache.Reverse(-6.20001, 106.80001)
+	if addr, _ := cache.Reverse(-6.20004, 106.80002); addr == nil || next.calls != 1 {
+		t.Fatalf("expected cache hit, calls=%d", next.calls)
+	}
+	// hasil kosong ikut di-cache
+	cache.Reverse(1, 1)
+	if addr, _ := cache.Reverse(1, 1); addr != nil || next.calls != 2 {
+		t.Fatalf("expected cached empty result, calls=%d", next.calls)
+	}
+	// kapasitas 2: entri paling lama dibuang
+	cache.Reverse(-7, 110)
+	if cache.Len() != 2 {
+		t.Fatalf("expected 2 entries, got %d", cache.Len())
+	}
+	cache.Reverse(-6.2, 106.8)
+	if next.calls != 4 {
+		t.Fatalf("expected evicted entry to be looked up again, calls=%d", next.calls)
+	}
+}
+
+func TestGeocode_TripAndCurrentPositionAddresses(t *testing.T) {
+	db := setupPlaceDB(t)
+	svc := ingest.NewService(db)
+	_, v := seedBoundDevice(t, db, "TRIP-GEO", "DEVICE", "trip-geo", ingest.ProtocolTeltonika)
+	target, err := svc.ResolveByDataSource("TRIP-GEO", "trip-geo")
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	on, off := true, false
+	base := time.Now().UTC().Add(-2 * time.Hour).Truncate(time.Second)
+	fixes := []ingest.Fix{tripFix(base, 0, 106.64, 0, &off)}
+	for i := 1; i <= 10; i++ {
+		fixes = append(fixes, tripFix(base, i, 106.64+float64(i)*0.02, 60, &on))
+	}
+	fixes = append(fixes, tripFix(base, 11, 106.84, 0, &off))
+	if _, err := svc.Store(target, fixes); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if n, err := trip.NewBuilder(db).RunOnce(fixes[11].TS.Add(time.Minute)); err != nil || n != 1 {
+		t.Fatalf("expected 1 trip, got %d (%v)", n, err)
+	}
+	tr := vehicleTrips(t, db, v.ID)[0]
+
+	h := trip.NewHandler(db)
+	h.Geocoder = geocode.NewCache(geocode.NewPlaceGeocoder(db), 100)
+	orgID := v.OrganizationID
+	userRole := auth.OrgRoleUser
+	router := tripRouter(h, auth.CurrentUser{ID: 1, UserType: auth.UserTypeOrgUser, OrganizationID: &orgID, OrgRole: &userRole})
+
+	w := doJSON(router, http.MethodGet, fmt.Sprintf("/api/trips/%d", tr.ID), "")
+	var detail struct {
+		Trip trip.Trip `json:"trip"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &detail); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("trip detail: %d %s", w.Code, w.Body.String())
+	}
+	if detail.Trip.StartAddress == nil || detail.Trip.StartAddress.Name != "Tangerang" ||
+		detail.Trip.EndAddress == nil || detail.Trip.EndAddress.Name != "Jakarta" {
+		t.Fatalf("unexpected trip addresses: %s", w.Body.String())
+	}
+	w = doJSON(router, http.MethodGet, fmt.Sprintf("/api/vehicles/%d/trips", v.ID), "")
+	if !strings.Contains(w.Body.String(), `"startAddress":{"label":"Tangerang, Kota Tangerang, Banten, ID"`) {
+		t.Fatalf("expected startAddress in trip list: %s", w.Body.String())
+	}
+	// tanpa geocoder: field alamat tidak muncul
+	plain := tripRouter(trip.NewHandler(db), auth.CurrentUser{ID: 1, UserType: auth.UserTypeOrgUser, OrganizationID: &orgID, OrgRole: &userRole})
+	if w := doJSON(plain, http.MethodGet, fmt.Sprintf("/api/trips/%d", tr.ID), ""); strings.Contains(w.Body.String(), "startAddress") {
+		t.Fatalf("expected no address without geocoder: %s", w.Body.String())
+	}
+
+	vh := vehicle.NewHandler(db)
+	vh.Geocoder = geocode.NewPlaceGeocoder(db)
+	vrouter := gin.New()
+	vh.RegisterRoutes(vrouter)
+	rec := httptest.NewRecorder()
+	vrouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/vehicles/%d/current-position", v.ID), nil))
+	var pos vehicle.VehicleCurrentPosition
+	if err := json.Unmarshal(rec.Body.Bytes(), &pos); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("current position: %d %s", rec.Code, rec.Body.String())
+	}
+	if pos.Address == nil || pos.Address.Name != "Jakarta" {
+		t.Fatalf("unexpected current position address: %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/username/fms-api/internal/alert"
+	"github.com/username/fms-api/internal/ingest"
+)
+
+// contoh frame dari dokumentasi protokol GT06
+const (
+	gt06LoginHex    = "78780D01012345678901234500018CDD0D0A"
+	gt06LocationHex = "78781F120B081D112E10CF027AC7EB0C46584900148F01CC00287D001FB8000380810D0A"
+)
+
+// gt06Frame membungkus protocol number + isi + serial menjadi frame 0x7878 lengkap dengan CRC
+func gt06Frame(protocol byte, content []byte, serial uint16) []byte {
+	body := []byte{byte(1 + len(content) + 2 + 2), protocol}
+	body = append(body, content...)
+	body = append(body, byte(serial>>8), byte(serial))
+	crc := ingest.GT06CRC(body)
+	frame := append([]byte{0x78, 0x78}, body...)
+	return append(frame, byte(crc>>8), byte(crc), 0x0D, 0x0A)
+}
+
+func TestDecodeGT06_LoginAndLocation(t *testing.T) {
+	login, err := ingest.DecodeGT06Frame(mustHex(t, gt06LoginHex))
+	if err != nil {
+		t.Fatalf("decode login failed: %v", err)
+	}
+	imei, err := login.IMEI()
+	if err != nil || imei != "123456789012345" || login.Serial != 1 {
+		t.Fatalf("unexpected login: imei=%q serial=%d err=%v", imei, login.Serial, err)
+	}
+	if hex.EncodeToString(ingest.GT06Response(ingest.GT06Login, 1)) != "787805010001d9dc0d0a" {
+		t.Fatalf("unexpected login response %x", ingest.GT06Response(ingest.GT06Login, 1))
+	}
+
+	pkt, err := ingest.DecodeGT06Frame(mustHex(t, gt06LocationHex))
+	if err != nil {
+		t.Fatalf("decode location failed: %v", err)
+	}
+	loc, err := pkt.Location()
+	if err != nil {
+		t.Fatalf("location failed: %v", err)
+	}
+	if !loc.TS.Equal(time.Date(2011, 8, 29, 17, 46, 16, 0, time.UTC)) || loc.Satellites != 15 || !loc.Positioned {
+		t.Fatalf("unexpected location: %+v", loc)
+	}
+	if loc.Lat < 23.11 || loc.Lat > 23.12 || loc.Lon < 114.40 || loc.Lon > 114.41 {
+		t.Fatalf("unexpected coordinates: %v,%v", loc.Lat, loc.Lon)
+	}
+
+	bad := mustHex(t, gt06LocationHex)
+	bad[10] ^= 0xFF
+	if _, err := ingest.DecodeGT06Frame(bad); err != ingest.ErrGT06CRC {
+		t.Fatalf("expected CRC error, got %v", err)
+	}
+}
+
+func TestGT06Server_LoginLocationHeartbeatAlarm(t *testing.T) {
+	db := setupTestDB(t)
+	if err := db.AutoMigrate(&alert.AlertType{}); err != nil {
+		t.Fatalf("automigrate failed: %v", err)
+	}
+	db.Create(&alert.AlertType{Code: "SOS", Name: "SOS", DefaultSeverity: "CRITICAL"})
+	dev, v := seedBoundDevice(t, db, "GT06-DS", ingest.ProtocolGT06, "123456789012345", ingest.ProtocolGT06)
+
+	srv := ingest.NewGT06Server("", ingest.NewService(db))
+	client, server := net.Pipe()
+	defer client.Close()
+	go srv.HandleConn(server)
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	expectResponse := func(protocol byte, serial uint16) {
+		t.Helper()
+		want := ingest.GT06Response(protocol, serial)
+		got := make([]byte, len(want))
+		if _, err := io.ReadFull(client, got); err != nil {
+			t.Fatalf("read response: %v", err)
+		}
+		if hex.EncodeToString(got) != hex.EncodeToString(want) {
+			t.Fatalf("expected response %x, got %x", want, got)
+		}
+	}
+
+	client.Write(mustHex(t, gt06LoginHex))
+	expectResponse(ingest.GT06Login, 1)
+
+	// lokasi tidak dibalas
+	client.Write(mustHex(t, gt06LocationHex))
+
+	// heartbeat: terminal info, voltage, gsm, alarm/language
+	client.Write(gt06Frame(ingest.GT06Heartbeat, []byte{0x02, 0x06, 0x04, 0x00, 0x02}, 4))
+	expectResponse(ingest.GT06Heartbeat, 4)
+
+	// alarm SOS: datetime, gps, lat, lon, speed, course, LBS, terminal info, voltage, gsm, alarm, language
+	alarm := mustHex(t, "0B081D112F00CF027AC7EB0C46584900148F"+"0801CC00287D001FB8"+"0206040102")
+	client.Write(gt06Frame(ingest.GT06Alarm, alarm, 5))
+	expectResponse(ingest.GT06Alarm, 5)
+	// ACK alarm hilang: device kirim ulang paket yang sama, tidak boleh jadi alert kedua
+	client.Write(gt06Frame(ingest.GT06Alarm, alarm, 6))
+	expectResponse(ingest.GT06Alarm, 6)
+
+	var cnt int64
+	db.Model(&ingest.PositionLog{}).Where("device_id = ?", dev.ID).Count(&cnt)
+	if cnt != 2 {
+		t.Fatalf("expected 2 position_log rows (location + alarm), got %d", cnt)
+	}
+
+	var alerts []alert.Alert
+	db.Where("vehicle_id = ?", v.ID).Find(&alerts)
+	if len(alerts) != 1 || alerts[0].Status != "ACTIVE" {
+		t.Fatalf("expected 1 active SOS alert, got %+v", alerts)
+	}
+}
+
+func TestGT06Server_ReloginMovesCommandSession(t *testing.T) {
+	db := setupTestDB(t)
+	first, _ := seedBoundDevice(t, db, "GT06-A", ingest.ProtocolGT06, "123456789012345", ingest.ProtocolGT06)
+	second, _ := seedBoundDevice(t, db, "GT06-B", ingest.ProtocolGT06, "123456789012346", ingest.ProtocolGT06)
+
+	svc := ingest.NewService(db)
+	hub := ingest.NewCommandHub(nil)
+	svc.Commands = hub
+	srv := ingest.NewGT06Server("", svc)
+	client, server := net.Pipe()
+	defer client.Close()
+	go srv.HandleConn(server)
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	login := func(bcd string, serial uint16) {
+		t.Helper()
+		client.Write(gt06Frame(ingest.GT06Login, mustHex(t, bcd), serial))
+		want := ingest.GT06Response(ingest.GT06Login, serial)
+		got := make([]byte, len(want))
+		if _, err := io.ReadFull(client, got); err != nil {
+			t.Fatalf("read login response: %v", err)
+		}
+	}
+	// session di-attach setelah balasan login terkirim
+	waitConnected := func(a, b bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for hub.Connected(first.ID) != a || hub.Connected(second.ID) != b {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected connected %v/%v, got %v/%v", a, b, hub.Connected(first.ID), hub.Connected(second.ID))
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	login("0123456789012345", 1)
+	waitConnected(true, false)
+	// koneksi yang sama login ulang dengan IMEI lain
+	login("0123456789012346", 2)
+	waitConnected(false, true)
+}
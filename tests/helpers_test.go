@@ -1,10 +1,13 @@
 package tests
 
 import (
+    "fmt"
+    "strings"
     "testing"
 
     "github.com/username/fms-api/internal/alert"
     "github.com/username/fms-api/internal/device"
+    "github.com/username/fms-api/internal/ingest"
     "github.com/username/fms-api/internal/organization"
     "github.com/username/fms-api/internal/user"
     "github.com/username/fms-api/internal/vehicle"
@@ -13,9 +16,11 @@ import (
     "gorm.io/gorm"
 )
 
-// setupTestDB opens an in-memory sqlite DB and auto-migrates all models
+// setupTestDB opens an in-memory sqlite DB and auto-migrates all models.
+// Each test gets its own named in-memory DB so rows never leak between tests.
 func setupTestDB(t *testing.T) *gorm.DB {
-    db, err := gorm.Open(gsqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+    dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"))
+    db, err := gorm.Open(gsqlite.Open(dsn), &gorm.Config{})
     if err != nil {
         t.Fatalf("failed to open sqlite memory DB: %v", err)
     }
@@ -30,6 +35,9 @@ func setupTestDB(t *testing.T) *gorm.DB {
         &device.Device{},
         &device.VehicleDevice{},
         &alert.Alert{},
+        &ingest.PositionLog{},
+        &ingest.QuarantinedPosition{},
+        &ingest.DeadLetter{},
     ); err != nil {
         t.Fatalf("automigrate failed: %v", err)
     }
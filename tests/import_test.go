@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/ingest"
+	"github.com/username/fms-api/internal/vehicle"
+)
+
+func TestImportCSV_DedupesAndKeepsCurrentPosition(t *testing.T) {
+	db := setupTestDB(t)
+	dev, v := seedBoundDevice(t, db, "LEGACY", "API", "356307042441013", "API")
+
+	// posisi terkini sudah lebih baru dari seluruh isi file
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	if err := db.Create(&vehicle.VehicleCurrentPositionDB{VehicleID: v.ID, TS: now, Lat: 1, Lon: 1, UpdatedAt: now}).Error; err != nil {
+		t.Fatalf("failed to seed current position: %v", err)
+	}
+	// satu row sudah ada sebelumnya -> harus dihitung duplikat
+	existing := ingest.PositionLog{VehicleID: v.ID, DeviceID: dev.ID, TS: time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC), Lat: -6.2, Lon: 106.8}
+	if err := db.Create(&existing).Error; err != nil {
+		t.Fatalf("failed to seed position_log: %v", err)
+	}
+
+	csv := "imei,time,latitude,longitude,speed,ign\n" +
+		"356307042441013,2025-01-01T10:00:00Z,-6.2,106.8,10,1\n" +
+		"356307042441013,2025-01-01T10:01:00Z,-6.21,106.81,20,1\n" +
+		"356307042441013,2025-01-01T10:02:00Z,-6.22,106.82,0,0\n" +
+		"356307042441013,2025-01-01T10:02:00Z,-6.22,106.82,0,0\n" +
+		"356307042441013,,-6.22,106.82,0,0\n" +
+		"unknown-imei,2025-01-01T10:03:00Z,-6.23,106.83,0,0\n" +
+		"356307042441013,2025-01-01T10:04:00Z,abc,106.83,0,0\n"
+
+	report, err := ingest.NewService(db).Import(strings.NewReader(csv), ingest.ImportOptions{
+		Format:     ingest.ImportFormatCSV,
+		DataSource: "LEGACY",
+		Columns: map[string]string{
+			"deviceId": "imei", "ts": "time", "lat": "latitude", "lon": "longitude",
+			"speedKph": "speed", "ignitionOn": "ign",
+		},
+		BatchSize: 2,
+	})
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if report.Rows != 7 || report.Inserted != 2 || report.Duplicates != 2 || report.Failed != 3 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	wantLines := []int{6, 7, 8}
+	for i, e := range report.Errors {
+		if e.Line != wantLines[i] {
+			t.Fatalf("unexpected error line at %d: %+v", i, e)
+		}
+	}
+	if report.Errors[1].Error != "unknown_device" {
+		t.Fatalf("expected unknown_device error, got %+v", report.Errors[1])
+	}
+
+	var cnt int64
+	db.Model(&ingest.PositionLog{}).Where("device_id = ?", dev.ID).Count(&cnt)
+	if cnt != 3 {
+		t.Fatalf("expected 3 position_log rows, got %d", cnt)
+	}
+
+	var cur vehicle.VehicleCurrentPositionDB
+	db.Where("vehicle_id = ?", v.ID).First(&cur)
+	if !cur.TS.Equal(now) || cur.Lat != 1 {
+		t.Fatalf("current position must not move backwards, got %+v", cur)
+	}
+}
+
+func TestImportPositions_NDJSONUpload(t *testing.T) {
+	db := setupTestDB(t)
+	dev, v := seedBoundDevice(t, db, "LEGACY2", "API", "veh-9", "API")
+
+	h := ingest.NewHandler(db)
+	router := gin.New()
+	cu := auth.CurrentUser{ID: 1, UserType: auth.UserTypeSuperAdmin}
+	router.POST("/ingest/import", func(c *gin.Context) { c.Set(auth.ContextUserKey, cu); h.ImportPositions(c) })
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("file", "history.ndjson")
+	fw.Write([]byte(`{"device_id":` + strconv.FormatInt(dev.ID, 10) + `,"ts":1735725600,"lat":-6.2,"lon":106.8}` + "\n" +
+		"\n" +
+		`not json` + "\n" +
+		`{"device_id":` + strconv.FormatInt(dev.ID, 10) + `,"ts":"2025-01-01T10:01:00Z","lat":-6.21,"lon":106.81,"ignition_on":true}` + "\n"))
+	mw.Close()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/ingest/import", body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body: %s", w.Code, w.Body.String())
+	}
+
+	var report ingest.ImportReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if report.Inserted != 2 || report.Failed != 1 || report.Errors[0].Line != 3 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	// belum ada posisi terkini -> diisi dengan fix terbaru dari file
+	var cur vehicle.VehicleCurrentPositionDB
+	if err := db.Where("vehicle_id = ?", v.ID).First(&cur).Error; err != nil {
+		t.Fatalf("expected current position: %v", err)
+	}
+	if cur.Lat != -6.21 || cur.IgnitionOn == nil || !*cur.IgnitionOn {
+		t.Fatalf("unexpected current position: %+v", cur)
+	}
+}
+
+func TestImportCSV_UsesEnvConfiguredFilters(t *testing.T) {
+	db := setupTestDB(t)
+	dev, _ := seedBoundDevice(t, db, "LEGACY-ENV", "API", "356307042441099", "API")
+	t.Setenv("INGEST_MAX_SPEED_KPH", "50")
+
+	// service fmsctl dibangun dari env yang sama dengan API
+	svc := ingest.NewServiceFromEnv(db)
+	if svc.Quality == nil || svc.Quality.Config.MaxSpeedKph != 50 || svc.ClockSkew == nil {
+		t.Fatalf("expected env-configured filters, got %+v", svc)
+	}
+
+	csv := "imei,time,latitude,longitude,speed\n" +
+		"356307042441099,2025-01-01T10:00:00Z,-6.2,106.8,40\n" +
+		"356307042441099,2025-01-01T10:01:00Z,-6.201,106.801,80\n"
+	report, err := svc.Import(strings.NewReader(csv), ingest.ImportOptions{
+		Format:     ingest.ImportFormatCSV,
+		DataSource: "LEGACY-ENV",
+		Columns:    map[string]string{"deviceId": "imei", "ts": "time", "lat": "latitude", "lon": "longitude", "speedKph": "speed"},
+	})
+	if err != nil || report.Inserted != 2 {
+		t.Fatalf("import: %+v, %v", report, err)
+	}
+	var flagged int64
+	db.Model(&ingest.PositionLog{}).Where("device_id = ? AND quality = ?", dev.ID, ingest.QualitySpeedSpike).Count(&flagged)
+	if flagged != 1 {
+		t.Fatalf("expected the 80 km/h row flagged by INGEST_MAX_SPEED_KPH, got %d", flagged)
+	}
+}
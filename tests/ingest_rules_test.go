@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/ingest"
+	"github.com/username/fms-api/internal/vehicle"
+)
+
+func TestStore_LateDuplicateAndFutureFixes(t *testing.T) {
+	db := setupTestDB(t)
+	dev, v := seedBoundDevice(t, db, "RULES", "API", "rules-1", "API")
+
+	svc := ingest.NewService(db)
+	svc.MaxFutureSkew = time.Minute
+	target := &ingest.Target{Device: dev, VehicleID: v.ID}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	latest := ingest.Fix{TS: now.Add(-time.Minute), Lat: -6.2, Lon: 106.8}
+	if res, err := svc.Store(target, []ingest.Fix{latest}); err != nil || res.Inserted != 1 {
+		t.Fatalf("store latest: %+v, %v", res, err)
+	}
+
+	// device menyusulkan buffer lama: masuk position_log tapi posisi terkini tidak mundur
+	old := ingest.Fix{TS: now.Add(-time.Hour), Lat: -7, Lon: 107}
+	res, err := svc.Store(target, []ingest.Fix{old, latest})
+	if err != nil {
+		t.Fatalf("store old: %v", err)
+	}
+	if res.Inserted != 1 || res.Late != 1 || res.Duplicates != 1 {
+		t.Fatalf("unexpected result for late replay: %+v", res)
+	}
+
+	var cur vehicle.VehicleCurrentPositionDB
+	db.Where("vehicle_id = ?", v.ID).First(&cur)
+	if !cur.TS.Equal(latest.TS) || cur.Lat != latest.Lat {
+		t.Fatalf("current position moved backwards: %+v", cur)
+	}
+
+	// jam device 1 jam lebih cepat -> dikarantina
+	future := ingest.Fix{TS: now.Add(time.Hour), Lat: -6.3, Lon: 106.9}
+	res, err = svc.Store(target, []ingest.Fix{future})
+	if err != nil || res.Quarantined != 1 || res.Inserted != 0 {
+		t.Fatalf("expected future fix to be quarantined: %+v, %v", res, err)
+	}
+
+	var cnt int64
+	db.Model(&ingest.PositionLog{}).Where("device_id = ?", dev.ID).Count(&cnt)
+	if cnt != 2 {
+		t.Fatalf("expected 2 position_log rows, got %d", cnt)
+	}
+	db.Where("vehicle_id = ?", v.ID).First(&cur)
+	if !cur.TS.Equal(latest.TS) {
+		t.Fatalf("quarantined fix must not touch current position: %+v", cur)
+	}
+
+	h := ingest.NewHandler(db)
+	router := gin.New()
+	cu := auth.CurrentUser{ID: 1, UserType: auth.UserTypeSuperAdmin}
+	router.GET("/ingest/quarantine", func(c *gin.Context) { c.Set(auth.ContextUserKey, cu); h.ListQuarantine(c) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ingest/quarantine?reason=FUTURE_TS", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Data []ingest.QuarantinedPosition `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if len(body.Data) != 1 || body.Data[0].DeviceID != dev.ID || !body.Data[0].TS.Equal(future.TS) {
+		t.Fatalf("unexpected quarantine list: %+v", body.Data)
+	}
+
+	// skew negatif mematikan karantina
+	svc.MaxFutureSkew = -1
+	res, err = svc.Store(target, []ingest.Fix{future})
+	if err != nil || res.Inserted != 1 {
+		t.Fatalf("expected future fix to be stored when quarantine disabled: %+v, %v", res, err)
+	}
+}
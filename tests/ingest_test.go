@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/device"
+	"github.com/username/fms-api/internal/ingest"
+	orgModel "github.com/username/fms-api/internal/organization"
+	"github.com/username/fms-api/internal/vehicle"
+)
+
+// seedBoundDevice membuat org, kendaraan, data source, device dan mapping aktif di antaranya
+func seedBoundDevice(t *testing.T, db *gorm.DB, dsCode, dsType, externalID, protocol string) (device.Device, vehicle.Vehicle) {
+	t.Helper()
+
+	org := orgModel.Organization{Name: "Org " + externalID, Active: true}
+	if err := db.Create(&org).Error; err != nil {
+		t.Fatalf("failed to create org: %v", err)
+	}
+	v := vehicle.Vehicle{OrganizationID: org.ID, PlateNumber: "B " + externalID, VIN: "VIN-" + externalID, Active: true}
+	if err := db.Create(&v).Error; err != nil {
+		t.Fatalf("failed to create vehicle: %v", err)
+	}
+	ds := device.DataSource{Name: dsCode, Code: dsCode, Type: dsType}
+	if err := db.Create(&ds).Error; err != nil {
+		t.Fatalf("failed to create data source: %v", err)
+	}
+	dev := device.Device{DataSourceID: ds.ID, ExternalID: externalID, Protocol: protocol, Active: true}
+	if err := db.Create(&dev).Error; err != nil {
+		t.Fatalf("failed to create device: %v", err)
+	}
+	mapping := device.VehicleDevice{VehicleID: v.ID, DeviceID: dev.ID, Active: true, AssignedAt: time.Now()}
+	if err := db.Create(&mapping).Error; err != nil {
+		t.Fatalf("failed to create mapping: %v", err)
+	}
+	return dev, v
+}
+
+func TestIngestPositions_InsertDuplicateAndUnknown(t *testing.T) {
+	db := setupTestDB(t)
+	dev, v := seedBoundDevice(t, db, "HTTP-IN", "API", "http-dev-1", "HTTP")
+
+	h := ingest.NewHandler(db)
+	router := gin.New()
+	cu := auth.CurrentUser{ID: 1, UserType: auth.UserTypeSuperAdmin}
+	router.POST("/ingest/positions", func(c *gin.Context) { c.Set(auth.ContextUserKey, cu); h.IngestPositions(c) })
+
+	lat1, lon1 := -6.2, 106.8
+	lat2, lon2 := -6.21, 106.81
+	t1 := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	t2 := t1.Add(30 * time.Second)
+
+	post := func(body ingest.IngestPositionsRequest) ingest.IngestPositionsResponse {
+		b, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/ingest/positions", bytes.NewReader(b))
+		r.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d, body: %s", w.Code, w.Body.String())
+		}
+		var resp ingest.IngestPositionsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	resp := post(ingest.IngestPositionsRequest{Positions: []ingest.PositionRequest{
+		{DataSource: "HTTP-IN", ExternalID: "http-dev-1", TS: t1.Format(time.RFC3339), Lat: &lat1, Lon: &lon1},
+		{DataSource: "HTTP-IN", ExternalID: "http-dev-1", TS: t2.Format(time.RFC3339), Lat: &lat2, Lon: &lon2},
+		{DataSource: "HTTP-IN", ExternalID: "nope", TS: t2.Format(time.RFC3339), Lat: &lat2, Lon: &lon2},
+		{DataSource: "HTTP-IN", ExternalID: "http-dev-1", TS: "bad", Lat: &lat2, Lon: &lon2},
+	}})
+	if resp.Inserted != 2 || resp.Duplicates != 0 || len(resp.Rejected) != 2 {
+		t.Fatalf("unexpected result: %+v", resp)
+	}
+
+	// kirim ulang fix yang sama -> dihitung duplikat
+	resp = post(ingest.IngestPositionsRequest{Positions: []ingest.PositionRequest{
+		{DataSource: "HTTP-IN", ExternalID: "http-dev-1", TS: t1.Format(time.RFC3339), Lat: &lat1, Lon: &lon1},
+	}})
+	if resp.Inserted != 0 || resp.Duplicates != 1 {
+		t.Fatalf("expected duplicate, got %+v", resp)
+	}
+
+	var cnt int64
+	db.Model(&ingest.PositionLog{}).Where("device_id = ?", dev.ID).Count(&cnt)
+	if cnt != 2 {
+		t.Fatalf("expected 2 position_log rows, got %d", cnt)
+	}
+
+	var cur vehicle.VehicleCurrentPositionDB
+	if err := db.Where("vehicle_id = ?", v.ID).First(&cur).Error; err != nil {
+		t.Fatalf("expected current position: %v", err)
+	}
+	if !cur.TS.Equal(t2) || cur.Lat != lat2 {
+		t.Fatalf("expected current position at latest fix, got %+v", cur)
+	}
+}
@@ -0,0 +1,184 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/device"
+	"github.com/username/fms-api/internal/ingest"
+)
+
+func TestMQTTConfig_TopicAndFieldMapping(t *testing.T) {
+	ds := device.DataSource{Code: "GW1", Type: "MQTT", Config: map[string]interface{}{
+		"fieldMapping": map[string]interface{}{"lat": "gps.la", "lon": "gps.lo", "speedKph": "spd", "ts": "time"},
+		"speedUnit":    "mps",
+	}}
+	cfg, err := ingest.ParseMQTTConfig(ds)
+	if err != nil {
+		t.Fatalf("parse config failed: %v", err)
+	}
+	if got := cfg.SubscribeTopic("GW1"); got != "fleet/GW1/+/position" {
+		t.Fatalf("unexpected subscribe topic %s", got)
+	}
+
+	code, ext, ok := cfg.MatchTopic("fleet/GW1/dev-9/position")
+	if !ok || code != "GW1" || ext != "dev-9" {
+		t.Fatalf("unexpected topic match: %s %s %v", code, ext, ok)
+	}
+	if _, _, ok := cfg.MatchTopic("fleet/GW1/dev-9/status"); ok {
+		t.Fatalf("status topic must not match")
+	}
+
+	fix, err := cfg.DecodePayload([]byte(`{"gps":{"la":-6.2,"lo":"106.8"},"spd":10,"time":1735725600000,"ignition":1}`))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if fix.Lat != -6.2 || fix.Lon != 106.8 || fix.TS.Unix() != 1735725600 {
+		t.Fatalf("unexpected fix: %+v", fix)
+	}
+	if fix.SpeedKph == nil || *fix.SpeedKph != 36 || fix.IgnitionOn == nil || !*fix.IgnitionOn {
+		t.Fatalf("unexpected speed/ignition: %v %v", fix.SpeedKph, fix.IgnitionOn)
+	}
+
+	if _, err := cfg.DecodePayload([]byte(`{"gps":{}}`)); err == nil {
+		t.Fatalf("expected error for payload without coordinates")
+	}
+}
+
+func TestMQTTSubscriber_HandleMessage(t *testing.T) {
+	db := setupTestDB(t)
+	dev, _ := seedBoundDevice(t, db, "GW2", "MQTT", "truck-7", "MQTT")
+
+	var ds device.DataSource
+	db.First(&ds, dev.DataSourceID)
+	sub, err := ingest.NewMQTTSubscriber(ds, ingest.NewService(db))
+	if err != nil {
+		t.Fatalf("new subscriber failed: %v", err)
+	}
+
+	if err := sub.HandleMessage("fleet/GW2/truck-7/position", []byte(`{"lat":-6.2,"lon":106.8,"ts":"2025-01-01T10:00:00Z"}`)); err != nil {
+		t.Fatalf("handle message failed: %v", err)
+	}
+	if err := sub.HandleMessage("fleet/OTHER/truck-7/position", []byte(`{"lat":-6.2,"lon":106.8}`)); err == nil {
+		t.Fatalf("expected error for topic of another data source")
+	}
+	if err := sub.HandleMessage("fleet/GW2/unknown/position", []byte(`{"lat":-6.2,"lon":106.8}`)); err != ingest.ErrUnknownDevice {
+		t.Fatalf("expected unknown device, got %v", err)
+	}
+
+	var cnt int64
+	db.Model(&ingest.PositionLog{}).Where("device_id = ?", dev.ID).Count(&cnt)
+	if cnt != 1 {
+		t.Fatalf("expected 1 position_log row, got %d", cnt)
+	}
+}
+
+func TestBackoff_GrowsAndCaps(t *testing.T) {
+	b := ingest.Backoff{Min: time.Second, Max: 5 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := b.Next(); got != w {
+			t.Fatalf("step %d: expected %s, got %s", i, w, got)
+		}
+	}
+	b.Reset()
+	if got := b.Next(); got != time.Second {
+		t.Fatalf("expected reset to min, got %s", got)
+	}
+}
+
+// allowAllHook izinkan semua client & topic (default broker = tolak semua)
+type allowAllHook struct {
+	mochi.HookBase
+}
+
+func (h *allowAllHook) ID() string { return "allow-all" }
+
+func (h *allowAllHook) Provides(b byte) bool {
+	return b == mochi.OnConnectAuthenticate || b == mochi.OnACLCheck
+}
+
+func (h *allowAllHook) OnConnectAuthenticate(*mochi.Client, packets.Packet) bool { return true }
+
+func (h *allowAllHook) OnACLCheck(*mochi.Client, string, bool) bool { return true }
+
+// startBroker broker MQTT in-process di addr (127.0.0.1:0 = port acak)
+func startBroker(t *testing.T, addr string) (*mochi.Server, string) {
+	t.Helper()
+	server := mochi.New(&mochi.Options{InlineClient: true, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err := server.AddHook(new(allowAllHook), nil); err != nil {
+		t.Fatalf("add hook: %v", err)
+	}
+	tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: addr})
+	if err := server.AddListener(tcp); err != nil {
+		t.Fatalf("listen broker: %v", err)
+	}
+	go server.Serve()
+	return server, tcp.Address()
+}
+
+// publishUntil kirim pesan berulang sampai position_log device berisi want row
+// (subscriber butuh waktu untuk connect / reconnect & subscribe)
+func publishUntil(t *testing.T, db *gorm.DB, server *mochi.Server, topic, payload string, deviceID int64, want int64) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		server.Publish(topic, []byte(payload), false, 0)
+		var cnt int64
+		db.Model(&ingest.PositionLog{}).Where("device_id = ?", deviceID).Count(&cnt)
+		if cnt >= want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %d position_log rows, got %d", want, cnt)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestMQTTSubscriber_RunAgainstLocalBroker(t *testing.T) {
+	db := setupTestDB(t)
+	dev, _ := seedBoundDevice(t, db, "GW3", "MQTT", "truck-9", "MQTT")
+
+	server, addr := startBroker(t, "127.0.0.1:0")
+	db.Model(&device.DataSource{}).Where("id = ?", dev.DataSourceID).
+		Update("config", fmt.Sprintf(`{"brokerUrl":"tcp://%s","clientId":"fms-test"}`, addr))
+	var ds device.DataSource
+	db.First(&ds, dev.DataSourceID)
+	sub, err := ingest.NewMQTTSubscriber(ds, ingest.NewService(db))
+	if err != nil {
+		t.Fatalf("new subscriber failed: %v", err)
+	}
+	sub.Backoff = ingest.Backoff{Min: 50 * time.Millisecond, Max: 200 * time.Millisecond}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		sub.Run(stop)
+		close(done)
+	}()
+
+	topic := "fleet/GW3/truck-9/position"
+	publishUntil(t, db, server, topic, `{"lat":-6.2,"lon":106.8,"ts":"2025-01-01T10:00:00Z"}`, dev.ID, 1)
+
+	// broker mati lalu hidup lagi di alamat yang sama: subscriber reconnect dengan backoff
+	server.Close()
+	server, _ = startBroker(t, addr)
+	defer server.Close()
+	publishUntil(t, db, server, topic, `{"lat":-6.21,"lon":106.81,"ts":"2025-01-01T10:01:00Z"}`, dev.ID, 2)
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Run did not return after stop")
+	}
+}
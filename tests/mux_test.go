@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/username/fms-api/internal/device"
+	"github.com/username/fms-api/internal/ingest"
+)
+
+func muxConn(t *testing.T, srv *ingest.MuxServer) net.Conn {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	go srv.HandleConn(server)
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	return client
+}
+
+func TestMuxServer_RoutesTeltonikaGT06AndOsmAnd(t *testing.T) {
+	db := setupTestDB(t)
+	telto, _ := seedBoundDevice(t, db, "MUX-TELTO", "DEVICE", "356307042441013", ingest.ProtocolTeltonika)
+	gt06, _ := seedBoundDevice(t, db, "MUX-GT06", ingest.ProtocolGT06, "123456789012345", "")
+	osm, _ := seedBoundDevice(t, db, "MUX-OSM", "DEVICE", "osm-mux-1", ingest.ProtocolOsmAnd)
+	srv := ingest.NewMuxServer("", ingest.NewService(db))
+
+	// Teltonika: handshake IMEI lalu AVL packet
+	c := muxConn(t, srv)
+	imei := "356307042441013"
+	hs := make([]byte, 2+len(imei))
+	binary.BigEndian.PutUint16(hs, uint16(len(imei)))
+	copy(hs[2:], imei)
+	c.Write(hs)
+	var accept [1]byte
+	if _, err := io.ReadFull(c, accept[:]); err != nil || accept[0] != 0x01 {
+		t.Fatalf("expected teltonika IMEI accepted, got %v (%v)", accept, err)
+	}
+	c.Write(mustHex(t, teltonikaCodec8EHex))
+	var ack [4]byte
+	if _, err := io.ReadFull(c, ack[:]); err != nil || binary.BigEndian.Uint32(ack[:]) != 1 {
+		t.Fatalf("expected teltonika ack, got %v (%v)", ack, err)
+	}
+
+	// GT06: login lalu lokasi
+	c = muxConn(t, srv)
+	c.Write(mustHex(t, gt06LoginHex))
+	resp := make([]byte, 10)
+	if _, err := io.ReadFull(c, resp); err != nil || resp[3] != ingest.GT06Login {
+		t.Fatalf("expected gt06 login response, got %x (%v)", resp, err)
+	}
+	c.Write(mustHex(t, gt06LocationHex))
+
+	// OsmAnd lewat HTTP di port yang sama
+	c = muxConn(t, srv)
+	c.Write([]byte("GET /?id=osm-mux-1&lat=-6.2&lon=106.8&timestamp=1735725600 HTTP/1.1\r\nHost: x\r\n\r\n"))
+	httpResp, err := http.ReadResponse(bufio.NewReader(c), nil)
+	if err != nil || httpResp.StatusCode != http.StatusOK {
+		t.Fatalf("expected osmand 200, got %v (%v)", httpResp, err)
+	}
+
+	for _, dev := range []device.Device{telto, gt06, osm} {
+		waitFor(t, func() bool {
+			var n int64
+			db.Model(&ingest.PositionLog{}).Where("device_id = ?", dev.ID).Count(&n)
+			return n == 1
+		})
+	}
+}
+
+func TestMuxServer_ProtocolMismatchAndUnknown(t *testing.T) {
+	db := setupTestDB(t)
+	// terdaftar sebagai GT06 tapi mengirim handshake Teltonika
+	seedBoundDevice(t, db, "MUX-MIS", ingest.ProtocolGT06, "356307042441013", ingest.ProtocolGT06)
+	srv := ingest.NewMuxServer("", ingest.NewService(db))
+
+	c := muxConn(t, srv)
+	imei := "356307042441013"
+	c.Write(append([]byte{0x00, byte(len(imei))}, imei...))
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected connection closed on protocol mismatch, got %v", err)
+	}
+
+	// handshake biner tidak dikenal
+	c = muxConn(t, srv)
+	go c.Write([]byte{0xDE, 0xAD, 0xBE, 0xEF})
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected connection closed on unknown handshake, got %v", err)
+	}
+
+	// protokol teks bukan HTTP
+	c = muxConn(t, srv)
+	go c.Write([]byte("##,imei:359586015829802,A;\n"))
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected connection closed on unknown text protocol, got %v", err)
+	}
+}
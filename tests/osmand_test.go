@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/username/fms-api/internal/device"
+	"github.com/username/fms-api/internal/ingest"
+)
+
+func TestOsmAnd_StoreAndRejectUnknownOrInactive(t *testing.T) {
+	db := setupTestDB(t)
+	dev, _ := seedBoundDevice(t, db, "PHONES", "API", "phone-1", ingest.ProtocolOsmAnd)
+
+	h := ingest.NewHandler(db)
+	router := gin.New()
+	h.RegisterOsmAndRoutes(router.Group("/osmand"))
+
+	get := func(query string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/osmand?"+query, nil)
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := get("id=phone-1&lat=-6.2&lon=106.8&timestamp=1735725600&speed=10"); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	var pos ingest.PositionLog
+	if err := db.Where("device_id = ?", dev.ID).First(&pos).Error; err != nil {
+		t.Fatalf("expected stored position: %v", err)
+	}
+	if pos.TS.Unix() != 1735725600 || pos.SpeedKph == nil || *pos.SpeedKph != 18.52 {
+		t.Fatalf("unexpected position: ts=%v speed=%v", pos.TS, pos.SpeedKph)
+	}
+
+	if code := get("id=ghost&lat=-6.2&lon=106.8"); code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for unknown device, got %d", code)
+	}
+	if code := get("id=phone-1&lat=abc&lon=106.8"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid lat, got %d", code)
+	}
+
+	db.Model(&device.Device{}).Where("id = ?", dev.ID).Update("active", false)
+	if code := get("id=phone-1&lat=-6.2&lon=106.8&timestamp=1735725660"); code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for inactive device, got %d", code)
+	}
+}
@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/username/fms-api/internal/ingest"
+	"github.com/username/fms-api/internal/vehicle"
+)
+
+func TestPipeline_BatchesAndCoalescesCurrentPosition(t *testing.T) {
+	db := setupTestDB(t)
+	devA, vA := seedBoundDevice(t, db, "PIPE-A", "API", "pipe-a", "API")
+	devB, vB := seedBoundDevice(t, db, "PIPE-B", "API", "pipe-b", "API")
+
+	svc := ingest.NewService(db)
+	p := ingest.NewPipeline(svc, ingest.PipelineConfig{Workers: 2, QueueSize: 8, BatchSize: 1000, FlushInterval: 20 * time.Millisecond})
+	svc.Pipeline = p
+
+	targetA := &ingest.Target{Device: devA, VehicleID: vA.ID}
+	targetB := &ingest.Target{Device: devB, VehicleID: vB.ID}
+	base := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	var wg sync.WaitGroup
+	results := make([]ingest.Result, 20)
+	errs := make([]error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			target := targetA
+			if i%2 == 1 {
+				target = targetB
+			}
+			fix := ingest.Fix{TS: base.Add(time.Duration(i) * time.Second), Lat: -6 - float64(i)/100, Lon: 106}
+			results[i], errs[i] = svc.Store(target, []ingest.Fix{fix})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil || results[i].Inserted != 1 {
+			t.Fatalf("store %d: result %+v, err %v", i, results[i], err)
+		}
+	}
+
+	// fix yang sama dua kali dalam satu panggilan: satu tersimpan, satu duplikat
+	dup := ingest.Fix{TS: base.Add(time.Hour), Lat: -7, Lon: 107}
+	res, err := svc.Store(targetA, []ingest.Fix{dup, dup, {TS: base, Lat: -6, Lon: 106}})
+	if err != nil || res.Inserted != 1 || res.Duplicates != 2 {
+		t.Fatalf("unexpected duplicate handling: %+v, err %v", res, err)
+	}
+
+	var cnt int64
+	db.Model(&ingest.PositionLog{}).Count(&cnt)
+	if cnt != 21 {
+		t.Fatalf("expected 21 position_log rows, got %d", cnt)
+	}
+
+	var curA, curB vehicle.VehicleCurrentPositionDB
+	db.Where("vehicle_id = ?", vA.ID).First(&curA)
+	db.Where("vehicle_id = ?", vB.ID).First(&curB)
+	if !curA.TS.Equal(base.Add(time.Hour)) || !curB.TS.Equal(base.Add(19*time.Second)) {
+		t.Fatalf("current position must hold the latest fix: A=%v B=%v", curA.TS, curB.TS)
+	}
+
+	stats := p.Stats()
+	if stats.Inserted != 21 || stats.Duplicates != 2 || stats.QueueCapacity != 16 || stats.Batches == 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	p.Close()
+	if p.QueueDepth() != 0 {
+		t.Fatalf("queue must be drained after close, depth %d", p.QueueDepth())
+	}
+	if _, err := svc.Store(targetA, []ingest.Fix{{TS: base.Add(2 * time.Hour), Lat: -6, Lon: 106}}); err != ingest.ErrPipelineClosed {
+		t.Fatalf("expected ErrPipelineClosed after close, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+
+	"github.com/username/fms-api/internal/alert"
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/device"
+	"github.com/username/fms-api/internal/ingest"
+)
+
+func TestPresence_LastSeenOfflineAlertAndFilters(t *testing.T) {
+	db := setupTestDB(t)
+	if err := db.AutoMigrate(&alert.AlertType{}); err != nil {
+		t.Fatalf("automigrate failed: %v", err)
+	}
+	db.Create(&alert.AlertType{Code: ingest.AlertDeviceOffline, Name: "Device Offline", DefaultSeverity: "MEDIUM"})
+
+	devA, vA := seedBoundDevice(t, db, "PRES-A", "API", "pres-a", ingest.ProtocolOsmAnd)
+	devB, _ := seedBoundDevice(t, db, "PRES-B", "API", "pres-b", ingest.ProtocolOsmAnd)
+	// device B boleh diam 2 jam
+	db.Model(&device.Device{}).Where("id = ?", devB.ID).Update("metadata", datatypes.JSONMap{"offlineAfterSeconds": 7200})
+
+	svc := ingest.NewService(db)
+	fixTS := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+	raw := map[string]interface{}{"protocol": ingest.ProtocolOsmAnd}
+	for _, dev := range []device.Device{devA, devB} {
+		target, err := svc.ResolveByProtocol(ingest.ProtocolOsmAnd, dev.ExternalID)
+		if err != nil {
+			t.Fatalf("resolve: %v", err)
+		}
+		fixes := []ingest.Fix{{TS: fixTS, Lat: -6.2, Lon: 106.8, Raw: raw}, {TS: fixTS.Add(-time.Hour), Lat: -6.3, Lon: 106.9, Raw: raw}}
+		if _, err := svc.Store(target, fixes); err != nil {
+			t.Fatalf("store: %v", err)
+		}
+	}
+
+	var got device.Device
+	db.First(&got, devA.ID)
+	if !got.Online || got.LastSeenAt == nil || got.LastFixAt == nil || !got.LastFixAt.Equal(fixTS) ||
+		got.LastSource == nil || *got.LastSource != ingest.ProtocolOsmAnd {
+		t.Fatalf("unexpected presence after store: %+v", got)
+	}
+
+	checker := ingest.NewOfflineChecker(db, 30*time.Minute)
+	later := time.Now().UTC().Add(31 * time.Minute)
+	if n, err := checker.CheckOnce(later); err != nil || n != 1 {
+		t.Fatalf("expected 1 device marked offline, got %d, %v", n, err)
+	}
+	if n, _ := checker.CheckOnce(later); n != 0 {
+		t.Fatalf("offline device must not be marked twice, got %d", n)
+	}
+
+	var alerts []alert.Alert
+	db.Where("vehicle_id = ? AND status = ?", vA.ID, "ACTIVE").Find(&alerts)
+	if len(alerts) != 1 || alerts[0].DeviceID == nil || *alerts[0].DeviceID != devA.ID {
+		t.Fatalf("expected 1 DEVICE_OFFLINE alert for vehicle A, got %+v", alerts)
+	}
+
+	h := device.NewHandler(db)
+	router := gin.New()
+	cu := auth.CurrentUser{ID: 1, UserType: auth.UserTypeSuperAdmin}
+	router.GET("/devices", func(c *gin.Context) { c.Set(auth.ContextUserKey, cu); h.ListDevices(c) })
+	list := func(query string) []device.Device {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/devices?"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("list %s: expected 200, got %d: %s", query, w.Code, w.Body.String())
+		}
+		var body struct {
+			Data []device.Device `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return body.Data
+	}
+	if d := list("online=false"); len(d) != 1 || d[0].ID != devA.ID {
+		t.Fatalf("expected only device A offline, got %+v", d)
+	}
+	if d := list("online=true"); len(d) != 1 || d[0].ID != devB.ID {
+		t.Fatalf("expected only device B online, got %+v", d)
+	}
+	if d := list("silentSince=1h"); len(d) != 0 {
+		t.Fatalf("no device has been silent for 1h yet, got %+v", d)
+	}
+	future := time.Now().UTC().Add(time.Minute).Format(time.RFC3339)
+	if d := list("silentSince=" + future); len(d) != 2 {
+		t.Fatalf("expected both devices silent since %s, got %+v", future, d)
+	}
+
+	// heartbeat membuat device online lagi dan alert offline di-clear
+	if err := svc.Seen(devA.ID, ingest.ProtocolGT06); err != nil {
+		t.Fatalf("seen: %v", err)
+	}
+	db.First(&got, devA.ID)
+	if !got.Online || *got.LastSource != ingest.ProtocolGT06 || !got.LastFixAt.Equal(fixTS) {
+		t.Fatalf("unexpected presence after heartbeat: %+v", got)
+	}
+	var active int64
+	db.Model(&alert.Alert{}).Where("vehicle_id = ? AND status = ?", vA.ID, "ACTIVE").Count(&active)
+	if active != 0 {
+		t.Fatalf("offline alert must be cleared when device comes back")
+	}
+}
@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/username/fms-api/internal/ingest"
+	"github.com/username/fms-api/internal/vehicle"
+)
+
+func TestQualityFilter_FlagsBadFixes(t *testing.T) {
+	db := setupTestDB(t)
+	dev, v := seedBoundDevice(t, db, "QUALITY", "API", "quality-1", "API")
+
+	svc := ingest.NewService(db)
+	svc.Quality = ingest.NewQualityFilter(ingest.DefaultQualityConfig())
+	target := &ingest.Target{Device: dev, VehicleID: v.ID}
+
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	speed := func(v float64) *float64 { return &v }
+	fixes := []ingest.Fix{
+		{TS: base, Lat: -6.2000, Lon: 106.8000, SpeedKph: speed(40)},
+		// (0,0) dari tracker yang belum dapat sinyal
+		{TS: base.Add(10 * time.Second), Lat: 0, Lon: 0},
+		// lompat ~110 km dalam 10 detik
+		{TS: base.Add(20 * time.Second), Lat: -7.2000, Lon: 106.8000, SpeedKph: speed(40)},
+		// HDOP terlalu besar
+		{TS: base.Add(30 * time.Second), Lat: -6.2010, Lon: 106.8000, Raw: map[string]interface{}{"hdop": 12.5}},
+		// kecepatan dilaporkan 400 km/h
+		{TS: base.Add(40 * time.Second), Lat: -6.2020, Lon: 106.8000, SpeedKph: speed(400)},
+		{TS: base.Add(50 * time.Second), Lat: -6.2030, Lon: 106.8000, SpeedKph: speed(30)},
+		// parkir, koordinat bergeser ~10 m
+		{TS: base.Add(60 * time.Second), Lat: -6.20309, Lon: 106.8000, SpeedKph: speed(0)},
+	}
+
+	res, err := svc.Store(target, fixes)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if res.Inserted != 7 || res.Flagged != 5 || res.Dropped != 0 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	var rows []ingest.PositionLog
+	db.Where("device_id = ?", dev.ID).Order("ts ASC").Find(&rows)
+	want := []string{
+		ingest.QualityGood, ingest.QualityInvalidCoord, ingest.QualitySpeedSpike, ingest.QualityLowAccuracy,
+		ingest.QualitySpeedSpike, ingest.QualityGood, ingest.QualityDrift,
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("expected %d rows, got %d", len(want), len(rows))
+	}
+	for i, r := range rows {
+		if r.Quality != want[i] {
+			t.Errorf("row %d (%v): expected %s, got %s", i, r.TS, want[i], r.Quality)
+		}
+	}
+
+	// posisi terkini hanya dari fix GOOD
+	var cur vehicle.VehicleCurrentPositionDB
+	db.Where("vehicle_id = ?", v.ID).First(&cur)
+	if !cur.TS.Equal(base.Add(50 * time.Second)) {
+		t.Fatalf("current position must come from the last GOOD fix, got %v", cur.TS)
+	}
+
+	// batch berikutnya membandingkan dengan fix GOOD terakhir, bukan dengan spike
+	res, err = svc.Store(target, []ingest.Fix{{TS: base.Add(70 * time.Second), Lat: -6.2050, Lon: 106.8000, SpeedKph: speed(30)}})
+	if err != nil || res.Inserted != 1 || res.Flagged != 0 {
+		t.Fatalf("expected next fix to be GOOD: %+v, %v", res, err)
+	}
+}
+
+func TestQualityFilter_DropConfig(t *testing.T) {
+	db := setupTestDB(t)
+	dev, v := seedBoundDevice(t, db, "QUALITY-DROP", "API", "quality-2", "API")
+
+	cfg := ingest.DefaultQualityConfig()
+	cfg.Drop = []string{ingest.QualityInvalidCoord}
+	svc := ingest.NewService(db)
+	svc.Quality = ingest.NewQualityFilter(cfg)
+	target := &ingest.Target{Device: dev, VehicleID: v.ID}
+
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	res, err := svc.Store(target, []ingest.Fix{
+		{TS: base, Lat: 0, Lon: 0},
+		{TS: base.Add(time.Second), Lat: 95, Lon: 106.8},
+		{TS: base.Add(2 * time.Second), Lat: -6.2, Lon: 106.8, Raw: map[string]interface{}{"payload": map[string]interface{}{"satellites": 2}}},
+	})
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if res.Dropped != 2 || res.Inserted != 1 || res.Flagged != 1 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	var cnt int64
+	db.Model(&ingest.PositionLog{}).Where("device_id = ?", dev.ID).Count(&cnt)
+	if cnt != 1 {
+		t.Fatalf("dropped fixes must not be stored, got %d rows", cnt)
+	}
+	var cur int64
+	db.Model(&vehicle.VehicleCurrentPositionDB{}).Where("vehicle_id = ?", v.ID).Count(&cur)
+	if cur != 0 {
+		t.Fatalf("low accuracy fix must not create current position")
+	}
+}
+
+func TestQualityFilter_ReanchorAfterBadFirstFixAndCreeping(t *testing.T) {
+	db := setupTestDB(t)
+	dev, v := seedBoundDevice(t, db, "QUALITY-ANCHOR", "API", "quality-3", "API")
+	target := &ingest.Target{Device: dev, VehicleID: v.ID}
+	newService := func() *ingest.Service {
+		svc := ingest.NewService(db)
+		svc.Quality = ingest.NewQualityFilter(ingest.DefaultQualityConfig())
+		return svc
+	}
+	svc := newService()
+
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	speed := func(v float64) *float64 { return &v }
+	on := true
+	store := func(svc *ingest.Service, step int, lat float64, kph float64) string {
+		t.Helper()
+		ts := base.Add(time.Duration(step) * 10 * time.Second)
+		if _, err := svc.Store(target, []ingest.Fix{{TS: ts, Lat: lat, Lon: 106.8, SpeedKph: speed(kph), IgnitionOn: &on}}); err != nil {
+			t.Fatalf("store: %v", err)
+		}
+		var row ingest.PositionLog
+		db.Where("device_id = ? AND ts = ?", dev.ID, ts).First(&row)
+		return row.Quality
+	}
+
+	// fix pertama setelah cold start meleset ~110 km tapi tidak punya pembanding
+	if q := store(svc, 0, -7.2, 20); q != ingest.QualityGood {
+		t.Fatalf("expected first fix GOOD, got %s", q)
+	}
+	want := []string{ingest.QualitySpeedSpike, ingest.QualitySpeedSpike}
+	for i, w := range want {
+		if q := store(svc, i+1, -6.2-float64(i)*0.0005, 20); q != w {
+			t.Fatalf("fix %d: expected %s, got %s", i+1, w, q)
+		}
+	}
+	// fix ke-3 yang konsisten jadi anchor baru, juga setelah restart (state dibaca dari position_log)
+	if q := store(newService(), 3, -6.201, 20); q != ingest.QualityGood {
+		t.Fatalf("expected re-anchor after 3 consistent fixes, got %s", q)
+	}
+	if q := store(svc, 4, -6.2015, 20); q != ingest.QualityGood {
+		t.Fatalf("expected GOOD after re-anchor, got %s", q)
+	}
+
+	// merayap ~5 m per 10 detik di kemacetan: bukan drift selama device melaporkan kecepatan
+	if q := store(svc, 5, -6.20155, 2); q != ingest.QualityGood {
+		t.Fatalf("expected creeping fix GOOD, got %s", q)
+	}
+	if q := store(svc, 6, -6.2016, 0); q != ingest.QualityDrift {
+		t.Fatalf("expected DRIFT with zero device speed, got %s", q)
+	}
+}
@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/username/fms-api/internal/ingest"
+	"github.com/username/fms-api/internal/vehicle"
+)
+
+func TestReprocess_RewritesDecodedColumnsFromRawPayload(t *testing.T) {
+	db := setupTestDB(t)
+	dev, v := seedBoundDevice(t, db, "REPROC", "DEVICE", "356307042441013", ingest.ProtocolTeltonika)
+	svc := ingest.NewService(db)
+	target := &ingest.Target{Device: dev, VehicleID: v.ID}
+
+	pkt, err := ingest.DecodeTeltonikaPacket(mustHex(t, teltonikaCodec8EHex))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	tfix := pkt.Records[0].Fix(pkt.Codec)
+
+	ofix, err := ingest.ParseOsmAndFix(url.Values{
+		"id": {"x"}, "lat": {"-6.2"}, "lon": {"106.8"}, "speed": {"10"},
+		"timestamp": {"1577836800"},
+	})
+	if err != nil {
+		t.Fatalf("osmand: %v", err)
+	}
+	mfix, err := (ingest.MQTTConfig{FieldMapping: map[string]string{"ts": "ts", "lat": "lat", "lon": "lon", "speedKph": "speed"}}).
+		DecodePayload([]byte(`{"ts": 1546304400, "lat": -6.25, "lon": 106.85, "speed": 42.5}`))
+	if err != nil {
+		t.Fatalf("mqtt: %v", err)
+	}
+	manual := ingest.Fix{TS: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), Lat: -6.1, Lon: 106.7}
+
+	if res, err := svc.Store(target, []ingest.Fix{tfix, ofix, mfix, manual}); err != nil || res.Inserted != 4 {
+		t.Fatalf("store: %+v, %v", res, err)
+	}
+
+	// simulasi bug parser lama: kolom hasil decode salah
+	db.Model(&ingest.PositionLog{}).Where("ts = ?", tfix.TS).Updates(map[string]interface{}{"odometer_km": 1, "speed_kph": 99})
+	db.Model(&ingest.PositionLog{}).Where("ts = ?", ofix.TS).Update("speed_kph", 10)
+	db.Model(&ingest.PositionLog{}).Where("ts = ?", mfix.TS).Updates(map[string]interface{}{"lat": 0, "quality": ingest.QualityInvalidCoord})
+	db.Model(&vehicle.VehicleCurrentPositionDB{}).Where("vehicle_id = ?", v.ID).Update("speed_kph", 10)
+
+	report, err := svc.Reprocess(ingest.ReprocessOptions{DeviceID: dev.ID, DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if report.Scanned != 4 || report.Changed != 3 || report.Skipped != 1 || report.Failed != 0 || len(report.Changes) != 3 {
+		t.Fatalf("unexpected dry run report: %+v", report)
+	}
+	var row ingest.PositionLog
+	db.Where("ts = ?", tfix.TS).First(&row)
+	if *row.OdometerKm != 1 {
+		t.Fatalf("dry run must not write, odometer %v", *row.OdometerKm)
+	}
+
+	report, err = svc.Reprocess(ingest.ReprocessOptions{DeviceID: dev.ID})
+	if err != nil || report.Changed != 3 {
+		t.Fatalf("reprocess: %+v, %v", report, err)
+	}
+	// record Teltonika contoh tanpa fix GPS (0,0): kualitasnya ikut dinilai ulang
+	if got := report.Changes[0].Fields; len(got) != 3 || got[0] != "odometer_km" || got[1] != "quality" || got[2] != "speed_kph" {
+		t.Fatalf("unexpected changed fields for teltonika row: %v", got)
+	}
+
+	var trow, orow ingest.PositionLog
+	db.Where("ts = ?", tfix.TS).First(&trow)
+	if *trow.OdometerKm != *tfix.OdometerKm || *trow.SpeedKph != *tfix.SpeedKph || trow.Quality != ingest.QualityInvalidCoord {
+		t.Fatalf("teltonika row not rewritten: %+v", trow)
+	}
+	db.Where("ts = ?", ofix.TS).First(&orow)
+	if *orow.SpeedKph != *ofix.SpeedKph {
+		t.Fatalf("osmand row not rewritten: %v", *orow.SpeedKph)
+	}
+	var mrow ingest.PositionLog
+	db.Where("ts = ?", mfix.TS).First(&mrow)
+	if mrow.Lat != mfix.Lat || mrow.Quality != ingest.QualityGood {
+		t.Fatalf("mqtt row not rewritten: %v %s", mrow.Lat, mrow.Quality)
+	}
+	var cur vehicle.VehicleCurrentPositionDB
+	db.Where("vehicle_id = ?", v.ID).First(&cur)
+	if cur.SpeedKph == nil || *cur.SpeedKph != *ofix.SpeedKph {
+		t.Fatalf("current position must follow reprocessed row, got %v", cur.SpeedKph)
+	}
+
+	// putaran kedua tidak menemukan perubahan lagi
+	report, err = svc.Reprocess(ingest.ReprocessOptions{DeviceID: dev.ID})
+	if err != nil || report.Changed != 0 || report.Unchanged != 3 {
+		t.Fatalf("expected idempotent reprocess: %+v, %v", report, err)
+	}
+
+	// posisi terkini yang setelah decode ulang jadi (0,0) diganti fix GOOD terakhir kendaraan
+	db.Model(&ingest.PositionLog{}).Where("ts = ?", ofix.TS).Update("raw_payload", `{"protocol":"OSMAND","params":{"id":"x","lat":"0","lon":"0","timestamp":"1577836800"}}`)
+	if report, err := svc.Reprocess(ingest.ReprocessOptions{DeviceID: dev.ID}); err != nil || report.Changed != 1 {
+		t.Fatalf("reprocess invalid row: %+v, %v", report, err)
+	}
+	db.Where("vehicle_id = ?", v.ID).First(&cur)
+	if !cur.TS.Equal(mfix.TS) || cur.Lat != mfix.Lat {
+		t.Fatalf("current position must fall back to last GOOD fix, got %v %v", cur.TS, cur.Lat)
+	}
+}
+
+func TestReprocess_UsesEnvConfiguredQuality(t *testing.T) {
+	db := setupTestDB(t)
+	dev, v := seedBoundDevice(t, db, "REPROC-ENV", "DEVICE", "reproc-env", ingest.ProtocolOsmAnd)
+	target := &ingest.Target{Device: dev, VehicleID: v.ID}
+
+	// 50 knot = 92,6 km/jam: GOOD dengan default, SPEED_SPIKE bila INGEST_MAX_SPEED_KPH=80
+	f, err := ingest.ParseOsmAndFix(url.Values{"id": {"x"}, "lat": {"-6.2"}, "lon": {"106.8"}, "speed": {"50"}, "timestamp": {"1577836800"}})
+	if err != nil {
+		t.Fatalf("osmand: %v", err)
+	}
+	if _, err := ingest.NewService(db).Store(target, []ingest.Fix{f}); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	db.Model(&ingest.PositionLog{}).Where("device_id = ?", dev.ID).Update("speed_kph", 1)
+
+	t.Setenv("INGEST_MAX_SPEED_KPH", "80")
+	report, err := ingest.NewServiceFromEnv(db).Reprocess(ingest.ReprocessOptions{DeviceID: dev.ID})
+	if err != nil || report.Changed != 1 {
+		t.Fatalf("reprocess: %+v, %v", report, err)
+	}
+	var row ingest.PositionLog
+	db.Where("device_id = ?", dev.ID).First(&row)
+	if row.Quality != ingest.QualitySpeedSpike {
+		t.Fatalf("expected quality from INGEST_MAX_SPEED_KPH, got %s", row.Quality)
+	}
+}
@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/username/fms-api/internal/ingest"
+)
+
+// contoh packet dari dokumentasi protokol Teltonika
+const (
+	teltonikaCodec8Hex  = "000000000000003608010000016B40D8EA30010000000000000000000000000000000105021503010101425E0F01F10000601A014E0000000000000000010000C7CF"
+	teltonikaCodec8EHex = "000000000000004A8E010000016B412CEE000100000000000000000000000000000000010005000100010100010011001D00010010015E2C880002000B000000003544C87A000E000000001DD7E06A00000100002994"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad hex: %v", err)
+	}
+	return b
+}
+
+func TestDecodeTeltonikaPacket_Codec8(t *testing.T) {
+	pkt, err := ingest.DecodeTeltonikaPacket(mustHex(t, teltonikaCodec8Hex))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if pkt.Codec != ingest.TeltonikaCodec8 || len(pkt.Records) != 1 {
+		t.Fatalf("unexpected packet: %+v", pkt)
+	}
+	rec := pkt.Records[0]
+	if rec.Timestamp.UnixMilli() != 0x16B40D8EA30 {
+		t.Fatalf("unexpected timestamp %v", rec.Timestamp)
+	}
+	if rec.IO[21] != 3 || rec.IO[1] != 1 || rec.IO[66] != 0x5E0F || rec.IO[241] != 0x601A || rec.IO[78] != 0 {
+		t.Fatalf("unexpected IO elements: %+v", rec.IO)
+	}
+}
+
+func TestDecodeTeltonikaPacket_Codec8EAndCRC(t *testing.T) {
+	frame := mustHex(t, teltonikaCodec8EHex)
+	pkt, err := ingest.DecodeTeltonikaPacket(frame)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	rec := pkt.Records[0]
+	if pkt.Codec != ingest.TeltonikaCodec8E || rec.IO[0x11] != 0x1D || rec.IO[0x10] != 0x015E2C88 || rec.IO[0x0B] != 0x3544C87A {
+		t.Fatalf("unexpected codec 8E record: %+v", rec.IO)
+	}
+
+	// odometer (IO 16, meter) ikut dipetakan ke Fix
+	f := rec.Fix(pkt.Codec)
+	if f.OdometerKm == nil || *f.OdometerKm != float64(0x015E2C88)/1000 {
+		t.Fatalf("expected odometer mapped from IO 16, got %v", f.OdometerKm)
+	}
+
+	// record mentah bisa di-decode ulang untuk reprocessing
+	again, err := ingest.DecodeTeltonikaRecord(pkt.Codec, rec.Raw)
+	if err != nil || !again.Timestamp.Equal(rec.Timestamp) {
+		t.Fatalf("re-decode of raw record failed: %v", err)
+	}
+
+	frame[len(frame)-1] ^= 0xFF
+	if _, err := ingest.DecodeTeltonikaPacket(frame); err != ingest.ErrTeltonikaCRC {
+		t.Fatalf("expected CRC error, got %v", err)
+	}
+}
+
+func TestTeltonikaServer_HandshakeStoreAndAck(t *testing.T) {
+	db := setupTestDB(t)
+	dev, _ := seedBoundDevice(t, db, "TELTO", "DEVICE", "356307042441013", ingest.ProtocolTeltonika)
+
+	srv := ingest.NewTeltonikaServer("", ingest.NewService(db))
+	client, server := net.Pipe()
+	defer client.Close()
+	go srv.HandleConn(server)
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	imei := "356307042441013"
+	hs := make([]byte, 2+len(imei))
+	binary.BigEndian.PutUint16(hs, uint16(len(imei)))
+	copy(hs[2:], imei)
+	if _, err := client.Write(hs); err != nil {
+		t.Fatalf("write handshake: %v", err)
+	}
+	var accept [1]byte
+	if _, err := io.ReadFull(client, accept[:]); err != nil || accept[0] != 0x01 {
+		t.Fatalf("expected IMEI accepted, got %v (%v)", accept, err)
+	}
+
+	if _, err := client.Write(mustHex(t, teltonikaCodec8EHex)); err != nil {
+		t.Fatalf("write packet: %v", err)
+	}
+	var ack [4]byte
+	if _, err := io.ReadFull(client, ack[:]); err != nil {
+		t.Fatalf("read ack: %v", err)
+	}
+	if binary.BigEndian.Uint32(ack[:]) != 1 {
+		t.Fatalf("expected ack for 1 record, got %v", ack)
+	}
+
+	var cnt int64
+	db.Model(&ingest.PositionLog{}).Where("device_id = ?", dev.ID).Count(&cnt)
+	if cnt != 1 {
+		t.Fatalf("expected 1 position_log row, got %d", cnt)
+	}
+}
+
+func TestTeltonikaServer_RejectsUnknownIMEI(t *testing.T) {
+	db := setupTestDB(t)
+	srv := ingest.NewTeltonikaServer("", ingest.NewService(db))
+	client, server := net.Pipe()
+	defer client.Close()
+	go srv.HandleConn(server)
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	imei := "000000000000000"
+	hs := append([]byte{0x00, byte(len(imei))}, imei...)
+	client.Write(hs)
+	var resp [1]byte
+	if _, err := io.ReadFull(client, resp[:]); err != nil || resp[0] != 0x00 {
+		t.Fatalf("expected IMEI rejected, got %v (%v)", resp, err)
+	}
+}
@@ -0,0 +1,200 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"github.com/username/fms-api/internal/ingest"
+	"github.com/username/fms-api/internal/trip"
+)
+
+func setupTripDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := setupTestDB(t)
+	if err := db.AutoMigrate(&trip.Trip{}, &trip.BuilderState{}, &trip.RuleSet{}, &trip.RebuildJob{}, &trip.Stop{},
+		&trip.ClassificationRule{}, &trip.TripCorrection{}, &trip.DailyStat{}); err != nil {
+		t.Fatalf("automigrate trip tables: %v", err)
+	}
+	return db
+}
+
+// tripFix fix buatan untuk skenario trip: langkah 30 detik dari base
+func tripFix(base time.Time, step int, lon, speed float64, ignition *bool) ingest.Fix {
+	return ingest.Fix{
+		TS:         base.Add(time.Duration(step) * 30 * time.Second),
+		Lat:        -6.2,
+		Lon:        lon,
+		SpeedKph:   &speed,
+		IgnitionOn: ignition,
+	}
+}
+
+func vehicleTrips(t *testing.T, db *gorm.DB, vehicleID int64) []trip.Trip {
+	t.Helper()
+	var trips []trip.Trip
+	if err := db.Where("vehicle_id = ?", vehicleID).Order("start_ts").Find(&trips).Error; err != nil {
+		t.Fatalf("load trips: %v", err)
+	}
+	return trips
+}
+
+func TestTripBuilder_IgnitionIncremental(t *testing.T) {
+	db := setupTripDB(t)
+	svc := ingest.NewService(db)
+	_, v := seedBoundDevice(t, db, "TRIP-IGN", "DEVICE", "trip-ign", ingest.ProtocolTeltonika)
+	target, err := svc.ResolveByDataSource("TRIP-IGN", "trip-ign")
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	on, off := true, false
+	base := time.Now().UTC().Add(-2 * time.Hour).Truncate(time.Second)
+	var fixes []ingest.Fix
+	fixes = append(fixes, tripFix(base, 0, 106.8, 0, &off))
+	for i := 1; i <= 10; i++ {
+		fixes = append(fixes, tripFix(base, i, 106.8+float64(i)*0.005, 60, &on))
+	}
+	fixes = append(fixes, tripFix(base, 11, 106.851, 0, &off))
+
+	// fix yang ditandai filter kualitas tidak ikut dihitung
+	spike := tripFix(base, 5, 110, 900, &on)
+	spike.TS = spike.TS.Add(15 * time.Second)
+	spike.Quality = ingest.QualitySpeedSpike
+
+	if _, err := svc.Store(target, append(append([]ingest.Fix{}, fixes[:6]...), spike)); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	builder := trip.NewBuilder(db)
+	if _, err := builder.RunOnce(fixes[5].TS.Add(10 * time.Second)); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	trips := vehicleTrips(t, db, v.ID)
+	if len(trips) != 1 || trips[0].Metadata["status"] != trip.StatusOpen || !trips[0].EndTs.Equal(fixes[5].TS) {
+		t.Fatalf("expected one open trip up to the 5th fix, got %+v", trips)
+	}
+	openID := trips[0].ID
+
+	if _, err := svc.Store(target, fixes[6:]); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	n, err := builder.RunOnce(fixes[11].TS.Add(10 * time.Second))
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 closed trip, got %d (%v)", n, err)
+	}
+
+	trips = vehicleTrips(t, db, v.ID)
+	if len(trips) != 1 || trips[0].ID != openID {
+		t.Fatalf("expected the open trip to be closed in place, got %+v", trips)
+	}
+	tr := trips[0]
+	if tr.Metadata["status"] != trip.StatusClosed || tr.Metadata["detection"] != trip.DetectionIgnition {
+		t.Fatalf("unexpected metadata: %+v", tr.Metadata)
+	}
+	if !tr.StartTs.Equal(fixes[1].TS) || !tr.EndTs.Equal(fixes[11].TS) || *tr.DurationSeconds != 300 {
+		t.Fatalf("unexpected trip window: %+v", tr)
+	}
+	if *tr.DistanceKm < 5 || *tr.DistanceKm > 5.2 || *tr.MaxSpeedKph != 60 || *tr.AvgSpeedKph < 60 || *tr.AvgSpeedKph > 62.5 {
+		t.Fatalf("unexpected trip stats: distance %v max %v avg %v", *tr.DistanceKm, *tr.MaxSpeedKph, *tr.AvgSpeedKph)
+	}
+	if *tr.StartLon != fixes[1].Lon || *tr.EndLon != fixes[11].Lon {
+		t.Fatalf("unexpected trip endpoints: %v -> %v", *tr.StartLon, *tr.EndLon)
+	}
+
+	var st trip.BuilderState
+	db.First(&st, "vehicle_id = ?", v.ID)
+	if st.Open != nil || st.LastTS == nil || !st.LastTS.Equal(fixes[11].TS) {
+		t.Fatalf("unexpected builder state: %+v", st)
+	}
+}
+
+func TestTripBuilder_MovementFallback(t *testing.T) {
+	db := setupTripDB(t)
+	svc := ingest.NewService(db)
+	_, v := seedBoundDevice(t, db, "TRIP-MOV", "DEVICE", "trip-mov", ingest.ProtocolOsmAnd)
+	target, err := svc.ResolveByDataSource("TRIP-MOV", "trip-mov")
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	// tanpa ignition: bergerak 4 langkah lalu diam melewati idle timeout, lalu geser sebentar (terlalu pendek)
+	base := time.Now().UTC().Add(-3 * time.Hour).Truncate(time.Second)
+	fixes := []ingest.Fix{tripFix(base, 0, 106.8, 0, nil)}
+	for i := 1; i <= 4; i++ {
+		fixes = append(fixes, tripFix(base, i, 106.8+float64(i)*0.004, 40, nil))
+	}
+	for i := 5; i <= 20; i++ {
+		fixes = append(fixes, tripFix(base, i, 106.816, 0, nil))
+	}
+	fixes = append(fixes, tripFix(base, 21, 106.8165, 10, nil))
+	for i := 22; i <= 40; i++ {
+		fixes = append(fixes, tripFix(base, i, 106.8165, 0, nil))
+	}
+	if _, err := svc.Store(target, fixes); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+
+	n, err := trip.NewBuilder(db).RunOnce(fixes[len(fixes)-1].TS.Add(10 * time.Second))
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 closed trip, got %d (%v)", n, err)
+	}
+	trips := vehicleTrips(t, db, v.ID)
+	if len(trips) != 1 {
+		t.Fatalf("expected short movement discarded, got %d trips", len(trips))
+	}
+	tr := trips[0]
+	// trip dimulai dari fix diam terakhir sebelum bergerak dan berakhir di fix bergerak terakhir
+	if tr.Metadata["detection"] != trip.DetectionMovement || !tr.StartTs.Equal(fixes[0].TS) || !tr.EndTs.Equal(fixes[4].TS) {
+		t.Fatalf("unexpected trip: %+v", tr)
+	}
+	if *tr.DistanceKm < 1.7 || *tr.DistanceKm > 1.8 || *tr.DurationSeconds != 120 {
+		t.Fatalf("unexpected trip stats: distance %v duration %v", *tr.DistanceKm, *tr.DurationSeconds)
+	}
+}
+
+func TestTripBuilder_SkipsFailingVehicleAndPagesLongTrips(t *testing.T) {
+	db := setupTripDB(t)
+	svc := ingest.NewService(db)
+	_, broken := seedBoundDevice(t, db, "TRIP-BAD", "DEVICE", "trip-bad", ingest.ProtocolTeltonika)
+	_, v := seedBoundDevice(t, db, "TRIP-LONG", "DEVICE", "trip-long", ingest.ProtocolTeltonika)
+
+	on, off := true, false
+	base := time.Now().UTC().Add(-12 * time.Hour).Truncate(time.Second)
+	bad, err := svc.ResolveByDataSource("TRIP-BAD", "trip-bad")
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if _, err := svc.Store(bad, []ingest.Fix{tripFix(base, 0, 106.8, 0, &off)}); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	// state rusak: kendaraan ini gagal dibangun, kendaraan lain tetap diproses
+	db.Create(&trip.BuilderState{VehicleID: broken.ID, LastTS: &base, Open: datatypes.JSON("{")})
+
+	// trip lebih panjang dari satu batch baca position_log
+	target, err := svc.ResolveByDataSource("TRIP-LONG", "trip-long")
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	fixes := []ingest.Fix{tripFix(base, 0, 106.8, 0, &off)}
+	for i := 1; i <= 1200; i++ {
+		fixes = append(fixes, tripFix(base, i, 106.8+float64(i)*0.0001, 40, &on))
+	}
+	fixes = append(fixes, tripFix(base, 1201, 106.9201, 0, &off))
+	if _, err := svc.Store(target, fixes); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+
+	n, err := trip.NewBuilder(db).RunOnce(fixes[len(fixes)-1].TS.Add(time.Minute))
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 closed trip despite the broken vehicle, got %d (%v)", n, err)
+	}
+	trips := vehicleTrips(t, db, v.ID)
+	if len(trips) != 1 || !trips[0].StartTs.Equal(fixes[1].TS) || !trips[0].EndTs.Equal(fixes[len(fixes)-1].TS) {
+		t.Fatalf("expected one trip spanning all batches, got %+v", trips)
+	}
+	if got := vehicleTrips(t, db, broken.ID); len(got) != 0 {
+		t.Fatalf("expected no trips for the broken vehicle, got %+v", got)
+	}
+}
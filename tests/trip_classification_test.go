@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/ingest"
+	"github.com/username/fms-api/internal/trip"
+)
+
+func TestTripClassification_RuleManualFinalizeCorrection(t *testing.T) {
+	db := setupTripDB(t)
+	svc := ingest.NewService(db)
+	_, v := seedBoundDevice(t, db, "TRIP-CLASS", "DEVICE", "trip-class", ingest.ProtocolTeltonika)
+	target, err := svc.ResolveByDataSource("TRIP-CLASS", "trip-class")
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	h := trip.NewHandler(db)
+	orgID := v.OrganizationID
+	adminRole, userRole := auth.OrgRoleAdmin, auth.OrgRoleUser
+	admin := tripRouter(h, auth.CurrentUser{ID: 1, UserType: auth.UserTypeOrgUser, OrganizationID: &orgID, OrgRole: &adminRole})
+	driver := tripRouter(h, auth.CurrentUser{ID: 2, UserType: auth.UserTypeOrgUser, OrganizationID: &orgID, OrgRole: &userRole})
+
+	// aturan: trip yang dimulai dalam 1 km dari rumah = PRIVATE
+	if w := doJSON(driver, http.MethodPost, "/api/trip-classification-rules", `{"name":"x","classification":"PRIVATE","geofenceLat":-6.2,"geofenceLon":106.8,"geofenceRadiusM":1000}`); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for driver, got %d", w.Code)
+	}
+	if w := doJSON(admin, http.MethodPost, "/api/trip-classification-rules", `{"name":"kosong","classification":"PRIVATE"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for rule without condition, got %d", w.Code)
+	}
+	w := doJSON(admin, http.MethodPost, "/api/trip-classification-rules",
+		`{"name":"Dari rumah","classification":"private","purpose":"Pribadi","geofenceLat":-6.2,"geofenceLon":106.8,"geofenceRadiusM":1000,"geofenceMatch":"start"}`)
+	var rule trip.ClassificationRule
+	json.Unmarshal(w.Body.Bytes(), &rule)
+	if w.Code != http.StatusCreated || rule.Classification != trip.ClassPrivate || rule.GeofenceMatch != trip.GeofenceStart || !rule.Active {
+		t.Fatalf("unexpected rule: %d %s", w.Code, w.Body.String())
+	}
+
+	on, off := true, false
+	base := time.Now().UTC().Add(-3 * time.Hour).Truncate(time.Second)
+	fixes := []ingest.Fix{tripFix(base, 0, 106.8, 0, &off)}
+	for i := 1; i <= 10; i++ {
+		fixes = append(fixes, tripFix(base, i, 106.8+float64(i)*0.005, 60, &on))
+	}
+	fixes = append(fixes, tripFix(base, 11, 106.851, 0, &off))
+	if _, err := svc.Store(target, fixes); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if n, err := trip.NewBuilder(db).RunOnce(fixes[11].TS.Add(time.Minute)); err != nil || n != 1 {
+		t.Fatalf("expected 1 trip, got %d (%v)", n, err)
+	}
+	tr := vehicleTrips(t, db, v.ID)[0]
+	if tr.Classification == nil || *tr.Classification != trip.ClassPrivate || *tr.ClassificationSource != trip.SourceRule || *tr.ClassificationRuleID != rule.ID {
+		t.Fatalf("expected trip classified by rule: %+v", tr)
+	}
+
+	// driver ubah jadi BUSINESS
+	tripPath := fmt.Sprintf("/api/trips/%d", tr.ID)
+	if w := doJSON(driver, http.MethodPatch, tripPath+"/classification", `{"classification":"leisure"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid classification, got %d", w.Code)
+	}
+	w = doJSON(driver, http.MethodPatch, tripPath+"/classification", `{"classification":"business","purpose":"Kunjungan klien"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("classify: %d %s", w.Code, w.Body.String())
+	}
+	tr = vehicleTrips(t, db, v.ID)[0]
+	if *tr.Classification != trip.ClassBusiness || *tr.Purpose != "Kunjungan klien" || *tr.ClassificationSource != trip.SourceManual || *tr.ClassifiedBy != 2 {
+		t.Fatalf("unexpected manual classification: %+v", tr)
+	}
+
+	// rebuild: klasifikasi manual pindah ke trip baru, bukan ditimpa aturan
+	if _, err := trip.NewRebuilder(db).RebuildVehicle(v.ID, base.Add(-time.Hour), base.Add(time.Hour), time.Now().UTC()); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	rebuilt := vehicleTrips(t, db, v.ID)
+	if len(rebuilt) != 1 || rebuilt[0].ID == tr.ID || *rebuilt[0].Classification != trip.ClassBusiness || *rebuilt[0].ClassificationSource != trip.SourceManual {
+		t.Fatalf("manual classification lost on rebuild: %+v", rebuilt)
+	}
+	tr = rebuilt[0]
+	tripPath = fmt.Sprintf("/api/trips/%d", tr.ID)
+
+	// finalisasi logbook
+	from, to := base.Add(-time.Hour).Format(time.RFC3339), base.Add(time.Hour).Format(time.RFC3339)
+	logbookPath := fmt.Sprintf("/api/vehicles/%d/logbook", v.ID)
+	var book struct {
+		Locked bool               `json:"locked"`
+		Totals map[string]float64 `json:"totals"`
+		Data   []trip.Trip        `json:"data"`
+	}
+	w = doJSON(driver, http.MethodGet, logbookPath+"?from="+from+"&to="+to, "")
+	json.Unmarshal(w.Body.Bytes(), &book)
+	if w.Code != http.StatusOK || book.Locked || len(book.Data) != 1 || book.Totals["businessKm"] != *tr.DistanceKm {
+		t.Fatalf("unexpected logbook: %d %s", w.Code, w.Body.String())
+	}
+	w = doJSON(driver, http.MethodPost, logbookPath+"/finalize", fmt.Sprintf(`{"from":%q,"to":%q}`, from, to))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"finalized":1`) {
+		t.Fatalf("finalize: %d %s", w.Code, w.Body.String())
+	}
+
+	// terkunci: perubahan hanya lewat koreksi admin dengan alasan
+	if w := doJSON(driver, http.MethodPatch, tripPath+"/classification", `{"classification":"PRIVATE"}`); w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 after finalize, got %d", w.Code)
+	}
+	if w := doJSON(driver, http.MethodPost, tripPath+"/corrections", `{"classification":"PRIVATE","reason":"salah input"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for driver correction, got %d", w.Code)
+	}
+	if w := doJSON(admin, http.MethodPost, tripPath+"/corrections", `{"classification":"PRIVATE"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without reason, got %d", w.Code)
+	}
+	if w := doJSON(admin, http.MethodPost, tripPath+"/corrections", `{"classification":"PRIVATE","reason":"Salah input driver"}`); w.Code != http.StatusCreated {
+		t.Fatalf("correction: %d %s", w.Code, w.Body.String())
+	}
+	w = doJSON(driver, http.MethodGet, tripPath+"/corrections", "")
+	var corrections struct {
+		Data []trip.TripCorrection `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &corrections)
+	if len(corrections.Data) != 1 || corrections.Data[0].Before["classification"] != trip.ClassBusiness ||
+		corrections.Data[0].After["classification"] != trip.ClassPrivate || *corrections.Data[0].UserID != 1 {
+		t.Fatalf("unexpected corrections: %s", w.Body.String())
+	}
+
+	w = doJSON(driver, http.MethodGet, logbookPath+"?format=csv&from="+from+"&to="+to, "")
+	if w.Code != http.StatusOK || w.Header().Get("X-Logbook-Locked") != "true" {
+		t.Fatalf("csv logbook: %d %v", w.Code, w.Header())
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], ",PRIVATE,Kunjungan klien,MANUAL,") {
+		t.Fatalf("unexpected csv: %s", w.Body.String())
+	}
+
+	// rebuild tidak boleh mengubah trip yang sudah difinalisasi
+	if _, err := trip.NewRebuilder(db).RebuildVehicle(v.ID, base.Add(-time.Hour), base.Add(time.Hour), time.Now().UTC()); !errors.Is(err, trip.ErrRebuildFinalized) {
+		t.Fatalf("expected ErrRebuildFinalized, got %v", err)
+	}
+}
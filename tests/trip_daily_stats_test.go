@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/ingest"
+	orgModel "github.com/username/fms-api/internal/organization"
+	"github.com/username/fms-api/internal/trip"
+)
+
+func TestTripDailyStats_OrgTimezoneAndScope(t *testing.T) {
+	db := setupTripDB(t)
+	svc := ingest.NewService(db)
+	_, v := seedBoundDevice(t, db, "TRIP-DAILY", "DEVICE", "trip-daily", ingest.ProtocolTeltonika)
+	target, err := svc.ResolveByDataSource("TRIP-DAILY", "trip-daily")
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	// WIB = UTC+7: 16:55Z sudah 23:55 lokal, trip melewati tengah malam
+	if err := db.Model(&orgModel.Organization{}).Where("id = ?", v.OrganizationID).Update("timezone", "Asia/Jakarta").Error; err != nil {
+		t.Fatalf("set timezone: %v", err)
+	}
+
+	on, off := true, false
+	base := time.Date(2025, 3, 10, 16, 50, 0, 0, time.UTC)
+	var fixes []ingest.Fix
+	for i := 0; i < 4; i++ {
+		fixes = append(fixes, tripFix(base, i, 106.8, 0, &off))
+	}
+	for i := 4; i < 10; i++ {
+		fixes = append(fixes, tripFix(base, i, 106.8, 0, &on))
+	}
+	for i := 10; i < 22; i++ {
+		fixes = append(fixes, tripFix(base, i, 106.8+float64(i-9)*0.005, 60, &on))
+	}
+	fixes = append(fixes, tripFix(base, 22, 106.86, 0, &off))
+	if _, err := svc.Store(target, fixes); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if n, err := trip.NewBuilder(db).RunOnce(fixes[22].TS.Add(time.Minute)); err != nil || n != 1 {
+		t.Fatalf("expected 1 trip, got %d (%v)", n, err)
+	}
+	tr := vehicleTrips(t, db, v.ID)[0]
+
+	orgID := v.OrganizationID
+	userRole := auth.OrgRoleUser
+	member := tripRouter(trip.NewHandler(db), auth.CurrentUser{ID: 1, UserType: auth.UserTypeOrgUser, OrganizationID: &orgID, OrgRole: &userRole})
+	otherOrg := orgID + 100
+	outsider := tripRouter(trip.NewHandler(db), auth.CurrentUser{ID: 2, UserType: auth.UserTypeOrgUser, OrganizationID: &otherOrg, OrgRole: &userRole})
+
+	w := doJSON(member, http.MethodGet, fmt.Sprintf("/api/vehicles/%d/daily-stats?from=2025-03-09&to=2025-03-12", v.ID), "")
+	var resp struct {
+		Timezone string           `json:"timezone"`
+		Data     []trip.DailyStat `json:"data"`
+		Totals   struct {
+			DistanceKm     float64 `json:"distanceKm"`
+			DrivingSeconds int64   `json:"drivingSeconds"`
+			IdleSeconds    int64   `json:"idleSeconds"`
+			TripCount      int64   `json:"tripCount"`
+		} `json:"totals"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("daily stats: %d %s", w.Code, w.Body.String())
+	}
+	if resp.Timezone != "Asia/Jakarta" || len(resp.Data) != 2 {
+		t.Fatalf("expected 2 local days, got %s", w.Body.String())
+	}
+	first, second := resp.Data[0], resp.Data[1]
+	if first.Day.String() != "2025-03-10" || second.Day.String() != "2025-03-11" || first.TripCount != 1 || second.TripCount != 0 {
+		t.Fatalf("unexpected days: %s", w.Body.String())
+	}
+	// bagian sebelum tengah malam lokal = sampai 17:00Z
+	midnight := time.Date(2025, 3, 11, 0, 0, 0, 0, time.FixedZone("WIB", 7*3600))
+	if first.DrivingSeconds != int64(midnight.Sub(tr.StartTs)/time.Second) || resp.Totals.DrivingSeconds != *tr.DurationSeconds {
+		t.Fatalf("unexpected driving seconds: %s (trip %+v)", w.Body.String(), tr)
+	}
+	if math.Abs(resp.Totals.DistanceKm-*tr.DistanceKm) > 0.011 || first.DistanceKm == 0 || second.DistanceKm == 0 {
+		t.Fatalf("distance not split across days: %s (trip %.2f)", w.Body.String(), *tr.DistanceKm)
+	}
+	if first.IdleSeconds != 150 || second.IdleSeconds != 0 || *first.MaxSpeedKph != 60 {
+		t.Fatalf("unexpected idle / max speed: %s", w.Body.String())
+	}
+
+	if w := doJSON(member, http.MethodGet, fmt.Sprintf("/api/vehicles/%d/daily-stats?from=2025-03-12&to=2025-03-01", v.ID), ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for inverted range, got %d", w.Code)
+	}
+	if w := doJSON(outsider, http.MethodGet, fmt.Sprintf("/api/vehicles/%d/daily-stats", v.ID), ""); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for other org, got %d", w.Code)
+	}
+
+	// laporan: hanya kendaraan organisasi user
+	report := func(router *gin.Engine) []trip.DailyStat {
+		t.Helper()
+		rec := doJSON(router, http.MethodGet, "/api/reports/daily-stats?from=2025-03-01&to=2025-03-31", "")
+		var body struct {
+			Data []trip.DailyStat `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("report: %d %s", rec.Code, rec.Body.String())
+		}
+		return body.Data
+	}
+	if rows := report(member); len(rows) != 2 || rows[0].Day.String() != "2025-03-11" || rows[0].VehicleID != v.ID {
+		t.Fatalf("unexpected report rows: %+v", rows)
+	}
+	if rows := report(outsider); len(rows) != 0 {
+		t.Fatalf("expected no rows for other org, got %+v", rows)
+	}
+
+	// ganti zona waktu lalu hitung ulang: seluruh trip jatuh di 10 Maret UTC
+	db.Model(&orgModel.Organization{}).Where("id = ?", orgID).Update("timezone", "UTC")
+	from, _ := trip.ParseLocalDate("2025-03-09")
+	to, _ := trip.ParseLocalDate("2025-03-12")
+	if err := trip.RefreshDailyStats(db, v.ID, from, to); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	var stats []trip.DailyStat
+	db.Where("vehicle_id = ?", v.ID).Order("day").Find(&stats)
+	if len(stats) != 1 || stats[0].Day.String() != "2025-03-10" || stats[0].Timezone != "UTC" || stats[0].DrivingSeconds != *tr.DurationSeconds {
+		t.Fatalf("unexpected stats after timezone change: %+v", stats)
+	}
+}
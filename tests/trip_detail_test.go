@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/ingest"
+	"github.com/username/fms-api/internal/trip"
+)
+
+func TestEncodePolyline(t *testing.T) {
+	// contoh dari dokumentasi format encoded polyline Google
+	got := trip.EncodePolyline([][2]float64{{38.5, -120.2}, {40.7, -120.95}, {43.252, -126.453}})
+	if want := "_p~iF~ps|U_ulLnnqC_mqNvxq`@"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestTripDetail_RouteOptions(t *testing.T) {
+	db := setupTripDB(t)
+	svc := ingest.NewService(db)
+	_, v := seedBoundDevice(t, db, "TRIP-DETAIL", "DEVICE", "trip-detail", ingest.ProtocolTeltonika)
+	target, err := svc.ResolveByDataSource("TRIP-DETAIL", "trip-detail")
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	// 20 langkah ke timur lalu 20 langkah ke utara: disederhanakan menjadi 3 titik
+	on := true
+	base := time.Now().UTC().Add(-2 * time.Hour).Truncate(time.Second)
+	var fixes []ingest.Fix
+	for i := 0; i <= 20; i++ {
+		fixes = append(fixes, tripFix(base, i, 106.8+float64(i)*0.005, 60, &on))
+	}
+	for i := 1; i <= 20; i++ {
+		f := tripFix(base, 20+i, 106.9, 60, &on)
+		f.Lat = -6.2 + float64(i)*0.005
+		fixes = append(fixes, f)
+	}
+	if _, err := svc.Store(target, fixes); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	tr := trip.Trip{VehicleID: v.ID, StartTs: fixes[0].TS, EndTs: fixes[len(fixes)-1].TS}
+	if err := db.Create(&tr).Error; err != nil {
+		t.Fatalf("create trip: %v", err)
+	}
+
+	orgID := v.OrganizationID
+	userRole := auth.OrgRoleUser
+	router := tripRouter(trip.NewHandler(db), auth.CurrentUser{ID: 1, UserType: auth.UserTypeOrgUser, OrganizationID: &orgID, OrgRole: &userRole})
+	path := fmt.Sprintf("/api/trips/%d", tr.ID)
+
+	var resp struct {
+		Positions      []map[string]interface{} `json:"positions"`
+		Polyline       string                   `json:"polyline"`
+		Points         int                      `json:"points"`
+		PositionsTotal int                      `json:"positionsTotal"`
+	}
+	get := func(query string) int {
+		resp.Positions, resp.Polyline = nil, ""
+		w := doJSON(router, http.MethodGet, path+query, "")
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code
+	}
+
+	if code := get(""); code != http.StatusOK || len(resp.Positions) != 41 || resp.PositionsTotal != 41 {
+		t.Fatalf("expected full route, got %d %d", code, len(resp.Positions))
+	}
+	if code := get("?simplify=10&fields=ts,lat,lon"); code != http.StatusOK || len(resp.Positions) != 3 || resp.PositionsTotal != 41 {
+		t.Fatalf("expected 3 simplified points, got %d %d", code, len(resp.Positions))
+	}
+	corner := resp.Positions[1]
+	if len(corner) != 3 || corner["lon"] != fixes[20].Lon || corner["lat"] != fixes[20].Lat {
+		t.Fatalf("unexpected corner point: %+v", corner)
+	}
+	if code := get("?maxPoints=5"); code != http.StatusOK || len(resp.Positions) != 5 ||
+		resp.Positions[4]["lat"] != fixes[40].Lat || resp.Positions[0]["ts"] == nil {
+		t.Fatalf("expected 5 sampled points ending at the last fix, got %d %+v", code, resp.Positions)
+	}
+	if code := get("?simplify=10&format=polyline"); code != http.StatusOK || resp.Points != 3 || resp.Positions != nil ||
+		resp.Polyline != trip.EncodePolyline([][2]float64{{-6.2, 106.8}, {-6.2, 106.9}, {-6.1, 106.9}}) {
+		t.Fatalf("unexpected polyline response: %d %+v", code, resp)
+	}
+	for _, q := range []string{"?simplify=-1", "?maxPoints=1", "?fields=ts,secret", "?format=xml"} {
+		if code := get(q); code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", q, code)
+		}
+	}
+}
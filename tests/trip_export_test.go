@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/ingest"
+	"github.com/username/fms-api/internal/trip"
+)
+
+func TestTripExport_Formats(t *testing.T) {
+	db := setupTripDB(t)
+	svc := ingest.NewService(db)
+	_, v := seedBoundDevice(t, db, "TRIP-EXPORT", "DEVICE", "trip-export", ingest.ProtocolTeltonika)
+	target, err := svc.ResolveByDataSource("TRIP-EXPORT", "trip-export")
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	// dua trip masing-masing 6 fix
+	on := true
+	base := time.Now().UTC().Add(-3 * time.Hour).Truncate(time.Second)
+	var trips []trip.Trip
+	for k := 0; k < 2; k++ {
+		start := base.Add(time.Duration(k) * time.Hour)
+		var fixes []ingest.Fix
+		for i := 0; i < 6; i++ {
+			fixes = append(fixes, tripFix(start, i, 106.8+float64(i)*0.005, float64(40+i), &on))
+		}
+		if _, err := svc.Store(target, fixes); err != nil {
+			t.Fatalf("store: %v", err)
+		}
+		tr := trip.Trip{VehicleID: v.ID, StartTs: fixes[0].TS, EndTs: fixes[5].TS}
+		if err := db.Create(&tr).Error; err != nil {
+			t.Fatalf("create trip: %v", err)
+		}
+		trips = append(trips, tr)
+	}
+
+	orgID := v.OrganizationID
+	userRole := auth.OrgRoleUser
+	router := tripRouter(trip.NewHandler(db), auth.CurrentUser{ID: 1, UserType: auth.UserTypeOrgUser, OrganizationID: &orgID, OrgRole: &userRole})
+	tripPath := fmt.Sprintf("/api/trips/%d/export", trips[0].ID)
+
+	w := doJSON(router, http.MethodGet, tripPath+"?format=gpx", "")
+	var gpx struct {
+		Points []struct {
+			Lat   float64 `xml:"lat,attr"`
+			Time  string  `xml:"time"`
+			Speed float64 `xml:"extensions>speedKph"`
+			Ign   bool    `xml:"extensions>ignitionOn"`
+		} `xml:"trk>trkseg>trkpt"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &gpx); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("invalid gpx (%d): %v\n%s", w.Code, err, w.Body.String())
+	}
+	if len(gpx.Points) != 6 || gpx.Points[5].Speed != 45 || !gpx.Points[0].Ign || gpx.Points[0].Lat != -6.2 {
+		t.Fatalf("unexpected gpx points: %+v", gpx.Points)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/gpx+xml" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, fmt.Sprintf("trip-%d.gpx", trips[0].ID)) {
+		t.Fatalf("unexpected content disposition %q", cd)
+	}
+
+	w = doJSON(router, http.MethodGet, tripPath+"?format=kml", "")
+	var kml struct {
+		Track struct {
+			When   []string `xml:"when"`
+			Coords []string `xml:"coord"`
+			Arrays []struct {
+				Name   string   `xml:"name,attr"`
+				Values []string `xml:"value"`
+			} `xml:"ExtendedData>SchemaData>SimpleArrayData"`
+		} `xml:"Document>Placemark>Track"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &kml); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("invalid kml (%d): %v\n%s", w.Code, err, w.Body.String())
+	}
+	tk := kml.Track
+	if len(tk.When) != 6 || len(tk.Coords) != 6 || len(tk.Arrays) != 2 || len(tk.Arrays[0].Values) != 6 ||
+		tk.Arrays[0].Values[1] != "41" || tk.Arrays[1].Values[0] != "true" || !strings.HasPrefix(tk.Coords[0], "106.8 -6.2") {
+		t.Fatalf("unexpected kml track: %+v", tk)
+	}
+
+	// multi-trip: GeoJSON satu feature per trip
+	rangePath := fmt.Sprintf("/api/vehicles/%d/trips/export?format=geojson&from=%s&to=%s", v.ID,
+		base.Add(-time.Minute).Format(time.RFC3339), base.Add(2*time.Hour).Format(time.RFC3339))
+	w = doJSON(router, http.MethodGet, rangePath, "")
+	var fc struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry struct {
+				Coordinates [][]float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties struct {
+				TripID     int64      `json:"tripId"`
+				CoordTimes []string   `json:"coordTimes"`
+				SpeedsKph  []*float64 `json:"speedsKph"`
+				IgnitionOn []*bool    `json:"ignitionOn"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &fc); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("invalid geojson (%d): %v\n%s", w.Code, err, w.Body.String())
+	}
+	if fc.Type != "FeatureCollection" || len(fc.Features) != 2 || fc.Features[1].Properties.TripID != trips[1].ID {
+		t.Fatalf("unexpected feature collection: %s", w.Body.String())
+	}
+	f := fc.Features[0]
+	if len(f.Geometry.Coordinates) != 6 || len(f.Properties.CoordTimes) != 6 || len(f.Properties.SpeedsKph) != 6 ||
+		len(f.Properties.IgnitionOn) != 6 || *f.Properties.SpeedsKph[2] != 42 || f.Geometry.Coordinates[0][0] != 106.8 {
+		t.Fatalf("unexpected feature: %+v", f)
+	}
+
+	if w := doJSON(router, http.MethodGet, tripPath+"?format=shp", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown format, got %d", w.Code)
+	}
+	if w := doJSON(router, http.MethodGet, fmt.Sprintf("/api/vehicles/%d/trips/export?format=gpx", v.ID), ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without range, got %d", w.Code)
+	}
+}
@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/ingest"
+	"github.com/username/fms-api/internal/trip"
+)
+
+func tripAdminRouter(h *trip.Handler, cu auth.CurrentUser) *gin.Engine {
+	router := gin.New()
+	admin := router.Group("/admin", func(c *gin.Context) { c.Set(auth.ContextUserKey, cu) })
+	h.RegisterAdminRoutes(admin)
+	return router
+}
+
+func TestTripRebuild_VehicleRange(t *testing.T) {
+	db := setupTripDB(t)
+	svc := ingest.NewService(db)
+	_, v := seedBoundDevice(t, db, "TRIP-REBUILD", "DEVICE", "trip-rebuild", ingest.ProtocolTeltonika)
+	target, err := svc.ResolveByDataSource("TRIP-REBUILD", "trip-rebuild")
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	on, off := true, false
+	drive := func(base time.Time) time.Time {
+		fixes := []ingest.Fix{tripFix(base, 0, 106.8, 0, &off)}
+		for i := 1; i <= 10; i++ {
+			fixes = append(fixes, tripFix(base, i, 106.8+float64(i)*0.005, 60, &on))
+		}
+		fixes = append(fixes, tripFix(base, 11, 106.851, 0, &off))
+		if _, err := svc.Store(target, fixes); err != nil {
+			t.Fatalf("store: %v", err)
+		}
+		return fixes[11].TS
+	}
+	base := time.Now().UTC().Add(-4 * time.Hour).Truncate(time.Second)
+	drive(base)
+	end := drive(base.Add(time.Hour))
+	builder := trip.NewBuilder(db)
+	if n, err := builder.RunOnce(end.Add(time.Minute)); err != nil || n != 2 {
+		t.Fatalf("expected 2 trips, got %d (%v)", n, err)
+	}
+	before := vehicleTrips(t, db, v.ID)
+
+	// trip rusak di tengah rentang: harus hilang setelah rebuild
+	bogusEnd := base.Add(35 * time.Minute)
+	if err := db.Create(&trip.Trip{VehicleID: v.ID, StartTs: base.Add(30 * time.Minute), EndTs: bogusEnd}).Error; err != nil {
+		t.Fatalf("create bogus trip: %v", err)
+	}
+
+	orgID := v.OrganizationID
+	adminRole := auth.OrgRoleAdmin
+	h := trip.NewHandler(db)
+	admin := tripAdminRouter(h, auth.CurrentUser{ID: 1, UserType: auth.UserTypeOrgUser, OrganizationID: &orgID, OrgRole: &adminRole})
+	otherOrg := orgID + 100
+	outsider := tripAdminRouter(h, auth.CurrentUser{ID: 2, UserType: auth.UserTypeOrgUser, OrganizationID: &otherOrg, OrgRole: &adminRole})
+
+	body := fmt.Sprintf(`{"vehicleId":%d,"from":%q,"to":%q}`, v.ID,
+		base.Add(20*time.Minute).Format(time.RFC3339), base.Add(3*time.Hour).Format(time.RFC3339))
+	if w := doJSON(outsider, http.MethodPost, "/admin/trips/rebuild", body); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for other org, got %d", w.Code)
+	}
+	if w := doJSON(admin, http.MethodPost, "/admin/trips/rebuild", `{"from":"2025-01-02T00:00:00Z","to":"2025-01-01T00:00:00Z","vehicleId":1}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for inverted range, got %d", w.Code)
+	}
+	w := doJSON(admin, http.MethodPost, "/admin/trips/rebuild", body)
+	var job trip.RebuildJob
+	json.Unmarshal(w.Body.Bytes(), &job)
+	if w.Code != http.StatusAccepted || job.Status != trip.RebuildQueued || job.TotalVehicles != 1 || job.OrganizationID != orgID {
+		t.Fatalf("unexpected create response: %d %s", w.Code, w.Body.String())
+	}
+
+	if n, err := trip.NewRebuilder(db).RunOnce(); err != nil || n != 1 {
+		t.Fatalf("expected 1 job processed, got %d (%v)", n, err)
+	}
+	w = doJSON(admin, http.MethodGet, fmt.Sprintf("/admin/trips/rebuild/%d", job.ID), "")
+	json.Unmarshal(w.Body.Bytes(), &job)
+	if w.Code != http.StatusOK || job.Status != trip.RebuildDone || job.DoneVehicles != 1 ||
+		job.TripsDeleted != 2 || job.TripsCreated != 1 || job.FinishedAt == nil {
+		t.Fatalf("unexpected job: %d %s", w.Code, w.Body.String())
+	}
+
+	// trip pertama di luar rentang tidak disentuh, trip kedua dibangun ulang dengan hasil yang sama
+	after := vehicleTrips(t, db, v.ID)
+	if len(after) != 2 || after[0].ID != before[0].ID || after[1].ID == before[1].ID {
+		t.Fatalf("unexpected trips after rebuild: %+v", after)
+	}
+	if !after[1].StartTs.Equal(before[1].StartTs) || !after[1].EndTs.Equal(before[1].EndTs) || *after[1].DistanceKm != *before[1].DistanceKm {
+		t.Fatalf("rebuilt trip differs: %+v vs %+v", after[1], before[1])
+	}
+
+	// builder live melanjutkan dari state hasil rebuild tanpa menggandakan trip
+	end = drive(base.Add(2 * time.Hour))
+	if n, err := builder.RunOnce(end.Add(time.Minute)); err != nil || n != 1 {
+		t.Fatalf("expected 1 new trip, got %d (%v)", n, err)
+	}
+	if trips := vehicleTrips(t, db, v.ID); len(trips) != 3 {
+		t.Fatalf("expected 3 trips, got %d", len(trips))
+	}
+
+	// job organisasi dengan aturan baru: semua trip terlalu pendek dan dihapus
+	minKm := 10.0
+	if err := db.Create(&trip.RuleSet{OrganizationID: orgID, MinDistanceKm: &minKm}).Error; err != nil {
+		t.Fatalf("create rules: %v", err)
+	}
+	orgJob, err := trip.CreateRebuildJob(db, trip.RebuildRequest{OrganizationID: &orgID, From: base, To: end.Add(time.Hour)}, nil)
+	if err != nil {
+		t.Fatalf("create org job: %v", err)
+	}
+	if err := trip.NewRebuilder(db).Run(orgJob, nil); err != nil {
+		t.Fatalf("run org job: %v", err)
+	}
+	if orgJob.Status != trip.RebuildDone || orgJob.TripsDeleted != 3 || orgJob.TripsCreated != 0 {
+		t.Fatalf("unexpected org job: %+v", orgJob)
+	}
+	if err := trip.NewRebuilder(db).Run(orgJob, nil); err != trip.ErrRebuildTaken {
+		t.Fatalf("expected finished job not to run twice, got %v", err)
+	}
+	if trips := vehicleTrips(t, db, v.ID); len(trips) != 0 {
+		t.Fatalf("expected no trips after org rebuild, got %d", len(trips))
+	}
+}
+
+func TestTripRebuild_UnknownOrganizationAndStaleJob(t *testing.T) {
+	db := setupTripDB(t)
+	_, v := seedBoundDevice(t, db, "TRIP-REBUILD-STALE", "DEVICE", "trip-rebuild-stale", ingest.ProtocolTeltonika)
+	super := tripAdminRouter(trip.NewHandler(db), auth.CurrentUser{ID: 1, UserType: auth.UserTypeSuperAdmin})
+
+	body := fmt.Sprintf(`{"organizationId":%d,"from":"2025-01-01T00:00:00Z","to":"2025-01-02T00:00:00Z"}`, v.OrganizationID+100)
+	if w := doJSON(super, http.MethodPost, "/admin/trips/rebuild", body); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown organization, got %d %s", w.Code, w.Body.String())
+	}
+
+	// job RUNNING yang ditinggal proses mati diantrekan ulang dengan progres direset, lalu selesai
+	now := time.Now().UTC()
+	stale, fresh := now.Add(-2*time.Hour), now.Add(-time.Minute)
+	jobs := []trip.RebuildJob{
+		{OrganizationID: v.OrganizationID, VehicleID: &v.ID, FromTS: now.Add(-24 * time.Hour), ToTS: now,
+			Status: trip.RebuildRunning, TotalVehicles: 1, DoneVehicles: 1, TripsDeleted: 4, CreatedAt: stale, StartedAt: &stale},
+		{OrganizationID: v.OrganizationID, VehicleID: &v.ID, FromTS: now.Add(-24 * time.Hour), ToTS: now,
+			Status: trip.RebuildRunning, TotalVehicles: 1, CreatedAt: fresh, StartedAt: &fresh},
+	}
+	if err := db.Create(&jobs).Error; err != nil {
+		t.Fatalf("create jobs: %v", err)
+	}
+	rebuilder := trip.NewRebuilder(db)
+	if n, err := rebuilder.RequeueStale(now); err != nil || n != 1 {
+		t.Fatalf("expected 1 stale job requeued, got %d (%v)", n, err)
+	}
+	if n, err := rebuilder.RunOnce(); err != nil || n != 1 {
+		t.Fatalf("expected 1 job processed, got %d (%v)", n, err)
+	}
+	var got []trip.RebuildJob
+	db.Order("id").Find(&got)
+	if got[0].Status != trip.RebuildDone || got[0].DoneVehicles != 1 || got[0].TripsDeleted != 0 {
+		t.Fatalf("unexpected requeued job: %+v", got[0])
+	}
+	if got[1].Status != trip.RebuildRunning {
+		t.Fatalf("expected fresh running job untouched, got %s", got[1].Status)
+	}
+}
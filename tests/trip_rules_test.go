@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/ingest"
+	"github.com/username/fms-api/internal/trip"
+)
+
+func tripRouter(h *trip.Handler, cu auth.CurrentUser) *gin.Engine {
+	router := gin.New()
+	api := router.Group("/api", func(c *gin.Context) { c.Set(auth.ContextUserKey, cu) })
+	h.RegisterRoutes(api)
+	return router
+}
+
+func doJSON(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestTripRules_OrgAndVehicleOverride(t *testing.T) {
+	db := setupTripDB(t)
+	svc := ingest.NewService(db)
+	_, v := seedBoundDevice(t, db, "TRIP-RULES", "DEVICE", "trip-rules", ingest.ProtocolTeltonika)
+	target, err := svc.ResolveByDataSource("TRIP-RULES", "trip-rules")
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	h := trip.NewHandler(db)
+	orgID := v.OrganizationID
+	adminRole, userRole := auth.OrgRoleAdmin, auth.OrgRoleUser
+	admin := tripRouter(h, auth.CurrentUser{ID: 1, UserType: auth.UserTypeOrgUser, OrganizationID: &orgID, OrgRole: &adminRole})
+	member := tripRouter(h, auth.CurrentUser{ID: 2, UserType: auth.UserTypeOrgUser, OrganizationID: &orgID, OrgRole: &userRole})
+	otherOrg := orgID + 100
+	outsider := tripRouter(h, auth.CurrentUser{ID: 3, UserType: auth.UserTypeOrgUser, OrganizationID: &otherOrg, OrgRole: &adminRole})
+	vehiclePath := "/api/vehicles/" + strconv.FormatInt(v.ID, 10) + "/trip-rules"
+
+	// aturan organisasi: hanya admin yang boleh mengubah
+	if w := doJSON(member, http.MethodPut, "/api/trip-rules", `{"minDistanceKm":10}`); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for org user, got %d", w.Code)
+	}
+	if w := doJSON(admin, http.MethodPut, "/api/trip-rules", `{"detection":"sideways"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid detection, got %d", w.Code)
+	}
+	w := doJSON(admin, http.MethodPut, "/api/trip-rules", `{"detection":"movement","minDistanceKm":10,"idleTimeoutSeconds":600}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var view struct {
+		Effective trip.RulesView `json:"effective"`
+	}
+	w = doJSON(member, http.MethodGet, vehiclePath, "")
+	json.Unmarshal(w.Body.Bytes(), &view)
+	if w.Code != http.StatusOK || view.Effective.Detection != trip.DetectionMovement || view.Effective.MinDistanceKm != 10 ||
+		view.Effective.IdleTimeoutSeconds != 600 || view.Effective.MaxGapSeconds != 900 {
+		t.Fatalf("unexpected effective rules: %d %+v", w.Code, view.Effective)
+	}
+	if w := doJSON(outsider, http.MethodGet, vehiclePath, ""); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for other org, got %d", w.Code)
+	}
+
+	// trip 5 km dibuang karena aturan organisasi minimal 10 km
+	on, off := true, false
+	drive := func(base time.Time) time.Time {
+		fixes := []ingest.Fix{tripFix(base, 0, 106.8, 0, &off)}
+		for i := 1; i <= 10; i++ {
+			fixes = append(fixes, tripFix(base, i, 106.8+float64(i)*0.005, 60, &on))
+		}
+		fixes = append(fixes, tripFix(base, 11, 106.851, 0, &off))
+		if _, err := svc.Store(target, fixes); err != nil {
+			t.Fatalf("store: %v", err)
+		}
+		return fixes[11].TS
+	}
+	base := time.Now().UTC().Add(-3 * time.Hour).Truncate(time.Second)
+	builder := trip.NewBuilder(db)
+	// ignition on/off tetap dihitung sebagai pergerakan karena aturan organisasi MOVEMENT
+	if n, err := builder.RunOnce(drive(base).Add(time.Hour)); err != nil || n != 0 {
+		t.Fatalf("expected short trip discarded, got %d (%v)", n, err)
+	}
+
+	// override kendaraan menurunkan jarak minimal, deteksi tetap ikut organisasi
+	w = doJSON(admin, http.MethodPut, vehiclePath, `{"minDistanceKm":1}`)
+	json.Unmarshal(w.Body.Bytes(), &view)
+	if w.Code != http.StatusOK || view.Effective.MinDistanceKm != 1 || view.Effective.Detection != trip.DetectionMovement {
+		t.Fatalf("unexpected override response: %d %s", w.Code, w.Body.String())
+	}
+	if n, err := builder.RunOnce(drive(base.Add(time.Hour)).Add(time.Hour)); err != nil || n != 1 {
+		t.Fatalf("expected trip kept with override, got %d (%v)", n, err)
+	}
+	trips := vehicleTrips(t, db, v.ID)
+	if len(trips) != 1 || trips[0].Metadata["detection"] != trip.DetectionMovement {
+		t.Fatalf("unexpected trips: %+v", trips)
+	}
+
+	// hapus override: kembali ke aturan organisasi
+	if w := doJSON(admin, http.MethodDelete, vehiclePath, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	rules, err := trip.ResolveRules(db, trip.DefaultRules(), v.ID)
+	if err != nil || rules.MinDistanceKm != 10 {
+		t.Fatalf("expected org rules after delete, got %+v (%v)", rules, err)
+	}
+}
@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/username/fms-api/internal/auth"
+	"github.com/username/fms-api/internal/ingest"
+	"github.com/username/fms-api/internal/trip"
+)
+
+func TestTripStops_ParkedIdleAndOngoing(t *testing.T) {
+	db := setupTripDB(t)
+	svc := ingest.NewService(db)
+	_, v := seedBoundDevice(t, db, "TRIP-STOPS", "DEVICE", "trip-stops", ingest.ProtocolTeltonika)
+	target, err := svc.ResolveByDataSource("TRIP-STOPS", "trip-stops")
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	// parkir 10 fix, idle 6 fix, jalan 10 fix, lalu parkir lagi di tujuan
+	on, off := true, false
+	base := time.Now().UTC().Add(-3 * time.Hour).Truncate(time.Second)
+	var fixes []ingest.Fix
+	for i := 0; i < 10; i++ {
+		fixes = append(fixes, tripFix(base, i, 106.8, 0, &off))
+	}
+	for i := 10; i < 16; i++ {
+		fixes = append(fixes, tripFix(base, i, 106.8, 0, &on))
+	}
+	for i := 16; i < 26; i++ {
+		fixes = append(fixes, tripFix(base, i, 106.8+float64(i-15)*0.005, 60, &on))
+	}
+	for i := 26; i < 34; i++ {
+		fixes = append(fixes, tripFix(base, i, 106.85, 0, &off))
+	}
+	if _, err := svc.Store(target, fixes); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	builder := trip.NewBuilder(db)
+	if _, err := builder.RunOnce(fixes[33].TS.Add(10 * time.Second)); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	orgID := v.OrganizationID
+	userRole := auth.OrgRoleUser
+	router := tripRouter(trip.NewHandler(db), auth.CurrentUser{ID: 1, UserType: auth.UserTypeOrgUser, OrganizationID: &orgID, OrgRole: &userRole})
+	list := func(query string) []trip.Stop {
+		t.Helper()
+		path := fmt.Sprintf("/api/vehicles/%d/stops?from=%s&to=%s%s", v.ID,
+			base.Add(-time.Hour).Format(time.RFC3339), base.Add(2*time.Hour).Format(time.RFC3339), query)
+		w := doJSON(router, http.MethodGet, path, "")
+		var resp struct {
+			Data []trip.Stop `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("list stops: %d %s", w.Code, w.Body.String())
+		}
+		return resp.Data
+	}
+
+	// urut terbaru dulu: parkir di tujuan (masih berlangsung), idle, parkir awal
+	stops := list("")
+	if len(stops) != 3 {
+		t.Fatalf("expected 3 stops, got %+v", stops)
+	}
+	dest, idle, parked := stops[0], stops[1], stops[2]
+	if !dest.Ongoing || *dest.IgnitionOn || !dest.StartTs.Equal(fixes[26].TS) || dest.DurationSeconds != 210 || dest.Lon != 106.85 {
+		t.Fatalf("unexpected destination stop: %+v", dest)
+	}
+	if idle.Ongoing || !*idle.IgnitionOn || !idle.StartTs.Equal(fixes[10].TS) || idle.DurationSeconds != 150 {
+		t.Fatalf("unexpected idle stop: %+v", idle)
+	}
+	// fix ignition on pertama masih di lokasi parkir: menjadi akhir stop parkir
+	if parked.Ongoing || *parked.IgnitionOn || !parked.StartTs.Equal(fixes[0].TS) || !parked.EndTs.Equal(fixes[10].TS) {
+		t.Fatalf("unexpected parked stop: %+v", parked)
+	}
+	if idleOnly := list("&ignition=true"); len(idleOnly) != 1 || idleOnly[0].ID != idle.ID {
+		t.Fatalf("expected only the idle stop, got %+v", idleOnly)
+	}
+
+	// stop yang berlangsung diperbarui di tempat lalu ditutup saat kendaraan bergerak lagi
+	more := []ingest.Fix{tripFix(base, 34, 106.85, 0, &off), tripFix(base, 35, 106.85, 0, &off), tripFix(base, 36, 106.855, 60, &on)}
+	if _, err := svc.Store(target, more); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if _, err := builder.RunOnce(more[2].TS.Add(10 * time.Second)); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	stops = list("")
+	if len(stops) != 3 || stops[0].ID != dest.ID || stops[0].Ongoing || !stops[0].EndTs.Equal(more[1].TS) || stops[0].DurationSeconds != 270 {
+		t.Fatalf("expected destination stop closed in place, got %+v", stops[0])
+	}
+
+	// rebuild menghasilkan stop yang sama
+	if _, err := trip.NewRebuilder(db).RebuildVehicle(v.ID, base, base.Add(time.Hour), time.Now().UTC()); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	rebuilt := list("")
+	if len(rebuilt) != 3 || !rebuilt[0].EndTs.Equal(stops[0].EndTs) || !rebuilt[1].StartTs.Equal(idle.StartTs) || !rebuilt[2].EndTs.Equal(parked.EndTs) {
+		t.Fatalf("unexpected stops after rebuild: %+v", rebuilt)
+	}
+
+	w := doJSON(router, http.MethodGet, fmt.Sprintf("/api/vehicles/%d/stops?from=%s&to=%s", v.ID,
+		base.Format(time.RFC3339), base.Add(30*24*time.Hour).Format(time.RFC3339)), "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for range over MAX_RANGE_DAYS, got %d", w.Code)
+	}
+}